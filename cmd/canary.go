@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+var validateOnly bool
+
+// checkLanguages checks that code can be generated end to end for each of languages, or every language when none are
+// given, with the plugins and toolchain of the flags
+func checkLanguages(ctx context.Context, languages []string) []util.Check {
+	if len(languages) == 0 {
+		languages = util.Languages()
+	}
+	opts := util.GenerateOptions{
+		RPCFramework:    rpcFramework,
+		MessagesOnly:    messagesOnly,
+		PluginPaths:     pluginPaths,
+		SeparatePlugins: separatePlugins,
+		ToolchainDir:    toolchainDir,
+		DockerImage:     dockerImage,
+		Env:             env,
+	}
+
+	var checks []util.Check
+	for _, l := range languages {
+		checks = append(checks, util.CheckGeneration(ctx, l, opts))
+	}
+	return checks
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asmahood/proto-client-generator/util"
+	"github.com/spf13/cobra"
+)
+
+func TestCheckLanguages(t *testing.T) {
+	// Without protoc, every check fails rather than being skipped
+	t.Setenv("PATH", t.TempDir())
+
+	checks := checkLanguages(context.Background(), nil)
+	if len(checks) != len(util.Languages()) {
+		t.Fatalf("got %d checks, want one per language", len(checks))
+	}
+	for i, l := range util.Languages() {
+		if checks[i].Name != "generate "+l || checks[i].Err == nil {
+			t.Errorf("unexpected check %+v", checks[i])
+		}
+	}
+
+	if checks := checkLanguages(context.Background(), []string{util.LanguagePython}); len(checks) != 1 || checks[0].Name != "generate "+util.LanguagePython {
+		t.Errorf("unexpected checks %+v", checks)
+	}
+}
+
+func TestConfigValuesSkipValidateOnly(t *testing.T) {
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("language", "", "")
+	cmd.Flags().Bool("validate-only-language", false, "")
+	if err := cmd.ParseFlags([]string{"--validate-only-language", "--language", "ruby"}); err != nil {
+		t.Fatal(err)
+	}
+	values, err := configValues(cmd.Flags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := values["validate-only-language"]; ok || values["language"] != "ruby" {
+		t.Errorf("unexpected configuration %v", values)
+	}
+}
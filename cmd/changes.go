@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/asmahood/proto-client-generator/generator"
+	"github.com/asmahood/proto-client-generator/util"
+	"github.com/spf13/cobra"
+)
+
+var sinceCommit string
+
+var changesCmd = &cobra.Command{
+	Use:   "changes",
+	Short: "List the changes to the protobuf API of services since a commit, for release notes",
+	Long: `List the changes to the protobuf API of services since a commit, for release notes.
+
+The protobufs of each service are compiled at --since-commit and at --ref, which defaults to the default branch, and
+the services, RPCs, messages, fields, enums and enum values added (+), removed (-) or changed (~) between them are
+listed.`,
+	Example:      "generate-clients changes -s catalog --since-commit v1.2.0",
+	Args:         validArgs(cobra.NoArgs),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		g := generator.Generator{Logger: logger}
+		opts := generator.Options{
+			Services:         strings.Split(service, ","),
+			Private:          private,
+			Host:             host,
+			Org:              org,
+			ServiceHosts:     serviceHosts,
+			ServiceOrgs:      serviceOrgs,
+			ProtoRepo:        protoRepo,
+			CloneURLTemplate: cloneURLTemplate,
+			RepoNames:        repoNames,
+			ProtoNames:       protoNames,
+			ReplaceImports:   replaceImports,
+			ProtoEncoding:    protoEncoding,
+			Ref:              ref,
+			CacheDir:         cacheDir,
+			Offline:          offline,
+			RefreshCache:     refresh,
+			ToolchainDir:     toolchainDir,
+			DockerImage:      dockerImage,
+			ImportPaths:      importPaths,
+			Proto3Optional:   proto3Optional,
+		}
+
+		changes, err := g.Changes(cmd.Context(), opts, sinceCommit)
+		if err != nil {
+			fatalf(exitCode(err), "Error: %s", err.Error())
+		}
+
+		for i, s := range changes {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s (%s..%s)\n", s.Service, shortCommit(s.Since), shortCommit(s.Commit))
+			if len(s.Changes) == 0 {
+				fmt.Println("  No changes")
+			}
+			for _, c := range s.Changes {
+				fmt.Printf("  %s\n", c)
+			}
+		}
+		return nil
+	},
+}
+
+// shortCommit abbreviates the commit SHA, or returns "unknown" if it is not known
+func shortCommit(sha string) string {
+	if sha == "" {
+		return "unknown"
+	}
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func init() {
+	changesCmd.Flags().StringVarP(&service, "service", "s", util.ServiceAll, "The services to compare. Accepts a comma separated list of services, or 'all' (the default)")
+	changesCmd.Flags().StringVar(&sinceCommit, "since-commit", "", "The branch, tag or commit SHA the protobufs are compared against")
+	changesCmd.Flags().StringVar(&ref, "ref", "", "The branch, tag or commit SHA with the changes. Defaults to the default branch")
+	changesCmd.Flags().BoolVarP(&private, "private", "p", false, "Compare the private protobufs of the services")
+	changesCmd.Flags().StringVar(&org, "org", util.DefaultOrg, "The Github organization that service repositories are cloned from")
+	changesCmd.Flags().StringVar(&host, "host", util.DefaultHost, "The Github host that repositories are cloned from")
+	changesCmd.Flags().StringToStringVar(&serviceHosts, "service-host", nil, "Maps a service to the Github host of its repository when it differs from --host, e.g. catalog=github.example.com. Can be repeated")
+	changesCmd.Flags().StringToStringVar(&serviceOrgs, "service-org", nil, "Maps a service to the Github organization of its repository when it differs from --org, e.g. catalog=other-org. Can be repeated")
+	changesCmd.Flags().StringVar(&protoRepo, "proto-repo", "", "A central protobuf repository (org/name) to clone instead of the service. Protobufs are read from its <service>/public or <service>/private directory")
+	changesCmd.Flags().StringVar(&cloneURLTemplate, "clone-url-template", "", "A Go template of the URL repositories are cloned from, overriding --host and --org, e.g. https://{{.Host}}/{{.Org}}/{{.Repo}}.git. Fields are .Host, .Org, .Service and .Repo")
+	changesCmd.Flags().StringToStringVar(&repoNames, "repo-name", nil, "Maps a service to the name of its repository when they differ, e.g. query=query-service. Can be repeated")
+	changesCmd.Flags().StringToStringVar(&protoNames, "service-name-override", nil, "Maps a service to the base name its protobuf is copied to, e.g. catalog=catalog_api. Can be repeated")
+	changesCmd.Flags().StringVar(&protoEncoding, "proto-encoding", "", "The character set of the protobufs, e.g. ISO-8859-1 or windows-1252, which they are transcoded to UTF-8 from before generation. Defaults to UTF-8")
+	changesCmd.Flags().StringToStringVar(&replaceImports, "replace-import", nil, "Rewrites imports of the protobuf starting with a prefix, e.g. github.com/org/protos/=common/. Can be repeated")
+	changesCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "A directory where cloned repositories are kept between runs")
+	changesCmd.Flags().BoolVar(&refresh, "refresh-cache", false, "Always fetch the repositories in --cache-dir, pruning deleted refs and resetting them to the remote")
+	changesCmd.Flags().BoolVar(&offline, "offline", false, "Only use the repositories in --cache-dir, without fetching")
+	changesCmd.Flags().StringArrayVar(&importPaths, "import-path", nil, "An extra directory that imports of the protobufs are resolved from. Can be repeated")
+	changesCmd.Flags().StringVar(&toolchainDir, "toolchain-dir", "", "A directory holding a pinned protoc binary to use instead of the one on your PATH")
+	changesCmd.Flags().StringVar(&dockerImage, "docker-image", "", "A Docker image providing protoc, which is run in a container of it instead of on your PATH")
+	changesCmd.Flags().BoolVar(&proto3Optional, "proto3-optional", false, "Pass --experimental_allow_proto3_optional to protoc")
+	changesCmd.MarkFlagRequired("since-commit")
+	rootCmd.AddCommand(changesCmd)
+}
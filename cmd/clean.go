@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/asmahood/proto-client-generator/util"
+	"github.com/spf13/cobra"
+)
+
+// forceClean removes the generated files without asking for confirmation
+var forceClean bool
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean [output...]",
+	Short: "Remove the generated files from output directories",
+	Long: `Remove the generated files from output directories.
+
+The outputs are given as arguments, or with --output, --output-template and --language-output as when generating,
+which can be set in .proto-gen.yaml. --output-template is rendered for every language given with --language, or every
+supported language. Only the files recorded in the manifest of each output are removed, along with the manifest, the
+.gitignore written with --write-gitignore and the directories left empty. Generated files modified since they were
+generated are kept. An output without a manifest, such as a batch generated into a directory per service, is cleaned
+through the manifests of its directories, one level deep.
+
+The files to remove are listed and confirmed before removing them, unless --force is given.`,
+	Example:      "generate-clients clean ./clients/golang ./clients/python",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputs, err := cleanOutputs(args)
+		if err != nil {
+			fatalf(exitCode(err), "Error: %s", err.Error())
+		}
+
+		var cleanups []util.OutputCleanup
+		total := 0
+		for _, output := range outputs {
+			planned, err := util.PlanCleanups(output)
+			if err != nil {
+				fatalf(ExitError, "Error: %s", err.Error())
+			}
+			for _, c := range planned {
+				fmt.Printf("%s: %d generated files\n", c.Path, len(c.Files))
+				for _, name := range c.Modified {
+					fmt.Printf("  %s was modified and is kept\n", name)
+				}
+				cleanups = append(cleanups, c)
+				total += len(c.Files)
+			}
+		}
+		if len(cleanups) == 0 {
+			fmt.Println("No generated files to remove")
+			return nil
+		}
+
+		if !forceClean {
+			if !interactive() {
+				fatalf(ExitValidation, "Error: Removing generated files must be confirmed from a terminal, or forced with --force")
+			}
+			question := fmt.Sprintf("Remove %d generated files from %d outputs?", total, len(cleanups))
+			ok, err := confirm(bufio.NewReader(os.Stdin), os.Stderr, question)
+			if err != nil {
+				fatalf(ExitError, "Error: %s", err.Error())
+			}
+			if !ok {
+				fmt.Println("Nothing was removed")
+				return nil
+			}
+		}
+
+		for _, c := range cleanups {
+			if err := util.RemoveOutput(c); err != nil {
+				fatalf(ExitCopy, "Error: %s", err.Error())
+			}
+			fmt.Printf("Removed %d generated files from %s\n", len(c.Files), c.Path)
+		}
+		return nil
+	},
+}
+
+// cleanOutputs returns the outputs given as args, with --output, and for each language with --output-template and
+// --language-output, without repeated entries
+func cleanOutputs(args []string) ([]string, error) {
+	outputs := append(append([]string{}, args...), outputDirs...)
+
+	if outputTemplate != "" || len(languageOutput) > 0 {
+		languages := parseLanguages(language)
+		if len(languages) == 0 && outputTemplate != "" {
+			languages = util.Languages()
+		}
+		for l := range languageOutput {
+			if !contains(languages, l) {
+				languages = append(languages, l)
+			}
+		}
+
+		paths, err := languageOutputs(languages, "", outputTemplate, languageOutput)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(languages)
+		for _, l := range languages {
+			outputs = append(outputs, paths[l])
+		}
+	}
+
+	var unique []string
+	for _, o := range outputs {
+		if o = strings.TrimSpace(o); o != "" && !contains(unique, o) {
+			unique = append(unique, o)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, validationError(errors.New("No outputs were given. Pass them as arguments, or with --output, --output-template or --language-output"))
+	}
+	return unique, nil
+}
+
+func init() {
+	cleanCmd.Flags().StringArrayVarP(&outputDirs, "output", "o", nil, "An output directory to remove the generated files from. Can be repeated")
+	cleanCmd.Flags().StringVar(&outputTemplate, "output-template", "", "A Go template of the output path of each language, e.g. ./clients/{{.Language}}")
+	cleanCmd.Flags().StringToStringVar(&languageOutput, "language-output", nil, "Maps a language to its output path, e.g. golang=./rpc. Can be repeated")
+	cleanCmd.Flags().StringVarP(&language, "language", "l", "", "The languages whose outputs are rendered from --output-template. Accepts a comma separated list. Defaults to every supported language")
+	cleanCmd.Flags().BoolVarP(&forceClean, "force", "f", false, "Remove the generated files without asking for confirmation")
+	rootCmd.AddCommand(cleanCmd)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bufio"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+func TestConfirm(t *testing.T) {
+	for input, want := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "": false, "sure\n": false} {
+		got, err := confirm(bufio.NewReader(strings.NewReader(input)), ioutil.Discard, "Remove?")
+		if err != nil || got != want {
+			t.Errorf("confirm(%q) = %t, %v, want %t", input, got, err, want)
+		}
+	}
+}
+
+func TestCleanOutputs(t *testing.T) {
+	t.Cleanup(func() { outputDirs, outputTemplate, languageOutput, language = nil, "", nil, "" })
+
+	outputDirs = []string{"./rpc", "./clients/ruby"}
+	outputTemplate = "./clients/{{.Language}}"
+	languageOutput = map[string]string{util.LanguageGo: "./rpc"}
+	language = util.LanguageRuby
+	got, err := cleanOutputs([]string{"./docs", " ./rpc "})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := []string{"./docs", "./rpc", "./clients/ruby"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The template is rendered for every language when none is given
+	outputDirs, languageOutput, language = nil, nil, ""
+	got, err = cleanOutputs(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != len(util.Languages()) {
+		t.Errorf("got %q, want the output of every language", got)
+	}
+
+	outputTemplate = ""
+	if _, err := cleanOutputs(nil); err == nil || exitCode(err) != ExitValidation {
+		t.Errorf("expected missing outputs to fail validation, got %v", err)
+	}
+}
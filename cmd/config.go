@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configName is the name of the defaults file loaded from the current working directory, without its extension
+const configName = ".proto-gen"
+
+// configEnvPrefix prefixes the environment variables setting flags, e.g. PROTO_GEN_LANGUAGE sets --language
+const configEnvPrefix = "PROTO_GEN_"
+
+// Keys of .proto-gen.yaml that are not flags
+const (
+	// configPluginOptions maps a plugin name to the options given to it for every service, e.g. go: [module=example.com/x]
+	configPluginOptions = "plugin-options"
+
+	// configServicePluginOptions maps a service to the plugin options of that service, which replace the global
+	// options of the same plugin
+	configServicePluginOptions = "service-plugin-options"
+
+	// configLanguageExtensions maps a language to the only extensions of generated files copied for it, replacing
+	// --extensions, e.g. golang: [.go]
+	configLanguageExtensions = "language-extensions"
+)
+
+var (
+	// pluginOptions and servicePluginOptions are the plugin options read from .proto-gen.yaml
+	pluginOptions        map[string][]string
+	servicePluginOptions map[string]map[string][]string
+
+	// languageExtensions are the extensions copied for each language read from .proto-gen.yaml
+	languageExtensions map[string][]string
+)
+
+// loadConfig reads .proto-gen.yaml from the current working directory, if present, and uses its values as the defaults
+// of cmd's flags. Keys in the file are flag names, e.g. language, org, output or private. A flag can also be set by a
+// PROTO_GEN_ environment variable named after it, e.g. PROTO_GEN_MAX_FILE_SIZE for --max-file-size, which takes
+// precedence over the file. Flags given on the command line always take precedence over both. The plugin-options and
+// service-plugin-options keys hold the options of protoc plugins, and language-extensions the extensions copied for each
+// language.
+func loadConfig(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed {
+			return
+		}
+		name := configEnv(f.Name)
+		if value, ok := os.LookupEnv(name); ok {
+			if setErr := cmd.Flags().Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value for '%s' in %s: %s", f.Name, name, setErr.Error())
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	v := viper.New()
+	v.SetConfigName(configName)
+	v.SetConfigType("yaml")
+	v.AddConfigPath(".")
+
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return fmt.Errorf("cannot read %s.yaml: %s", configName, err.Error())
+	}
+
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || !v.IsSet(f.Name) {
+			return
+		}
+		if setErr := setFlagFromConfig(cmd.Flags(), f, v); setErr != nil {
+			err = fmt.Errorf("invalid value for '%s' in %s.yaml: %s", f.Name, configName, setErr.Error())
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := v.UnmarshalKey(configPluginOptions, &pluginOptions); err != nil {
+		return fmt.Errorf("invalid value for '%s' in %s.yaml: %s", configPluginOptions, configName, err.Error())
+	}
+	if err := v.UnmarshalKey(configServicePluginOptions, &servicePluginOptions); err != nil {
+		return fmt.Errorf("invalid value for '%s' in %s.yaml: %s", configServicePluginOptions, configName, err.Error())
+	}
+	if err := v.UnmarshalKey(configLanguageExtensions, &languageExtensions); err != nil {
+		return fmt.Errorf("invalid value for '%s' in %s.yaml: %s", configLanguageExtensions, configName, err.Error())
+	}
+	return nil
+}
+
+// configEnv returns the name of the environment variable setting the flag name
+func configEnv(name string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// globalPluginOpts returns the plugin options of every service: those of .proto-gen.yaml, with the options of a plugin
+// given on the command line replacing those of the file
+func globalPluginOpts(flagOpts map[string][]string) map[string][]string {
+	opts := make(map[string][]string, len(pluginOptions)+len(flagOpts))
+	for name, o := range pluginOptions {
+		opts[name] = o
+	}
+	for name, o := range flagOpts {
+		if len(o) > 0 {
+			opts[name] = o
+		}
+	}
+	return opts
+}
+
+// setFlagFromConfig sets f to the value of its key in v. Lists and maps are set one element at a time so repeatable
+// flags receive every entry.
+func setFlagFromConfig(flags *pflag.FlagSet, f *pflag.Flag, v *viper.Viper) error {
+	switch f.Value.Type() {
+	case "stringSlice", "stringArray":
+		for _, s := range v.GetStringSlice(f.Name) {
+			if err := flags.Set(f.Name, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "stringToString":
+		m := v.GetStringMapString(f.Name)
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if err := flags.Set(f.Name, fmt.Sprintf("%s=%s", k, m[k])); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return flags.Set(f.Name, v.GetString(f.Name))
+	}
+}
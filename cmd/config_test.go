@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// chdir changes the working directory to dir for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// configCommand returns a command with flags of each type read from .proto-gen.yaml, parsed from args
+func configCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("language", "", "")
+	cmd.Flags().Bool("private", false, "")
+	cmd.Flags().Int64("max-file-size", 100, "")
+	cmd.Flags().StringSlice("extensions", nil, "")
+	cmd.Flags().StringToString("repo-name", nil, "")
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+// writeConfig writes config as the .proto-gen.yaml of a new working directory
+func writeConfig(t *testing.T, config string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, configName+".yaml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, dir)
+	t.Cleanup(func() { pluginOptions, servicePluginOptions, languageExtensions = nil, nil, nil })
+}
+
+func TestLoadConfig(t *testing.T) {
+	writeConfig(t, `language: ruby
+private: true
+max-file-size: 200
+extensions: [.rb, .json]
+repo-name:
+  query: query-service
+  search: search-service
+`)
+	cmd := configCommand(t, "--private=false")
+	if err := loadConfig(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := cmd.Flags()
+	if got, _ := flags.GetString("language"); got != "ruby" {
+		t.Errorf("language = %q, want ruby", got)
+	}
+	if got, _ := flags.GetBool("private"); got {
+		t.Error("the private flag given on the command line was replaced by the file")
+	}
+	if got, _ := flags.GetInt64("max-file-size"); got != 200 {
+		t.Errorf("max-file-size = %d, want 200", got)
+	}
+	if got, _ := flags.GetStringSlice("extensions"); !reflect.DeepEqual(got, []string{".rb", ".json"}) {
+		t.Errorf("extensions = %q", got)
+	}
+	want := map[string]string{"query": "query-service", "search": "search-service"}
+	if got, _ := flags.GetStringToString("repo-name"); !reflect.DeepEqual(got, want) {
+		t.Errorf("repo-name = %v, want %v", got, want)
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	chdir(t, t.TempDir())
+	cmd := configCommand(t)
+	if err := loadConfig(cmd); err != nil {
+		t.Fatalf("a missing file is not an error: %s", err)
+	}
+	if got, _ := cmd.Flags().GetInt64("max-file-size"); got != 100 {
+		t.Errorf("max-file-size = %d, want the default 100", got)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	writeConfig(t, "max-file-size: large\n")
+	err := loadConfig(configCommand(t))
+	if err == nil || !strings.Contains(err.Error(), "invalid value for 'max-file-size' in .proto-gen.yaml") {
+		t.Fatalf("expected the invalid value to be reported, got %v", err)
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	writeConfig(t, "language: ruby\nmax-file-size: 200\n")
+	t.Setenv(configEnv("max-file-size"), "300")
+	t.Setenv(configEnv("repo-name"), "search=search-service")
+	cmd := configCommand(t)
+	if err := loadConfig(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cmd.Flags().GetString("language"); got != "ruby" {
+		t.Errorf("language = %q, want ruby from the file", got)
+	}
+	if got, _ := cmd.Flags().GetInt64("max-file-size"); got != 300 {
+		t.Errorf("max-file-size = %d, want 300 from the environment", got)
+	}
+	if got, _ := cmd.Flags().GetStringToString("repo-name"); !reflect.DeepEqual(got, map[string]string{"search": "search-service"}) {
+		t.Errorf("repo-name = %v", got)
+	}
+
+	t.Setenv(configEnv("max-file-size"), "large")
+	err := loadConfig(configCommand(t))
+	if err == nil || !strings.Contains(err.Error(), "invalid value for 'max-file-size' in PROTO_GEN_MAX_FILE_SIZE") {
+		t.Fatalf("expected the invalid value to be reported, got %v", err)
+	}
+}
+
+func TestLoadConfigPluginOptions(t *testing.T) {
+	writeConfig(t, `plugin-options:
+  go: [module=example.com/clients]
+  twirp: [package_prefix=example.com]
+service-plugin-options:
+  query:
+    go: [module=example.com/query]
+`)
+	if err := loadConfig(configCommand(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	wantService := map[string]map[string][]string{"query": {"go": {"module=example.com/query"}}}
+	if !reflect.DeepEqual(servicePluginOptions, wantService) {
+		t.Errorf("service plugin options = %v, want %v", servicePluginOptions, wantService)
+	}
+
+	got := globalPluginOpts(map[string][]string{"go": nil, "twirp": {"package_prefix=example.org"}})
+	want := map[string][]string{"go": {"module=example.com/clients"}, "twirp": {"package_prefix=example.org"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("globalPluginOpts = %v, want the options of the command line to replace those of the file: %v", got, want)
+	}
+}
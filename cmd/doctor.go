@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/asmahood/proto-client-generator/util"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that the tools and access needed to generate code are available",
+	Long: `Check that the tools and access needed to generate code are available.
+
+Checks that protoc, the protoc plugins of each language (or only --language), and git can be found, and that the
+--host can be reached over SSH and HTTPS. Exits with an error if a required check fails.`,
+	Args:         validArgs(cobra.NoArgs),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		opts := util.GenerateOptions{ToolchainDir: toolchainDir, PluginPaths: pluginPaths}
+
+		languages := util.Languages()
+		if language != "" {
+			if !util.IsValidLanguage(language) {
+				return fmt.Errorf("Client code generation is not supported for '%s'", language)
+			}
+			languages = []string{language}
+		}
+
+		checks := []util.Check{util.CheckProtoc(ctx, opts)}
+		for _, l := range languages {
+			checks = append(checks, util.CheckPlugins(l, rpcFramework, opts)...)
+		}
+		checks = append(checks, util.CheckGit(ctx), util.CheckSSH(ctx, host), util.CheckHTTPS(ctx, host), util.CheckBuf())
+
+		if !printChecks(os.Stdout, useColor(os.Stdout), checks) {
+			return errors.New("Required checks failed")
+		}
+		return nil
+	},
+}
+
+// printChecks writes a report of checks to w with remediation hints for those that failed, and returns false if a
+// required check failed
+func printChecks(w io.Writer, color bool, checks []util.Check) bool {
+	passed := true
+	t := newTable(w, color)
+	t.row("CHECK", "STATUS", "DETAIL")
+	for _, c := range checks {
+		switch {
+		case c.Err == nil:
+			t.row(c.Name, t.green("pass"), c.Detail)
+		case c.Optional:
+			t.row(c.Name, t.yellow("warn"), c.Err.Error()+". "+c.Hint)
+		default:
+			passed = false
+			t.row(c.Name, t.red("fail"), c.Err.Error()+". "+c.Hint)
+		}
+	}
+	t.flush()
+	return passed
+}
+
+func init() {
+	doctorCmd.Flags().StringVarP(&language, "language", "l", "", "Only check the plugins of this language")
+	doctorCmd.Flags().StringVar(&rpcFramework, "rpc-framework", util.DefaultRPCFramework, "The RPC framework whose plugins are checked. Valid values are: twirp, grpc, none")
+	doctorCmd.Flags().StringVar(&host, "host", util.DefaultHost, "The Github host whose connectivity is checked")
+	doctorCmd.Flags().StringVar(&toolchainDir, "toolchain-dir", "", "A directory holding pinned protoc and plugin binaries to check instead of those on your PATH")
+	doctorCmd.Flags().StringToStringVar(&pluginPaths, "plugin-path", nil, "Maps a protoc plugin to its binary, e.g. go=/usr/local/bin/protoc-gen-go-custom. Can be repeated")
+	rootCmd.AddCommand(doctorCmd)
+}
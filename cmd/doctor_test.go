@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+func TestPrintChecks(t *testing.T) {
+	passing := util.Check{Name: "protoc", Detail: "3.19 (/usr/bin/protoc)"}
+	optional := util.Check{Name: "buf", Err: errors.New("buf was not found"), Hint: "Install buf", Optional: true}
+	failing := util.Check{Name: "git", Err: errors.New("git cannot be run"), Hint: "Install git"}
+
+	var out strings.Builder
+	if !printChecks(&out, false, []util.Check{passing, optional}) {
+		t.Error("a failed optional check failed the report")
+	}
+	want := "CHECK   STATUS  DETAIL\n" +
+		"protoc  pass    3.19 (/usr/bin/protoc)\n" +
+		"buf     warn    buf was not found. Install buf\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if printChecks(&out, false, []util.Check{passing, failing}) {
+		t.Error("a failed required check passed the report")
+	}
+	if !strings.Contains(out.String(), "git     fail    git cannot be run. Install git\n") {
+		t.Errorf("the failed check was not reported with its hint: %q", out.String())
+	}
+}
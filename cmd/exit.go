@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/asmahood/proto-client-generator/generator"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the command, distinguishing the kinds of failure
+const (
+	ExitError      = 1
+	ExitValidation = 2
+	ExitClone      = 3
+	ExitGenerate   = 4
+	ExitCopy       = 5
+	ExitPartial    = 6
+)
+
+// exitCode returns the exit code for err, chosen by the phase of the generation workflow it occurred in, or
+// ExitPartial if only some services of a batch failed
+func exitCode(err error) int {
+	var partialErr *generator.PartialError
+	if errors.As(err, &partialErr) {
+		return ExitPartial
+	}
+
+	var genErr *generator.Error
+	if !errors.As(err, &genErr) {
+		return ExitError
+	}
+
+	switch genErr.Phase {
+	case generator.PhaseValidate:
+		return ExitValidation
+	case generator.PhaseClone:
+		return ExitClone
+	case generator.PhaseProto, generator.PhaseGenerate:
+		return ExitGenerate
+	case generator.PhaseCopy:
+		return ExitCopy
+	default:
+		return ExitError
+	}
+}
+
+// flagError reports an unknown flag or a flag with an invalid value as a validation failure, exiting with
+// ExitValidation
+func flagError(cmd *cobra.Command, err error) error {
+	return validationError(err)
+}
+
+// validArgs wraps the positional argument validator of a command, reporting invalid arguments as a validation failure
+// so that they exit with ExitValidation
+func validArgs(args cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, a []string) error {
+		if err := args(cmd, a); err != nil {
+			return validationError(err)
+		}
+		return nil
+	}
+}
+
+// fatalf logs the formatted message and exits with code
+func fatalf(code int, format string, v ...interface{}) {
+	logger.Printf(format, v...)
+	closeLogFile()
+	os.Exit(code)
+}
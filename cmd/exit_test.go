@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/asmahood/proto-client-generator/generator"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"validation", &generator.Error{Phase: generator.PhaseValidate, Err: errors.New("invalid")}, ExitValidation},
+		{"clone", &generator.Error{Service: "search", Phase: generator.PhaseClone, Err: errors.New("clone failed")}, ExitClone},
+		{"protobuf", &generator.Error{Service: "search", Phase: generator.PhaseProto, Err: errors.New("lint failed")}, ExitGenerate},
+		{"generate", &generator.Error{Service: "search", Phase: generator.PhaseGenerate, Err: errors.New("protoc failed")}, ExitGenerate},
+		{"copy", &generator.Error{Service: "search", Phase: generator.PhaseCopy, Err: errors.New("copy failed")}, ExitCopy},
+		{"setup", &generator.Error{Phase: generator.PhaseSetup, Err: errors.New("no temp")}, ExitError},
+		{"partial", &generator.PartialError{}, ExitPartial},
+		{"wrapped", fmt.Errorf("run: %w", &generator.Error{Phase: generator.PhaseClone, Err: errors.New("clone failed")}), ExitClone},
+		{"other", errors.New("boom"), ExitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Fatalf("got exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCodeOfInvalidCommandLines(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown flag", []string{"--no-such-flag"}},
+		{"invalid flag value", []string{"--depth", "deep"}},
+		{"unknown subcommand flag", []string{"list", "--no-such-flag"}},
+		{"unexpected argument", []string{"list", "extra"}},
+		{"unknown command", []string{"no-such-command"}},
+	}
+
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	defer rootCmd.SetArgs(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootCmd.SetArgs(tt.args)
+			err := rootCmd.Execute()
+			if err == nil {
+				t.Fatal("expected the command line to be rejected")
+			}
+			if got := exitCode(err); got != ExitValidation {
+				t.Fatalf("got exit code %d for %q, want %d", got, err, ExitValidation)
+			}
+		})
+	}
+}
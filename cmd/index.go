@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// servicesIndex is the URL of a service index extending the built-in services
+var servicesIndex string
+
+// loadServiceIndex fetches the service index at url and adds its services to the built-in services. If the index
+// cannot be fetched, a previously cached copy is used with a warning
+func loadServiceIndex(ctx context.Context, url string) error {
+	index, err := util.FetchServiceIndex(ctx, url, util.ServiceIndexOptions{CacheDir: cacheDir, HTTPProxy: httpProxy, HTTPSProxy: httpsProxy})
+	if err != nil {
+		if len(index.Services) == 0 {
+			return err
+		}
+		logger.Printf("Warning: %s, using the cached index", err.Error())
+	}
+	return util.AddServices(index)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/asmahood/proto-client-generator/generator"
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// languageOutputs returns the output directory of each of languages. A language's output is taken from
+// languageOutput, then rendered from outputTemplate, and otherwise output, which can only be used for a single
+// language.
+func languageOutputs(languages []string, output string, outputTemplate string, languageOutput map[string]string) (map[string]string, error) {
+	var tmpl *template.Template
+	if outputTemplate != "" {
+		var err error
+		if tmpl, err = template.New("output").Option("missingkey=error").Parse(outputTemplate); err != nil {
+			return nil, validationError(fmt.Errorf("Invalid output template: %s", err.Error()))
+		}
+	}
+
+	outputs := make(map[string]string)
+	for _, l := range languages {
+		switch {
+		case languageOutput[l] != "":
+			outputs[l] = languageOutput[l]
+		case tmpl != nil:
+			var path bytes.Buffer
+			if err := tmpl.Execute(&path, struct{ Language string }{l}); err != nil {
+				return nil, validationError(fmt.Errorf("Invalid output template: %s", err.Error()))
+			}
+			outputs[l] = path.String()
+		case output != "" && len(languages) == 1:
+			outputs[l] = output
+		case output != "":
+			return nil, validationError(fmt.Errorf("The output of '%s' must be given with --output-template or --language-output when generating multiple languages", l))
+		default:
+			return nil, validationError(fmt.Errorf("No output was given for '%s'. Use --output, --output-template or --language-output", l))
+		}
+	}
+
+	for l := range languageOutput {
+		if !contains(languages, l) {
+			return nil, validationError(fmt.Errorf("An output was given for '%s', which is not a selected language", l))
+		}
+	}
+	return outputs, nil
+}
+
+// languageLayouts returns the layout of the output of each of languages that has one. A language's layout is taken
+// from layouts, and otherwise is its conventional layout if conventional is set.
+func languageLayouts(languages []string, conventional bool, layouts map[string]string) (map[string]string, error) {
+	for l := range layouts {
+		if !contains(languages, l) {
+			return nil, validationError(fmt.Errorf("A layout was given for '%s', which is not a selected language", l))
+		}
+	}
+
+	result := make(map[string]string)
+	for _, l := range languages {
+		switch {
+		case layouts[l] != "":
+			result[l] = layouts[l]
+		case conventional:
+			result[l] = util.DefaultLayout(l)
+		}
+	}
+	return result, nil
+}
+
+// languageCopyExtensions returns the extensions of the generated files copied for each of languages, if restricted.
+// A language's extensions are taken from the language-extensions of .proto-gen.yaml, and otherwise are exts. The
+// entry 'default' stands for the conventional extensions of the language.
+func languageCopyExtensions(languages []string, exts []string) (map[string][]string, error) {
+	for l := range languageExtensions {
+		if !util.IsValidLanguage(l) {
+			return nil, validationError(fmt.Errorf("Extensions were given for '%s', which is not a supported language", l))
+		}
+	}
+
+	result := make(map[string][]string)
+	for _, l := range languages {
+		if e, ok := languageExtensions[l]; ok {
+			result[l] = util.ExpandExtensions(l, e)
+		} else if len(exts) > 0 {
+			result[l] = util.ExpandExtensions(l, exts)
+		}
+	}
+	return result, nil
+}
+
+// parseLanguages splits the comma separated list of languages, removing empty and repeated entries
+func parseLanguages(s string) []string {
+	var languages []string
+	for _, l := range strings.Split(s, ",") {
+		l = strings.TrimSpace(l)
+		if l != "" && !contains(languages, l) {
+			languages = append(languages, l)
+		}
+	}
+	return languages
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// validationError wraps err as a validation failure of the run
+func validationError(err error) error {
+	return &generator.Error{Phase: generator.PhaseValidate, Err: err}
+}
+
+// validateLanguages checks the options that only support a single language
+func validateLanguages(languages []string) error {
+	if len(languages) == 0 {
+		return validationError(errors.New("A language must be given"))
+	}
+	for _, l := range languages {
+		if !util.IsValidLanguage(l) {
+			return validationError(fmt.Errorf("Client code generation is not supported for '%s'", l))
+		}
+	}
+	if len(languages) > 1 && (watch || archive != "") {
+		return validationError(errors.New("--watch and --archive can only be used with a single language"))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/asmahood/proto-client-generator/generator"
+)
+
+func TestParseLanguages(t *testing.T) {
+	if got := parseLanguages(" golang,ruby,, golang "); !reflect.DeepEqual(got, []string{"golang", "ruby"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLanguageOutputs(t *testing.T) {
+	tests := []struct {
+		name           string
+		languages      []string
+		output         string
+		outputTemplate string
+		languageOutput map[string]string
+		want           map[string]string
+		wantErr        string
+	}{
+		{"single output", []string{"golang"}, "rpc", "", nil, map[string]string{"golang": "rpc"}, ""},
+		{"template", []string{"golang", "ruby"}, "", "clients/{{.Language}}", nil, map[string]string{"golang": "clients/golang", "ruby": "clients/ruby"}, ""},
+		{"language output takes precedence", []string{"golang", "ruby"}, "", "clients/{{.Language}}", map[string]string{"golang": "rpc"}, map[string]string{"golang": "rpc", "ruby": "clients/ruby"}, ""},
+		{"output of multiple languages", []string{"golang", "ruby"}, "rpc", "", map[string]string{"golang": "rpc"}, nil, "The output of 'ruby' must be given"},
+		{"no output", []string{"golang"}, "", "", nil, nil, "No output was given for 'golang'"},
+		{"unselected language", []string{"golang"}, "rpc", "", map[string]string{"ruby": "lib"}, nil, "'ruby', which is not a selected language"},
+		{"invalid template", []string{"golang"}, "", "clients/{{.Lang}}", nil, nil, "Invalid output template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs, err := languageOutputs(tt.languages, tt.output, tt.outputTemplate, tt.languageOutput)
+			if tt.wantErr != "" {
+				var genErr *generator.Error
+				if !errors.As(err, &genErr) || genErr.Phase != generator.PhaseValidate || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected a validation error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(outputs, tt.want) {
+				t.Errorf("got %v, want %v", outputs, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLanguages(t *testing.T) {
+	defer func(a string) { archive = a }(archive)
+
+	if err := validateLanguages([]string{"golang", "ruby"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for _, languages := range [][]string{nil, {"golang", "cobol"}} {
+		if err := validateLanguages(languages); err == nil {
+			t.Errorf("the languages %q were accepted", languages)
+		}
+	}
+
+	archive = "clients.zip"
+	if err := validateLanguages([]string{"golang", "ruby"}); err == nil {
+		t.Error("an archive of multiple languages was accepted")
+	}
+}
+
+func TestLanguageLayouts(t *testing.T) {
+	languages := []string{"golang", "ruby", "java"}
+
+	layouts, err := languageLayouts(languages, false, map[string]string{"ruby": "gems/{{.Service}}"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := map[string]string{"ruby": "gems/{{.Service}}"}; !reflect.DeepEqual(layouts, want) {
+		t.Errorf("got %v, want %v", layouts, want)
+	}
+
+	layouts, err = languageLayouts(languages, true, map[string]string{"ruby": "gems/{{.Service}}"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]string{"golang": "pkg/{{.Service}}", "ruby": "gems/{{.Service}}", "java": "src/main/java"}
+	if !reflect.DeepEqual(layouts, want) {
+		t.Errorf("got %v, want %v", layouts, want)
+	}
+
+	if _, err := languageLayouts(languages, true, map[string]string{"python": "{{.Service}}"}); err == nil {
+		t.Error("a layout of a language that is not selected was accepted")
+	}
+}
+
+func TestLanguageCopyExtensions(t *testing.T) {
+	languageExtensions = map[string][]string{"ruby": {".rb"}}
+	defer func() { languageExtensions = nil }()
+
+	got, err := languageCopyExtensions([]string{"golang", "ruby"}, []string{"default", ".txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string][]string{"golang": {".go", ".json", ".txt"}, "ruby": {".rb"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got, _ := languageCopyExtensions([]string{"golang"}, nil); len(got) != 0 {
+		t.Errorf("extensions were restricted without being given: %v", got)
+	}
+
+	languageExtensions = map[string][]string{"cobol": {".cbl"}}
+	if _, err := languageCopyExtensions([]string{"golang"}, nil); exitCode(err) != ExitValidation {
+		t.Errorf("expected the extensions of an unsupported language to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/asmahood/proto-client-generator/util"
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the services and whether they have a public or private protobuf defined",
+	Args:  validArgs(cobra.NoArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		t := newTable(os.Stdout, useColor(os.Stdout))
+		t.row("SERVICE", "PUBLIC", "PRIVATE")
+		for _, s := range util.KnownServices() {
+			t.row(s, availability(t, util.IsValidPublicService(s)), availability(t, util.IsValidPrivateService(s)))
+		}
+		return t.flush()
+	},
+}
+
+// availability renders whether a protobuf is defined as a colored yes or no
+func availability(t *table, defined bool) cell {
+	if defined {
+		return t.green("yes")
+	}
+	return t.red("no")
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/asmahood/proto-client-generator/generator"
+)
+
+// Formats of the log output
+const (
+	logFormatText   = "text"
+	logFormatLogfmt = "logfmt"
+	logFormatJSON   = "json"
+)
+
+var (
+	logFormat     string
+	conciseErrors bool
+	logFilePath   string
+)
+
+// logFile is the file opened by --log-file, which receives a copy of everything written to stderr
+var logFile *os.File
+
+// logger receives every message logged by the command. It is replaced according to --log-format before running
+var logger generator.Logger = log.Default()
+
+// newLogger returns the logger writing format to w
+func newLogger(format string, w io.Writer) (generator.Logger, error) {
+	switch format {
+	case logFormatText:
+		return log.New(w, "", log.LstdFlags), nil
+	case logFormatLogfmt, logFormatJSON:
+		return newStructuredLogger(w, format == logFormatJSON), nil
+	default:
+		return nil, fmt.Errorf("Invalid log format '%s'. Valid values are: %s, %s, %s", format, logFormatText, logFormatLogfmt, logFormatJSON)
+	}
+}
+
+// logOutput returns the writer the command logs to: stderr, and with a path, also the file at path, which is created
+// or truncated
+func logOutput(path string) (io.Writer, error) {
+	if path == "" {
+		return os.Stderr, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create log file: %s", err.Error())
+	}
+	logFile = f
+	return io.MultiWriter(os.Stderr, f), nil
+}
+
+// closeLogFile syncs and closes the file opened by --log-file, if any, so that it is complete once the command exits
+func closeLogFile() {
+	if logFile == nil {
+		return
+	}
+	logFile.Sync()
+	logFile.Close()
+	logFile = nil
+}
+
+// levelPrefixes are the prefixes of messages logged at a level other than info
+var levelPrefixes = map[string]slog.Level{"Warning: ": slog.LevelWarn, "Error: ": slog.LevelError}
+
+// structuredLogger writes each message as a line of logfmt or JSON through slog
+type structuredLogger struct {
+	logger *slog.Logger
+}
+
+// newStructuredLogger returns a structuredLogger writing JSON lines to w if json is true, and logfmt lines otherwise
+func newStructuredLogger(w io.Writer, json bool) *structuredLogger {
+	if json {
+		return &structuredLogger{slog.New(slog.NewJSONHandler(w, nil))}
+	}
+	return &structuredLogger{slog.New(slog.NewTextHandler(w, nil))}
+}
+
+func (l *structuredLogger) Printf(format string, v ...interface{}) {
+	msg := strings.TrimRight(fmt.Sprintf(format, v...), "\n")
+	level := slog.LevelInfo
+	for prefix, prefixLevel := range levelPrefixes {
+		if strings.HasPrefix(msg, prefix) {
+			msg, level = strings.TrimPrefix(msg, prefix), prefixLevel
+			break
+		}
+	}
+	l.logger.Log(context.Background(), level, msg)
+}
+
+func (l *structuredLogger) Event(e generator.Event) {
+	attrs := []slog.Attr{slog.String("service", e.Service), slog.String("language", e.Language)}
+	if e.Phase != "" {
+		attrs = append(attrs, slog.String("phase", string(e.Phase)))
+	}
+	attrs = append(attrs, slog.String("duration", e.Duration.Round(time.Millisecond).String()))
+
+	level := slog.LevelInfo
+	if e.Err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", e.Err.Error()))
+	}
+	l.logger.LogAttrs(context.Background(), level, e.Message, attrs...)
+}
+
+// tmpPlaceholder replaces the paths of temporary directories in messages logged with --concise-errors
+const tmpPlaceholder = "<tmp>"
+
+// tmpDirPattern matches the temporary directories created during a run, which are named by a prefix followed by a
+// random number, along with those created within them, such as /tmp/client-generation-123456/search-7890
+var tmpDirPattern = regexp.MustCompile(regexp.QuoteMeta(strings.TrimRight(os.TempDir(), `/\`)) + `(?:[/\\][\w.-]*-\d+)+`)
+
+// conciseLogger replaces the paths of temporary directories in the messages it logs
+type conciseLogger struct {
+	logger generator.Logger
+}
+
+// conciseEventLogger is a conciseLogger of an EventLogger, also rewriting the messages and errors of events
+type conciseEventLogger struct {
+	conciseLogger
+	events generator.EventLogger
+}
+
+// newConciseLogger returns a logger rewriting the messages of logger
+func newConciseLogger(logger generator.Logger) generator.Logger {
+	if events, ok := logger.(generator.EventLogger); ok {
+		return conciseEventLogger{conciseLogger{logger}, events}
+	}
+	return conciseLogger{logger}
+}
+
+// concise returns s with the paths of temporary directories replaced
+func concise(s string) string {
+	return tmpDirPattern.ReplaceAllString(s, tmpPlaceholder)
+}
+
+func (l conciseLogger) Printf(format string, v ...interface{}) {
+	l.logger.Printf("%s", concise(fmt.Sprintf(format, v...)))
+}
+
+func (l conciseEventLogger) Event(e generator.Event) {
+	e.Message = concise(e.Message)
+	if e.Err != nil {
+		e.Err = errors.New(concise(e.Err.Error()))
+	}
+	l.events.Event(e)
+}
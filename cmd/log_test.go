@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asmahood/proto-client-generator/generator"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var out strings.Builder
+	logger, err := newLogger(logFormatJSON, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Printf("Cloning %s\n", "search")
+	logger.Printf("Warning: %s is deprecated", "search")
+	events := logger.(generator.EventLogger)
+	events.Event(generator.Event{Service: "search", Language: "golang", Message: "Generated", Duration: 1500 * time.Millisecond})
+	events.Event(generator.Event{Service: "search", Language: "golang", Phase: generator.PhaseClone, Message: "Failed", Err: errors.New("clone failed")})
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	want := []map[string]string{
+		{"level": "INFO", "msg": "Cloning search"},
+		{"level": "WARN", "msg": "search is deprecated"},
+		{"level": "INFO", "msg": "Generated", "service": "search", "language": "golang", "duration": "1.5s"},
+		{"level": "ERROR", "msg": "Failed", "service": "search", "phase": "clone", "error": "clone failed"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("logged %d lines, want %d: %q", len(lines), len(want), out.String())
+	}
+
+	for i, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %d is not JSON: %q", i, line)
+		}
+		if _, ok := entry["time"]; !ok {
+			t.Errorf("line %d has no time: %q", i, line)
+		}
+		for key, value := range want[i] {
+			if entry[key] != value {
+				t.Errorf("line %d %s = %v, want %q", i, key, entry[key], value)
+			}
+		}
+	}
+}
+
+func TestLogfmtLogger(t *testing.T) {
+	var out strings.Builder
+	logger, err := newLogger(logFormatLogfmt, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.(generator.EventLogger).Event(generator.Event{Service: "search", Language: "golang", Message: "Generated client", Duration: time.Second})
+
+	line := out.String()
+	for _, pair := range []string{"level=INFO", `msg="Generated client"`, "service=search", "language=golang", "duration=1s"} {
+		if !strings.Contains(line, pair) {
+			t.Errorf("line does not contain %s: %q", pair, line)
+		}
+	}
+}
+
+func TestNewLoggerInvalidFormat(t *testing.T) {
+	if _, err := newLogger("xml", &strings.Builder{}); err == nil {
+		t.Error("newLogger(xml) did not fail")
+	}
+}
+
+func TestConciseLogger(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "client-generation-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	clone := filepath.Join(tmp, "search-1234")
+
+	var out strings.Builder
+	structured, err := newLogger(logFormatJSON, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := newConciseLogger(structured)
+	logger.Printf("Error: protoc failed in %s", clone)
+	logger.(generator.EventLogger).Event(generator.Event{Service: "search", Message: "Failed", Err: fmt.Errorf("cannot read %s", filepath.Join(clone, "search.proto"))})
+
+	logged := out.String()
+	if strings.Contains(logged, tmp) {
+		t.Errorf("logged the temporary directory %s: %q", tmp, logged)
+	}
+	for _, want := range []string{"protoc failed in <tmp>", "cannot read <tmp>" + string(filepath.Separator) + "search.proto"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("logged %q, want it to contain %q", logged, want)
+		}
+	}
+
+	var text strings.Builder
+	plain, _ := newLogger(logFormatText, &text)
+	newConciseLogger(plain).Printf("Cloning into %s", clone)
+	if _, ok := newConciseLogger(plain).(generator.EventLogger); ok {
+		t.Error("the concise logger of a text logger logs events")
+	}
+	if !strings.HasSuffix(text.String(), "Cloning into <tmp>\n") {
+		t.Errorf("logged %q, want the temporary directory replaced", text.String())
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "generate.log")
+	if err := os.WriteFile(path, []byte("a previous run\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+	defer func(f *os.File) { os.Stderr = f }(os.Stderr)
+	os.Stderr = stderr
+
+	output, err := logOutput(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, err := newLogger(logFormatText, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Printf("Cloning %s", "search")
+	logger.Printf("Error: %s", "clone failed")
+	closeLogFile()
+	if logFile != nil {
+		t.Error("the log file was not closed")
+	}
+
+	for _, name := range []string{path, stderr.Name()} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logged := string(data)
+		if strings.Contains(logged, "a previous run") || !strings.Contains(logged, "Cloning search\n") || !strings.HasSuffix(logged, "Error: clone failed\n") {
+			t.Errorf("%s = %q, want the messages of the run", filepath.Base(name), logged)
+		}
+	}
+
+	if _, err := logOutput(filepath.Join(dir, "missing", "generate.log")); err == nil {
+		t.Error("a log file in a missing directory was created")
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiReset  = "\x1b[0m"
+)
+
+var (
+	colorMode string
+	noColor   bool
+)
+
+// useColor returns true if output written to f should be colored. Color is disabled by --no-color, --color=never or the
+// NO_COLOR environment variable, and by default is only used when f is a terminal.
+func useColor(f *os.File) bool {
+	if noColor || colorMode == colorNever {
+		return false
+	}
+	if colorMode == colorAlways {
+		return true
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// cell is a table cell, optionally painted with an ANSI color code
+type cell struct {
+	text  string
+	color string
+}
+
+// table writes column aligned rows, optionally coloring cells. Widths are computed from the uncolored text so escape
+// codes do not affect alignment.
+type table struct {
+	w     io.Writer
+	color bool
+	rows  [][]cell
+}
+
+func newTable(w io.Writer, color bool) *table {
+	return &table{w: w, color: color}
+}
+
+// row adds a row of cells. Values other than cells are formatted with fmt.Sprint
+func (t *table) row(values ...interface{}) {
+	cells := make([]cell, 0, len(values))
+	for _, v := range values {
+		if c, ok := v.(cell); ok {
+			cells = append(cells, c)
+		} else {
+			cells = append(cells, cell{text: fmt.Sprint(v)})
+		}
+	}
+	t.rows = append(t.rows, cells)
+}
+
+func (t *table) green(s string) cell  { return cell{text: s, color: ansiGreen} }
+func (t *table) red(s string) cell    { return cell{text: s, color: ansiRed} }
+func (t *table) yellow(s string) cell { return cell{text: s, color: ansiYellow} }
+
+// flush writes the rows added to the table
+func (t *table) flush() error {
+	var widths []int
+	for _, r := range t.rows {
+		for i, c := range r {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(c.text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range t.rows {
+		for i, c := range r {
+			if t.color && c.color != "" {
+				b.WriteString(c.color + c.text + ansiReset)
+			} else {
+				b.WriteString(c.text)
+			}
+			if i < len(r)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c.text)+2))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	t.rows = nil
+	_, err := io.WriteString(t.w, b.String())
+	return err
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	for _, color := range []bool{false, true} {
+		var out strings.Builder
+		tbl := newTable(&out, color)
+		tbl.row("SERVICE", "PUBLIC")
+		tbl.row("organizations", tbl.green("yes"))
+		tbl.row("search", tbl.red("no"))
+		if err := tbl.flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		green, red, reset := "", "", ""
+		if color {
+			green, red, reset = ansiGreen, ansiRed, ansiReset
+		}
+		want := "SERVICE        PUBLIC\n" +
+			"organizations  " + green + "yes" + reset + "\n" +
+			"search         " + red + "no" + reset + "\n"
+		if out.String() != want {
+			t.Errorf("color %t: got %q, want %q", color, out.String(), want)
+		}
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	defer func(mode string, no bool) { colorMode, noColor = mode, no }(colorMode, noColor)
+	f, err := os.CreateTemp(t.TempDir(), "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		mode    string
+		noColor bool
+		want    bool
+	}{
+		{colorAuto, false, false},
+		{colorAlways, false, true},
+		{colorAlways, true, false},
+		{colorNever, false, false},
+	}
+	for _, tt := range tests {
+		colorMode, noColor = tt.mode, tt.noColor
+		if got := useColor(f); got != tt.want {
+			t.Errorf("useColor with --color=%s --no-color=%t = %t, want %t", tt.mode, tt.noColor, got, tt.want)
+		}
+	}
+}
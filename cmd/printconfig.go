@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of --print-config
+const (
+	configFormatYAML = "yaml"
+	configFormatJSON = "json"
+)
+
+var (
+	printConfigOnly   bool
+	printConfigFormat string
+)
+
+// configValues returns the effective value of every flag in flags, keyed by flag name as in .proto-gen.yaml, along with
+// the plugin options and language extensions read from the file. Flags that only affect the command itself are left out.
+func configValues(flags *pflag.FlagSet) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil {
+			return
+		}
+		switch f.Name {
+		case "help", "print-config", "print-config-format", "validate-only-language":
+			return
+		}
+
+		var value interface{}
+		switch f.Value.Type() {
+		case "bool":
+			value, err = flags.GetBool(f.Name)
+		case "int":
+			value, err = flags.GetInt(f.Name)
+		case "int64":
+			value, err = flags.GetInt64(f.Name)
+		case "stringArray":
+			value, err = flags.GetStringArray(f.Name)
+		case "stringSlice":
+			value, err = flags.GetStringSlice(f.Name)
+		case "stringToString":
+			value, err = flags.GetStringToString(f.Name)
+		default:
+			value = f.Value.String()
+		}
+		values[f.Name] = value
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pluginOptions) > 0 {
+		values[configPluginOptions] = pluginOptions
+	}
+	if len(servicePluginOptions) > 0 {
+		values[configServicePluginOptions] = servicePluginOptions
+	}
+	if len(languageExtensions) > 0 {
+		values[configLanguageExtensions] = languageExtensions
+	}
+	return values, nil
+}
+
+// printConfig writes the effective configuration of flags to w in format, in the layout of .proto-gen.yaml
+func printConfig(w io.Writer, flags *pflag.FlagSet, format string) error {
+	values, err := configValues(flags)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch format {
+	case configFormatYAML:
+		data, err = yaml.Marshal(values)
+	case configFormatJSON:
+		if data, err = json.MarshalIndent(values, "", "  "); err == nil {
+			data = append(data, '\n')
+		}
+	default:
+		return validationError(fmt.Errorf("Invalid configuration format '%s'. Valid values are: %s, %s", format, configFormatYAML, configFormatJSON))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot encode configuration: %s", err.Error())
+	}
+
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestPrintConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	config := `language: ruby
+org: file-org
+language-extensions:
+  golang: [.go]
+plugin-options:
+  go: [module=example.com/x]
+`
+	if err := os.WriteFile(filepath.Join(dir, configName+".yaml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, dir)
+	t.Setenv(configEnv("language"), "python")
+	t.Setenv(configEnv("org"), "env-org")
+	t.Setenv(configEnv("extensions"), ".py,.pyi")
+	t.Cleanup(func() { pluginOptions, servicePluginOptions, languageExtensions = nil, nil, nil })
+
+	var lang, org, output string
+	var exts []string
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().StringVar(&lang, "language", "", "")
+	cmd.Flags().StringVar(&org, "org", "asmahood", "")
+	cmd.Flags().StringVar(&output, "output", ".", "")
+	cmd.Flags().StringSliceVar(&exts, "extensions", nil, "")
+	if err := cmd.ParseFlags([]string{"--org", "flag-org"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := printConfig(&out, cmd.Flags(), configFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(out.String()), &values); err != nil {
+		t.Fatalf("print-config is not JSON: %s", err)
+	}
+
+	want := map[string]interface{}{
+		"org":                 "flag-org",
+		"language":            "python",
+		"output":              ".",
+		"extensions":          []interface{}{".py", ".pyi"},
+		"plugin-options":      map[string]interface{}{"go": []interface{}{"module=example.com/x"}},
+		"language-extensions": map[string]interface{}{"golang": []interface{}{".go"}},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("print-config = %v, want %v", values, want)
+	}
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/asmahood/proto-client-generator/util"
+	"github.com/spf13/cobra"
+)
+
+// isTerminal returns true if f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// interactive returns true if the user can be prompted for missing flags, i.e. both stdin and stderr are terminals
+func interactive() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stderr)
+}
+
+// promptMissing prompts for the language, and for the services if --service was not given either, when no language
+// was given. Outside of a terminal, such as in CI, a missing language is an error instead.
+func promptMissing(cmd *cobra.Command) error {
+	if language != "" {
+		return nil
+	}
+	if !interactive() {
+		return validationError(errors.New("A language must be given with --language"))
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	var err error
+	if language, err = selectOption(in, "Language", util.Languages()); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("service") {
+		return nil
+	}
+
+	services := append([]string{util.ServiceAll}, util.AllServices(private)...)
+	service, err = selectOption(in, "Service", services)
+	return err
+}
+
+// selectOption lets the user pick one of the options with the arrow keys, and falls back to the numbered prompt of
+// choose when the terminal cannot be put in raw mode
+func selectOption(in *bufio.Reader, label string, options []string) (string, error) {
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return choose(in, os.Stderr, label, options)
+	}
+	defer restore()
+	return selectWithKeys(in, os.Stderr, label, options)
+}
+
+// selectorSize is the number of options shown at once by the selector, longer lists scroll
+const selectorSize = 10
+
+// key is a key press understood by the selector
+type key int
+
+const (
+	keyOther key = iota
+	keyUp
+	keyDown
+	keyEnter
+	keyAbort
+)
+
+// readKey reads one key press from in, a terminal in raw mode. The arrow keys, j and k move, enter selects, and
+// ctrl-c, ctrl-d and escape abort.
+func readKey(in *bufio.Reader) (key, error) {
+	b, err := in.ReadByte()
+	if err != nil {
+		return keyOther, err
+	}
+
+	switch b {
+	case '\r', '\n':
+		return keyEnter, nil
+	case 3, 4:
+		return keyAbort, nil
+	case 'k':
+		return keyUp, nil
+	case 'j':
+		return keyDown, nil
+	case 0x1b:
+		// An escape sequence arrives in one read, so a lone escape is the escape key itself
+		if in.Buffered() == 0 {
+			return keyAbort, nil
+		}
+		if next, err := in.ReadByte(); err != nil || (next != '[' && next != 'O') {
+			return keyOther, err
+		}
+		arrow, err := in.ReadByte()
+		if err != nil {
+			return keyOther, err
+		}
+		switch arrow {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		}
+	}
+	return keyOther, nil
+}
+
+// selector is the state of the arrow key selector: the highlighted option and the first option shown
+type selector struct {
+	options []string
+	cursor  int
+	top     int
+}
+
+// move moves the cursor one option up or down, wrapping around at either end, and scrolls to keep it shown
+func (s *selector) move(k key) {
+	switch k {
+	case keyUp:
+		s.cursor = (s.cursor - 1 + len(s.options)) % len(s.options)
+	case keyDown:
+		s.cursor = (s.cursor + 1) % len(s.options)
+	default:
+		return
+	}
+
+	if s.cursor < s.top {
+		s.top = s.cursor
+	} else if s.cursor >= s.top+selectorSize {
+		s.top = s.cursor - selectorSize + 1
+	}
+}
+
+// render writes the label and the shown options to out, with the cursor on the highlighted one, and returns the
+// number of lines written
+func (s *selector) render(out io.Writer, label string) int {
+	fmt.Fprintf(out, "\r\x1b[J? %s (use the arrow keys and enter):\n", label)
+	lines := 1
+	for i := s.top; i < len(s.options) && i < s.top+selectorSize; i++ {
+		cursor := " "
+		if i == s.cursor {
+			cursor = ">"
+		}
+		fmt.Fprintf(out, "\r%s %s\n", cursor, s.options[i])
+		lines++
+	}
+	return lines
+}
+
+// selectWithKeys shows the options on out and reads key presses from in, a terminal in raw mode, until one is
+// selected. The list is redrawn in place after every key and replaced by the choice once one is made.
+func selectWithKeys(in *bufio.Reader, out io.Writer, label string, options []string) (string, error) {
+	s := &selector{options: options}
+	lines := s.render(out, label)
+
+	for {
+		k, err := readKey(in)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("cannot read choice: %s", err.Error())
+		}
+		fmt.Fprintf(out, "\x1b[%dA", lines)
+
+		switch {
+		case k == keyEnter:
+			fmt.Fprintf(out, "\r\x1b[J%s: %s\n", label, options[s.cursor])
+			return options[s.cursor], nil
+		case k == keyAbort || err != nil:
+			fmt.Fprint(out, "\r\x1b[J")
+			return "", validationError(fmt.Errorf("No %s was chosen", strings.ToLower(label)))
+		}
+
+		s.move(k)
+		lines = s.render(out, label)
+	}
+}
+
+// choose writes the numbered options to out and reads the choice from in, by number or by name, until a valid option
+// is chosen
+func choose(in *bufio.Reader, out io.Writer, label string, options []string) (string, error) {
+	for i, o := range options {
+		fmt.Fprintf(out, "  %d) %s\n", i+1, o)
+	}
+
+	for {
+		fmt.Fprintf(out, "%s [1-%d]: ", label, len(options))
+		line, err := in.ReadString('\n')
+		choice := strings.TrimSpace(line)
+
+		if n, convErr := strconv.Atoi(choice); convErr == nil && n >= 1 && n <= len(options) {
+			return options[n-1], nil
+		}
+		for _, o := range options {
+			if choice == o {
+				return o, nil
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(out)
+			return "", validationError(fmt.Errorf("No %s was chosen", strings.ToLower(label)))
+		}
+		if err != nil {
+			return "", fmt.Errorf("cannot read choice: %s", err.Error())
+		}
+		fmt.Fprintf(out, "Invalid choice '%s'\n", choice)
+	}
+}
+
+// confirm writes question to out and reads a yes or no answer from in. Anything but yes, including no answer at all,
+// is taken as no
+func confirm(in *bufio.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+	line, err := in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("cannot read answer: %s", err.Error())
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
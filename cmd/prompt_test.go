@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/asmahood/proto-client-generator/generator"
+)
+
+func TestReadKey(t *testing.T) {
+	tests := []struct {
+		input string
+		want  key
+	}{
+		{"\x1b[A", keyUp},
+		{"\x1b[B", keyDown},
+		{"\x1bOA", keyUp},
+		{"\x1bOB", keyDown},
+		{"k", keyUp},
+		{"j", keyDown},
+		{"\r", keyEnter},
+		{"\n", keyEnter},
+		{"\x03", keyAbort},
+		{"\x04", keyAbort},
+		{"\x1b", keyAbort},
+		{"\x1b[C", keyOther},
+		{"x", keyOther},
+	}
+
+	for _, tt := range tests {
+		got, err := readKey(bufio.NewReader(strings.NewReader(tt.input)))
+		if err != nil {
+			t.Fatalf("readKey(%q) error: %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Errorf("readKey(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSelectWithKeys(t *testing.T) {
+	options := []string{"golang", "ruby", "python"}
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"enter selects the first option", "\r", "golang"},
+		{"down moves to the next option", "\x1b[B\r", "ruby"},
+		{"other keys are ignored", "x\x1b[Cj\r", "ruby"},
+		{"up wraps to the last option", "\x1b[A\r", "python"},
+		{"down wraps to the first option", "jjj\r", "golang"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			got, err := selectWithKeys(bufio.NewReader(strings.NewReader(tt.input)), &out, "Language", options)
+			if err != nil {
+				t.Fatalf("selectWithKeys error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("selectWithKeys = %q, want %q", got, tt.want)
+			}
+			if !strings.HasSuffix(out.String(), "Language: "+tt.want+"\n") {
+				t.Errorf("output does not end with the choice: %q", out.String())
+			}
+		})
+	}
+}
+
+func TestSelectWithKeysAborted(t *testing.T) {
+	for _, input := range []string{"\x03", "j\x1b", ""} {
+		_, err := selectWithKeys(bufio.NewReader(strings.NewReader(input)), ioutil.Discard, "Service", []string{"all"})
+
+		var genErr *generator.Error
+		if !errors.As(err, &genErr) || genErr.Phase != generator.PhaseValidate {
+			t.Fatalf("selectWithKeys(%q) error = %v, want a validation error", input, err)
+		}
+		if !strings.Contains(err.Error(), "No service was chosen") {
+			t.Errorf("selectWithKeys(%q) error = %v", input, err)
+		}
+	}
+}
+
+func TestSelectorScrolls(t *testing.T) {
+	var options []string
+	for i := 0; i < selectorSize+5; i++ {
+		options = append(options, fmt.Sprintf("service%d", i))
+	}
+	s := &selector{options: options}
+
+	for i := 0; i < selectorSize; i++ {
+		s.move(keyDown)
+	}
+	if s.cursor != selectorSize || s.top != 1 {
+		t.Fatalf("after %d downs cursor = %d, top = %d, want %d, 1", selectorSize, s.cursor, s.top, selectorSize)
+	}
+
+	var out strings.Builder
+	if lines := s.render(&out, "Service"); lines != selectorSize+1 {
+		t.Errorf("render wrote %d lines, want %d", lines, selectorSize+1)
+	}
+	if strings.Contains(out.String(), "service0\n") || !strings.Contains(out.String(), fmt.Sprintf("> service%d\n", selectorSize)) {
+		t.Errorf("render did not scroll to the cursor: %q", out.String())
+	}
+
+	s.move(keyDown)
+	s.move(keyDown)
+	s.move(keyDown)
+	s.move(keyDown)
+	s.move(keyDown)
+	if s.cursor != 0 || s.top != 0 {
+		t.Errorf("after wrapping cursor = %d, top = %d, want 0, 0", s.cursor, s.top)
+	}
+}
+
+func TestChoose(t *testing.T) {
+	options := []string{"golang", "ruby"}
+	for input, want := range map[string]string{"2\n": "ruby", "golang\n": "golang", "3\nruby\n": "ruby"} {
+		got, err := choose(bufio.NewReader(strings.NewReader(input)), ioutil.Discard, "Language", options)
+		if err != nil || got != want {
+			t.Errorf("choose(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+}
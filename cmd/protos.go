@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/asmahood/proto-client-generator/generator"
+	"github.com/asmahood/proto-client-generator/util"
+	"github.com/spf13/cobra"
+)
+
+var listProtosCmd = &cobra.Command{
+	Use:   "list-protos",
+	Short: "List the protobuf files of services without cloning them",
+	Long: `List the protobuf files of services without cloning them.
+
+The files in the public/ and private/ protobuf directories of each service are listed at --ref, which defaults to the
+default branch. Repositories are cloned without their file contents or a working tree and listed with git ls-tree,
+unless they are cached in --cache-dir.`,
+	Example:      "generate-clients list-protos -s catalog,search",
+	Args:         validArgs(cobra.NoArgs),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		g := generator.Generator{Logger: logger}
+		opts := generator.Options{
+			Services:         strings.Split(service, ","),
+			Host:             host,
+			Org:              org,
+			ServiceHosts:     serviceHosts,
+			ServiceOrgs:      serviceOrgs,
+			ProtoRepo:        protoRepo,
+			CloneURLTemplate: cloneURLTemplate,
+			RepoNames:        repoNames,
+			Ref:              ref,
+			CacheDir:         cacheDir,
+			Offline:          offline,
+			RefreshCache:     refresh,
+		}
+
+		listed, err := g.ListProtos(cmd.Context(), opts)
+		if err != nil {
+			fatalf(exitCode(err), "Error: %s", err.Error())
+		}
+
+		for i, s := range listed {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s (%s)\n", s.Service, shortCommit(s.Commit))
+			if len(s.Public) == 0 && len(s.Private) == 0 {
+				fmt.Println("  No protobufs")
+			}
+			for _, f := range s.Public {
+				fmt.Printf("  public/%s\n", f)
+			}
+			for _, f := range s.Private {
+				fmt.Printf("  private/%s\n", f)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	listProtosCmd.Flags().StringVarP(&service, "service", "s", util.ServiceAll, "The services to list. Accepts a comma separated list of services, or 'all' (the default)")
+	listProtosCmd.Flags().StringVar(&ref, "ref", "", "The branch, tag or commit SHA to list the protobufs at. Defaults to the default branch")
+	listProtosCmd.Flags().StringVar(&org, "org", util.DefaultOrg, "The Github organization that service repositories are cloned from")
+	listProtosCmd.Flags().StringVar(&host, "host", util.DefaultHost, "The Github host that repositories are cloned from")
+	listProtosCmd.Flags().StringToStringVar(&serviceHosts, "service-host", nil, "Maps a service to the Github host of its repository when it differs from --host, e.g. catalog=github.example.com. Can be repeated")
+	listProtosCmd.Flags().StringToStringVar(&serviceOrgs, "service-org", nil, "Maps a service to the Github organization of its repository when it differs from --org, e.g. catalog=other-org. Can be repeated")
+	listProtosCmd.Flags().StringVar(&protoRepo, "proto-repo", "", "A central protobuf repository (org/name) to list instead of the service. Protobufs are read from its <service>/public and <service>/private directories")
+	listProtosCmd.Flags().StringVar(&cloneURLTemplate, "clone-url-template", "", "A Go template of the URL repositories are cloned from, overriding --host and --org, e.g. https://{{.Host}}/{{.Org}}/{{.Repo}}.git. Fields are .Host, .Org, .Service and .Repo")
+	listProtosCmd.Flags().StringToStringVar(&repoNames, "repo-name", nil, "Maps a service to the name of its repository when they differ, e.g. query=query-service. Can be repeated")
+	listProtosCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "A directory where cloned repositories are kept between runs")
+	listProtosCmd.Flags().BoolVar(&refresh, "refresh-cache", false, "Always fetch the repositories in --cache-dir, pruning deleted refs and resetting them to the remote")
+	listProtosCmd.Flags().BoolVar(&offline, "offline", false, "Only use the repositories in --cache-dir, without fetching")
+	rootCmd.AddCommand(listProtosCmd)
+}
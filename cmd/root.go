@@ -1,10 +1,20 @@
 package cmd
 
 import (
-	"log"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/asmahood/proto-client-generator/generator"
 	"github.com/asmahood/proto-client-generator/util"
 	"github.com/spf13/cobra"
 )
@@ -13,110 +23,645 @@ var (
 	language   string
 	service    string
 	private    bool
-	outputPath string
-)
+	onlyPublic bool
+	onlyPriv   bool
+	discover   bool
+	outputDirs []string
+
+	outputTemplate string
+	languageOutput map[string]string
+	layouts        map[string]string
+	conventional   bool
+	maxFileSize    int64
+	trimPrefix     string
+
+	includeProto bool
+	outputMode   string
+	outputOwner  string
 
-/*
-Command workflow:
+	extensions        []string
+	excludeExtensions []string
+	banner            string
+	protoRepo         string
+	openAPI           bool
+	docs              bool
+	docsFormat        string
+	grpcGateway       bool
+	endpoint          string
+	vendorWKT         bool
+	normalizePkg      bool
+	formatProto       bool
+	methods           []string
+	requireClean      bool
+	goModImports      bool
+	splitByProto      bool
+	repoNames         map[string]string
+	cloneURLTemplate  string
+	protoNames        map[string]string
 
-1. Validate language flag is one of the support SDK languages
+	replaceImports map[string]string
+	protoEncoding  string
+	org            string
+	host           string
+	serviceHosts   map[string]string
+	serviceOrgs    map[string]string
 
-2. Validate service is a valid microservice in the stack
+	outputPerService bool
+	dedupeShared     bool
+	clean            bool
+	writeGitignore   bool
+	changedOnly      bool
+	incremental      bool
+	resume           bool
+	keepGoing        bool
+	jsonOutput       bool
+	listFiles        bool
+	showDiff         bool
+	archive          string
+	commit           bool
+	commitMessage    string
 
-3. Setup temporary directories. This will be used to pull down services from Github, and to generate the code into
+	httpProxy   string
+	httpsProxy  string
+	waitLock    bool
+	cacheDir    string
+	localSource string
+	protoFile   string
 
-4. Pull source code from Github and clone into the temp directory
+	protoArtifact       string
+	protoArtifactSHA256 string
 
-5. Copy proto file from either public/ or private/ (based on flag)
+	watch       bool
+	offline     bool
+	refresh     bool
+	ref         string
+	depth       int
+	submodules  bool
+	cloneFilter string
+	maxClone    int64
 
-6. Run protoc generation command based on language specified
+	timeout         time.Duration
+	cloneTimeout    time.Duration
+	generateTimeout time.Duration
+	generateRetries int
 
-7. Copy generated files to output path
+	rpcFramework string
+	messagesOnly bool
+	goOpts       []string
+	twirpOpts    []string
+	pluginPaths  map[string]string
 
-8. Clean up temporary directories
+	separatePlugins bool
+	streaming       bool
+	failOnWarning   bool
+	bufLint         bool
+	noBufLint       bool
+	noPreflight     bool
+	dockerImage     string
+	toolchainDir    string
+	protocWorkDir   string
+	importPaths     []string
+	withMocks       bool
+	verifyCompile   bool
+	env             []string
 
-*/
+	proto3Optional bool
+
+	descriptorSetOut string
+	descriptorGzip   bool
+	breakingCheck    bool
+	baseline         string
+)
 
 var rootCmd = &cobra.Command{
-	Use:     "generate-clients",
-	Short:   "Use to generate server/client code from protobuf files",
-	Long:    ``,
+	Use:   "generate-clients",
+	Short: "Use to generate server/client code from protobuf files",
+	Long: `Use to generate server/client code from protobuf files.
+
+Default flag values can be set in a .proto-gen.yaml file in the current working directory, keyed by flag name:
+
+  language: golang
+  org: asmahood
+  output: ./rpc
+  private: true
+  service-host:
+    catalog: github.example.com
+  service-org:
+    catalog: other-org
+
+A flag can also be set by an environment variable named after it with a PROTO_GEN_ prefix, e.g. PROTO_GEN_LANGUAGE
+or PROTO_GEN_MAX_FILE_SIZE, which overrides the value in the file. Flags given on the command line override both.
+
+When no language is given and the command is run from a terminal, the language, and the services if --service is not
+given either, are chosen from a list. Otherwise a language must be given.
+
+Exit codes:
+
+  1  any other failure, or the run was interrupted
+  2  the flags or services are invalid
+  3  a repository could not be cloned
+  4  the protobufs are invalid, or code could not be generated from them
+  5  the generated code could not be written to the output
+  6  some services of a batch were generated, but others failed`,
 	Example: "generate-clients -l ruby -s catalog -o ./namara-ruby/lib/rpc/catalog",
-	Run: func(cmd *cobra.Command, args []string) {
-		// Validate we can generate code for the inputted language
-		if valid := util.IsValidLanguage(language); !valid {
-			log.Fatalf("Error: Client code generation is not supported for '%s'\n", language)
+	Args:    validArgs(cobra.NoArgs),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Use the environment and .proto-gen.yaml as defaults for any flag not given on the command line
+		if err := loadConfig(cmd); err != nil {
+			return err
 		}
 
-		// Validate that a public service exists for this service
-		if valid := util.IsValidPublicService(service); !private && !valid {
-			log.Fatalf("Error: The service '%s' does not have a public protobuf defined\n", service)
+		// Errors reported by cobra are copied to the log file along with the log messages
+		output, err := logOutput(logFilePath)
+		if err != nil {
+			return err
+		}
+		cmd.Root().SetErr(output)
+		if logger, err = newLogger(logFormat, output); err != nil {
+			return err
+		}
+		if conciseErrors {
+			logger = newConciseLogger(logger)
 		}
 
-		// If we are generating private code, validate the service has defined a private protobuf
-		if valid := util.IsValidPrivateService(service); private && !valid {
-			log.Fatalf("Error: The service '%s' does not have a private protobuf defined\n", service)
+		if servicesIndex != "" {
+			return loadServiceIndex(cmd.Context(), servicesIndex)
 		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		g := generator.Generator{Logger: logger}
 
+		// Only print the configuration the run would use, as resolved from the flags, environment, .proto-gen.yaml and
+		// defaults
+		if printConfigOnly {
+			if err := printConfig(os.Stdout, cmd.Flags(), printConfigFormat); err != nil {
+				fatalf(exitCode(err), "Error: %s", err.Error())
+			}
+			return
+		}
 
-		// Create temporary directory to download service source code to
-		tmpDir, err := os.MkdirTemp(os.TempDir(), "client-generation-")
-		if err != nil {
-			log.Fatalf("Error: Cannot create temporary directory: %s\n", err.Error())
+		// Only check that code can be generated for the languages, from a built-in protobuf instead of a service
+		if validateOnly {
+			languages := parseLanguages(language)
+			for _, l := range languages {
+				if !util.IsValidLanguage(l) {
+					fatalf(ExitValidation, "Error: Client code generation is not supported for '%s'", l)
+				}
+			}
+			if !printChecks(os.Stdout, useColor(os.Stdout), checkLanguages(cmd.Context(), languages)) {
+				fatalf(ExitGenerate, "Error: Code cannot be generated for every language")
+			}
+			return
 		}
-		defer util.CleanUpDirectories(tmpDir)
-		log.Printf("Created temporary directory %s", tmpDir)
 
-		// Create protobuf directory to hold .proto files
-		protoDir := filepath.Join(tmpDir, "proto")
-		err = os.Mkdir(protoDir, os.ModeDir)
-		if err != nil {
-			util.CleanUpDirectories(tmpDir)
-			log.Fatalf("Error: Cannot create protobuf directory: %s", err.Error())
+		// Prompt for a missing language, and services, when run from a terminal
+		if err := promptMissing(cmd); err != nil {
+			fatalf(exitCode(err), "Error: %s", err.Error())
+		}
+		if watch && listFiles {
+			fatalf(ExitValidation, "Error: --watch cannot be combined with --list-generated-files")
+		}
+		if watch && showDiff {
+			fatalf(ExitValidation, "Error: --watch cannot be combined with --diff")
+		}
+		if watch && protoFile != "" {
+			fatalf(ExitValidation, "Error: --watch cannot be combined with --proto-from-file")
+		}
+		if watch && requireClean {
+			fatalf(ExitValidation, "Error: --watch cannot be combined with --require-clean")
 		}
 
-		// Clone service source into temp directory
-		serviceDir, err := util.CloneService(service, tmpDir)
+		languages := parseLanguages(language)
+		if err := validateLanguages(languages); err != nil {
+			fatalf(exitCode(err), "Error: %s", err.Error())
+		}
+		// Outputs after the first are mirrors of it, which receive the same generated files
+		var outputPath string
+		var mirrors []string
+		if len(outputDirs) > 0 {
+			outputPath, mirrors = outputDirs[0], outputDirs[1:]
+		}
+		if len(mirrors) > 0 && len(languages) > 1 {
+			fatalf(ExitValidation, "Error: --output can only be repeated when generating a single language")
+		}
+		outputs, err := languageOutputs(languages, outputPath, outputTemplate, languageOutput)
 		if err != nil {
-			util.CleanUpDirectories(tmpDir)
-			log.Fatalf("Error: %s", err.Error())
+			fatalf(exitCode(err), "Error: %s", err.Error())
 		}
-
-		// Copy either public or private proto file into the proto directory
-		err = util.CopyProtobuf(service, serviceDir, protoDir, private)
+		outputLayouts, err := languageLayouts(languages, conventional, layouts)
 		if err != nil {
-			util.CleanUpDirectories(tmpDir)
-			log.Fatalf("Error: %s", err.Error())
+			fatalf(exitCode(err), "Error: %s", err.Error())
 		}
-
-		// Generate client code based on lanaguage
-		err = util.GenerateCode(language, service, protoDir)
+		copyExtensions, err := languageCopyExtensions(languages, extensions)
 		if err != nil {
-			util.CleanUpDirectories(tmpDir)
-			log.Fatalf("Error: %s", err.Error())
+			fatalf(exitCode(err), "Error: %s", err.Error())
+		}
+
+		// A protobuf given on stdin can only be read once, so it is read up front for every language
+		var proto []byte
+		if protoFile != "" {
+			if proto, err = readProtoFile(protoFile); err != nil {
+				fatalf(ExitValidation, "Error: %s", err.Error())
+			}
+		}
+
+		opts := generator.Options{
+			Services:          strings.Split(service, ","),
+			Private:           private || onlyPriv,
+			OnlyPublic:        onlyPublic,
+			OnlyPrivate:       onlyPriv,
+			Discover:          discover,
+			OutputPerService:  outputPerService,
+			DedupeShared:      dedupeShared,
+			MirrorPaths:       mirrors,
+			Archive:           archive,
+			Commit:            commit,
+			CommitMessage:     commitMessage,
+			Clean:             clean,
+			WriteGitignore:    writeGitignore,
+			ChangedOnly:       changedOnly,
+			ListFiles:         listFiles,
+			Diff:              showDiff,
+			Incremental:       incremental,
+			Resume:            resume,
+			KeepGoing:         keepGoing,
+			WaitLock:          waitLock,
+			MaxFileSize:       maxFileSize,
+			TrimPrefix:        trimPrefix,
+			IncludeProto:      includeProto,
+			ExcludeExtensions: excludeExtensions,
+			Banner:            banner,
+			OutputMode:        outputMode,
+			OutputOwner:       outputOwner,
+			Host:              host,
+			Org:               org,
+			ServiceHosts:      serviceHosts,
+			ServiceOrgs:       serviceOrgs,
+			ProtoRepo:         protoRepo,
+			RepoNames:         repoNames,
+			CloneURLTemplate:  cloneURLTemplate,
+			ProtoNames:        protoNames,
+			ReplaceImports:    replaceImports,
+			ProtoEncoding:     protoEncoding,
+			Ref:               ref,
+			Depth:             depth,
+			Timeout:           timeout,
+			CloneTimeout:      cloneTimeout,
+			GenerateTimeout:   generateTimeout,
+			GenerateRetries:   generateRetries,
+			CloneFilter:       cloneFilter,
+			MaxCloneSize:      maxClone,
+			RecurseSubmodules: submodules,
+			CacheDir:          cacheDir,
+			Offline:           offline,
+			RefreshCache:      refresh,
+			HTTPProxy:         httpProxy,
+			HTTPSProxy:        httpsProxy,
+			RPCFramework:      rpcFramework,
+			MessagesOnly:      messagesOnly,
+			PluginOpts: globalPluginOpts(map[string][]string{
+				"go":    goOpts,
+				"twirp": twirpOpts,
+			}),
+			ServicePluginOpts:   servicePluginOptions,
+			PluginPaths:         pluginPaths,
+			SeparatePlugins:     separatePlugins,
+			NoStreaming:         !streaming,
+			FailOnWarning:       failOnWarning,
+			ToolchainDir:        toolchainDir,
+			ProtocWorkDir:       protocWorkDir,
+			DockerImage:         dockerImage,
+			ImportPaths:         importPaths,
+			Env:                 env,
+			Proto3Optional:      proto3Optional,
+			BufLint:             bufLint,
+			SkipBufLint:         noBufLint,
+			SkipPreflight:       noPreflight,
+			DescriptorSetOut:    descriptorSetOut,
+			DescriptorGzip:      descriptorGzip,
+			BreakingCheck:       breakingCheck,
+			Baseline:            baseline,
+			WithMocks:           withMocks,
+			VerifyCompile:       verifyCompile,
+			OpenAPI:             openAPI,
+			Docs:                docs,
+			DocsFormat:          docsFormat,
+			GRPCGateway:         grpcGateway,
+			DefaultEndpoint:     endpoint,
+			VendorWKT:           vendorWKT,
+			NormalizePackage:    normalizePkg,
+			FormatProto:         formatProto,
+			Methods:             methods,
+			RequireClean:        requireClean,
+			GoModuleImports:     goModImports,
+			SplitByProto:        splitByProto,
+			LocalSource:         localSource,
+			ProtoArtifactURL:    protoArtifact,
+			ProtoArtifactSHA256: protoArtifactSHA256,
 		}
 
-		// Copy generated files to output directory
-		err = util.CopyGeneratedFiles(protoDir, outputPath)
+		opts.Language = languages[0]
+		opts.ReuseDescriptor = len(languages) > 1
+		opts.OutputPath = outputs[opts.Language]
+		opts.Layout = outputLayouts[opts.Language]
+		opts.Extensions = copyExtensions[opts.Language]
+		if proto != nil {
+			opts.Proto = bytes.NewReader(proto)
+		}
+
+		// In watch mode a failed generation is reported, and the next change regenerates it
+		if watch {
+			err := g.Watch(cmd.Context(), opts, generator.DefaultWatchDebounce, func(result generator.Result, err error) {
+				printResult(result, err)
+				if err != nil && cmd.Context().Err() == nil {
+					logger.Printf("Error: %s", err.Error())
+				}
+			})
+			if err != nil {
+				fatalf(exitCode(err), "Error: %s", err.Error())
+			}
+			return
+		}
+
+		// Each language is generated in turn into its own output, stopping at the first failure
+		var result generator.Result
+		for _, l := range languages {
+			opts.Language = l
+			opts.OutputPath = outputs[l]
+			opts.Layout = outputLayouts[l]
+			opts.Extensions = copyExtensions[l]
+			if proto != nil {
+				opts.Proto = bytes.NewReader(proto)
+			}
+
+			var languageResult generator.Result
+			languageResult, err = g.Generate(cmd.Context(), opts)
+			result.Services = append(result.Services, languageResult.Services...)
+			if err != nil {
+				break
+			}
+		}
+		printResult(result, err)
+
+		if cmd.Context().Err() != nil {
+			fatalf(ExitError, "Error: Generation was interrupted")
+		}
 		if err != nil {
-			util.CleanUpDirectories(tmpDir)
-			log.Fatalf("Error: %s", err.Error())
+			fatalf(exitCode(err), "Error: %s", err.Error())
 		}
 	},
 }
 
+// readProtoFile reads the protobuf at path, or from stdin if path is -
+func readProtoFile(path string) ([]byte, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read protobuf from stdin: %s", err.Error())
+		}
+		return data, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read protobuf: %s", err.Error())
+	}
+	return data, nil
+}
+
+// printResult prints the result for tooling consuming the run, or a summary table of each service
+func printResult(result generator.Result, err error) {
+	if !jsonOutput {
+		if listFiles {
+			printFiles(os.Stdout, useColor(os.Stdout), result)
+			return
+		}
+		if showDiff {
+			printDiffs(os.Stdout, result)
+			return
+		}
+		printSummary(os.Stdout, useColor(os.Stdout), result, err)
+		if changedOnly {
+			printChanged(result)
+		}
+		return
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		fatalf(ExitError, "Error: Cannot encode result: %s", err.Error())
+	}
+}
+
+// printFiles writes a table of the files generated by a run that lists them to w, with their paths in the output
+func printFiles(w io.Writer, color bool, result generator.Result) {
+	if len(result.Services) == 0 {
+		return
+	}
+
+	t := newTable(w, color)
+	t.row("SERVICE", "FILE", "BYTES")
+	for _, s := range result.Services {
+		for _, f := range s.Files {
+			t.row(s.Service, filepath.Join(s.OutputPath, filepath.FromSlash(f)), s.FileSizes[f])
+		}
+	}
+	t.flush()
+}
+
+// printDiffs writes the unified diffs of a run that diffs the generated files against the output to w, with their
+// paths in the output
+func printDiffs(w io.Writer, result generator.Result) {
+	for _, s := range result.Services {
+		for _, d := range s.Diffs {
+			fmt.Fprintf(w, "diff %s\n%s", filepath.Join(s.OutputPath, filepath.FromSlash(d.Name)), d.Diff)
+		}
+	}
+}
+
+// printChanged prints the files that were created or updated in the output of each service
+func printChanged(result generator.Result) {
+	var changed []string
+	for _, s := range result.Services {
+		for _, f := range s.Changed {
+			changed = append(changed, filepath.Join(s.OutputPath, filepath.FromSlash(f)))
+		}
+	}
+
+	fmt.Printf("\n%d files changed\n", len(changed))
+	for _, f := range changed {
+		fmt.Printf("  %s\n", f)
+	}
+}
+
+// printSummary writes a table of the services generated by a run to w. If err is the failure of a service, it is
+// included as a failed row.
+func printSummary(w io.Writer, color bool, result generator.Result, err error) {
+	var genErr *generator.Error
+	failed := errors.As(err, &genErr) && genErr.Service != ""
+	if len(result.Services) == 0 && !failed {
+		return
+	}
+
+	t := newTable(w, color)
+	t.row("SERVICE", "OUTPUT", "CREATED", "UPDATED", "UNCHANGED", "DELETED", "BYTES", "STATUS")
+	var succeeded, skipped, failures int
+	for _, s := range result.Services {
+		switch {
+		case s.Failed:
+			failures++
+			t.row(s.Service, s.OutputPath, "-", "-", "-", "-", "-", t.red("failed"))
+
+			// The failure the run stopped at is already recorded in the result
+			if failed && s.Service == genErr.Service {
+				failed = false
+			}
+		case s.Skipped:
+			skipped++
+			t.row(s.Service, s.OutputPath, s.Created, s.Updated, s.Unchanged, len(s.Deleted), s.Bytes, t.yellow("skipped"))
+		default:
+			succeeded++
+			t.row(s.Service, s.OutputPath, s.Created, s.Updated, s.Unchanged, len(s.Deleted), s.Bytes, t.green("ok"))
+		}
+	}
+	if failed {
+		failures++
+		t.row(genErr.Service, "-", "-", "-", "-", "-", "-", t.red("failed"))
+	}
+	t.flush()
+
+	if failures > 0 && succeeded+skipped+failures > 1 {
+		fmt.Fprintf(w, "\n%d succeeded, %d skipped, %d failed\n", succeeded, skipped, failures)
+	}
+}
+
 func init() {
+	// Invalid command lines exit with ExitValidation, like other invalid options
+	rootCmd.SetFlagErrorFunc(flagError)
+
+	// Flags shared by every command
+	rootCmd.PersistentFlags().StringVar(&colorMode, "color", colorAuto, "When to color output. Valid values are: auto, always, never")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logFormatText, "The format of log messages. Valid values are: text, logfmt, json. logfmt and json also record the service, language, phase, duration and error of each generated service")
+	rootCmd.PersistentFlags().StringVar(&logFilePath, "log-file", "", "Also write log messages and errors to this file, which is created or truncated, e.g. to keep the log of a CI run")
+	rootCmd.PersistentFlags().BoolVar(&conciseErrors, "concise-errors", false, "Replace the paths of temporary directories in log and error messages with <tmp>, so the output of runs can be compared")
+	rootCmd.PersistentFlags().StringVar(&servicesIndex, "services-index", "", "The URL of a JSON index of services and their protobufs, e.g. {\"services\": [{\"name\": \"billing\", \"public\": true}]}, merged with the built-in services. It is cached in --cache-dir, or the user's cache directory, for an hour")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output. Equivalent to --color=never")
+
 	// Initialize command flags
-	rootCmd.Flags().StringVarP(&language, "language", "l", "", "The language of the generated output code. Valid values are: golang, ruby, python, javascript")
-	rootCmd.Flags().StringVarP(&service, "service", "s", "all", "The service to generate client code for. Currently generating for all services is not supported")
-	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "The path to output the generated code. This path is relative to your current working directory")
+	rootCmd.Flags().StringVarP(&language, "language", "l", "", "The language of the generated output code. Valid values are: golang, ruby, python, java, javascript. Accepts a comma separated list, along with --output-template or --language-output")
+	rootCmd.Flags().StringVarP(&service, "service", "s", util.ServiceAll, "The service to generate client code for. Accepts a comma separated list of services, or 'all' (the default) to generate every service with a public (or private) protobuf. See the list command")
+	rootCmd.Flags().StringArrayVarP(&outputDirs, "output", "o", nil, "The path to output the generated code. This path is relative to your current working directory. Can be repeated to write the same generated code to several directories")
+	rootCmd.Flags().StringVar(&outputTemplate, "output-template", "", "A Go template of the output path of each language, e.g. ./clients/{{.Language}}. Used instead of --output when generating multiple languages")
+	rootCmd.Flags().StringToStringVar(&languageOutput, "language-output", nil, "Maps a language to its output path, e.g. golang=./rpc. Takes precedence over --output-template. Can be repeated")
 	rootCmd.Flags().BoolVarP(&private, "private", "p", false, "Will use private protobuf files to generate code instead of public protobufs")
-	rootCmd.MarkFlagRequired("language")
-	rootCmd.MarkFlagRequired("output")
+	rootCmd.Flags().BoolVar(&listFiles, "list-generated-files", false, "Generate the code, but only print the files that would be copied to the output and their sizes instead of copying them")
+	rootCmd.Flags().BoolVar(&showDiff, "diff", false, "Generate the code, but only print unified diffs of how the generated files would change the output instead of copying them")
+	rootCmd.Flags().BoolVar(&changedOnly, "changed-only", false, "Only write the generated files that differ from the output, and list them. With --list-generated-files, only the files that would change are listed")
+	rootCmd.Flags().BoolVar(&writeGitignore, "write-gitignore", false, "Write a .gitignore to the output that ignores everything but the generated files, so only generated files are committed")
+	rootCmd.Flags().BoolVar(&clean, "clean", false, "Remove files generated by a previous run that are no longer generated, as recorded in the output's manifest")
+	rootCmd.Flags().BoolVar(&incremental, "incremental", false, "Skip services whose protobufs and settings are unchanged since they were last generated into the output")
+	rootCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Continue generating the remaining services of a batch after one fails. If only some services fail, the exit code is 6")
+	rootCmd.Flags().BoolVar(&resume, "resume", false, "Skip the services that succeeded in the previous run of a batch that failed. Their state is kept in --cache-dir, or the temporary directory, until a batch fully succeeds")
+	rootCmd.Flags().StringVar(&archive, "archive", "", "Also write the generated files and their manifests to a .zip or .tar.gz archive at this path")
+	rootCmd.Flags().BoolVar(&commit, "commit", false, "Commit the generated files to the git repository holding the output, if anything changed")
+	rootCmd.Flags().StringVar(&commitMessage, "commit-message", "", "A Go template of the message of the --commit commit, with the fields .Language, .Services and .Sources (each with a .Service and .Commit)")
+	rootCmd.Flags().BoolVar(&printConfigOnly, "print-config", false, "Print the configuration the run would use, resolved from the flags, PROTO_GEN_ environment variables, .proto-gen.yaml and defaults, and exit without generating")
+	rootCmd.Flags().StringVar(&printConfigFormat, "print-config-format", configFormatYAML, "Format of --print-config, yaml or json")
+	rootCmd.Flags().BoolVar(&validateOnly, "validate-only-language", false, "Only check that code can be generated for each --language, or every language, from a tiny built-in protobuf, verifying protoc and its plugins, and exit")
+	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result of the run to stdout as JSON")
+	rootCmd.Flags().BoolVar(&onlyPublic, "only-public", false, "Only generate the services that have a public protobuf, skipping the others instead of failing. Cannot be used with --private")
+	rootCmd.Flags().BoolVar(&onlyPriv, "only-private", false, "Only generate the services that have a private protobuf from their private protobufs, skipping the others instead of failing. Implies --private")
+	rootCmd.Flags().BoolVar(&discover, "discover", false, "Determine whether a service has a public or private protobuf from its cloned repository rather than the built-in service lists")
+	rootCmd.Flags().BoolVar(&outputPerService, "output-per-service", true, "When generating multiple services, write each service's files to <output>/<service>. If false, all files are merged into the output directory")
+	rootCmd.Flags().BoolVar(&dedupeShared, "dedupe-shared", false, "When merging the files of multiple services into the output, copy a file that several services generate identically, such as that of a shared protobuf, once instead of failing on the collision")
+	rootCmd.Flags().BoolVar(&conventional, "conventional-layout", false, "Write each service's files to the conventional directory of the language under the output: pkg/<service> for golang, lib/rpc/<service> for ruby, <service> for python, src/main/java for java and src/rpc/<service> for javascript")
+	rootCmd.Flags().StringToStringVar(&layouts, "layout", nil, "Maps a language to a Go template of the directory under the output each service is written to, with the fields .Service and .Language, e.g. golang=internal/{{.Service}}pb. Takes precedence over --conventional-layout. Can be repeated")
+	rootCmd.Flags().StringVar(&org, "org", util.DefaultOrg, "The Github organization that service repositories are cloned from")
+	rootCmd.Flags().StringVar(&host, "host", util.DefaultHost, "The Github host that repositories are cloned from")
+	rootCmd.Flags().StringToStringVar(&serviceHosts, "service-host", nil, "Maps a service to the Github host of its repository when it differs from --host, e.g. catalog=github.example.com. Can be repeated")
+	rootCmd.Flags().StringToStringVar(&serviceOrgs, "service-org", nil, "Maps a service to the Github organization of its repository when it differs from --org, e.g. catalog=other-org. Can be repeated")
+	rootCmd.Flags().StringVar(&protoRepo, "proto-repo", "", "A central protobuf repository (org/name) to clone instead of the service. Protobufs are read from its <service>/public or <service>/private directory")
+	rootCmd.Flags().StringVar(&cloneURLTemplate, "clone-url-template", "", "A Go template of the URL repositories are cloned from, overriding --host and --org, e.g. https://{{.Host}}/{{.Org}}/{{.Repo}}.git. Fields are .Host, .Org, .Service and .Repo")
+	rootCmd.Flags().StringToStringVar(&repoNames, "repo-name", nil, "Maps a service to the name of its repository when they differ, e.g. query=query-service. Can be repeated")
+	rootCmd.Flags().StringVar(&localSource, "local-source", "", "A local checkout of the service's repository (or of --proto-repo) to generate from instead of cloning")
+	rootCmd.Flags().StringVar(&protoFile, "proto-from-file", "", "Generate from this protobuf, or from stdin if -, instead of cloning a repository. Requires a single --service, which names the protobuf")
+	rootCmd.Flags().StringVar(&protoArtifact, "proto-artifact-url", "", "Download the service's protobufs from this .zip, .tar.gz or .tgz archive, such as a release asset, instead of cloning a repository. Requires a single --service and --proto-artifact-sha256")
+	rootCmd.Flags().StringVar(&protoArtifactSHA256, "proto-artifact-sha256", "", "The SHA-256 checksum that the archive downloaded from --proto-artifact-url must match")
+	rootCmd.Flags().BoolVar(&watch, "watch", false, "Regenerate whenever a protobuf in --local-source changes, until interrupted")
+	rootCmd.Flags().StringVar(&ref, "ref", "", "The branch, tag or commit SHA of the repositories to generate from. Defaults to their default branch")
+	rootCmd.Flags().StringVar(&cloneFilter, "clone-filter", "", "A git filter spec used to partially clone repositories, e.g. blob:none to only download the files that are checked out")
+	rootCmd.Flags().Int64Var(&maxClone, "max-clone-size", 0, "The largest size in bytes a cloned repository may grow to, including its git history. Clones are aborted once they grow larger. 0 disables the limit")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 0, "The longest each phase of generating a service may take, e.g. 2m. 0 disables the limit")
+	rootCmd.Flags().DurationVar(&cloneTimeout, "clone-timeout", 0, "The longest cloning the repository of a service may take. Defaults to --timeout")
+	rootCmd.Flags().IntVar(&generateRetries, "generate-retries", 0, "The number of times to retry generating a service when a plugin fails transiently, rather than because of an error in the protobufs")
+	rootCmd.Flags().DurationVar(&generateTimeout, "generate-timeout", 0, "The longest running protoc for a service may take. Defaults to --timeout")
+	rootCmd.Flags().IntVar(&depth, "depth", 0, "Clone repositories with only this many commits of history. 0 clones the full history")
+	rootCmd.Flags().BoolVar(&submodules, "recurse-submodules", false, "Also clone the submodules of repositories, for protobufs defined in a submodule")
+	rootCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "A directory where cloned repositories are kept between runs. Cached repositories are updated instead of cloned again")
+	rootCmd.Flags().BoolVar(&refresh, "refresh-cache", false, "Always fetch the repositories in --cache-dir, pruning deleted refs and resetting them to the remote, e.g. after a branch was force pushed")
+	rootCmd.Flags().BoolVar(&offline, "offline", false, "Do not use the network, generating from the repositories in --cache-dir as they are. Fails if a repository is not cached")
+	rootCmd.Flags().StringToStringVar(&protoNames, "service-name-override", nil, "Maps a service to the base name its protobuf is copied to, e.g. catalog=catalog_api. The generated files are named after it. Can be repeated")
+	rootCmd.Flags().StringVar(&protoEncoding, "proto-encoding", "", "The character set of the protobufs, e.g. ISO-8859-1 or windows-1252, which they are transcoded to UTF-8 from before generation. Defaults to UTF-8")
+	rootCmd.Flags().StringToStringVar(&replaceImports, "replace-import", nil, "Rewrites imports of the protobuf starting with a prefix, e.g. github.com/org/protos/=common/. Can be repeated")
+	rootCmd.Flags().StringVar(&httpProxy, "http-proxy", "", "The HTTP proxy used when cloning repositories and fetching the service index. Defaults to the HTTP_PROXY environment variable")
+	rootCmd.Flags().StringVar(&httpsProxy, "https-proxy", "", "The HTTPS proxy used when cloning repositories and fetching the service index. Defaults to the HTTPS_PROXY environment variable")
+	rootCmd.Flags().StringVar(&rpcFramework, "rpc-framework", util.DefaultRPCFramework, "The RPC framework to generate client and server code for. Valid values are: twirp, grpc, none")
+	rootCmd.Flags().BoolVar(&messagesOnly, "messages-only", false, "Will only generate message types, without any RPC client or server code")
+	rootCmd.Flags().BoolVar(&goModImports, "go-module-imports", false, "Map the protobufs to the Go packages they are generated into within the module holding the output, found from the closest go.mod, instead of their go_package options. Only supported for golang")
+	rootCmd.Flags().StringArrayVar(&goOpts, "go-opt", nil, "An extra option for the go plugin, appended to --go_out (e.g. module=github.com/org/repo). Can be repeated")
+	rootCmd.Flags().StringArrayVar(&twirpOpts, "twirp-opt", nil, "An extra option for the twirp plugin, appended to --twirp_out. Can be repeated")
+	rootCmd.Flags().StringToStringVar(&pluginPaths, "plugin-path", nil, "Maps a protoc plugin to its binary, e.g. go=/usr/local/bin/protoc-gen-go-custom. Plugins are go, twirp, go-grpc, grpc-gateway, openapiv2 and so on. Can be repeated")
+	rootCmd.Flags().BoolVar(&streaming, "streaming", true, "Generate clients supporting streaming RPCs from gRPC plugins where it is optional (grpc-web for javascript). gRPC clients of other languages always support streaming, and Twirp does not support it")
+	rootCmd.Flags().BoolVar(&failOnWarning, "fail-on-warning", false, "Fail if protoc reports warnings about a protobuf, such as unused imports")
+	rootCmd.Flags().BoolVar(&separatePlugins, "separate-plugins", false, "Run each protoc plugin in its own protoc invocation, so errors are attributed to the plugin that produced them")
+	rootCmd.Flags().StringArrayVar(&importPaths, "import-path", nil, "An extra directory that imports of the protobufs are resolved from, searched after the service's protobufs. Can be repeated")
+	rootCmd.Flags().StringVar(&protocWorkDir, "protoc-workdir", "", "The working directory of protoc and its plugins, for plugins that resolve relative paths from it. Defaults to the directory of the copied protobufs")
+	rootCmd.Flags().StringVar(&toolchainDir, "toolchain-dir", "", "A directory holding pinned protoc and plugin binaries to use instead of those on your PATH")
+	rootCmd.Flags().StringVar(&dockerImage, "docker-image", "", "A Docker image providing protoc and its plugins, e.g. example.com/protoc:3.19. protoc is run in a container of it with the protobuf and output directories mounted, instead of on your PATH")
+	rootCmd.Flags().StringArrayVar(&env, "env", nil, "An environment variable (KEY=VALUE) set for protoc and its plugins, e.g. TS_PROTO_OPT=esModuleInterop=true. Can be repeated")
+	rootCmd.Flags().BoolVar(&proto3Optional, "proto3-optional", false, "Pass --experimental_allow_proto3_optional to protoc. By default it is passed when the installed protoc requires it for proto3 optional fields")
+	rootCmd.Flags().BoolVar(&noPreflight, "no-preflight", false, "Skip checking that the repositories can be accessed with git ls-remote before generating multiple services")
+	rootCmd.Flags().BoolVar(&bufLint, "buf-lint", false, "Lint the protobufs with buf before generation, failing on violations. Only runs when buf is installed and the service has a buf.yaml")
+	rootCmd.Flags().BoolVar(&noBufLint, "no-buf-lint", false, "Skip linting the protobufs with buf, overriding --buf-lint, e.g. when it is set in .proto-gen.yaml")
+	rootCmd.Flags().StringVar(&descriptorSetOut, "descriptor-set-out", "", "Write the compiled FileDescriptorSet of the service to this path. When generating multiple services, this is a directory holding <service>.pb files")
+	rootCmd.Flags().BoolVar(&descriptorGzip, "descriptor-gzip", false, "Gzip compress the descriptor written by --descriptor-set-out. When generating multiple services, they are written to <service>.pb.gz")
+	rootCmd.Flags().BoolVar(&breakingCheck, "breaking-check", false, "Fail if the protobuf has breaking changes compared to the --baseline descriptor. Requires buf")
+	rootCmd.Flags().StringVar(&baseline, "baseline", "", "The FileDescriptorSet used by --breaking-check, such as one previously written by --descriptor-set-out")
+	rootCmd.Flags().BoolVar(&verifyCompile, "verify-compile", false, "Check that the generated code compiles before copying it to the output. golang is built with go build, while python, ruby and javascript are checked for syntax errors")
+	rootCmd.Flags().BoolVar(&withMocks, "with-mocks", false, "Will also generate gomock mocks of the RPC interfaces using mockgen. Only supported for golang")
+	rootCmd.Flags().BoolVar(&grpcGateway, "grpc-gateway", false, "Will also generate grpc-gateway reverse proxies (.pb.gw.go) serving the RPCs over REST using protoc-gen-grpc-gateway. Only supported for golang with --rpc-framework=grpc")
+	rootCmd.Flags().StringVar(&endpoint, "default-endpoint", "", "A base URL embedded in the generated clients as a constant, e.g. DefaultEndpoint in <service>_endpoint.go, to connect to by default. Only supported for golang and python")
+	rootCmd.Flags().BoolVar(&splitByProto, "split-by-proto", false, "Generate each protobuf of a service on its own, into a subdirectory of the output named after the protobuf, e.g. <output>/search for search.proto")
+	rootCmd.Flags().BoolVar(&requireClean, "require-clean", false, "Refuse to generate if the output has uncommitted changes in git, so generated code is not mixed with manual edits")
+	rootCmd.Flags().BoolVar(&normalizePkg, "normalize-package", false, "Rewrite the package of the copied protobufs to be scoped by the service, e.g. api.v1 of catalog becomes catalog.api.v1, so services declaring the same package do not generate clashing code")
+	rootCmd.Flags().StringSliceVar(&methods, "methods", nil, "Only generate clients of these RPC methods, stripping the others and the messages only they use from the compiled protobufs, e.g. Query,Search.Suggest. Methods are named as Method or Service.Method")
+	rootCmd.Flags().BoolVar(&formatProto, "format-proto", false, "Format the protobufs with buf format, or clang-format if buf is not installed, before generating and copying them. Skipped if neither is installed")
+	rootCmd.Flags().BoolVar(&vendorWKT, "vendor-wkt", false, "Also generate the code of the well-known types (google/protobuf/*.proto) imported by the protobufs into the output, so it is self-contained. Their protobufs are read from --import-path or the include directory of protoc")
+	rootCmd.Flags().BoolVar(&docs, "docs", false, "Will also generate documentation of the protobufs using protoc-gen-doc, written to the output as <service>.<ext>")
+	rootCmd.Flags().StringVar(&docsFormat, "docs-format", util.DocsMarkdown, "The format of the documentation generated with --docs. Valid values are: html, markdown, json")
+	rootCmd.Flags().BoolVar(&openAPI, "openapi", false, "Will also generate an OpenAPI v2 specification (.swagger.json) using protoc-gen-openapiv2")
+	rootCmd.Flags().BoolVar(&waitLock, "wait-lock", false, "Wait for another run writing to the same output to finish, instead of failing")
+	rootCmd.Flags().StringVar(&trimPrefix, "trim-prefix", "", "A directory prefix to strip from the paths of generated files in the output, e.g. github.com/org/repo")
+	rootCmd.Flags().StringVar(&banner, "banner", "", "A Go template of a comment prepended to every generated file, with the fields .Service, .Language and .Commit, e.g. 'DO NOT EDIT. Generated from {{.Service}}@{{.Commit}}'")
+	rootCmd.Flags().StringSliceVar(&extensions, "extensions", nil, "Only copy generated files with these extensions to the output, e.g. .go,.pb.json. 'default' stands for the conventional extensions of the language. Set per language with language-extensions in .proto-gen.yaml")
+	rootCmd.Flags().StringSliceVar(&excludeExtensions, "exclude-extensions", nil, "Never copy generated files with these extensions to the output, e.g. .log,.DS_Store")
+	rootCmd.Flags().BoolVar(&includeProto, "include-proto", false, "Will also copy the .proto files to the output alongside the generated code")
+	rootCmd.Flags().StringVar(&outputMode, "output-mode", "", "The octal permission bits set on the generated files copied to the output, e.g. 0664. Defaults to those of the generated files")
+	rootCmd.Flags().StringVar(&outputOwner, "output-owner", "", "The user[:group] owning the generated files copied to the output, e.g. 1000:1000, so that steps running as another user can modify them. Not supported on Windows")
+	rootCmd.Flags().Int64Var(&maxFileSize, "max-file-size", util.DefaultMaxFileSize, "The largest file in bytes that will be copied. Set to 0 to disable the limit")
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	// Cancel the run on SIGINT/SIGTERM. This kills any running subprocess, and lets the temporary directories be cleaned
+	// up before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
+	closeLogFile()
+	if err != nil {
+		os.Exit(exitCode(err))
 	}
 }
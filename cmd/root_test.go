@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asmahood/proto-client-generator/generator"
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+func TestPrintFiles(t *testing.T) {
+	var out strings.Builder
+	printFiles(&out, false, generator.Result{})
+	if out.String() != "" {
+		t.Errorf("printed %q for a run without services", out.String())
+	}
+
+	result := generator.Result{Services: []generator.ServiceResult{{
+		Service:    "search",
+		OutputPath: "rpc",
+		Files:      []string{"search.pb.go", "v1/search.twirp.go"},
+		FileSizes:  map[string]int64{"search.pb.go": 120, "v1/search.twirp.go": 4096},
+	}}}
+	printFiles(&out, false, result)
+	want := "SERVICE  FILE                    BYTES\n" +
+		"search   " + filepath.Join("rpc", "search.pb.go") + "        120\n" +
+		"search   " + filepath.Join("rpc", "v1", "search.twirp.go") + "  4096\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestReadProtoFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "billing.proto")
+	if err := os.WriteFile(path, []byte("syntax = \"proto3\";\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readProtoFile(path); err != nil || string(data) != "syntax = \"proto3\";\n" {
+		t.Errorf("got %q, %v", data, err)
+	}
+	if _, err := readProtoFile(filepath.Join(t.TempDir(), "missing.proto")); err == nil || !strings.HasPrefix(err.Error(), "Cannot read protobuf") {
+		t.Errorf("expected a missing protobuf to be reported, got %v", err)
+	}
+
+	stdin, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = stdin
+	if data, err := readProtoFile("-"); err != nil || string(data) != "syntax = \"proto3\";\n" {
+		t.Errorf("read %q, %v from stdin", data, err)
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	result := generator.Result{Services: []generator.ServiceResult{
+		{Service: "search", OutputPath: "out/search", Created: 2, Bytes: 100},
+		{Service: "query", OutputPath: "out/query", Failed: true, Error: "protoc failed"},
+	}}
+	err := &generator.PartialError{Succeeded: 1, Errs: []error{errors.New("protoc failed")}}
+
+	var out strings.Builder
+	printSummary(&out, false, result, err)
+	want := "SERVICE  OUTPUT      CREATED  UPDATED  UNCHANGED  DELETED  BYTES  STATUS\n" +
+		"search   out/search  2        0        0          0        100    ok\n" +
+		"query    out/query   -        -        -          -        -      failed\n" +
+		"\n1 succeeded, 0 skipped, 1 failed\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	// A batch stopping at a failure lists it, without a summary line for a single service
+	out.Reset()
+	printSummary(&out, false, generator.Result{}, &generator.Error{Service: "search", Phase: generator.PhaseClone, Err: errors.New("clone failed")})
+	if want := "SERVICE  OUTPUT  CREATED  UPDATED  UNCHANGED  DELETED  BYTES  STATUS\n" +
+		"search   -       -        -        -          -        -      failed\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestPrintDiffs(t *testing.T) {
+	result := generator.Result{Services: []generator.ServiceResult{{
+		Service:    "search",
+		OutputPath: "rpc",
+		Diffs: []util.FileDiff{
+			{Name: "v1/search.pb.go", Status: util.FileUpdated, Diff: "--- a/v1/search.pb.go\n+++ b/v1/search.pb.go\n"},
+		},
+	}, {Service: "query", OutputPath: "rpc"}}}
+
+	var out strings.Builder
+	printDiffs(&out, result)
+	if want := "diff " + filepath.Join("rpc", "v1", "search.pb.go") + "\n--- a/v1/search.pb.go\n+++ b/v1/search.pb.go\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// makeRaw puts the console input f in raw mode, so keys are read one at a time without being echoed and arrive as
+// the same escape sequences as on other terminals, and turns on escape sequence processing for stderr. It returns
+// the function that restores the previous modes.
+func makeRaw(f *os.File) (func(), error) {
+	in, out := windows.Handle(f.Fd()), windows.Handle(os.Stderr.Fd())
+	var inMode, outMode uint32
+	if err := windows.GetConsoleMode(in, &inMode); err != nil {
+		return nil, err
+	}
+	if err := windows.GetConsoleMode(out, &outMode); err != nil {
+		return nil, err
+	}
+
+	raw := inMode&^(windows.ENABLE_ECHO_INPUT|windows.ENABLE_LINE_INPUT|windows.ENABLE_PROCESSED_INPUT) |
+		windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(in, raw); err != nil {
+		return nil, err
+	}
+	if err := windows.SetConsoleMode(out, outMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+		_ = windows.SetConsoleMode(in, inMode)
+		return nil, err
+	}
+
+	return func() {
+		_ = windows.SetConsoleMode(in, inMode)
+		_ = windows.SetConsoleMode(out, outMode)
+	}, nil
+}
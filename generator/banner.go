@@ -0,0 +1,42 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// BannerData is the data the banner template is rendered with for each service
+type BannerData struct {
+	// Service is the service the file was generated for
+	Service string
+
+	// Language is the language of the generated code
+	Language string
+
+	// Commit is the SHA of the source commit the service was generated from, if known
+	Commit string
+}
+
+// parseBanner parses the banner template text
+func parseBanner(text string) (*template.Template, error) {
+	tmpl, err := template.New("banner").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid banner template: %s", err.Error())
+	}
+	return tmpl, nil
+}
+
+// renderBanner renders the banner of the files generated for service from commit. It is empty if no banner is
+// configured.
+func (r *run) renderBanner(service string, commit string) (string, error) {
+	if r.banner == nil {
+		return "", nil
+	}
+
+	var b bytes.Buffer
+	if err := r.banner.Execute(&b, BannerData{Service: service, Language: r.opts.Language, Commit: commit}); err != nil {
+		return "", fmt.Errorf("cannot render banner: %s", err.Error())
+	}
+	return b.String(), nil
+}
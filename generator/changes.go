@@ -0,0 +1,134 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// ServiceChanges are the changes to the protobuf API of a service between two commits
+type ServiceChanges struct {
+	Service string
+
+	// Since and Commit are the SHAs of the commits compared, if known
+	Since  string
+	Commit string
+
+	Changes []util.DescriptorChange
+}
+
+/*
+Changes compares the protobufs of opts.Services at the ref since with those at opts.Ref, which defaults to the default
+branch. For each service and ref:
+
+1. Clone either the central protobuf repository or the service source at the ref
+
+2. Copy the public or private protobuf and compile it into a FileDescriptorSet, as for Options.DescriptorSetOut
+
+The services, RPCs, messages, fields, enums and enum values of the two descriptor sets are then compared.
+*/
+func (g *Generator) Changes(ctx context.Context, opts Options, since string) ([]ServiceChanges, error) {
+	if since == "" {
+		return nil, &Error{Phase: PhaseValidate, Err: errors.New("A commit to compare against must be given")}
+	}
+	if opts.LocalSource != "" || opts.ProtoArtifactURL != "" {
+		return nil, &Error{Phase: PhaseValidate, Err: errors.New("A local source or protobuf artifact cannot be compared at another commit")}
+	}
+
+	if err := validateCache(opts); err != nil {
+		return nil, &Error{Phase: PhaseValidate, Err: err}
+	}
+	if _, err := util.ParseCloneURLTemplate(opts.CloneURLTemplate); err != nil {
+		return nil, &Error{Phase: PhaseValidate, Err: err}
+	}
+	if err := util.ValidateProtoEncoding(opts.ProtoEncoding); err != nil {
+		return nil, &Error{Phase: PhaseValidate, Err: err}
+	}
+
+	services, err := normalizeServices(opts.Services)
+	if err != nil {
+		return nil, &Error{Phase: PhaseValidate, Err: err}
+	}
+	if len(services) == 0 {
+		services = util.AllServices(opts.Private)
+	}
+
+	r := &run{opts: opts}
+	var changes []ServiceChanges
+	for _, s := range services {
+		if err := ctx.Err(); err != nil {
+			return changes, &Error{Service: s, Phase: PhaseSetup, Err: err}
+		}
+
+		sinceOpts := opts
+		sinceOpts.Ref = since
+		previous, sinceCommit, err := g.descriptorElements(ctx, r, sinceOpts, s)
+		if err != nil {
+			return changes, err
+		}
+		next, commit, err := g.descriptorElements(ctx, r, opts, s)
+		if err != nil {
+			return changes, err
+		}
+
+		changes = append(changes, ServiceChanges{Service: s, Since: sinceCommit, Commit: commit, Changes: util.DiffDescriptors(previous, next)})
+	}
+	return changes, nil
+}
+
+// descriptorElements compiles the protobuf of service at opts.Ref and returns the elements it declares, along with the
+// commit they were read from
+func (g *Generator) descriptorElements(ctx context.Context, r *run, opts Options, service string) (map[string]util.Element, string, error) {
+	fail := func(phase Phase, err error) (map[string]util.Element, string, error) {
+		return nil, "", &Error{Service: service, Phase: phase, Err: err}
+	}
+
+	tmpDir, err := os.MkdirTemp(os.TempDir(), util.TempDirPrefix)
+	if err != nil {
+		return fail(PhaseSetup, fmt.Errorf("cannot create temporary directory: %s", err.Error()))
+	}
+	defer func() {
+		if err := util.CleanUpDirectories(tmpDir); err != nil {
+			g.logf("Warning: %s", err.Error())
+		}
+	}()
+
+	protoDir := filepath.Join(tmpDir, "proto")
+	if err := os.Mkdir(protoDir, os.ModeDir|0755); err != nil {
+		return fail(PhaseSetup, fmt.Errorf("cannot create protobuf directory: %s", err.Error()))
+	}
+
+	cloneCtx, cancelClone := phaseContext(ctx, opts.cloneTimeout())
+	src, err := checkout(cloneCtx, opts, service, tmpDir)
+	cancelClone()
+	if err != nil {
+		return fail(PhaseClone, timeoutError(cloneCtx, "clone", opts.cloneTimeout(), err))
+	}
+
+	protoName := opts.protoName(service)
+	if err := util.CopyProtobuf(protoName, src.protoRoot, protoDir, opts.Private, opts.MaxFileSize, opts.ProtoEncoding); err != nil {
+		return fail(PhaseProto, err)
+	}
+	if err := util.ReplaceImports(protoDir, opts.ReplaceImports); err != nil {
+		return fail(PhaseProto, err)
+	}
+
+	genOpts := util.GenerateOptions{Logger: g.Logger, ToolchainDir: opts.ToolchainDir, WorkDir: opts.ProtocWorkDir, DockerImage: opts.DockerImage, ImportPaths: opts.ImportPaths, Env: opts.Env}
+	genOpts.Proto3Optional = g.needsProto3Optional(ctx, r, genOpts)
+	genCtx, cancelGenerate := phaseContext(ctx, opts.generateTimeout())
+	defer cancelGenerate()
+	descriptor := filepath.Join(tmpDir, fmt.Sprintf("%s.pb", service))
+	if err := util.GenerateDescriptorSet(genCtx, protoName, protoDir, descriptor, genOpts); err != nil {
+		return fail(PhaseGenerate, timeoutError(genCtx, "generation", opts.generateTimeout(), err))
+	}
+
+	elements, err := util.ReadDescriptorSet(descriptor)
+	if err != nil {
+		return fail(PhaseProto, err)
+	}
+	return elements, src.commit, nil
+}
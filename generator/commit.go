@@ -0,0 +1,71 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// DefaultCommitMessage is the template of the message of commits made by Options.Commit
+const DefaultCommitMessage = `Regenerate {{.Language}} clients for {{.Services}}
+{{range .Sources}}
+{{.Service}}: {{.Commit}}{{end}}
+`
+
+// CommitData is the data the commit message template is rendered with
+type CommitData struct {
+	// Language is the language of the generated code
+	Language string
+
+	// Services is a comma separated list of the services that were generated
+	Services string
+
+	// Sources hold the service and source commit of every generated service
+	Sources []ServiceResult
+}
+
+// parseCommitMessage parses the commit message template text, or DefaultCommitMessage if text is empty
+func parseCommitMessage(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultCommitMessage
+	}
+	tmpl, err := template.New("commit").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid commit message template: %s", err.Error())
+	}
+	return tmpl, nil
+}
+
+// commit commits the generated files in the output to its git repository, with a message rendered from tmpl. Nothing
+// is committed if the output is unchanged.
+func (g *Generator) commit(ctx context.Context, tmpl *template.Template, opts Options, result Result) error {
+	data := CommitData{Language: opts.Language}
+	var services []string
+	for _, s := range result.Services {
+		if !s.Skipped {
+			services = append(services, s.Service)
+			data.Sources = append(data.Sources, s)
+		}
+	}
+	data.Services = strings.Join(services, ", ")
+
+	var message bytes.Buffer
+	if err := tmpl.Execute(&message, data); err != nil {
+		return fmt.Errorf("cannot render commit message: %s", err.Error())
+	}
+
+	sha, err := util.CommitOutput(ctx, opts.OutputPath, message.String())
+	if err != nil {
+		return err
+	}
+	if sha == "" {
+		g.logf("Nothing changed in %s, not committing", opts.OutputPath)
+		return nil
+	}
+	g.logf("Committed %s as %s", opts.OutputPath, sha)
+	return nil
+}
@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// inputDescriptor is a FileDescriptorSet a service's protobufs were compiled into, kept to generate the code of other
+// languages from
+type inputDescriptor struct {
+	// fingerprint identifies the protobufs and protoc settings the descriptor was compiled from
+	fingerprint string
+
+	// language is the language the descriptor was first compiled for
+	language string
+
+	data []byte
+}
+
+// inputDescriptorSet returns the path of a FileDescriptorSet in tmpDir of the protobufs in protoDir, for generating code
+// from with util.GenerateOptions.DescriptorSetIn. The descriptor compiled for another language of service is reused
+// when its protobufs and protoc settings are unchanged, so that the protobufs are only parsed once across languages.
+func (g *Generator) inputDescriptorSet(ctx context.Context, opts Options, service string, protoName string, protoDir string, tmpDir string, genOpts util.GenerateOptions) (string, error) {
+	settings := fmt.Sprint(protoName, genOpts.ImportPaths, genOpts.Proto3Optional, genOpts.ToolchainDir, genOpts.DockerImage)
+	fingerprint, err := util.ProtoFingerprint(protoDir, settings)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(tmpDir, fmt.Sprintf("%s-inputs.pb", service))
+	if d, ok := g.descriptors[service]; ok && d.fingerprint == fingerprint {
+		if err := os.WriteFile(path, d.data, 0644); err != nil {
+			return "", fmt.Errorf("cannot write descriptor set: %s", err.Error())
+		}
+		g.logf("Reusing the protobufs of %s compiled for %s", service, d.language)
+		return path, nil
+	}
+
+	if err := util.CompileDescriptorSet(ctx, protoName, protoDir, path, genOpts); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read descriptor set: %s", err.Error())
+	}
+
+	// Only the latest descriptor of each service is kept, so that watching a service does not accumulate them
+	if g.descriptors == nil {
+		g.descriptors = make(map[string]inputDescriptor)
+	}
+	g.descriptors[service] = inputDescriptor{fingerprint: fingerprint, language: opts.Language, data: data}
+	return path, nil
+}
@@ -0,0 +1,1790 @@
+// Package generator generates server/client code from the protobuf files of services. It is the library behind the
+// generate-clients command, and can be embedded in other Go tooling.
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// Logger receives progress messages from a Generator. *log.Logger satisfies Logger.
+type Logger = util.Logger
+
+// Options configures a generation run
+type Options struct {
+	// Language is the language of the generated code. See util.IsValidLanguage
+	Language string
+
+	// Services are the services to generate code for. An empty list, or a list containing only util.ServiceAll,
+	// selects every service with a protobuf defined.
+	Services []string
+
+	// Private uses the private protobuf of each service instead of the public one
+	Private bool
+
+	// OnlyPublic and OnlyPrivate only generate the services known to have a public, or private, protobuf, skipping the
+	// others instead of failing. OnlyPublic cannot be used with Private, and OnlyPrivate requires it
+	OnlyPublic  bool
+	OnlyPrivate bool
+
+	// Discover determines whether services have a public or private protobuf by inspecting their cloned repository,
+	// instead of relying on the built-in service lists. With util.ServiceAll, every known service is cloned and those
+	// without a protobuf are skipped
+	Discover bool
+
+	// OutputPath is the directory generated files are written to, relative to the current working directory
+	OutputPath string
+
+	// MirrorPaths are further directories the same generated files are written to, each laid out as OutputPath and with
+	// its own manifest. Go import paths of GoModuleImports are those of OutputPath
+	MirrorPaths []string
+
+	// Archive is the path of a .zip or .tar.gz archive that the generated files and their manifests are also
+	// written to, named by their path relative to OutputPath
+	Archive string
+
+	// Commit commits the generated files to the git repository holding OutputPath, if anything changed. The commit
+	// message is rendered from the CommitMessage template, or DefaultCommitMessage
+	Commit        bool
+	CommitMessage string
+
+	// OutputPerService writes the files of each service to OutputPath/<service> when generating multiple services.
+	// Otherwise files of all services are merged into OutputPath, and colliding file names are an error.
+	OutputPerService bool
+
+	// DedupeShared copies a generated file that several services of a batch generate identically into the merged
+	// OutputPath once, from the first service generating it, rather than rejecting it as a collision. The file is
+	// recorded for each of the services, in ServiceResult.Shared for all but the first
+	DedupeShared bool
+
+	// Layout is a template of the directory under OutputPath each service is written to, rendered with LayoutData,
+	// e.g. pkg/{{.Service}}. It takes precedence over OutputPerService. See util.DefaultLayout for the conventional
+	// layout of each language
+	Layout string
+
+	// Resume skips the services of a batch that were generated successfully by a previous run with the same language,
+	// output and source which then failed. Batch runs record the services that succeed until they fully succeed
+	Resume bool
+
+	// KeepGoing continues a batch past the services that fail, recording their errors in the result. A batch in which
+	// some services were generated and others failed returns a *PartialError
+	KeepGoing bool
+
+	// ListFiles generates the services but only lists the files that would be copied to the output, in
+	// ServiceResult.FileSizes, leaving the output untouched
+	ListFiles bool
+
+	// Diff generates the services but only reports how the generated files would change the output, as unified diffs
+	// in ServiceResult.Diffs, leaving the output untouched
+	Diff bool
+
+	// ChangedOnly only writes the generated files that differ from the output, leaving identical files, and their
+	// modification times, untouched. With ListFiles, only the files that would change are listed
+	ChangedOnly bool
+
+	// WriteGitignore writes a .gitignore to the output that ignores everything but the generated files recorded in its
+	// manifest, so that only generated files are committed and changes to the generated file set show up in its diff
+	WriteGitignore bool
+
+	// Incremental skips generating a service whose protobufs and generation settings are unchanged since it was last
+	// generated into the same output, as recorded in the output's manifest
+	Incremental bool
+
+	// Clean removes files from the output that were generated by a previous run, as recorded in its manifest, but are no
+	// longer generated
+	Clean bool
+
+	// WaitLock waits for another run writing to the same output directory to finish, instead of failing
+	WaitLock bool
+
+	// MaxFileSize is the largest file in bytes that will be copied. 0 disables the limit
+	MaxFileSize int64
+
+	// TrimPrefix is a slash separated directory prefix removed from the paths of generated files in the output
+	TrimPrefix string
+
+	// IncludeProto also copies the .proto files of the service to the output
+	IncludeProto bool
+
+	// Extensions, if given, are the only extensions of generated files copied to the output, e.g. .go or .pb.go.
+	// Generated files with one of the ExcludeExtensions are never copied. See util.DefaultExtensions
+	Extensions        []string
+	ExcludeExtensions []string
+
+	// Banner is a template of a comment prepended to every generated file, rendered with BannerData. Files are
+	// commented in the syntax of their language; files without a comment syntax, such as JSON, are left as they are
+	Banner string
+
+	// OutputMode is the octal permission bits set on the generated files copied to the output, e.g. 0664, and
+	// OutputOwner the user[:group] they are owned by, so that steps running as another user, such as a non-root step
+	// after a containerized build, can read and modify them. Files keep the defaults when they are empty
+	OutputMode  string
+	OutputOwner string
+
+	// Host is the Github host that repositories are cloned from. Defaults to util.DefaultHost
+	Host string
+
+	// Org is the Github organization that service repositories are cloned from. Defaults to util.DefaultOrg
+	Org string
+
+	// ServiceHosts and ServiceOrgs override Host and Org for individual services
+	ServiceHosts map[string]string
+	ServiceOrgs  map[string]string
+
+	// ProtoRepo is a central protobuf repository (org/name) cloned instead of each service's repository
+	ProtoRepo string
+
+	// RepoNames maps services to the name of their repository when it differs from the service key
+	RepoNames map[string]string
+
+	// CloneURLTemplate is a text/template rendering the URL each repository is cloned from with util.CloneURLData,
+	// e.g. https://{{.Host}}/{{.Org}}/{{.Repo}}.git, overriding the SSH URL built from the host and organization
+	CloneURLTemplate string
+
+	// ReplaceImports maps import path prefixes to their replacement, rewriting the import statements of the copied
+	// protobufs before generation
+	ReplaceImports map[string]string
+
+	// ProtoEncoding is the character set of the protobufs, e.g. ISO-8859-1, which they are transcoded to UTF-8 from when
+	// copied. Defaults to UTF-8, which protobufs are copied as they are from
+	ProtoEncoding string
+
+	// ProtoNames maps services to the base name their protobuf is copied to, e.g. catalog=catalog_api. The names of
+	// the generated files derive from it. Defaults to the service key
+	ProtoNames map[string]string
+
+	// Ref is the branch, tag or commit SHA of the repositories generated from. Defaults to their default branch
+	Ref string
+
+	// Depth limits clones to this many commits of history. 0 clones the full history
+	Depth int
+
+	// Timeout bounds the commands of each phase of generating a service, unless overridden by CloneTimeout or
+	// GenerateTimeout. 0 disables the limit
+	Timeout time.Duration
+
+	// CloneTimeout bounds cloning the repository of a service
+	CloneTimeout time.Duration
+
+	// GenerateTimeout bounds running protoc and its plugins for a service
+	GenerateTimeout time.Duration
+
+	// GenerateRetries is the number of times generating the code of a service is retried when a plugin fails without
+	// protoc reporting an error in the protobufs, e.g. when it crashes or cannot reach the network
+	GenerateRetries int
+
+	// RecurseSubmodules also clones the submodules of repositories
+	RecurseSubmodules bool
+
+	// MaxCloneSize is the largest size in bytes a clone may grow to, including its git history. Larger clones are
+	// aborted. 0 disables the limit
+	MaxCloneSize int64
+
+	// CloneFilter is a git filter spec, e.g. blob:none, used for partial clones of the repositories
+	CloneFilter string
+
+	// LocalSource is a local checkout of the repository that would be cloned, either the service's repository or
+	// ProtoRepo. When set, nothing is cloned
+	LocalSource string
+
+	// Proto is the content of a protobuf to generate from instead of cloning a repository, such as one read from stdin.
+	// Exactly one service must be given, which names the protobuf and is not required to be a known service
+	Proto io.Reader
+
+	// ProtoArtifactURL is a .zip, .tar.gz or .tgz archive of the service's protobufs to download instead of cloning a
+	// repository, such as a release asset. The archive holds the public/ and private/ directories, optionally within a
+	// proto/ directory or a single top-level directory. Exactly one service must be given
+	ProtoArtifactURL string
+
+	// ProtoArtifactSHA256 is the hex encoded SHA-256 checksum the downloaded ProtoArtifactURL must match
+	ProtoArtifactSHA256 string
+
+	// CacheDir is a directory where cloned repositories are kept and reused between runs
+	CacheDir string
+
+	// Offline uses only the clones in CacheDir, without any network git operation
+	Offline bool
+
+	// RefreshCache always fetches the clones in CacheDir, pruning deleted refs and resetting them to the remote, for
+	// branches that were force pushed
+	RefreshCache bool
+
+	// HTTPProxy and HTTPSProxy are the proxies used when cloning repositories
+	HTTPProxy  string
+	HTTPSProxy string
+
+	// RPCFramework is the framework RPC code is generated for. Defaults to util.DefaultRPCFramework
+	RPCFramework string
+
+	// MessagesOnly generates only the message types, without any RPC code
+	MessagesOnly bool
+
+	// PluginOpts holds extra options appended to the output options of a protoc plugin, keyed by plugin name (e.g. go,
+	// twirp)
+	PluginOpts map[string][]string
+
+	// ServicePluginOpts holds the plugin options of individual services, keyed by service and then plugin name. The
+	// options of a plugin given for a service replace those of the plugin in PluginOpts
+	ServicePluginOpts map[string]map[string][]string
+
+	// NoStreaming generates unary-only clients from plugins where streaming support is optional, currently the
+	// grpc-web plugin for javascript. gRPC clients of other languages always support streaming, and Twirp never does
+	NoStreaming bool
+
+	// FailOnWarning fails generation of a service when protoc reports warnings about its protobuf
+	FailOnWarning bool
+
+	// SeparatePlugins runs each protoc plugin in its own protoc invocation, attributing failures to the plugin
+	SeparatePlugins bool
+
+	// PluginPaths maps plugin names to the plugin binary protoc runs, for plugins with a non-standard name or location
+	PluginPaths map[string]string
+
+	// ToolchainDir is a directory holding pinned protoc and plugin binaries, used instead of those on the PATH
+	ToolchainDir string
+
+	// ProtocWorkDir is the working directory of protoc and its plugins, for plugins that resolve paths from it rather
+	// than the proto path. Defaults to the directory of the copied protobufs
+	ProtocWorkDir string
+
+	// DockerImage is a Docker image providing protoc and its plugins, which protoc is run in instead of on the host
+	DockerImage string
+
+	// ImportPaths are extra directories that imports of the protobufs are resolved from, such as a checkout of shared
+	// protobufs. They are searched in order, after the protobufs of the service
+	ImportPaths []string
+
+	// Env holds KEY=VALUE environment variables passed to protoc and its plugins. They are not set when cloning
+	Env []string
+
+	// Proto3Optional allows proto3 optional fields in protoc versions where they are experimental. It is enabled
+	// automatically when the installed protoc requires it
+	Proto3Optional bool
+
+	// BufLint lints the protobufs with buf before generation, failing on violations. Linting only runs when buf is
+	// installed and the service has a buf.yaml
+	BufLint bool
+
+	// SkipBufLint disables BufLint, e.g. when buf-lint is set in .proto-gen.yaml
+	SkipBufLint bool
+
+	// SkipPreflight disables checking that the repositories can be accessed before generating multiple services
+	SkipPreflight bool
+
+	// DescriptorSetOut, if set, is the path the compiled FileDescriptorSet of the service is written to. When generating
+	// multiple services it is a directory, and each service's descriptor is written to <service>.pb inside it
+	DescriptorSetOut string
+
+	// DescriptorGzip gzip compresses the descriptor written to DescriptorSetOut. When generating multiple services,
+	// each is written to <service>.pb.gz
+	DescriptorGzip bool
+
+	// ReuseDescriptor compiles the protobufs of each service into a FileDescriptorSet once, kept by the Generator, and
+	// generates code from it, so that generating several languages with the same Generator parses them only once
+	ReuseDescriptor bool
+
+	// BreakingCheck fails generation if the service's protobuf has breaking changes compared to the FileDescriptorSet at
+	// Baseline. Requires buf to be installed
+	BreakingCheck bool
+
+	// Baseline is the FileDescriptorSet compared against by BreakingCheck. When generating multiple services it is a
+	// directory holding a <service>.pb descriptor for each of them
+	Baseline string
+
+	// VerifyCompile checks that the generated code compiles before copying it to the output. Go code is built, while
+	// Python, Ruby and JavaScript code is checked for syntax errors. Not supported for Java, nor offline for Go as go mod
+	// tidy resolves the dependencies of the generated code
+	VerifyCompile bool
+
+	// WithMocks also generates gomock mocks of the generated RPC interfaces. Only supported for Go
+	WithMocks bool
+
+	// DefaultEndpoint is a base URL embedded in the generated clients as a constant, e.g. DefaultEndpoint in
+	// <service>_endpoint.go for Go, so they can connect to the service of an environment by default. Only supported
+	// for Go and Python
+	DefaultEndpoint string
+
+	// OpenAPI also generates an OpenAPI v2 specification for each service
+	OpenAPI bool
+
+	// Docs also generates documentation of the protobufs of each service with protoc-gen-doc, in DocsFormat, which
+	// defaults to util.DocsMarkdown. The documentation is copied to the output as <service>.<ext>, e.g. search.md
+	Docs       bool
+	DocsFormat string
+
+	// SplitByProto generates each protobuf of the service on its own, into a subdirectory of the output named after the
+	// protobuf, e.g. <output>/search for search.proto. Cannot be used with WithMocks
+	SplitByProto bool
+
+	// GoModuleImports maps the import path of each protobuf to the package it is generated into within the Go module
+	// holding OutputPath, found from the closest go.mod, overriding the go_package options. Only supported for Go
+	GoModuleImports bool
+
+	// VendorWKT also generates the code of the well-known types (google/protobuf/*.proto) imported by the protobufs
+	// into the output, copying their protobufs from the include directory of protoc
+	VendorWKT bool
+
+	// NormalizePackage scopes the package of every copied protobuf by its service, e.g. api.v1 of catalog becomes
+	// catalog.api.v1, so that services declaring the same package do not generate clashing symbols
+	NormalizePackage bool
+
+	// Methods strips the RPC methods not listed from the compiled protobufs code is generated from, along with the
+	// services left without any and the messages and imports only the stripped methods used, so that a minimal client is
+	// generated. Methods are named as Method or Service.Method. The protobufs copied by IncludeProto are left whole
+	Methods []string
+
+	// FormatProto formats the copied protobufs with buf format, or clang-format when buf is not installed, before they
+	// are generated and copied to the output. Formatting is skipped if neither is installed
+	FormatProto bool
+
+	// RequireClean refuses to generate into an output with uncommitted changes in git, so that generated files are not
+	// mixed with manual edits
+	RequireClean bool
+
+	// GRPCGateway also generates grpc-gateway reverse proxies (.pb.gw.go) of the services. Only supported for Go with
+	// the gRPC framework
+	GRPCGateway bool
+}
+
+// Result describes the outcome of a generation run
+type Result struct {
+	// Services holds the result of each generated service, in the order they were generated
+	Services []ServiceResult `json:"services"`
+}
+
+// ServiceResult describes the generated output of a single service
+type ServiceResult struct {
+	Service string `json:"service"`
+
+	// OutputPath is the directory the service's files were written to
+	OutputPath string `json:"outputPath"`
+
+	// MirrorPaths are the directories the same files were also written to. See Options.MirrorPaths
+	MirrorPaths []string `json:"mirrorPaths,omitempty"`
+
+	// Shared are the names of the generated files already written to OutputPath, identically, by another service, and
+	// not copied again. See Options.DedupeShared
+	Shared []string `json:"shared,omitempty"`
+
+	// Commit is the SHA of the source commit the service was generated from, if known
+	Commit string `json:"commit,omitempty"`
+
+	// Files are the names of the files written to OutputPath
+	Files []string `json:"files"`
+
+	// Created, Updated and Unchanged count the copied files that were new to the output, replaced a different file, or
+	// were identical to the file already in the output
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+
+	// Changed are the names of the Files that were created or updated
+	Changed []string `json:"changed,omitempty"`
+
+	// Skipped is true if the service was not generated, with SkipReason describing why. See Options.Incremental and
+	// Options.Discover
+	Skipped    bool   `json:"skipped,omitempty"`
+	SkipReason string `json:"skipReason,omitempty"`
+
+	// Failed is true if the service could not be generated, with Error describing why. See Options.KeepGoing
+	Failed bool   `json:"failed,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// Deleted are the names of stale files removed from OutputPath by Options.Clean
+	Deleted []string `json:"deleted,omitempty"`
+
+	// Bytes is the total size of the copied files
+	Bytes int64 `json:"bytes"`
+
+	// FileSizes are the sizes of the Files that would be written to OutputPath when the files were only listed. See
+	// Options.ListFiles
+	FileSizes map[string]int64 `json:"fileSizes,omitempty"`
+
+	// Diffs are the changes the generated files would make to OutputPath when they were only diffed. See Options.Diff
+	Diffs []util.FileDiff `json:"diffs,omitempty"`
+}
+
+// count records how the copied file f changed the output
+func (r *ServiceResult) count(f util.CopiedFile) {
+	switch f.Status {
+	case util.FileCreated:
+		r.Created++
+		r.Changed = append(r.Changed, f.Name)
+	case util.FileUpdated:
+		r.Updated++
+		r.Changed = append(r.Changed, f.Name)
+	case util.FileUnchanged:
+		r.Unchanged++
+	}
+}
+
+// Summary returns a one line description of the changes made to the output of the service
+func (r ServiceResult) Summary() string {
+	if r.Skipped {
+		return fmt.Sprintf("%s: skipped, %s", r.Service, r.SkipReason)
+	}
+	if r.Failed {
+		return fmt.Sprintf("%s: failed, %s", r.Service, r.Error)
+	}
+	if r.FileSizes != nil {
+		return fmt.Sprintf("%s: %d files generated (%d bytes), %d would change in %s", r.Service, len(r.Files), r.Bytes, len(r.Changed), r.OutputPath)
+	}
+	return fmt.Sprintf("%s: %d files created, %d updated, %d unchanged, %d deleted (%d bytes) in %s", r.Service, r.Created, r.Updated, r.Unchanged, len(r.Deleted), r.Bytes, r.OutputPath)
+}
+
+// Phase identifies the step of the generation workflow in which an error occurred
+type Phase string
+
+const (
+	PhaseValidate Phase = "validate"
+	PhaseSetup    Phase = "setup"
+	PhaseClone    Phase = "clone"
+	PhaseProto    Phase = "proto"
+	PhaseGenerate Phase = "generate"
+	PhaseCopy     Phase = "copy"
+)
+
+// Error is returned by Generate when a run fails
+type Error struct {
+	// Service is the service being generated when the error occurred. It is empty for errors that are not specific to a
+	// service, such as invalid options
+	Service string
+
+	Phase Phase
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Service == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Service, e.Err.Error())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// PartialError is returned by Generate when some services of a batch were generated and others failed. The failed
+// services are recorded in the Result along with their errors
+type PartialError struct {
+	Succeeded int
+
+	// Errs are the errors of the failed services, in the order they were generated
+	Errs []error
+}
+
+func (e *PartialError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d of %d services failed: %s", len(e.Errs), e.Succeeded+len(e.Errs), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error of the first failed service
+func (e *PartialError) Unwrap() error {
+	return e.Errs[0]
+}
+
+// Generator runs the generation workflow. The zero value is ready to use.
+type Generator struct {
+	// Logger receives progress messages. If nil, messages are discarded
+	Logger Logger
+
+	// descriptors holds the protobufs of each service compiled with Options.ReuseDescriptor, keyed by service
+	descriptors map[string]inputDescriptor
+}
+
+func (g *Generator) logf(format string, v ...interface{}) {
+	if g.Logger != nil {
+		g.Logger.Printf(format, v...)
+	}
+}
+
+/*
+Generate runs the generation workflow:
+
+1. Validate language is one of the support SDK languages
+
+2. Validate each service is a valid microservice in the stack. Steps 3-8 are run for each of the services
+
+3. Setup temporary directories. This will be used to pull down services from Github, and to generate the code into
+
+4. Pull source code from Github and clone into the temp directory. If a central protobuf repository is configured, it is
+cloned instead of the service and the service's subdirectory is used
+
+5. Copy proto file from either public/ or private/ (based on opts.Private), and lint it with buf if opts.BufLint is set
+
+6. Run protoc generation command based on language specified, and optionally generate mocks, an OpenAPI
+specification and documentation
+
+7. Copy generated files to output path, and record them in the output's manifest. Files of a previous run that are no
+longer generated are removed when opts.Clean is set. When opts.ListFiles is set the files are only listed instead, and
+when opts.Diff is set their changes to the output are only diffed
+
+8. Clean up temporary directories
+
+If a step fails, Generate stops and returns an *Error describing it, along with the results of the services that were
+already generated.
+*/
+func (g *Generator) Generate(ctx context.Context, opts Options) (Result, error) {
+	var result Result
+
+	// Validate we can generate code for the inputted language
+	if valid := util.IsValidLanguage(opts.Language); !valid {
+		return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("Client code generation is not supported for '%s'", opts.Language)}
+	}
+
+	// Validate the RPC framework has a plugin for the inputted language
+	if !opts.MessagesOnly {
+		if err := util.ValidateRPCFramework(opts.Language, opts.rpcFramework()); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+
+	// Validate mocks can be generated for the inputted language and RPC framework
+	if opts.WithMocks {
+		if !util.IsMockableLanguage(opts.Language) {
+			return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("Mocks cannot be generated for '%s'", opts.Language)}
+		}
+		if opts.MessagesOnly || opts.rpcFramework() == util.RPCFrameworkNone {
+			return result, &Error{Phase: PhaseValidate, Err: errors.New("Mocks cannot be generated without RPC code")}
+		}
+		if opts.SplitByProto {
+			return result, &Error{Phase: PhaseValidate, Err: errors.New("Mocks cannot be generated when splitting the output by protobuf")}
+		}
+	}
+
+	if opts.DefaultEndpoint != "" {
+		if err := util.ValidateDefaultEndpoint(opts.Language, opts.DefaultEndpoint); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+		if opts.MessagesOnly || opts.rpcFramework() == util.RPCFrameworkNone {
+			return result, &Error{Phase: PhaseValidate, Err: errors.New("A default endpoint cannot be embedded without RPC code")}
+		}
+		if opts.SplitByProto {
+			return result, &Error{Phase: PhaseValidate, Err: errors.New("A default endpoint cannot be embedded when splitting the output by protobuf")}
+		}
+	}
+
+	if len(opts.Methods) > 0 && (opts.MessagesOnly || opts.rpcFramework() == util.RPCFrameworkNone) {
+		return result, &Error{Phase: PhaseValidate, Err: errors.New("Methods cannot be selected without generating RPC code")}
+	}
+
+	if opts.GRPCGateway {
+		if err := util.ValidateGRPCGateway(opts.Language, opts.rpcFramework(), opts.MessagesOnly); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+
+	if opts.Docs {
+		if err := util.ValidateDocsFormat(opts.docsFormat()); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+
+	if opts.GoModuleImports && opts.Language != util.LanguageGo {
+		return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("Go module import paths cannot be used for '%s'", opts.Language)}
+	}
+
+	if opts.VerifyCompile && !util.IsVerifiableLanguage(opts.Language) {
+		return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("Compiling generated '%s' code cannot be verified", opts.Language)}
+	}
+	if opts.VerifyCompile && opts.Offline && opts.Language == util.LanguageGo {
+		return result, &Error{Phase: PhaseValidate, Err: errors.New("Compiling generated Go code cannot be verified offline, as go mod tidy needs the network to resolve its dependencies")}
+	}
+
+	for _, exts := range [][]string{opts.Extensions, opts.ExcludeExtensions} {
+		if err := util.ValidateExtensions(exts); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+
+	if err := validateCache(opts); err != nil {
+		return result, &Error{Phase: PhaseValidate, Err: err}
+	}
+	if _, err := util.ParseCloneURLTemplate(opts.CloneURLTemplate); err != nil {
+		return result, &Error{Phase: PhaseValidate, Err: err}
+	}
+	if err := util.ValidateProtoEncoding(opts.ProtoEncoding); err != nil {
+		return result, &Error{Phase: PhaseValidate, Err: err}
+	}
+	if opts.OutputMode != "" {
+		if _, err := util.ParseFileMode(opts.OutputMode); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+	if opts.OutputOwner != "" {
+		if _, err := util.ParseFileOwner(opts.OutputOwner); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+
+	if opts.ProtocWorkDir != "" {
+		if info, err := os.Stat(opts.ProtocWorkDir); err != nil || !info.IsDir() {
+			return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("The protoc working directory '%s' is not a directory", opts.ProtocWorkDir)}
+		}
+	}
+
+	if err := validateMirrors(opts); err != nil {
+		return result, &Error{Phase: PhaseValidate, Err: err}
+	}
+
+	if opts.Archive != "" {
+		if _, err := util.ArchiveFormat(opts.Archive); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+
+	for s, name := range opts.ProtoNames {
+		if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+			return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("Invalid protobuf name '%s' for the service '%s'", name, s)}
+		}
+	}
+
+	if opts.ListFiles && (opts.Archive != "" || opts.Commit || opts.Clean || opts.DescriptorSetOut != "") {
+		return result, &Error{Phase: PhaseValidate, Err: errors.New("Listing the generated files cannot be combined with an archive, a commit, cleaning the output or writing a descriptor set")}
+	}
+	if opts.Diff && (opts.ListFiles || opts.Archive != "" || opts.Commit || opts.Clean || opts.DescriptorSetOut != "") {
+		return result, &Error{Phase: PhaseValidate, Err: errors.New("Diffing the generated files cannot be combined with listing them, an archive, a commit, cleaning the output or writing a descriptor set")}
+	}
+
+	if opts.Depth < 0 {
+		return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("Invalid clone depth %d", opts.Depth)}
+	}
+
+	if opts.Timeout < 0 || opts.CloneTimeout < 0 || opts.GenerateTimeout < 0 {
+		return result, &Error{Phase: PhaseValidate, Err: errors.New("Timeouts cannot be negative")}
+	}
+	if opts.MaxCloneSize < 0 {
+		return result, &Error{Phase: PhaseValidate, Err: errors.New("The maximum clone size cannot be negative")}
+	}
+	if opts.GenerateRetries < 0 {
+		return result, &Error{Phase: PhaseValidate, Err: errors.New("The number of generate retries cannot be negative")}
+	}
+
+	var commitMessage *template.Template
+	if opts.Commit {
+		var err error
+		if commitMessage, err = parseCommitMessage(opts.CommitMessage); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+
+	var banner *template.Template
+	if opts.Banner != "" {
+		var err error
+		if banner, err = parseBanner(opts.Banner); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+
+	if err := util.ValidateEnv(opts.Env); err != nil {
+		return result, &Error{Phase: PhaseValidate, Err: err}
+	}
+
+	if opts.BreakingCheck && opts.Baseline == "" {
+		return result, &Error{Phase: PhaseValidate, Err: errors.New("A baseline descriptor must be given to check for breaking changes")}
+	}
+
+	var layout *template.Template
+	if opts.Layout != "" {
+		var err error
+		if layout, err = parseLayout(opts.Layout); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+
+	r := &run{opts: opts, banner: banner, layout: layout, copied: make(map[string]string), copiedSHA256: make(map[string]string), symbols: make(map[string]string)}
+
+	services, err := normalizeServices(opts.Services)
+	if err != nil {
+		return result, &Error{Phase: PhaseValidate, Err: err}
+	}
+	if opts.Proto != nil {
+		if len(services) != 1 {
+			return result, &Error{Phase: PhaseValidate, Err: errors.New("Exactly one service must be given to generate from a protobuf")}
+		}
+		if opts.LocalSource != "" {
+			return result, &Error{Phase: PhaseValidate, Err: errors.New("A protobuf cannot be generated from along with a local source")}
+		}
+	}
+	if opts.ProtoArtifactURL != "" {
+		if err := validateArtifact(opts, services); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+	}
+	if len(services) == 0 {
+		services = util.AllServices(opts.Private)
+
+		// In discovery mode every service is cloned, and those without a protobuf are skipped
+		if opts.Discover {
+			services = util.KnownServices()
+			r.skipMissing = true
+		}
+		if len(services) == 0 {
+			return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("No service has a %s protobuf defined", scope(opts.Private))}
+		}
+		g.logf("Generating every service with a %s protobuf: %s", scope(opts.Private), strings.Join(services, ", "))
+	}
+
+	// Only the services known to have a protobuf of the scope are generated, skipping the rest. The run remains a batch
+	// even if a single service is left, so that its output is laid out the same
+	requested := len(services)
+	if opts.OnlyPublic || opts.OnlyPrivate {
+		if err := validateOnlyScope(opts); err != nil {
+			return result, &Error{Phase: PhaseValidate, Err: err}
+		}
+		var filtered []ServiceResult
+		services, filtered = filterScope(services, opts)
+		for _, skipped := range filtered {
+			g.event(Event{Message: skipped.Summary(), Service: skipped.Service, Language: opts.Language})
+			result.Services = append(result.Services, skipped)
+		}
+		if len(services) == 0 {
+			return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("None of the services have a %s protobuf defined", scope(opts.Private))}
+		}
+	}
+
+	for _, s := range services {
+		// A given protobuf or artifact does not belong to a known service
+		if opts.Proto != nil || opts.ProtoArtifactURL != "" {
+			break
+		}
+
+		// Validate that a public service exists for this service
+		if valid := util.IsValidPublicService(s); !opts.Private && !valid {
+			if opts.Discover {
+				g.logf("Warning: The service '%s' is not known to have a public protobuf defined, it will be checked after cloning", s)
+				continue
+			}
+			return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("The service '%s' does not have a public protobuf defined", s)}
+		}
+
+		// If we are generating private code, validate the service has defined a private protobuf
+		if valid := util.IsValidPrivateService(s); opts.Private && !valid {
+			if opts.Discover {
+				g.logf("Warning: The service '%s' is not known to have a private protobuf defined, it will be checked after cloning", s)
+				continue
+			}
+			return result, &Error{Phase: PhaseValidate, Err: fmt.Errorf("The service '%s' does not have a private protobuf defined", s)}
+		}
+	}
+
+	if opts.LocalSource != "" && opts.ProtoRepo == "" && len(services) > 1 {
+		return result, &Error{Phase: PhaseValidate, Err: errors.New("A local source can only be used for multiple services when it is a central protobuf repository")}
+	}
+
+	if opts.RequireClean {
+		if err := requireClean(ctx, opts); err != nil {
+			return result, err
+		}
+	}
+
+	r.batch = requested > 1
+	if r.batch {
+		if err := g.preflight(ctx, opts, services); err != nil {
+			return result, err
+		}
+	}
+
+	// The services that succeeded before a failed batch are recorded, so that the batch can be resumed
+	var failures []error
+	var resumePath string
+	resumed := make(map[string]bool)
+	state := &util.ResumeState{}
+	if r.resumable() {
+		resumePath = resumeStatePath(opts, services)
+		if opts.Resume {
+			if state, err = util.ReadResumeState(resumePath); err != nil {
+				return result, &Error{Phase: PhaseSetup, Err: err}
+			}
+			for _, s := range state.Succeeded {
+				resumed[s] = true
+			}
+		}
+	}
+
+	for _, s := range services {
+		if err := ctx.Err(); err != nil {
+			return result, &Error{Service: s, Phase: PhaseSetup, Err: err}
+		}
+
+		serviceOutputPath := opts.OutputPath
+		switch {
+		case r.layout != nil:
+			if serviceOutputPath, err = r.layoutPath(s); err != nil {
+				return result, &Error{Service: s, Phase: PhaseValidate, Err: err}
+			}
+		case r.batch && opts.OutputPerService:
+			serviceOutputPath = filepath.Join(opts.OutputPath, s)
+		}
+
+		if resumed[s] {
+			serviceResult := ServiceResult{Service: s, OutputPath: serviceOutputPath, Skipped: true, SkipReason: "generated by the resumed run"}
+			g.event(Event{Message: serviceResult.Summary(), Service: s, Language: opts.Language})
+			result.Services = append(result.Services, serviceResult)
+			continue
+		}
+
+		start := time.Now()
+		serviceResult, err := g.generateService(ctx, r, s, serviceOutputPath)
+		if err != nil {
+			g.event(failureEvent(s, opts.Language, start, err))
+			result.Services = append(result.Services, failedResult(s, serviceOutputPath, err))
+			failures = append(failures, err)
+			if opts.KeepGoing && ctx.Err() == nil {
+				continue
+			}
+			return result, batchError(result, failures)
+		}
+
+		g.event(Event{Message: serviceResult.Summary(), Service: s, Language: opts.Language, Duration: time.Since(start)})
+		result.Services = append(result.Services, serviceResult)
+
+		if resumePath != "" {
+			state.Succeeded = append(state.Succeeded, s)
+			if err := util.WriteResumeState(resumePath, state); err != nil {
+				g.logf("Warning: %s", err.Error())
+			}
+		}
+	}
+
+	// The output of a batch that partly failed is not archived or committed, and it can still be resumed
+	if len(failures) > 0 {
+		return result, batchError(result, failures)
+	}
+
+	if opts.Archive != "" {
+		if err := writeArchive(opts.Archive, opts.OutputPath, result); err != nil {
+			return result, &Error{Phase: PhaseCopy, Err: err}
+		}
+		g.logf("Wrote archive %s", opts.Archive)
+	}
+
+	if opts.Commit {
+		if err := g.commit(ctx, commitMessage, opts, result); err != nil {
+			return result, &Error{Phase: PhaseCopy, Err: err}
+		}
+	}
+
+	if resumePath != "" {
+		if err := util.RemoveResumeState(resumePath); err != nil {
+			g.logf("Warning: %s", err.Error())
+		}
+	}
+	return result, nil
+}
+
+// failedResult returns the result of service, which failed to generate into outputPath with err
+func failedResult(service string, outputPath string, err error) ServiceResult {
+	var genErr *Error
+	if errors.As(err, &genErr) {
+		err = genErr.Err
+	}
+	return ServiceResult{Service: service, OutputPath: outputPath, Failed: true, Error: err.Error()}
+}
+
+// batchError returns the error of a run that failed with failures. If any service in result was generated it is a
+// *PartialError, otherwise it is the first failure
+func batchError(result Result, failures []error) error {
+	succeeded := 0
+	for _, s := range result.Services {
+		if !s.Failed && !s.Skipped {
+			succeeded++
+		}
+	}
+	if succeeded == 0 {
+		return failures[0]
+	}
+	return &PartialError{Succeeded: succeeded, Errs: failures}
+}
+
+// writeArchive writes the files generated for the services in result, and the manifests of their output directories,
+// to the archive at path
+func writeArchive(path string, outputPath string, result Result) error {
+	root, err := filepath.Abs(outputPath)
+	if err != nil {
+		return fmt.Errorf("cannot resolve output path: %s", err.Error())
+	}
+	var outputs []util.ArchiveOutput
+	index := make(map[string]int)
+	for _, s := range result.Services {
+		dir, err := filepath.Abs(s.OutputPath)
+		if err != nil {
+			return fmt.Errorf("cannot resolve output path: %s", err.Error())
+		}
+		i, ok := index[dir]
+		if !ok {
+			i = len(outputs)
+			index[dir] = i
+			outputs = append(outputs, util.ArchiveOutput{Path: dir})
+		}
+		outputs[i].Services = append(outputs[i].Services, s.Service)
+	}
+	return util.WriteArchive(path, root, outputs)
+}
+
+// maxListedChanges is the number of uncommitted changes listed by requireClean
+const maxListedChanges = 5
+
+// requireClean returns an error if the output or its mirrors have uncommitted changes
+func requireClean(ctx context.Context, opts Options) error {
+	for _, output := range append([]string{opts.OutputPath}, opts.MirrorPaths...) {
+		changes, err := util.UncommittedChanges(ctx, output)
+		if err != nil {
+			return &Error{Phase: PhaseValidate, Err: err}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		listed := changes
+		if len(listed) > maxListedChanges {
+			listed = append(listed[:maxListedChanges:maxListedChanges], fmt.Sprintf("and %d more", len(changes)-maxListedChanges))
+		}
+		return &Error{Phase: PhaseValidate, Err: fmt.Errorf("The output '%s' has uncommitted changes: %s. Commit or discard them before generating", output, strings.Join(listed, ", "))}
+	}
+	return nil
+}
+
+// validateCache checks that a cache directory is given for the options that use it
+func validateCache(opts Options) error {
+	switch {
+	case opts.Offline && opts.CacheDir == "":
+		return errors.New("A cache directory must be given to run offline")
+	case opts.RefreshCache && opts.CacheDir == "":
+		return errors.New("A cache directory must be given to refresh the cache")
+	case opts.RefreshCache && opts.Offline:
+		return errors.New("The cache cannot be refreshed offline")
+	}
+	return nil
+}
+
+// validateOnlyScope checks that opts.OnlyPublic and opts.OnlyPrivate agree with the protobufs being generated
+func validateOnlyScope(opts Options) error {
+	switch {
+	case opts.OnlyPublic && opts.OnlyPrivate:
+		return errors.New("Only public and only private services cannot both be generated")
+	case opts.OnlyPublic && opts.Private:
+		return errors.New("Only public services cannot be generated from private protobufs")
+	case opts.OnlyPrivate && !opts.Private:
+		return errors.New("Only private services must be generated from private protobufs")
+	case opts.Proto != nil || opts.ProtoArtifactURL != "":
+		return errors.New("Services cannot be filtered when generating from a given protobuf or artifact")
+	}
+	return nil
+}
+
+// filterScope returns the services known to have a protobuf of the scope being generated, along with the results of
+// those skipped
+func filterScope(services []string, opts Options) ([]string, []ServiceResult) {
+	var kept []string
+	var skipped []ServiceResult
+	for _, s := range services {
+		if (opts.Private && util.IsValidPrivateService(s)) || (!opts.Private && util.IsValidPublicService(s)) {
+			kept = append(kept, s)
+			continue
+		}
+		skipped = append(skipped, ServiceResult{Service: s, Skipped: true, SkipReason: fmt.Sprintf("no %s protobuf defined", scope(opts.Private))})
+	}
+	return kept, skipped
+}
+
+// normalizeServices trims the services requested, removing empty and repeated entries. An empty list is returned when
+// every service is requested, and util.ServiceAll cannot be combined with other services.
+func normalizeServices(requested []string) ([]string, error) {
+	var services []string
+	seen := make(map[string]bool)
+	all := false
+	for _, s := range requested {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "" || seen[s]:
+			continue
+		case s == util.ServiceAll:
+			all = true
+		default:
+			services = append(services, s)
+		}
+		seen[s] = true
+	}
+
+	if all && len(services) > 0 {
+		return nil, fmt.Errorf("The service '%s' cannot be combined with other services", util.ServiceAll)
+	}
+	return services, nil
+}
+
+func (o Options) rpcFramework() string {
+	if o.RPCFramework == "" {
+		return util.DefaultRPCFramework
+	}
+	return o.RPCFramework
+}
+
+// servicePluginOpts returns the plugin options of service, with its own options of a plugin replacing the global ones
+func (o Options) servicePluginOpts(service string) map[string][]string {
+	overrides := o.ServicePluginOpts[service]
+	if len(overrides) == 0 {
+		return o.PluginOpts
+	}
+
+	merged := make(map[string][]string, len(o.PluginOpts)+len(overrides))
+	for name, opts := range o.PluginOpts {
+		merged[name] = opts
+	}
+	for name, opts := range overrides {
+		merged[name] = opts
+	}
+	return merged
+}
+
+// run holds the state shared by the services generated in a single call to Generate
+type run struct {
+	opts Options
+
+	// batch is true when multiple services are generated
+	batch bool
+
+	// banner is the template of the banner prepended to generated files, if any
+	banner *template.Template
+
+	// layout is the template of the output directory of each service, if any
+	layout *template.Template
+
+	// skipMissing skips services found to have no protobuf after cloning, instead of failing
+	skipMissing bool
+
+	// copied records which service wrote each file when output is merged, and is used to reject name collisions.
+	// copiedSHA256 records the sha256 of each of those files as generated, to find those shared by identical content
+	copied       map[string]string
+	copiedSHA256 map[string]string
+
+	// symbols records which service declared each package-level Go identifier when output is merged, keyed by
+	// <package>.<identifier>
+	symbols map[string]string
+
+	// proto3Optional caches whether protoc needs util.Proto3OptionalFlag, once it has been detected
+	proto3Optional *bool
+}
+
+// checkSymbols warns about package-level Go identifiers generated for service that another service already declared in
+// the same package of the merged output
+func (g *Generator) checkSymbols(r *run, service string, protoDir string) error {
+	symbols, err := util.GoSymbols(protoDir, r.opts.copyOptions())
+	if err != nil {
+		return err
+	}
+
+	pkgs := make([]string, 0, len(symbols))
+	for pkg := range symbols {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		for _, name := range symbols[pkg] {
+			key := pkg + "." + name
+			if other, ok := r.symbols[key]; ok && other != service {
+				g.logf("Warning: '%s' generated for service '%s' is also declared by service '%s' in package '%s'", name, service, other, pkg)
+				continue
+			}
+			r.symbols[key] = service
+		}
+	}
+	return nil
+}
+
+// needsProto3Optional reports whether protoc must be passed util.Proto3OptionalFlag. The protoc version is detected
+// once per run; if it cannot be determined, the flag is not passed.
+func (g *Generator) needsProto3Optional(ctx context.Context, r *run, opts util.GenerateOptions) bool {
+	if r.opts.Proto3Optional {
+		return true
+	}
+	if r.proto3Optional == nil {
+		needed := false
+		if major, minor, err := util.ProtocVersion(ctx, opts); err != nil {
+			g.logf("Warning: %s", err.Error())
+		} else {
+			needed = util.NeedsProto3OptionalFlag(major, minor)
+		}
+		r.proto3Optional = &needed
+	}
+	return *r.proto3Optional
+}
+
+func (o Options) cloneOptions() util.CloneOptions {
+	return util.CloneOptions{
+		Host:              o.Host,
+		Org:               o.Org,
+		ServiceHosts:      o.ServiceHosts,
+		ServiceOrgs:       o.ServiceOrgs,
+		RepoNames:         o.RepoNames,
+		URLTemplate:       o.cloneURLTemplate(),
+		Ref:               o.Ref,
+		Depth:             o.Depth,
+		Filter:            o.CloneFilter,
+		MaxSize:           o.MaxCloneSize,
+		RecurseSubmodules: o.RecurseSubmodules,
+		CacheDir:          o.CacheDir,
+		Offline:           o.Offline,
+		Refresh:           o.RefreshCache,
+		HTTPProxy:         o.HTTPProxy,
+		HTTPSProxy:        o.HTTPSProxy,
+	}
+}
+
+// cloneURLTemplate returns the parsed CloneURLTemplate, or nil if it is not set. It is validated before cloning
+func (o Options) cloneURLTemplate() *template.Template {
+	tmpl, _ := util.ParseCloneURLTemplate(o.CloneURLTemplate)
+	return tmpl
+}
+
+// source is a checkout of the repository holding the protobufs of a service
+type source struct {
+	// dir is the root of the checkout
+	dir string
+
+	// protoRoot is the directory holding the service's public/ and private/ protobuf directories
+	protoRoot string
+
+	// commit is the SHA of the commit checked out. A local source may not be a git repository, and an artifact is not
+	// one, so they have none
+	commit string
+}
+
+// checkout clones either the central protobuf repository or the source of service into tmpDir at opts.Ref, locates
+// the service in opts.LocalSource, or downloads the opts.ProtoArtifactURL into tmpDir
+func checkout(ctx context.Context, opts Options, service string, tmpDir string) (source, error) {
+	cloneOpts := opts.cloneOptions()
+
+	var src source
+	var err error
+	switch {
+	case opts.ProtoArtifactURL != "":
+		artifactOpts := util.ArtifactOptions{SHA256: opts.ProtoArtifactSHA256, HTTPProxy: opts.HTTPProxy, HTTPSProxy: opts.HTTPSProxy, MaxFileSize: opts.MaxFileSize}
+		if src.dir, err = util.DownloadArtifact(ctx, opts.ProtoArtifactURL, tmpDir, artifactOpts); err != nil {
+			return src, err
+		}
+		src.protoRoot = util.ArtifactProtoRoot(src.dir)
+		return src, nil
+	case opts.LocalSource != "":
+		// A local checkout is used as it is, in place of the clone
+		src.dir = opts.LocalSource
+		if opts.ProtoRepo != "" {
+			src.protoRoot = filepath.Join(src.dir, service)
+		} else {
+			src.protoRoot = filepath.Join(src.dir, "proto")
+		}
+	case opts.ProtoRepo != "":
+		org, repo := util.ParseRepository(opts.ProtoRepo)
+		if src.dir, err = util.CloneRepository(ctx, org, repo, tmpDir, cloneOpts); err != nil {
+			return src, err
+		}
+		src.protoRoot = filepath.Join(src.dir, service)
+	default:
+		if src.dir, err = util.CloneService(ctx, service, tmpDir, cloneOpts); err != nil {
+			return src, err
+		}
+		src.protoRoot = filepath.Join(src.dir, "proto")
+	}
+
+	src.commit, _ = util.RepositoryCommit(ctx, src.dir)
+	return src, nil
+}
+
+// generateService runs the generation workflow for a single service, writing its generated files to serviceOutputPath
+func (g *Generator) generateService(ctx context.Context, r *run, service string, serviceOutputPath string) (ServiceResult, error) {
+	opts := r.opts
+	opts.PluginOpts = opts.servicePluginOpts(service)
+	fail := func(phase Phase, err error) (ServiceResult, error) {
+		return ServiceResult{}, &Error{Service: service, Phase: phase, Err: err}
+	}
+
+	// The temporary directories are removed once done, which must not take the output with it. The output is checked
+	// before creating anything, as it can only be inside one that already exists, such as that of another run
+	mirrors, err := opts.mirrorPaths(serviceOutputPath)
+	if err != nil {
+		return fail(PhaseSetup, err)
+	}
+	for _, output := range append([]string{serviceOutputPath}, mirrors...) {
+		dir, err := util.TempDirOf(output, os.TempDir())
+		if err != nil {
+			return fail(PhaseSetup, err)
+		}
+		if dir != "" {
+			return fail(PhaseValidate, fmt.Errorf("The output '%s' is inside the temporary directory '%s', which is removed after generating. Choose an output outside of it", output, dir))
+		}
+	}
+
+	// Create temporary directory to download service source code to
+	tmpDir, err := os.MkdirTemp(os.TempDir(), util.TempDirPrefix)
+	if err != nil {
+		return fail(PhaseSetup, fmt.Errorf("cannot create temporary directory: %s", err.Error()))
+	}
+	defer func() {
+		if err := util.CleanUpDirectories(tmpDir); err != nil {
+			g.logf("Warning: %s", err.Error())
+		}
+	}()
+	g.logf("Created temporary directory %s", tmpDir)
+
+	// Create protobuf directory to hold .proto files
+	protoDir := filepath.Join(tmpDir, "proto")
+	err = os.Mkdir(protoDir, os.ModeDir)
+	if err != nil {
+		return fail(PhaseSetup, fmt.Errorf("cannot create protobuf directory: %s", err.Error()))
+	}
+
+	// Every later step refers to the protobuf by protoName
+	protoName := opts.protoName(service)
+	serviceProtoRoot, commit := "", ""
+	if opts.Proto != nil {
+		// A given protobuf is written to the proto directory in place of cloning
+		if err := util.WriteProtobuf(opts.Proto, protoName, protoDir, opts.MaxFileSize, opts.ProtoEncoding); err != nil {
+			return fail(PhaseProto, err)
+		}
+	} else {
+		// Clone either the central protobuf repository or the service source into temp directory
+		cloneCtx, cancelClone := phaseContext(ctx, opts.cloneTimeout())
+		src, err := checkout(cloneCtx, opts, service, tmpDir)
+		cancelClone()
+		if err != nil {
+			return fail(PhaseClone, timeoutError(cloneCtx, "clone", opts.cloneTimeout(), err))
+		}
+		serviceProtoRoot, commit = src.protoRoot, src.commit
+
+		// In discovery mode, whether the service has a protobuf is determined from the cloned repository
+		if opts.Discover && !util.HasProtobufs(serviceProtoRoot, opts.Private) {
+			if r.skipMissing {
+				return ServiceResult{Service: service, OutputPath: serviceOutputPath, Skipped: true, SkipReason: fmt.Sprintf("no %s protobuf defined", scope(opts.Private))}, nil
+			}
+			return fail(PhaseProto, fmt.Errorf("The service '%s' does not have a %s protobuf defined", service, scope(opts.Private)))
+		}
+
+		// Copy either public or private proto file into the proto directory
+		err = util.CopyProtobuf(protoName, serviceProtoRoot, protoDir, opts.Private, opts.MaxFileSize, opts.ProtoEncoding)
+		if err != nil {
+			return fail(PhaseProto, err)
+		}
+	}
+
+	// Rewrite imports that do not match the layout of the protobuf directory
+	if err := util.ReplaceImports(protoDir, opts.ReplaceImports); err != nil {
+		return fail(PhaseProto, err)
+	}
+
+	// Scope the packages of the protobufs by the service, so they cannot clash with those of other services
+	if opts.NormalizePackage {
+		renames, err := util.NormalizePackages(protoDir, service)
+		if err != nil {
+			return fail(PhaseProto, err)
+		}
+		var renamed []string
+		for old, scoped := range renames {
+			renamed = append(renamed, fmt.Sprintf("%s to %s", old, scoped))
+		}
+		sort.Strings(renamed)
+		for _, r := range renamed {
+			g.logf("Renamed package %s", r)
+		}
+	}
+
+	// Format the protobufs, so that those copied to the output with IncludeProto are tidy
+	if opts.FormatProto {
+		if err := g.formatProtos(ctx, protoDir); err != nil {
+			return fail(PhaseProto, err)
+		}
+	}
+
+	// Copy the imported well-known types alongside the protobufs, so that their code is generated into the output too
+	if opts.VendorWKT {
+		vendored, err := util.VendorWellKnownTypes(protoDir, util.GenerateOptions{ToolchainDir: opts.ToolchainDir, ImportPaths: opts.ImportPaths})
+		if err != nil {
+			return fail(PhaseProto, err)
+		}
+		if len(vendored) > 0 {
+			g.logf("Vendoring the well-known types %s", strings.Join(vendored, ", "))
+		}
+	}
+
+	// Skip regenerating the service if it was already generated into the output from the same protobufs and settings.
+	// The rendered banner is fingerprinted along with its template, as it can name the commit generated from
+	banner, err := r.renderBanner(service, commit)
+	if err != nil {
+		return fail(PhaseCopy, err)
+	}
+	fingerprint, err := util.ProtoFingerprint(protoDir, opts.generationSettings()+banner)
+	if err != nil {
+		return fail(PhaseProto, err)
+	}
+	if opts.Incremental && !opts.ListFiles && !opts.Diff {
+		manifest, err := util.ReadManifest(serviceOutputPath)
+		if err != nil {
+			return fail(PhaseCopy, err)
+		}
+		if manifest.IsUpToDate(serviceOutputPath, service, fingerprint) {
+			result := ServiceResult{Service: service, OutputPath: serviceOutputPath, Commit: commit, Skipped: true, SkipReason: fmt.Sprintf("up to date in %s", serviceOutputPath)}
+			for _, f := range manifest.ServiceFiles(service) {
+				result.Files = append(result.Files, f.Name)
+			}
+			return result, nil
+		}
+	}
+
+	// Lint the copied protobufs with buf if requested, it is installed and the service has configured it
+	if opts.BufLint && !opts.SkipBufLint && serviceProtoRoot != "" {
+		if err := g.bufLint(ctx, protoDir, serviceProtoRoot, opts.Private); err != nil {
+			return fail(PhaseProto, err)
+		}
+	}
+
+	genOpts := util.GenerateOptions{
+		Logger:          g.Logger,
+		RPCFramework:    opts.RPCFramework,
+		MessagesOnly:    opts.MessagesOnly,
+		PluginOpts:      opts.PluginOpts,
+		PluginPaths:     opts.PluginPaths,
+		SeparatePlugins: opts.SeparatePlugins,
+		NoStreaming:     opts.NoStreaming,
+		FailOnWarning:   opts.FailOnWarning,
+		ToolchainDir:    opts.ToolchainDir,
+		WorkDir:         opts.ProtocWorkDir,
+		DockerImage:     opts.DockerImage,
+		ImportPaths:     opts.ImportPaths,
+		Env:             opts.Env,
+		GRPCGateway:     opts.GRPCGateway,
+		SplitByProto:    opts.SplitByProto,
+		Retries:         opts.GenerateRetries,
+	}
+	genOpts.Proto3Optional = g.needsProto3Optional(ctx, r, genOpts)
+
+	// Point the imports of the generated Go code at the packages of the module the output is in
+	if opts.GoModuleImports {
+		mappings, err := util.GoImportMappings(protoDir, serviceOutputPath, opts.TrimPrefix, opts.SplitByProto)
+		if err != nil {
+			return fail(PhaseSetup, err)
+		}
+		genOpts.PluginOpts = util.WithGoImportMappings(opts.PluginOpts, mappings)
+	}
+
+	// Every protoc invocation of the service is bounded by the generate timeout
+	genCtx, cancelGenerate := phaseContext(ctx, opts.generateTimeout())
+	defer cancelGenerate()
+	failGenerate := func(err error) (ServiceResult, error) {
+		return fail(PhaseGenerate, timeoutError(genCtx, "generation", opts.generateTimeout(), err))
+	}
+
+	// Generate from the protobufs compiled once for every language
+	if opts.ReuseDescriptor {
+		descriptor, err := g.inputDescriptorSet(genCtx, opts, service, protoName, protoDir, tmpDir, genOpts)
+		if err != nil {
+			return failGenerate(err)
+		}
+		genOpts.DescriptorSetIn = descriptor
+	}
+
+	// Compile the descriptor set of the service to check it for breaking changes, or write it out
+	if opts.BreakingCheck || opts.DescriptorSetOut != "" {
+		descriptor := filepath.Join(tmpDir, fmt.Sprintf("%s.pb", service))
+		if err := util.GenerateDescriptorSet(genCtx, protoName, protoDir, descriptor, genOpts); err != nil {
+			return failGenerate(err)
+		}
+
+		if opts.BreakingCheck {
+			if err := util.BufBreaking(ctx, descriptor, descriptorPath(opts.Baseline, service, r.batch)); err != nil {
+				return fail(PhaseProto, err)
+			}
+		}
+
+		if opts.DescriptorSetOut != "" {
+			out := descriptorPath(opts.DescriptorSetOut, service, r.batch)
+			if opts.DescriptorGzip && r.batch {
+				out += ".gz"
+			}
+			if err := util.CopyDescriptorSet(descriptor, out, opts.DescriptorGzip); err != nil {
+				return fail(PhaseCopy, err)
+			}
+		}
+	}
+
+	// Generate from the compiled protobufs with the methods that were not selected stripped, so that only the client of
+	// those selected is generated. The descriptor written out and checked for breaking changes above is left whole
+	if len(opts.Methods) > 0 {
+		descriptor := genOpts.DescriptorSetIn
+		if descriptor == "" {
+			descriptor = filepath.Join(tmpDir, fmt.Sprintf("%s-inputs.pb", service))
+			if err := util.CompileDescriptorSet(genCtx, protoName, protoDir, descriptor, genOpts); err != nil {
+				return failGenerate(err)
+			}
+		}
+		filtered := filepath.Join(tmpDir, fmt.Sprintf("%s-methods.pb", service))
+		if err := util.FilterMethods(descriptor, filtered, opts.Methods); err != nil {
+			return fail(PhaseProto, err)
+		}
+		genOpts.DescriptorSetIn = filtered
+	}
+
+	// Generate client code based on lanaguage
+	err = util.GenerateCode(genCtx, opts.Language, protoName, protoDir, genOpts)
+	if err != nil {
+		return failGenerate(err)
+	}
+
+	// Generate mocks of the generated RPC interfaces if requested
+	if opts.WithMocks {
+		err = util.GenerateMocks(genCtx, opts.Language, protoName, protoDir, genOpts)
+		if err != nil {
+			return failGenerate(err)
+		}
+	}
+
+	// Embed the default endpoint of the service in the generated clients if requested
+	if opts.DefaultEndpoint != "" {
+		if err := util.GenerateDefaultEndpoint(opts.Language, protoName, protoDir, opts.DefaultEndpoint); err != nil {
+			return failGenerate(err)
+		}
+	}
+
+	// Generate an OpenAPI specification alongside the client code if requested
+	if opts.OpenAPI {
+		err = util.GenerateOpenAPI(genCtx, protoName, protoDir, genOpts)
+		if err != nil {
+			return failGenerate(err)
+		}
+	}
+
+	// Generate documentation of the protobufs alongside the client code if requested
+	if opts.Docs {
+		if err := util.GenerateDocs(genCtx, protoName, opts.docsFormat(), protoDir, genOpts); err != nil {
+			return failGenerate(err)
+		}
+	}
+
+	// Check the generated code compiles before it is copied to the output
+	if opts.VerifyCompile {
+		if err := util.VerifyCompile(genCtx, opts.Language, protoDir, opts.copyOptions(), genOpts); err != nil {
+			return failGenerate(err)
+		}
+	}
+
+	// When several services share one output directory, refuse to overwrite another service's generated files
+	var shared []string
+	if serviceOutputPath == opts.OutputPath {
+		listOpts := opts.copyOptions()
+		listOpts.ChangedOnly = false
+		files, err := util.ListGeneratedFiles(protoDir, serviceOutputPath, listOpts)
+		if err != nil {
+			return fail(PhaseCopy, err)
+		}
+
+		for _, f := range files {
+			other, ok := r.copied[f.Name]
+			switch {
+			case !ok:
+				r.copied[f.Name] = service
+				r.copiedSHA256[f.Name] = f.SHA256
+			case r.copiedSHA256[f.Name] != f.SHA256:
+				return fail(PhaseCopy, fmt.Errorf("generated file '%s' collides with the output of service '%s'", f.Name, other))
+			case !opts.DedupeShared:
+				return fail(PhaseCopy, fmt.Errorf("generated file '%s' collides with the identical output of service '%s'. Shared files can be deduplicated to copy them once", f.Name, other))
+			default:
+				shared = append(shared, f.Name)
+			}
+		}
+
+		// Files shared with a service generated before are left to it, and not copied again
+		if len(shared) > 0 {
+			g.logf("Sharing %s with the services that generated them first", strings.Join(shared, ", "))
+			if err := util.DropGeneratedFiles(protoDir, shared, listOpts); err != nil {
+				return fail(PhaseCopy, err)
+			}
+		}
+
+		// Identically named files are rejected above, but Go files merged into one package can still declare the
+		// same identifiers and fail to compile
+		if opts.Language == util.LanguageGo {
+			if err := g.checkSymbols(r, service, protoDir); err != nil {
+				return fail(PhaseCopy, err)
+			}
+		}
+	}
+
+	copyOpts := opts.copyOptions()
+	copyOpts.Banner = banner
+
+	// Only report the files that would be copied when listing them
+	if opts.ListFiles {
+		listed, err := util.ListGeneratedFiles(protoDir, serviceOutputPath, copyOpts)
+		if err != nil {
+			return fail(PhaseCopy, err)
+		}
+
+		result := ServiceResult{Service: service, OutputPath: serviceOutputPath, Commit: commit, FileSizes: make(map[string]int64)}
+		for _, f := range listed {
+			result.Files = append(result.Files, f.Name)
+			result.FileSizes[f.Name] = f.Size
+			result.Bytes += f.Size
+			result.count(f)
+		}
+		return result, nil
+	}
+
+	// Only report how the files would change the output when diffing them
+	if opts.Diff {
+		diffs, err := util.DiffGeneratedFiles(protoDir, serviceOutputPath, copyOpts)
+		if err != nil {
+			return fail(PhaseCopy, err)
+		}
+
+		result := ServiceResult{Service: service, OutputPath: serviceOutputPath, Commit: commit, Diffs: diffs}
+		for _, d := range diffs {
+			result.Files = append(result.Files, d.Name)
+			result.Changed = append(result.Changed, d.Name)
+			if d.Status == util.FileCreated {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+		}
+		return result, nil
+	}
+
+	result := ServiceResult{Service: service, OutputPath: serviceOutputPath, Commit: commit, Shared: shared}
+	files, deleted, err := g.writeOutput(r, service, protoDir, serviceOutputPath, copyOpts, fingerprint, shared)
+	if err != nil {
+		return fail(PhaseCopy, err)
+	}
+	for _, f := range files {
+		result.Files = append(result.Files, f.Name)
+		result.Bytes += f.Size
+		result.count(f)
+	}
+	result.Deleted = deleted
+
+	// Mirrors receive the same files, and are cleaned and recorded like the output
+	for _, mirror := range mirrors {
+		if _, _, err := g.writeOutput(r, service, protoDir, mirror, copyOpts, fingerprint, shared); err != nil {
+			return fail(PhaseCopy, fmt.Errorf("mirror '%s': %s", mirror, err.Error()))
+		}
+		result.MirrorPaths = append(result.MirrorPaths, mirror)
+	}
+
+	return result, nil
+}
+
+// writeOutput copies the generated files of service in protoDir to outputPath, removing stale files with Options.Clean,
+// and records them in the output's manifest along with the shared files another service already wrote. It returns the
+// copied files and the names of those removed
+func (g *Generator) writeOutput(r *run, service string, protoDir string, outputPath string, copyOpts util.CopyOptions, fingerprint string, shared []string) ([]util.CopiedFile, []string, error) {
+	opts := r.opts
+	// The output is resolved once, so that the lock, the manifest and the copied files all refer to the same directory
+	outputPath, err := filepath.Abs(outputPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot resolve output path: %s", err.Error())
+	}
+	if err := os.MkdirAll(outputPath, 0755); err != nil {
+		return nil, nil, fmt.Errorf("cannot create output directory: %s", err.Error())
+	}
+
+	// Lock the output directory so concurrent runs targeting it cannot interleave their writes
+	lock, err := util.LockOutput(outputPath, opts.WaitLock)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer lock.Unlock()
+
+	manifest, err := util.ReadManifest(outputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := util.CopyGeneratedFiles(protoDir, outputPath, copyOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Shared files are recorded for every service generating them, so that none of them removes the file as stale
+	recorded := append([]util.CopiedFile(nil), files...)
+	for _, name := range shared {
+		f, err := util.OutputFile(outputPath, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		recorded = append(recorded, f)
+	}
+
+	// Remove files generated by a previous run that are no longer generated
+	var deleted []string
+	if opts.Clean {
+		if deleted, err = util.RemoveStaleFiles(outputPath, manifest, service, recorded); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Record the generated files in the manifest of the output directory
+	manifest.Language = opts.Language
+	manifest.SetServiceFiles(service, recorded)
+	manifest.SetInputs(service, fingerprint)
+	if err := util.WriteManifest(outputPath, manifest); err != nil {
+		return nil, nil, err
+	}
+	if opts.WriteGitignore {
+		if err := util.WriteGitignore(outputPath, manifest); err != nil {
+			return nil, nil, err
+		}
+	}
+	return files, deleted, nil
+}
+
+// bufLint lints the protobufs in protoDir with the buf.yaml of the service, searched for in its public/private protobuf
+// directory, the directory holding those, and the repository root. Linting is skipped if buf or buf.yaml are missing.
+func (g *Generator) bufLint(ctx context.Context, protoDir string, serviceProtoRoot string, private bool) error {
+	config := util.FindBufConfig(filepath.Join(serviceProtoRoot, scope(private)), serviceProtoRoot, filepath.Dir(serviceProtoRoot))
+	if config == "" {
+		return nil
+	}
+	if !util.BufAvailable() {
+		g.logf("Skipping buf lint: buf is not installed")
+		return nil
+	}
+
+	g.logf("Linting protobufs with %s", config)
+	return util.BufLint(ctx, protoDir, config)
+}
+
+// formatProtos formats the protobufs in protoDir with the first formatter installed. Formatting is skipped if there is
+// none.
+func (g *Generator) formatProtos(ctx context.Context, protoDir string) error {
+	formatter := util.FindProtoFormatter()
+	if formatter == "" {
+		g.logf("Skipping protobuf formatting: neither %s nor %s is installed", util.FormatterBuf, util.FormatterClangFormat)
+		return nil
+	}
+
+	g.logf("Formatting protobufs with %s", formatter)
+	return util.FormatProtos(ctx, protoDir, formatter)
+}
+
+// mirrorPaths returns the directories of MirrorPaths the files written to serviceOutputPath are also written to
+func (o Options) mirrorPaths(serviceOutputPath string) ([]string, error) {
+	rel, err := filepath.Rel(o.OutputPath, serviceOutputPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve the output of mirrors: %s", err.Error())
+	}
+	mirrors := make([]string, 0, len(o.MirrorPaths))
+	for _, m := range o.MirrorPaths {
+		mirrors = append(mirrors, filepath.Join(m, rel))
+	}
+	return mirrors, nil
+}
+
+// validateMirrors checks that the mirrors of the output are given, and that no two outputs overlap, as each is
+// cleaned and locked on its own
+func validateMirrors(opts Options) error {
+	outputs := append([]string{opts.OutputPath}, opts.MirrorPaths...)
+	for i, m := range opts.MirrorPaths {
+		if m == "" {
+			return errors.New("The path of a mirror of the output cannot be empty")
+		}
+		for _, other := range outputs[:i+1] {
+			overlap, err := util.PathsOverlap(m, other)
+			if err != nil {
+				return err
+			}
+			if overlap {
+				return fmt.Errorf("The outputs '%s' and '%s' overlap. Each output must be a separate directory", other, m)
+			}
+		}
+	}
+	return nil
+}
+
+// docsFormat returns the format documentation is generated in
+func (o Options) docsFormat() string {
+	if o.DocsFormat == "" {
+		return util.DocsMarkdown
+	}
+	return o.DocsFormat
+}
+
+// protoName returns the base name the protobuf of service is copied to
+func (o Options) protoName(service string) string {
+	if name, ok := o.ProtoNames[service]; ok && name != "" {
+		return strings.TrimSuffix(name, ".proto")
+	}
+	return service
+}
+
+func (o Options) copyOptions() util.CopyOptions {
+	opts := util.CopyOptions{
+		MaxFileSize:  o.MaxFileSize,
+		TrimPrefix:   o.TrimPrefix,
+		IncludeProto: o.IncludeProto,
+		ChangedOnly:  o.ChangedOnly,
+
+		Extensions:        o.Extensions,
+		ExcludeExtensions: o.ExcludeExtensions,
+	}
+	// Both are validated before generating
+	if o.OutputMode != "" {
+		opts.Mode, _ = util.ParseFileMode(o.OutputMode)
+	}
+	if o.OutputOwner != "" {
+		opts.Owner, _ = util.ParseFileOwner(o.OutputOwner)
+	}
+	return opts
+}
+
+// generationSettings returns a description of the options affecting generated code, used to fingerprint the inputs of a
+// generation. Options that change what is generated must be included.
+func (o Options) generationSettings() string {
+	return fmt.Sprint(o.Language, o.Private, o.rpcFramework(), o.MessagesOnly, o.PluginOpts, o.WithMocks, o.DefaultEndpoint, o.OpenAPI, o.Docs, o.docsFormat(), o.GRPCGateway, o.VendorWKT, o.NormalizePackage, o.GoModuleImports, o.SplitByProto, o.IncludeProto, o.Extensions, o.ExcludeExtensions, o.Env, o.ProtoNames, o.NoStreaming, o.Banner, o.ImportPaths, o.TrimPrefix, o.PluginPaths, o.ToolchainDir, o.DockerImage, o.Proto3Optional, o.OutputMode, o.OutputOwner, o.DedupeShared, o.Methods)
+}
+
+// scope returns the name of the protobuf directory used for private or public protobufs
+func scope(private bool) string {
+	if private {
+		return "private"
+	}
+	return "public"
+}
+
+// descriptorPath returns the descriptor file of service at path. When generating multiple services path is a directory
+// holding a descriptor per service.
+func descriptorPath(path string, service string, batch bool) string {
+	if batch {
+		return filepath.Join(path, fmt.Sprintf("%s.pb", service))
+	}
+	return path
+}
+
+// validateArtifact checks that the services can be generated from opts.ProtoArtifactURL
+func validateArtifact(opts Options, services []string) error {
+	switch {
+	case len(services) != 1:
+		return errors.New("Exactly one service must be given to generate from a protobuf artifact")
+	case opts.LocalSource != "" || opts.Proto != nil || opts.ProtoRepo != "":
+		return errors.New("A protobuf artifact cannot be combined with a local source, a protobuf or a protobuf repository")
+	case opts.Offline:
+		return errors.New("A protobuf artifact cannot be downloaded offline")
+	case opts.ProtoArtifactSHA256 == "":
+		return errors.New("The SHA-256 checksum of the protobuf artifact must be given")
+	}
+	if err := util.ValidateSHA256(opts.ProtoArtifactSHA256); err != nil {
+		return err
+	}
+	return util.ValidateArtifactURL(opts.ProtoArtifactURL)
+}
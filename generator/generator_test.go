@@ -0,0 +1,2106 @@
+package generator
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// fakeProtoc is a protoc that writes a file for each plugin output, holding the plugin argument without its output
+// directory. Its arguments are recorded in $FAKE_PROTOC_LOG when set
+const fakeProtoc = `[ -z "$FAKE_PROTOC_LOG" ] || echo "$@" >> "$FAKE_PROTOC_LOG"
+if [ "$1" = "--version" ]; then echo "libprotoc 3.19.4"; exit 0; fi
+for a in "$@"; do
+  case "$a" in
+    --descriptor_set_out=*) echo descriptor > "${a#*=}";;
+    --*_out=*)
+      name=${a%%_out=*}; name=${name#--}
+      dir=${a#*_out=}; dir=${dir##*:}
+      echo "// generated by ${a%"$dir"}" > "$dir/search_$name.txt";;
+  esac
+done
+`
+
+const searchProto = `syntax = "proto3";
+
+package search.v1;
+
+service Search {
+  rpc Query(QueryRequest) returns (QueryResponse);
+}
+
+message QueryRequest {
+  string query = 1;
+}
+
+message QueryResponse {
+  repeated string results = 1;
+}
+`
+
+// fakeCommand installs an executable shell script named name, running script, first on the PATH for the rest of the
+// test
+func fakeCommand(t *testing.T, name string, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// setenv sets the environment variable key to value for the rest of the test
+func setenv(t *testing.T, key string, value string) {
+	t.Helper()
+	previous, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// chdir changes the working directory to dir for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// writeFile writes data to the slash separated name under dir, creating its directories
+func writeFile(t *testing.T, dir string, name string, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setupGeneration installs fakeProtoc, rewrites the Github URLs of the org and util.DefaultOrg organizations to an empty
+// directory of remotes, and moves to an empty working directory
+func setupGeneration(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remotes := t.TempDir()
+	setenv(t, "TEST_REMOTES", remotes)
+	setenv(t, "GIT_CONFIG_COUNT", "3")
+	setenv(t, "GIT_CONFIG_KEY_0", "protocol.file.allow")
+	setenv(t, "GIT_CONFIG_VALUE_0", "always")
+	for i, org := range []string{"org", util.DefaultOrg} {
+		setenv(t, fmt.Sprintf("GIT_CONFIG_KEY_%d", i+1), "url.file://"+filepath.ToSlash(remotes)+"/.insteadOf")
+		setenv(t, fmt.Sprintf("GIT_CONFIG_VALUE_%d", i+1), "git@github.com:"+org+"/")
+	}
+	fakeCommand(t, "protoc", fakeProtoc)
+	chdir(t, t.TempDir())
+}
+
+// git runs git with args in dir, failing the test on error and returning its trimmed output
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// remoteRepository creates the repository repo among the remotes with a commit of files, keyed by their slash separated
+// paths, on its main branch
+func remoteRepository(t *testing.T, repo string, files map[string]string) {
+	t.Helper()
+	remotes := os.Getenv("TEST_REMOTES")
+	dir := filepath.Join(remotes, repo+".git")
+	git(t, remotes, "init", "--quiet", "--initial-branch=main", dir)
+	for name, data := range files {
+		writeFile(t, dir, name, data)
+	}
+	git(t, dir, "add", "-A")
+	git(t, dir, "commit", "--quiet", "-m", "main")
+}
+
+// searchRepository creates the source repository of search, holding its public protobuf
+func searchRepository(t *testing.T) {
+	t.Helper()
+	remoteRepository(t, "search", map[string]string{"proto/public/search.proto": searchProto})
+}
+
+// protocLog records the arguments of every protoc invocation for the rest of the test, returning the path of the log
+func protocLog(t *testing.T) string {
+	t.Helper()
+	log := filepath.Join(t.TempDir(), "protoc.log")
+	setenv(t, "FAKE_PROTOC_LOG", log)
+	return log
+}
+
+// protocCalls returns the protoc invocations recorded in log, apart from version checks
+func protocCalls(t *testing.T, log string) []string {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line != "" && line != "--version" {
+			calls = append(calls, line)
+		}
+	}
+	return calls
+}
+
+// localSource writes a checkout of a service repository holding the public protobuf of search, returning its path
+func localSource(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, dir, "proto/public/search.proto", searchProto)
+	return dir
+}
+
+// searchOptions returns the options generating the search service into output
+func searchOptions(output string) Options {
+	return Options{Services: []string{"search"}, Language: "golang", OutputPath: output}
+}
+
+// readDir returns the names of the files in dir apart from the manifest, failing the test on error
+func readDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Name() != util.ManifestName {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// generateSearch generates the search service with opts, failing the test on error
+func generateSearch(t *testing.T, g *Generator, opts Options) ServiceResult {
+	t.Helper()
+	result, err := g.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("generation failed: %s", err)
+	}
+	if len(result.Services) != 1 {
+		t.Fatalf("got %d service results, want 1", len(result.Services))
+	}
+	return result.Services[0]
+}
+
+func TestGenerateFromProtoRepo(t *testing.T) {
+	setupGeneration(t)
+	remoteRepository(t, "protos", map[string]string{"search/public/search.proto": searchProto})
+
+	opts := searchOptions("out")
+	opts.ProtoRepo = "org/protos"
+	generateSearch(t, &Generator{}, opts)
+
+	if _, err := os.Stat(filepath.Join("out", "search_go.txt")); err != nil {
+		t.Fatalf("the protobuf of the central repository was not generated: %s", err)
+	}
+}
+
+func TestGenerateOpenAPI(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.OpenAPI = true
+	generateSearch(t, &Generator{}, opts)
+
+	if _, err := os.Stat(filepath.Join("out", "search_openapiv2.txt")); err != nil {
+		t.Errorf("the OpenAPI specification was not copied: %s", err)
+	}
+}
+
+// centralRepository creates a central protobuf repository holding the public protobufs of search and query
+func centralRepository(t *testing.T) {
+	t.Helper()
+	remoteRepository(t, "protos", map[string]string{
+		"search/public/search.proto": searchProto,
+		"query/public/query.proto":   strings.Replace(searchProto, "search.v1", "query.v1", 1),
+	})
+}
+
+// batchOptions returns the options generating search and query from the central repository into output
+func batchOptions(output string) Options {
+	opts := searchOptions(output)
+	opts.Services = []string{"search", "query"}
+	opts.ProtoRepo = "org/protos"
+	return opts
+}
+
+func TestGenerateBatchOutputPerService(t *testing.T) {
+	setupGeneration(t)
+	centralRepository(t)
+	opts := batchOptions("out")
+	opts.OutputPerService = true
+
+	result, err := (&Generator{}).Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("batch generation failed: %s", err)
+	}
+	if len(result.Services) != 2 {
+		t.Fatalf("generated %d services, want 2", len(result.Services))
+	}
+	for _, s := range opts.Services {
+		if _, err := os.Stat(filepath.Join("out", s, "search_go.txt")); err != nil {
+			t.Errorf("service %s was not generated into its own directory: %s", s, err)
+		}
+	}
+}
+
+func TestGenerateBatchMergedCollision(t *testing.T) {
+	setupGeneration(t)
+	centralRepository(t)
+
+	_, err := (&Generator{}).Generate(context.Background(), batchOptions("out"))
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseCopy || !strings.Contains(err.Error(), "collides with the identical output of service 'search'") {
+		t.Fatalf("expected the files of both services to collide in the merged output, got %v", err)
+	}
+}
+
+func TestGenerateMessagesOnly(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.MessagesOnly = true
+	generateSearch(t, &Generator{}, opts)
+
+	if files := readDir(t, "out"); strings.Join(files, ",") != "search_go.txt" {
+		t.Fatalf("expected only the messages to be generated, got %q", files)
+	}
+}
+
+func TestGenerateCancelled(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	fakeCommand(t, "protoc", `if [ "$1" = "--version" ]; then echo "libprotoc 3.19.4"; exit 0; fi
+exec sleep 10
+`)
+	root := t.TempDir()
+	setenv(t, "TMPDIR", root)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := (&Generator{}).Generate(ctx, searchOptions("out")); err == nil {
+		t.Fatal("the cancelled generation succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("protoc was not killed on cancellation, generation took %s", elapsed)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("the temporary directories were not removed: %d left", len(entries))
+	}
+}
+
+func TestGenerateRPCFramework(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.RPCFramework = util.RPCFrameworkGRPC
+	generateSearch(t, &Generator{}, opts)
+
+	if files := readDir(t, "out"); strings.Join(files, ",") != "search_go-grpc.txt,search_go.txt" {
+		t.Fatalf("expected the gRPC plugin to replace twirp, got %q", files)
+	}
+
+	opts.Language = util.LanguageJava
+	opts.RPCFramework = util.RPCFrameworkTwirp
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Fatalf("expected twirp for java to be refused, got %v", err)
+	}
+}
+
+// recordingLogger records the messages it is given
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func TestGenerateResult(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	logger := &recordingLogger{}
+	g := Generator{Logger: logger}
+	s := generateSearch(t, &g, searchOptions("out"))
+
+	if s.Service != "search" || s.OutputPath != "out" || strings.Join(s.Files, ",") != "search_go.txt,search_twirp.txt" {
+		t.Errorf("unexpected service result %+v", s)
+	}
+	if !strings.Contains(strings.Join(logger.messages, "\n"), "Created temporary directory") {
+		t.Errorf("the progress was not logged: %q", logger.messages)
+	}
+
+	// Invalid options are reported as validation errors before anything is done
+	opts := searchOptions("out")
+	opts.Language = "cobol"
+	_, err := g.Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Fatalf("expected a validation error for an unknown language, got %v", err)
+	}
+}
+
+func TestGenerateBreakingCheck(t *testing.T) {
+	setupGeneration(t)
+	fakeCommand(t, "buf", `echo 'search.proto:5:3:Field "1" on message "QueryRequest" was deleted.'
+exit 100
+`)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.BreakingCheck = true
+
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Fatalf("expected a breaking check without a baseline to be refused, got %v", err)
+	}
+
+	opts.Baseline = writeFile(t, t.TempDir(), "baseline.bin", "descriptor")
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	if !errors.As(err, &genErr) || !strings.Contains(err.Error(), "breaking changes detected") {
+		t.Fatalf("expected the breaking changes to fail generation, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("out", "search_go.txt")); err == nil {
+		t.Error("the client was generated despite the breaking changes")
+	}
+}
+
+func TestGeneratePluginOpts(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.PluginOpts = map[string][]string{"go": {"module=example.com/x"}, "twirp": {"a=b", "c=d"}}
+	generateSearch(t, &Generator{}, opts)
+
+	for file, want := range map[string]string{"search_go.txt": "--go_out=paths=source_relative,module=example.com/x:", "search_twirp.txt": "--twirp_out=paths=source_relative,a=b,c=d:"} {
+		data, err := os.ReadFile(filepath.Join("out", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s was not generated with %s: %q", file, want, data)
+		}
+	}
+}
+
+func TestGenerateSummaryCounts(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	g := Generator{}
+	opts := searchOptions("out")
+
+	type counts struct{ created, updated, unchanged, deleted int }
+	check := func(r ServiceResult, want counts) {
+		t.Helper()
+		got := counts{r.Created, r.Updated, r.Unchanged, len(r.Deleted)}
+		if got != want {
+			t.Fatalf("got %+v, want %+v", got, want)
+		}
+	}
+
+	// The first run creates a file per plugin
+	check(generateSearch(t, &g, opts), counts{created: 2})
+
+	// Nothing changes when regenerating
+	check(generateSearch(t, &g, opts), counts{unchanged: 2})
+
+	// A file edited in the output is overwritten
+	writeFile(t, "out", "search_go.txt", "edited\n")
+	check(generateSearch(t, &g, opts), counts{updated: 1, unchanged: 1})
+
+	// Without the twirp plugin, its file is deleted when cleaning
+	opts.MessagesOnly = true
+	opts.Clean = true
+	r := generateSearch(t, &g, opts)
+	check(r, counts{unchanged: 1, deleted: 1})
+	if r.Deleted[0] != "search_twirp.txt" {
+		t.Fatalf("deleted %v, want search_twirp.txt", r.Deleted)
+	}
+	if _, err := os.Stat(filepath.Join("out", "search_twirp.txt")); err == nil {
+		t.Fatal("stale file was not deleted")
+	}
+	if want := "search: 0 files created, 0 updated, 1 unchanged, 1 deleted"; !strings.HasPrefix(r.Summary(), want) {
+		t.Fatalf("got summary %q, want it to start with %q", r.Summary(), want)
+	}
+}
+
+func TestGeneratePluginPaths(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.PluginPaths = map[string]string{"twirp": "/opt/bin/protoc-gen-twirp-custom"}
+	generateSearch(t, &Generator{}, opts)
+
+	calls := protocCalls(t, log)
+	if len(calls) != 1 {
+		t.Fatalf("unexpected protoc calls %q", calls)
+	}
+	if !strings.Contains(calls[0], "--plugin=protoc-gen-twirp=/opt/bin/protoc-gen-twirp-custom --twirp_out=") {
+		t.Errorf("protoc was not run with the custom twirp plugin: %q", calls[0])
+	}
+	if strings.Contains(calls[0], "--plugin=protoc-gen-go=") {
+		t.Errorf("protoc was run with a custom go plugin: %q", calls[0])
+	}
+}
+
+func TestGenerateSeparatePlugins(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.SeparatePlugins = true
+	generateSearch(t, &Generator{}, opts)
+
+	calls := protocCalls(t, log)
+	if len(calls) != 2 || !strings.Contains(calls[0], "--go_out=") || strings.Contains(calls[0], "--twirp_out=") ||
+		!strings.Contains(calls[1], "--twirp_out=") || strings.Contains(calls[1], "--go_out=") {
+		t.Fatalf("protoc was not run once per plugin: %q", calls)
+	}
+
+	// A failure is attributed to the plugin that produced it
+	fakeCommand(t, "protoc", `case "$*" in *--twirp_out=*) echo "twirp crashed" >&2; exit 1;; esac
+`+fakeProtoc)
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "plugin 'twirp' failed") {
+		t.Errorf("expected the twirp plugin to be reported as failing, got %v", err)
+	}
+}
+
+func TestGenerateDiscover(t *testing.T) {
+	setupGeneration(t)
+	remoteRepository(t, "protos", map[string]string{"search/private/search.proto": searchProto})
+	opts := searchOptions("out")
+	opts.ProtoRepo = "org/protos"
+	opts.Private = true
+
+	// search is not known to have a private protobuf
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Fatalf("expected the unknown private protobuf to be refused, got %v", err)
+	}
+
+	opts.Discover = true
+	generateSearch(t, &Generator{}, opts)
+
+	opts.Services = []string{"query"}
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseProto || !strings.Contains(err.Error(), "does not have a private protobuf defined") {
+		t.Fatalf("expected the missing protobuf to be found after cloning, got %v", err)
+	}
+}
+
+func TestGenerateIncludeProto(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	generateSearch(t, &Generator{}, opts)
+	if _, err := os.Stat(filepath.Join("out", "search.proto")); err == nil {
+		t.Fatal("the protobuf was copied without being requested")
+	}
+
+	opts.IncludeProto = true
+	s := generateSearch(t, &Generator{}, opts)
+	data, err := os.ReadFile(filepath.Join("out", "search.proto"))
+	if err != nil {
+		t.Fatalf("the protobuf was not copied: %s", err)
+	}
+	if string(data) != searchProto {
+		t.Errorf("the copied protobuf differs from the source: %q", data)
+	}
+	if !strings.Contains(strings.Join(s.Files, ","), "search.proto") {
+		t.Errorf("the protobuf is not among the files of the result: %q", s.Files)
+	}
+}
+
+func TestGenerateReplaceImports(t *testing.T) {
+	setupGeneration(t)
+	src := t.TempDir()
+	writeFile(t, src, "proto/public/search.proto", strings.Replace(searchProto, "package search.v1;", "package search.v1;\n\nimport \"github.com/org/protos/page.proto\";", 1))
+
+	opts := searchOptions("out")
+
+	opts.LocalSource = src
+	opts.IncludeProto = true
+	opts.ReplaceImports = map[string]string{"github.com/org/protos/": "common/"}
+	generateSearch(t, &Generator{}, opts)
+
+	data, err := os.ReadFile(filepath.Join("out", "search.proto"))
+	if err != nil {
+		t.Fatalf("the protobuf was not copied: %s", err)
+	}
+	if !strings.Contains(string(data), "import \"common/page.proto\";") || strings.Contains(string(data), "github.com/org/protos/") {
+		t.Errorf("the import was not rewritten before generating: %q", data)
+	}
+}
+
+func TestGenerateImportPaths(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	shared := t.TempDir()
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.ImportPaths = []string{shared, "third_party", shared}
+	generateSearch(t, &Generator{}, opts)
+
+	calls := protocCalls(t, log)
+	if len(calls) != 1 {
+		t.Fatalf("unexpected protoc calls %q", calls)
+	}
+	var paths []string
+	for _, arg := range strings.Fields(calls[0]) {
+		if strings.HasPrefix(arg, "--proto_path=") {
+			paths = append(paths, strings.TrimPrefix(arg, "--proto_path="))
+		}
+	}
+	// protoc runs in the protobuf directory, so relative import paths are resolved from the working directory first
+	thirdParty, err := filepath.Abs("third_party")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 || paths[1] != shared || paths[2] != thirdParty {
+		t.Errorf("protoc was run with the proto paths %q, want the protobuf directory, %s and %s", paths, shared, thirdParty)
+	}
+}
+
+func TestGenerateEnv(t *testing.T) {
+	setupGeneration(t)
+	envLog := filepath.Join(t.TempDir(), "env.log")
+	fakeCommand(t, "protoc", `echo "$PLUGIN_MODE" >> `+envLog+"\n"+fakeProtoc)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.Env = []string{"PLUGIN_MODE=strict"}
+	generateSearch(t, &Generator{}, opts)
+
+	data, err := os.ReadFile(envLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Fields(string(data)); len(lines) == 0 || lines[len(lines)-1] != "strict" {
+		t.Errorf("protoc ran with PLUGIN_MODE=%q", data)
+	}
+
+	opts.Env = []string{"INVALID"}
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Fatalf("expected the invalid variable to be refused, got %v", err)
+	}
+}
+
+// archiveNames returns the names of the files in the zip or gzipped tar archive at path
+func archiveNames(t *testing.T, path string) []string {
+	t.Helper()
+	var names []string
+	if strings.HasSuffix(path, ".zip") {
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return names
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+	}
+}
+
+func TestGenerateArchive(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	for _, archive := range []string{"client.zip", "client.tar.gz"} {
+		opts := searchOptions("out")
+		opts.Archive = archive
+		generateSearch(t, &Generator{}, opts)
+
+		names := archiveNames(t, archive)
+		sort.Strings(names)
+		want := util.ManifestName + ",search_go.txt,search_twirp.txt"
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("%s holds %s, want %s", archive, got, want)
+		}
+	}
+}
+
+func TestGenerateAbsoluteOutput(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	output := filepath.Join(t.TempDir(), "out")
+	opts := searchOptions(output)
+	opts.Archive = "client.zip"
+	generateSearch(t, &Generator{}, opts)
+
+	if got := strings.Join(readDir(t, output), ","); got != "search_go.txt,search_twirp.txt" {
+		t.Errorf("the output holds %s, want the generated files", got)
+	}
+	manifest, err := util.ReadManifest(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := manifest.ServiceFiles("search"); len(files) != 2 {
+		t.Errorf("the manifest records %+v, want the generated files", files)
+	}
+	if got := strings.Join(readDir(t, "."), ","); got != "client.zip" {
+		t.Errorf("the working directory holds %s, want only the archive", got)
+	}
+	names := archiveNames(t, "client.zip")
+	sort.Strings(names)
+	if got, want := strings.Join(names, ","), util.ManifestName+",search_go.txt,search_twirp.txt"; got != want {
+		t.Errorf("the archive holds %s, want %s", got, want)
+	}
+}
+
+func TestGenerateProtoNames(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.ProtoNames = map[string]string{"search": "search_api.proto"}
+	opts.IncludeProto = true
+	generateSearch(t, &Generator{}, opts)
+
+	if _, err := os.Stat(filepath.Join("out", "search_api.proto")); err != nil {
+		t.Errorf("the protobuf was not copied under its overridden name: %s", err)
+	}
+
+	for _, name := range []string{"../search", ".."} {
+		opts.ProtoNames = map[string]string{"search": name}
+		_, err := (&Generator{}).Generate(context.Background(), opts)
+		var genErr *Error
+		if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+			t.Errorf("expected the name %q to be refused, got %v", name, err)
+		}
+	}
+}
+
+func TestGenerateProto3Optional(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		forced  bool
+		want    bool
+	}{
+		{"protoc 3.13 needs the flag", "3.13.0", false, true},
+		{"protoc 3.19 does not", "3.19.4", false, false},
+		{"forced", "3.19.4", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupGeneration(t)
+			log := protocLog(t)
+			fakeCommand(t, "protoc", strings.Replace(fakeProtoc, "libprotoc 3.19.4", "libprotoc "+tt.version, 1))
+			searchRepository(t)
+			opts := searchOptions("out")
+			opts.Proto3Optional = tt.forced
+			generateSearch(t, &Generator{}, opts)
+
+			calls := protocCalls(t, log)
+			if len(calls) != 1 || strings.Contains(calls[0], util.Proto3OptionalFlag) != tt.want {
+				t.Errorf("protoc calls %q, want the flag %t", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSymbols(t *testing.T) {
+	logger := &recordingLogger{}
+	g := Generator{Logger: logger}
+	r := &run{symbols: make(map[string]string)}
+
+	search := t.TempDir()
+	writeFile(t, search, "search.pb.go", "package apiv1\n\ntype Pagination struct{}\n\ntype SearchRequest struct{}\n")
+	query := t.TempDir()
+	writeFile(t, query, "query.pb.go", "package apiv1\n\ntype Pagination struct{}\n\ntype QueryRequest struct{}\n")
+	other := t.TempDir()
+	writeFile(t, other, "other.pb.go", "package otherv1\n\ntype Pagination struct{}\n")
+
+	if err := g.checkSymbols(r, "search", search); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(logger.messages) != 0 {
+		t.Fatalf("the first service was warned about: %q", logger.messages)
+	}
+	if err := g.checkSymbols(r, "query", query); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := g.checkSymbols(r, "other", other); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := "Warning: 'Pagination' generated for service 'query' is also declared by service 'search' in package 'apiv1'"
+	if len(logger.messages) != 1 || logger.messages[0] != want {
+		t.Errorf("got warnings %q, want %q", logger.messages, want)
+	}
+}
+
+// gitIdentity sets the author and committer of commits made by the rest of the test
+func gitIdentity(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		setenv(t, key+"_NAME", "test")
+		setenv(t, key+"_EMAIL", "test@example.com")
+	}
+}
+
+func TestGenerateCommit(t *testing.T) {
+	setupGeneration(t)
+	gitIdentity(t)
+	src := localSource(t)
+	git(t, src, "init", "--quiet")
+	git(t, src, "add", "-A")
+	git(t, src, "commit", "--quiet", "-m", "protos")
+	sha := git(t, src, "rev-parse", "HEAD")
+
+	git(t, ".", "init", "--quiet")
+	writeFile(t, ".", "README.md", "clients\n")
+	git(t, ".", "add", "-A")
+	git(t, ".", "commit", "--quiet", "-m", "readme")
+	writeFile(t, ".", "README.md", "changed outside of the output\n")
+
+	opts := searchOptions("out")
+	opts.LocalSource = src
+	opts.Commit = true
+	generateSearch(t, &Generator{}, opts)
+
+	message := git(t, ".", "log", "-1", "--format=%B")
+	if want := "Regenerate golang clients for search\n\nsearch: " + sha; message != want {
+		t.Errorf("committed with message %q, want %q", message, want)
+	}
+	if files := git(t, ".", "show", "--name-only", "--format=", "HEAD"); files != "out/.proto-gen-manifest.json\nout/search_go.txt\nout/search_twirp.txt" {
+		t.Errorf("committed %q", files)
+	}
+
+	// Nothing is committed when the output did not change
+	opts.CommitMessage = "Regenerate {{.Services}}"
+	generateSearch(t, &Generator{}, opts)
+	if n := git(t, ".", "rev-list", "--count", "HEAD"); n != "2" {
+		t.Errorf("the repository has %s commits after regenerating unchanged output, want 2", n)
+	}
+}
+
+func TestNormalizeServices(t *testing.T) {
+	tests := []struct {
+		requested []string
+		want      string
+		wantErr   bool
+	}{
+		{nil, "", false},
+		{[]string{"all"}, "", false},
+		{[]string{" search", "query ", "", "search"}, "search,query", false},
+		{[]string{"all", "all"}, "", false},
+		{[]string{"all", "search"}, "", true},
+	}
+	for _, tt := range tests {
+		services, err := normalizeServices(tt.requested)
+		if (err != nil) != tt.wantErr || strings.Join(services, ",") != tt.want {
+			t.Errorf("normalizeServices(%q) = %q, %v, want %q", tt.requested, services, err, tt.want)
+		}
+	}
+
+	opts := searchOptions("out")
+	opts.Services = []string{"search", "all"}
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate || !strings.Contains(err.Error(), "'all' cannot be combined") {
+		t.Errorf("expected 'all' combined with a service to be refused, got %v", err)
+	}
+}
+
+func TestGenerateDescriptorGzip(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.DescriptorSetOut = "search.pb"
+	opts.DescriptorGzip = true
+	generateSearch(t, &Generator{}, opts)
+
+	f, err := os.Open("search.pb")
+	if err != nil {
+		t.Fatalf("the descriptor was not written: %s", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("the descriptor is not gzip compressed: %s", err)
+	}
+	if data, err := io.ReadAll(zr); err != nil || string(data) != "descriptor\n" {
+		t.Errorf("the descriptor decompresses to %q, %v", data, err)
+	}
+
+	// The descriptors of a batch are named with the extension of their compression
+	centralRepository(t)
+	opts = batchOptions("")
+	opts.OutputPerService = true
+	opts.OutputPath = "out"
+	opts.DescriptorSetOut = "descriptors"
+	opts.DescriptorGzip = true
+	if _, err := (&Generator{}).Generate(context.Background(), opts); err != nil {
+		t.Fatalf("batch generation failed: %s", err)
+	}
+	for _, s := range opts.Services {
+		if _, err := os.Stat(filepath.Join("descriptors", s+".pb.gz")); err != nil {
+			t.Errorf("the descriptor of %s was not written: %s", s, err)
+		}
+	}
+}
+
+func TestRenderBanner(t *testing.T) {
+	r := &run{opts: Options{Language: "golang"}}
+	if banner, err := r.renderBanner("search", "abc123"); err != nil || banner != "" {
+		t.Errorf("rendered %q, %v without a banner", banner, err)
+	}
+
+	tmpl, err := parseBanner("DO NOT EDIT: generated for {{.Service}} ({{.Language}}) from {{.Commit}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.banner = tmpl
+	banner, err := r.renderBanner("search", "abc123")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := "DO NOT EDIT: generated for search (golang) from abc123"; banner != want {
+		t.Errorf("rendered %q, want %q", banner, want)
+	}
+
+	if _, err := parseBanner("{{.Service"); err == nil || !strings.Contains(err.Error(), "Invalid banner template") {
+		t.Errorf("expected an invalid template to be refused, got %v", err)
+	}
+}
+
+func TestGenerateListFiles(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.ListFiles = true
+	s := generateSearch(t, &Generator{}, opts)
+
+	if _, err := os.Stat("out"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the output was written when only listing the files: %v", err)
+	}
+	want := map[string]int64{"search_go.txt": int64(len("// generated by --go_out=paths=source_relative:\n")), "search_twirp.txt": int64(len("// generated by --twirp_out=paths=source_relative:\n"))}
+	if strings.Join(s.Files, ",") != "search_go.txt,search_twirp.txt" || len(s.FileSizes) != len(want) {
+		t.Fatalf("unexpected listed files %q, %v", s.Files, s.FileSizes)
+	}
+	for name, size := range want {
+		if s.FileSizes[name] != size {
+			t.Errorf("%s is listed with %d bytes, want %d", name, s.FileSizes[name], size)
+		}
+	}
+	if s.Bytes != want["search_go.txt"]+want["search_twirp.txt"] {
+		t.Errorf("listed %d bytes in total", s.Bytes)
+	}
+
+	opts.Clean = true
+	if _, err := (&Generator{}).Generate(context.Background(), opts); err == nil {
+		t.Error("listing the files was combined with cleaning the output")
+	}
+}
+
+func TestGenerateCloneFilter(t *testing.T) {
+	setupGeneration(t)
+	log := filepath.Join(t.TempDir(), "git.log")
+	fakeCommand(t, "git", `echo "$@" >> `+log+`
+exit 1
+`)
+	opts := searchOptions("out")
+	opts.CloneFilter = "blob:none"
+	if _, err := (&Generator{}).Generate(context.Background(), opts); err == nil {
+		t.Fatal("generation succeeded without a repository to clone")
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("git was not run: %s", err)
+	}
+	if !strings.Contains(string(data), "clone --filter=blob:none ") {
+		t.Errorf("the repository was not partially cloned: %q", data)
+	}
+}
+
+func TestChangesValidation(t *testing.T) {
+	g := &Generator{}
+	opts := searchOptions("out")
+	opts.LocalSource = localSource(t)
+	for name, since := range map[string]string{"no commit": "", "local source": "abc1234"} {
+		_, err := g.Changes(context.Background(), opts, since)
+		var genErr *Error
+		if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+			t.Errorf("%s: expected a validation error, got %v", name, err)
+		}
+	}
+}
+
+func TestGeneratePreflight(t *testing.T) {
+	setupGeneration(t)
+	log := filepath.Join(t.TempDir(), "git.log")
+	fakeCommand(t, "git", `echo "$@" >> `+log+`
+if [ "$1" = "ls-remote" ]; then echo 'Permission denied (publickey).' >&2; exit 128; fi
+exit 1
+`)
+	opts := searchOptions("out")
+	opts.Services = []string{"search", "query"}
+	opts.SkipPreflight = false
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseClone || genErr.Service != "search" || !strings.Contains(err.Error(), "preflight check failed") {
+		t.Fatalf("expected the preflight check to fail, got %v", err)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both services are on the same host, so only one is checked, and nothing is cloned
+	if calls := strings.Split(strings.TrimSpace(string(data)), "\n"); len(calls) != 1 || !strings.HasPrefix(calls[0], "ls-remote ") {
+		t.Errorf("git was run as %q", calls)
+	}
+}
+
+func TestGenerateChangedOnly(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.ChangedOnly = true
+	if s := generateSearch(t, &Generator{}, opts); strings.Join(s.Changed, ",") != "search_go.txt,search_twirp.txt" || s.Created != 2 {
+		t.Fatalf("unexpected first result %+v", s)
+	}
+
+	writeFile(t, "out", "search_twirp.txt", "edited\n")
+	s := generateSearch(t, &Generator{}, opts)
+	if strings.Join(s.Changed, ",") != "search_twirp.txt" || s.Updated != 1 || s.Unchanged != 1 {
+		t.Errorf("unexpected result %+v", s)
+	}
+
+	// Listing the files only reports those that would change
+	writeFile(t, "out", "search_go.txt", "edited\n")
+	opts.ListFiles = true
+	s = generateSearch(t, &Generator{}, opts)
+	if strings.Join(s.Files, ",") != "search_go.txt" || !strings.Contains(s.Summary(), "1 would change in out") {
+		t.Errorf("unexpected listing %+v: %s", s, s.Summary())
+	}
+}
+
+func TestGenerateFromProto(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	fakeCommand(t, "git", "echo \"git must not be run\" >&2\nexit 1\n")
+	opts := Options{Services: []string{"billing"}, Language: "golang", OutputPath: "out", SkipPreflight: true, SkipBufLint: true}
+	opts.Proto = strings.NewReader(strings.Replace(searchProto, "search.v1", "billing.v1", 1))
+	s := generateSearch(t, &Generator{}, opts)
+
+	if s.Service != "billing" || len(s.Files) == 0 {
+		t.Errorf("unexpected result %+v", s)
+	}
+	calls := protocCalls(t, log)
+	if len(calls) != 1 || !strings.HasSuffix(calls[0], "billing.proto") {
+		t.Errorf("protoc did not compile the given protobuf: %q", calls)
+	}
+
+	opts.Services = []string{"billing", "search"}
+	opts.Proto = strings.NewReader(searchProto)
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected a protobuf given for two services to be refused, got %v", err)
+	}
+}
+
+func TestGenerateLayout(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.Layout = util.DefaultLayout(util.LanguageGo)
+	if s := generateSearch(t, &Generator{}, opts); s.OutputPath != filepath.Join("out", "pkg", "search") {
+		t.Errorf("generated into %s", s.OutputPath)
+	}
+	if _, err := os.Stat(filepath.Join("out", "pkg", "search", "search_go.txt")); err != nil {
+		t.Errorf("the service was not generated into its conventional directory: %s", err)
+	}
+
+	for _, layout := range []string{"../{{.Service}}", "{{.Project}}"} {
+		opts.Layout = layout
+		_, err := (&Generator{}).Generate(context.Background(), opts)
+		var genErr *Error
+		if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+			t.Errorf("expected the layout %s to be refused, got %v", layout, err)
+		}
+	}
+}
+
+func TestGenerateGRPCGateway(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.RPCFramework = util.RPCFrameworkGRPC
+	opts.GRPCGateway = true
+	s := generateSearch(t, &Generator{}, opts)
+
+	calls := protocCalls(t, log)
+	if len(calls) != 1 || !strings.Contains(calls[0], "--grpc-gateway_out=paths=source_relative:") {
+		t.Fatalf("protoc was not run with the grpc-gateway plugin: %q", calls)
+	}
+	if !strings.Contains(strings.Join(s.Files, ","), "search_grpc-gateway.txt") {
+		t.Errorf("the gateway output was not copied: %q", s.Files)
+	}
+
+	opts.RPCFramework = util.RPCFrameworkTwirp
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected grpc-gateway with twirp to be refused, got %v", err)
+	}
+}
+
+func TestGenerateFromArtifact(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	var archive bytes.Buffer
+	zw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Name: "search-1.2.0/proto/public/search.proto", Mode: 0644, Size: int64(len(searchProto)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte(searchProto))
+	tw.Close()
+	zw.Close()
+	sum := sha256.Sum256(archive.Bytes())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(archive.Bytes()) }))
+	defer srv.Close()
+
+	opts := searchOptions("out")
+	opts.ProtoArtifactURL = srv.URL + "/search-1.2.0.tar.gz"
+	opts.ProtoArtifactSHA256 = hex.EncodeToString(sum[:])
+	generateSearch(t, &Generator{}, opts)
+	if calls := protocCalls(t, log); len(calls) != 1 || !strings.HasSuffix(calls[0], "search.proto") {
+		t.Errorf("protoc did not compile the downloaded protobuf: %q", calls)
+	}
+
+	opts.ProtoArtifactSHA256 = strings.Repeat("0", 64)
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseClone || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected the checksum mismatch to fail the download, got %v", err)
+	}
+}
+
+func TestGenerateVendorWKT(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	include := t.TempDir()
+	writeFile(t, include, "google/protobuf/timestamp.proto", "syntax = \"proto3\";\n\npackage google.protobuf;\n")
+	src := t.TempDir()
+	writeFile(t, src, "proto/public/search.proto", strings.Replace(searchProto, "package search.v1;", "package search.v1;\n\nimport \"google/protobuf/timestamp.proto\";", 1))
+
+	opts := searchOptions("out")
+
+	opts.LocalSource = src
+	opts.ImportPaths = []string{include}
+	generateSearch(t, &Generator{}, opts)
+	if calls := protocCalls(t, log); len(calls) != 1 || strings.Contains(calls[0], "timestamp.proto") {
+		t.Fatalf("the well-known type was generated without being vendored: %q", calls)
+	}
+
+	opts.VendorWKT = true
+	generateSearch(t, &Generator{}, opts)
+	calls := protocCalls(t, log)
+	if len(calls) != 2 || !strings.Contains(calls[1], filepath.Join("google", "protobuf", "timestamp.proto")) {
+		t.Errorf("the vendored well-known type was not generated: %q", calls)
+	}
+}
+
+func TestGenerateGoModuleImports(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	writeFile(t, ".", "go.mod", "module example.com/clients\n\ngo 1.21\n")
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.GoModuleImports = true
+	generateSearch(t, &Generator{}, opts)
+
+	calls := protocCalls(t, log)
+	if len(calls) != 1 || !strings.Contains(calls[0], "--go_out=paths=source_relative,Msearch.proto=example.com/clients/out:") {
+		t.Fatalf("protoc was not given the import path within the module: %q", calls)
+	}
+
+	opts.Language = "python"
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected Go module imports for python to be refused, got %v", err)
+	}
+}
+
+func TestGenerateSplitByProto(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	src := localSource(t)
+	writeFile(t, src, "proto/public/common/page.proto", "syntax = \"proto3\";\n\npackage common;\n")
+	opts := searchOptions("out")
+	opts.LocalSource = src
+	opts.SplitByProto = true
+	s := generateSearch(t, &Generator{}, opts)
+
+	calls := protocCalls(t, log)
+	if len(calls) != 2 {
+		t.Fatalf("protoc was run %d times, want once per protobuf: %q", len(calls), calls)
+	}
+	for _, name := range []string{"search", "page"} {
+		if _, err := os.Stat(filepath.Join("out", name, "search_go.txt")); err != nil {
+			t.Errorf("%s.proto was not generated into its own subdirectory: %s", name, err)
+		}
+	}
+	if len(s.Files) != 4 {
+		t.Errorf("copied %q, want the code of both plugins for both protobufs", s.Files)
+	}
+
+	opts.WithMocks = true
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected mocks with split output to be refused, got %v", err)
+	}
+}
+
+func TestGenerateServicePluginOpts(t *testing.T) {
+	setupGeneration(t)
+	centralRepository(t)
+	opts := batchOptions("out")
+	opts.OutputPerService = true
+	opts.PluginOpts = map[string][]string{"go": {"module=example.com/global"}, "twirp": {"module=example.com/twirp"}}
+	opts.ServicePluginOpts = map[string]map[string][]string{"query": {"go": {"module=example.com/query"}}}
+	if _, err := (&Generator{}).Generate(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"search/search_go.txt":    "--go_out=paths=source_relative,module=example.com/global:",
+		"search/search_twirp.txt": "--twirp_out=paths=source_relative,module=example.com/twirp:",
+		"query/search_go.txt":     "--go_out=paths=source_relative,module=example.com/query:",
+		"query/search_twirp.txt":  "--twirp_out=paths=source_relative,module=example.com/twirp:",
+	}
+	for file, arg := range want {
+		data, err := os.ReadFile(filepath.Join("out", filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), arg) {
+			t.Errorf("%s was not generated with %s: %q", file, arg, data)
+		}
+	}
+}
+
+func TestGenerateMaxCloneSize(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.MaxCloneSize = -1
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected a negative maximum clone size to be refused, got %v", err)
+	}
+}
+
+func TestGenerateDockerImage(t *testing.T) {
+	setupGeneration(t)
+	dockerLog := filepath.Join(t.TempDir(), "docker.log")
+	fakeCommand(t, "docker", `echo "$@" >> `+dockerLog+`
+while [ "$1" != "protoc" ]; do shift; done
+shift
+exec protoc "$@"
+`)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.DockerImage = "example.com/protoc:3.19"
+	generateSearch(t, &Generator{}, opts)
+
+	data, err := os.ReadFile(dockerLog)
+	if err != nil {
+		t.Fatalf("protoc was not run in a container: %s", err)
+	}
+	if !strings.Contains(string(data), "example.com/protoc:3.19 protoc --proto_path=.") {
+		t.Errorf("protoc was not run in the image: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join("out", "search_go.txt")); err != nil {
+		t.Errorf("the code generated in the container was not copied: %s", err)
+	}
+}
+
+func TestGenerateOnlyPublic(t *testing.T) {
+	setupGeneration(t)
+	centralRepository(t)
+	opts := batchOptions("out")
+	opts.Services = []string{"search", "audit"}
+	opts.OnlyPublic = true
+
+	result, err := (&Generator{}).Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped := map[string]bool{}
+	generated := map[string]int{}
+	for _, s := range result.Services {
+		skipped[s.Service] = s.Skipped
+		generated[s.Service] = len(s.Files)
+	}
+	if want := map[string]bool{"search": false, "audit": true}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped services = %v, want %v", skipped, want)
+	}
+	if generated["search"] == 0 || generated["audit"] != 0 {
+		t.Errorf("generated %v files, want only the public service generated", generated)
+	}
+
+	opts.Services = []string{"audit"}
+	if _, err := (&Generator{}).Generate(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "None of the services have a public protobuf defined") {
+		t.Errorf("expected no public service to be an error, got %v", err)
+	}
+
+	for _, invalid := range []Options{
+		{Services: []string{"search"}, OnlyPublic: true, Private: true},
+		{Services: []string{"search"}, OnlyPrivate: true},
+		{Services: []string{"search"}, OnlyPublic: true, OnlyPrivate: true},
+	} {
+		invalid.Language, invalid.LocalSource, invalid.OutputPath, invalid.SkipPreflight = "golang", opts.LocalSource, "out", true
+		_, err := (&Generator{}).Generate(context.Background(), invalid)
+		var genErr *Error
+		if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+			t.Errorf("expected %+v to be refused, got %v", invalid, err)
+		}
+	}
+}
+
+func TestGenerateKeepGoing(t *testing.T) {
+	setupGeneration(t)
+	fakeCommand(t, "protoc", `case "$*" in *"$FAIL_PROTO"*) echo "$FAIL_PROTO: broken" >&2; exit 1;; esac
+`+fakeProtoc)
+	centralRepository(t)
+
+	tests := []struct {
+		name       string
+		failProto  string
+		wantFailed []string
+		check      func(error) bool
+	}{
+		{"success", "none.proto", nil, func(err error) bool { return err == nil }},
+		{"partial", "query.proto", []string{"query"}, func(err error) bool {
+			var partialErr *PartialError
+			return errors.As(err, &partialErr) && partialErr.Succeeded == 1 && len(partialErr.Errs) == 1
+		}},
+		{"failure", ".proto", []string{"search", "query"}, func(err error) bool {
+			var genErr *Error
+			return errors.As(err, &genErr) && genErr.Phase == PhaseGenerate && !errors.As(err, new(*PartialError))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, "FAIL_PROTO", tt.failProto)
+			opts := batchOptions(filepath.Join(tt.name, "out"))
+			opts.OutputPerService = true
+			opts.KeepGoing = true
+
+			result, err := (&Generator{}).Generate(context.Background(), opts)
+			if !tt.check(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var failed []string
+			for _, s := range result.Services {
+				if s.Failed {
+					failed = append(failed, s.Service)
+				}
+			}
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("failed services = %q, want %q", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestGenerateOffline(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.CacheDir = t.TempDir()
+	opts.Offline = true
+
+	// Nothing can be generated offline before the repository is cached
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseClone || !strings.Contains(err.Error(), "cannot be cloned offline") {
+		t.Fatalf("expected generating offline from an empty cache to fail, got %v", err)
+	}
+	if _, err := os.Stat("out"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the failed offline run created the output: %v", err)
+	}
+
+	opts.Offline = false
+	generateSearch(t, &Generator{}, opts)
+	if err := os.RemoveAll("out"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached clone is generated from once the remote is gone
+	if err := os.RemoveAll(filepath.Join(os.Getenv("TEST_REMOTES"), "search.git")); err != nil {
+		t.Fatal(err)
+	}
+	opts.Offline = true
+	generateSearch(t, &Generator{}, opts)
+	if got := strings.Join(readDir(t, "out"), ","); got != "search_go.txt,search_twirp.txt" {
+		t.Errorf("the offline run generated %s, want the files generated from the cache", got)
+	}
+}
+
+func TestValidateCache(t *testing.T) {
+	for _, tt := range []struct {
+		opts    Options
+		wantErr bool
+	}{
+		{Options{}, false},
+		{Options{CacheDir: "cache", RefreshCache: true}, false},
+		{Options{RefreshCache: true}, true},
+		{Options{CacheDir: "cache", RefreshCache: true, Offline: true}, true},
+		{Options{Offline: true}, true},
+	} {
+		if err := validateCache(tt.opts); (err != nil) != tt.wantErr {
+			t.Errorf("validateCache(%+v) = %v, want error %t", tt.opts, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGenerateDocs(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.Docs = true
+	opts.DocsFormat = util.DocsHTML
+	generateSearch(t, &Generator{}, opts)
+
+	data, err := os.ReadFile(filepath.Join("out", "search_doc.txt"))
+	if err != nil {
+		t.Fatalf("the documentation was not copied: %s", err)
+	}
+	if !strings.Contains(string(data), "--doc_out=html,search.html:") {
+		t.Errorf("the documentation was not generated as html: %q", data)
+	}
+
+	opts.DocsFormat = "pdf"
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected the pdf documentation format to be refused, got %v", err)
+	}
+}
+
+func TestGenerateMirrorPaths(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.MirrorPaths = []string{"mirror"}
+	s := generateSearch(t, &Generator{}, opts)
+	if !reflect.DeepEqual(s.MirrorPaths, []string{"mirror"}) {
+		t.Errorf("mirror paths = %q, want [mirror]", s.MirrorPaths)
+	}
+
+	for _, name := range append(s.Files, util.ManifestName) {
+		want, err := os.ReadFile(filepath.Join("out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join("mirror", name))
+		if err != nil {
+			t.Fatalf("%s was not mirrored: %s", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("the mirror of %s = %q, want %q", name, got, want)
+		}
+	}
+
+	for _, mirrors := range [][]string{{""}, {"out/nested"}, {"mirror", "mirror"}} {
+		opts.MirrorPaths = mirrors
+		_, err := (&Generator{}).Generate(context.Background(), opts)
+		var genErr *Error
+		if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+			t.Errorf("expected the mirrors %q to be refused, got %v", mirrors, err)
+		}
+	}
+}
+
+func TestMirrorPathsOfService(t *testing.T) {
+	opts := Options{OutputPath: "out", MirrorPaths: []string{"vendor/clients", "/srv/clients"}}
+	got, err := opts.mirrorPaths(filepath.Join("out", "search"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join("vendor", "clients", "search"), filepath.Join("/srv", "clients", "search")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mirrorPaths = %q, want each laid out as the output: %q", got, want)
+	}
+}
+
+func TestGenerateProtocWorkDir(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	workDirs := filepath.Join(t.TempDir(), "workdirs.log")
+	fakeCommand(t, "protoc", `[ "$1" = "--version" ] || pwd >> `+workDirs+"\n"+fakeProtoc)
+	workDir := t.TempDir()
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.ProtocWorkDir = workDir
+	generateSearch(t, &Generator{}, opts)
+
+	data, err := os.ReadFile(workDirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != workDir {
+		t.Errorf("protoc ran in %q, want %q", got, workDir)
+	}
+	if calls := protocCalls(t, log); len(calls) != 1 || strings.Contains(calls[0], "--proto_path=. ") {
+		t.Errorf("the protobuf directory was not given to protoc by its absolute path: %q", calls)
+	}
+
+	opts.ProtocWorkDir = filepath.Join(workDir, "missing")
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected a missing working directory to be refused, got %v", err)
+	}
+}
+
+func TestGenerateNormalizePackage(t *testing.T) {
+	setupGeneration(t)
+	protos := filepath.Join(t.TempDir(), "protos.log")
+	fakeCommand(t, "protoc", `[ "$1" = "--version" ] || cat search.proto >> `+protos+"\n"+fakeProtoc)
+	src := t.TempDir()
+	writeFile(t, src, "proto/public/search.proto", strings.Replace(searchProto, "package search.v1;", "package api.v1;", 1))
+
+	logger := &recordingLogger{}
+	opts := searchOptions("out")
+	opts.LocalSource = src
+	opts.NormalizePackage = true
+	generateSearch(t, &Generator{Logger: logger}, opts)
+
+	data, err := os.ReadFile(protos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "package search.api.v1;") {
+		t.Errorf("protoc was not run on the scoped package: %q", data)
+	}
+	if !strings.Contains(strings.Join(logger.messages, "\n"), "Renamed package api.v1 to search.api.v1") {
+		t.Errorf("the rename was not logged: %q", logger.messages)
+	}
+}
+
+func TestGenerateRequireClean(t *testing.T) {
+	setupGeneration(t)
+	gitIdentity(t)
+	git(t, ".", "init", "--quiet")
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.RequireClean = true
+	generateSearch(t, &Generator{}, opts)
+	git(t, ".", "add", "-A")
+	git(t, ".", "commit", "--quiet", "-m", "generate")
+
+	// Regenerating the committed output is allowed
+	generateSearch(t, &Generator{}, opts)
+
+	for i := 0; i < 7; i++ {
+		writeFile(t, "out", fmt.Sprintf("edit%d.go", i), "package search\n")
+	}
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate || !strings.Contains(err.Error(), "out/edit0.go") || !strings.Contains(err.Error(), "and 2 more") {
+		t.Errorf("expected the dirty output to be refused, got %v", err)
+	}
+}
+
+func TestGenerateRetriesValidation(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.GenerateRetries = -1
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected a negative number of retries to be refused, got %v", err)
+	}
+}
+
+func TestGenerateFormatProto(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	fakeCommand(t, "buf", `[ "$1 $2" = "format -w" ] || exit 2
+printf '// formatted\n' >> "$3"
+`)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.FormatProto = true
+	opts.IncludeProto = true
+	logger := &recordingLogger{}
+	generateSearch(t, &Generator{Logger: logger}, opts)
+
+	data, err := os.ReadFile(filepath.Join("out", "search.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != searchProto+"// formatted\n" {
+		t.Errorf("the copied protobuf was not formatted: %q", data)
+	}
+	if calls := protocCalls(t, log); len(calls) != 1 {
+		t.Errorf("protoc was run %d times, want once", len(calls))
+	}
+	if !strings.Contains(strings.Join(logger.messages, "\n"), "Formatting protobufs with buf") {
+		t.Errorf("the formatter was not logged: %q", logger.messages)
+	}
+}
+
+func TestGenerateDefaultEndpoint(t *testing.T) {
+	setupGeneration(t)
+	fakeCommand(t, "protoc", `[ "$1" = "--version" ] || printf 'package searchv1\n' > search.pb.go
+`+fakeProtoc)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.DefaultEndpoint = "https://search.staging.example.com"
+	generateSearch(t, &Generator{}, opts)
+
+	data, err := os.ReadFile(filepath.Join("out", "search_endpoint.go"))
+	if err != nil {
+		t.Fatalf("the default endpoint was not copied: %s", err)
+	}
+	if !strings.Contains(string(data), "package searchv1\n") || !strings.Contains(string(data), `const DefaultEndpoint = "https://search.staging.example.com"`) {
+		t.Errorf("search_endpoint.go = %q", data)
+	}
+
+	opts.MessagesOnly = true
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected a default endpoint without RPC code to be refused, got %v", err)
+	}
+}
+
+func TestGenerateDiff(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	generateSearch(t, &Generator{}, opts)
+	writeFile(t, "out", "search_go.txt", "// edited\n")
+	manifest, err := os.ReadFile(filepath.Join("out", util.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Diff = true
+	s := generateSearch(t, &Generator{}, opts)
+	if len(s.Diffs) != 1 || s.Diffs[0].Name != "search_go.txt" || s.Diffs[0].Status != util.FileUpdated {
+		t.Fatalf("diffs = %+v, want only the edited file", s.Diffs)
+	}
+	if want := "-// edited\n+// generated by --go_out=paths=source_relative:\n"; !strings.Contains(s.Diffs[0].Diff, want) {
+		t.Errorf("diff = %q, want it to contain %q", s.Diffs[0].Diff, want)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join("out", "search_go.txt")); string(data) != "// edited\n" {
+		t.Errorf("the output was written while diffing: %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join("out", util.ManifestName)); !bytes.Equal(data, manifest) {
+		t.Error("the manifest was written while diffing")
+	}
+
+	opts.Clean = true
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected diffing with a clean output to be refused, got %v", err)
+	}
+}
+
+func TestGenerateInvalidCloneURLTemplate(t *testing.T) {
+	setupGeneration(t)
+	for _, tmpl := range []string{"https://{{.Host}/{{.Repo}}", "https://{{.Owner}}/{{.Repo}}"} {
+		opts := searchOptions("out")
+		opts.CloneURLTemplate = tmpl
+		_, err := (&Generator{}).Generate(context.Background(), opts)
+		var genErr *Error
+		if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+			t.Errorf("template %q: expected a validation error, got %v", tmpl, err)
+		}
+		if _, err := os.Stat("out"); !os.IsNotExist(err) {
+			t.Errorf("template %q: the output was created", tmpl)
+		}
+	}
+}
+
+// searchDescriptorSet is a FileDescriptorSet of a search.proto declaring the Query and Suggest methods, which use
+// QueryRequest and SuggestRequest
+func searchDescriptorSet() []byte {
+	field := func(num int, data ...string) string {
+		b := strings.Join(data, "")
+		return string(binary.AppendUvarint(binary.AppendUvarint(nil, uint64(num)<<3|2), uint64(len(b)))) + b
+	}
+	method := func(name string, input string) string {
+		return field(2, field(1, name), field(2, ".search.v1."+input), field(3, ".search.v1.QueryResponse"))
+	}
+	return []byte(field(1, field(1, "search.proto"), field(2, "search.v1"),
+		field(4, field(1, "QueryRequest")), field(4, field(1, "SuggestRequest")), field(4, field(1, "QueryResponse")),
+		field(6, field(1, "Search"), method("Query", "QueryRequest"), method("Suggest", "SuggestRequest"))))
+}
+
+func TestGenerateMethods(t *testing.T) {
+	setupGeneration(t)
+	descriptor := writeFile(t, t.TempDir(), "search.pb", string(searchDescriptorSet()))
+	generatedFrom := filepath.Join(t.TempDir(), "generated-from.pb")
+	setenv(t, "SEARCH_DESCRIPTOR", descriptor)
+	setenv(t, "GENERATED_FROM", generatedFrom)
+	fakeCommand(t, "protoc", fakeProtoc+`for a in "$@"; do
+  case "$a" in
+    --descriptor_set_out=*) cp "$SEARCH_DESCRIPTOR" "${a#*=}";;
+    --descriptor_set_in=*) cp "${a#*=}" "$GENERATED_FROM";;
+  esac
+done
+`)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.IncludeProto = true
+	opts.Methods = []string{"Search.Query"}
+	generateSearch(t, &Generator{}, opts)
+
+	elements, err := util.ReadDescriptorSet(generatedFrom)
+	if err != nil {
+		t.Fatalf("the code was not generated from a descriptor set: %s", err)
+	}
+	var names []string
+	for _, e := range elements {
+		names = append(names, e.Kind+" "+e.Name)
+	}
+	sort.Strings(names)
+	want := []string{"message search.v1.QueryRequest", "message search.v1.QueryResponse", "rpc search.v1.Search.Query", "service search.v1.Search"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("generated from %q, want only the selected method and the messages it uses %q", names, want)
+	}
+	if data, err := os.ReadFile(filepath.Join("out", "search.proto")); err != nil || string(data) != searchProto {
+		t.Errorf("the copied protobuf was not left whole: %q, %v", data, err)
+	}
+
+	opts.Methods = []string{"Delete"}
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseProto || !strings.Contains(err.Error(), "Delete") {
+		t.Errorf("expected the undeclared method to fail, got %v", err)
+	}
+
+	opts.Methods = []string{"Query"}
+	opts.MessagesOnly = true
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected selecting methods without RPC code to be refused, got %v", err)
+	}
+}
+
+func TestGenerateDedupeShared(t *testing.T) {
+	setupGeneration(t)
+	centralRepository(t)
+	opts := batchOptions("out")
+	opts.DedupeShared = true
+	opts.Clean = true
+
+	for i := 0; i < 2; i++ {
+		result, err := (&Generator{}).Generate(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("generating the identical files failed: %s", err)
+		}
+		if len(result.Services) != 2 || len(result.Services[0].Shared) != 0 || !reflect.DeepEqual(result.Services[1].Shared, []string{"search_go.txt", "search_twirp.txt"}) {
+			t.Fatalf("unexpected results %+v", result.Services)
+		}
+		if _, err := os.Stat(filepath.Join("out", "search_go.txt")); err != nil {
+			t.Fatalf("the shared file was removed: %s", err)
+		}
+	}
+
+	manifest, err := util.ReadManifest("out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range opts.Services {
+		if files := manifest.ServiceFiles(s); len(files) != 2 {
+			t.Errorf("the manifest records %+v for %s, want the shared files", files, s)
+		}
+	}
+}
+
+func TestGenerateDedupeSharedDiffering(t *testing.T) {
+	setupGeneration(t)
+	// Each service generates different content under the same name
+	fakeCommand(t, "protoc", fakeProtoc+`for a; do last=$a; done
+[ "$1" = "--version" ] || echo "$last" >> "$dir/search_$name.txt"
+`)
+	centralRepository(t)
+	opts := batchOptions("out")
+	opts.DedupeShared = true
+
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseCopy || !strings.Contains(err.Error(), "collides with the output of service 'search'") {
+		t.Errorf("expected the differing files to collide, got %v", err)
+	}
+}
+
+func TestGenerateOutputMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	setupGeneration(t)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.OutputMode = "0640"
+	generateSearch(t, &Generator{}, opts)
+	info, err := os.Stat(filepath.Join("out", "search_go.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("the generated file has mode %o, want 640", info.Mode().Perm())
+	}
+
+	for _, bad := range []Options{{OutputMode: "0999"}, {OutputOwner: "1000:"}} {
+		opts := searchOptions("invalid")
+		opts.OutputMode, opts.OutputOwner = bad.OutputMode, bad.OutputOwner
+		_, err := (&Generator{}).Generate(context.Background(), opts)
+		var genErr *Error
+		if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+			t.Errorf("expected mode %q and owner %q to be refused, got %v", bad.OutputMode, bad.OutputOwner, err)
+		}
+	}
+}
+
+func TestGenerateReuseDescriptor(t *testing.T) {
+	setupGeneration(t)
+	log := protocLog(t)
+	src := localSource(t)
+	logger := &recordingLogger{}
+	g := &Generator{Logger: logger}
+	compiled := func() int {
+		n := 0
+		for _, c := range protocCalls(t, log) {
+			if strings.Contains(c, "--include_source_info") {
+				n++
+			}
+		}
+		return n
+	}
+
+	opts := searchOptions("go")
+
+	opts.LocalSource = src
+	opts.ReuseDescriptor = true
+	generateSearch(t, g, opts)
+	opts.Language, opts.OutputPath = util.LanguageRuby, "ruby"
+	generateSearch(t, g, opts)
+
+	if n := compiled(); n != 1 {
+		t.Errorf("the protobufs were compiled %d times for two languages, want once", n)
+	}
+	for _, c := range protocCalls(t, log) {
+		if !strings.Contains(c, "--include_source_info") && !strings.Contains(c, "--descriptor_set_in=") {
+			t.Errorf("code was not generated from the descriptor set: %q", c)
+		}
+	}
+	if want := "Reusing the protobufs of search compiled for " + util.LanguageGo; !strings.Contains(strings.Join(logger.messages, "\n"), want) {
+		t.Errorf("messages %q, want %q", logger.messages, want)
+	}
+
+	// Changed protobufs are compiled again
+	writeFile(t, src, "proto/public/search.proto", strings.Replace(searchProto, "string query = 1;", "string query = 1;\n  int32 limit = 2;", 1))
+	generateSearch(t, g, opts)
+	if n := compiled(); n != 2 {
+		t.Errorf("the changed protobufs were compiled %d times in total, want twice", n)
+	}
+}
+
+func TestGenerateProtoEncoding(t *testing.T) {
+	setupGeneration(t)
+	src := t.TempDir()
+	writeFile(t, src, "proto/public/search.proto", strings.Replace(searchProto, "service Search {", "// Recherche caf\xe9\nservice Search {", 1))
+
+	opts := searchOptions("out")
+
+	opts.LocalSource = src
+	opts.IncludeProto = true
+	opts.ProtoEncoding = "ISO-8859-1"
+	generateSearch(t, &Generator{}, opts)
+	data, err := os.ReadFile(filepath.Join("out", "search.proto"))
+	if err != nil {
+		t.Fatalf("the protobuf was not copied: %s", err)
+	}
+	if !strings.Contains(string(data), "// Recherche café\n") {
+		t.Errorf("the protobuf was not transcoded before generating: %q", data)
+	}
+
+	opts.ProtoEncoding = "EBCDIC-XYZ"
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected the unknown encoding to be refused, got %v", err)
+	}
+}
+
+func TestGenerateBufLintIsOptIn(t *testing.T) {
+	setupGeneration(t)
+	bufLog := filepath.Join(t.TempDir(), "buf.log")
+	fakeCommand(t, "buf", `echo "$@" >> `+bufLog+`
+echo "search.proto:3:1:Package name should be versioned"
+exit 100
+`)
+	remoteRepository(t, "search", map[string]string{
+		"proto/public/search.proto": searchProto,
+		"proto/buf.yaml":            "version: v1\n",
+	})
+
+	g := Generator{}
+	if _, err := g.Generate(context.Background(), searchOptions("out")); err != nil {
+		t.Fatalf("generation without --buf-lint failed: %s", err)
+	}
+	if _, err := os.Stat(bufLog); err == nil {
+		t.Fatal("buf lint ran without being requested")
+	}
+
+	opts := searchOptions("out")
+	opts.BufLint = true
+	_, err := g.Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseProto || !strings.Contains(err.Error(), "buf lint found violations") {
+		t.Fatalf("expected the lint violations to fail generation, got %v", err)
+	}
+
+	opts.SkipBufLint = true
+	if _, err := g.Generate(context.Background(), opts); err != nil {
+		t.Fatalf("generation with --no-buf-lint failed: %s", err)
+	}
+}
+
+func TestGenerationSettings(t *testing.T) {
+	base := Options{Language: "golang"}
+	changes := map[string]func(o *Options){
+		"TrimPrefix":     func(o *Options) { o.TrimPrefix = "github.com/org/repo" },
+		"PluginPaths":    func(o *Options) { o.PluginPaths = map[string]string{"go": "/bin/protoc-gen-go"} },
+		"ToolchainDir":   func(o *Options) { o.ToolchainDir = "/opt/toolchain" },
+		"DockerImage":    func(o *Options) { o.DockerImage = "protoc:3.19" },
+		"Proto3Optional": func(o *Options) { o.Proto3Optional = true },
+		"OutputMode":     func(o *Options) { o.OutputMode = "0664" },
+		"OutputOwner":    func(o *Options) { o.OutputOwner = "1000:1000" },
+		"DedupeShared":   func(o *Options) { o.DedupeShared = true },
+		"Banner":         func(o *Options) { o.Banner = "DO NOT EDIT" },
+		"NoStreaming":    func(o *Options) { o.NoStreaming = true },
+		"Methods":        func(o *Options) { o.Methods = []string{"Query"} },
+	}
+	for name, change := range changes {
+		changed := base
+		change(&changed)
+		if changed.generationSettings() == base.generationSettings() {
+			t.Errorf("changing %s does not change the generation settings", name)
+		}
+	}
+}
+
+func TestGenerateIncremental(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	g := Generator{}
+	opts := searchOptions("out")
+	opts.Incremental = true
+
+	if r := generateSearch(t, &g, opts); r.Skipped {
+		t.Fatal("first generation was skipped")
+	}
+	if r := generateSearch(t, &g, opts); !r.Skipped {
+		t.Fatal("unchanged service was regenerated")
+	}
+
+	// A manual edit of the same size is regenerated
+	writeFile(t, "out", "search_go.txt", "// generated by --go_out=paths=source_relativE:\n")
+	if r := generateSearch(t, &g, opts); r.Skipped || r.Updated != 1 {
+		t.Fatalf("edited output was not regenerated: %+v", r)
+	}
+
+	// Settings placing the files differently are regenerated
+	opts.TrimPrefix = "pkg"
+	if r := generateSearch(t, &g, opts); r.Skipped {
+		t.Fatal("service was skipped after changing the trimmed prefix")
+	}
+}
+
+func TestGenerateIncrementalBanner(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	g := Generator{}
+	opts := searchOptions("out")
+	opts.Incremental = true
+	opts.Banner = "Generated from {{.Commit}}"
+	opts.IncludeProto = true
+	generateSearch(t, &g, opts)
+
+	// A new commit leaves the protobufs as they were, but changes the rendered banner
+	remote := filepath.Join(os.Getenv("TEST_REMOTES"), "search.git")
+	writeFile(t, remote, "README.md", "search\n")
+	git(t, remote, "add", "-A")
+	git(t, remote, "commit", "--quiet", "-m", "readme")
+	r := generateSearch(t, &g, opts)
+	if r.Skipped {
+		t.Fatal("service was skipped although its banner names another commit")
+	}
+	data, err := os.ReadFile(filepath.Join("out", "search.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "// Generated from " + r.Commit + "\n"; r.Commit == "" || !strings.HasPrefix(string(data), want) {
+		t.Errorf("search.proto = %q, want the banner %q", data, want)
+	}
+}
+
+func TestGenerateOutputInTempDir(t *testing.T) {
+	setupGeneration(t)
+	searchRepository(t)
+	root := t.TempDir()
+	setenv(t, "TMPDIR", root)
+	chdir(t, root)
+	if err := os.Mkdir(util.TempDirPrefix+"123", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	g := Generator{}
+	_, err := g.Generate(context.Background(), searchOptions(filepath.Join(util.TempDirPrefix+"123", "out")))
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate || !strings.Contains(err.Error(), "is inside the temporary directory") {
+		t.Fatalf("expected an output inside a temporary directory to be refused, got %v", err)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Errorf("the refused run created %d entries in the temporary directory root", len(entries)-1)
+	}
+
+	// The temporary directory root itself holds the temporary directories, but is not removed
+	if _, err := g.Generate(context.Background(), searchOptions(".")); err != nil {
+		t.Fatalf("generating into the temporary directory root failed: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "search_go.txt")); err != nil {
+		t.Errorf("search_go.txt was not generated: %s", err)
+	}
+}
+
+func TestGenerateVerifyCompile(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	setupGeneration(t)
+	setenv(t, "GOPROXY", "off")
+	setenv(t, "GOFLAGS", "")
+	// Writes the Go code in $GO_SOURCE to the go_out directory
+	fakeCommand(t, "protoc", `if [ "$1" = "--version" ]; then echo "libprotoc 3.19.4"; exit 0; fi
+for a in "$@"; do
+  case "$a" in
+    --go_out=*) printf '%s\n' "$GO_SOURCE" > "${a##*:}/search.pb.go";;
+  esac
+done
+`)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.VerifyCompile = true
+
+	setenv(t, "GO_SOURCE", "package searchv1\n\nfunc Query() { return 1 }")
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "generated code does not compile") {
+		t.Fatalf("expected code that does not compile to be refused, got %v", err)
+	}
+	if _, err := os.Stat("out"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("code that does not compile was copied to the output: %v", err)
+	}
+
+	setenv(t, "GO_SOURCE", "package searchv1\n\nfunc Query() int { return 1 }")
+	generateSearch(t, &Generator{}, opts)
+	if files := readDir(t, "out"); !reflect.DeepEqual(files, []string{"search.pb.go"}) {
+		t.Errorf("expected the compiling code to be copied, got %v", files)
+	}
+
+	opts.Offline = true
+	opts.CacheDir = t.TempDir()
+	_, err = (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate || !strings.Contains(err.Error(), "go mod tidy needs the network") {
+		t.Errorf("expected verifying Go code offline to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// LayoutData is the data the layout template is rendered with for each service
+type LayoutData struct {
+	Service  string
+	Language string
+}
+
+// parseLayout parses the layout template text
+func parseLayout(text string) (*template.Template, error) {
+	tmpl, err := template.New("layout").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid layout template: %s", err.Error())
+	}
+	return tmpl, nil
+}
+
+// layoutPath returns the output directory of service, rendered from the layout under opts.OutputPath. The rendered
+// directory must stay within the output.
+func (r *run) layoutPath(service string) (string, error) {
+	var b bytes.Buffer
+	if err := r.layout.Execute(&b, LayoutData{Service: service, Language: r.opts.Language}); err != nil {
+		return "", fmt.Errorf("Invalid layout template: %s", err.Error())
+	}
+
+	dir := filepath.Clean(filepath.FromSlash(b.String()))
+	if filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("The layout of the service '%s' must be a directory within the output, got '%s'", service, b.String())
+	}
+	return filepath.Join(r.opts.OutputPath, dir), nil
+}
@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"errors"
+	"time"
+)
+
+// Event is a structured record of the generation of a service, logged once the service is generated or has failed
+type Event struct {
+	// Message describes the event
+	Message string
+
+	Service  string
+	Language string
+
+	// Phase is the phase in which generating the service failed, if it did
+	Phase Phase
+
+	// Duration is how long generating the service took
+	Duration time.Duration
+
+	// Err is the failure of the service, if it did fail
+	Err error
+}
+
+// EventLogger is a Logger that also records structured events, such as a logger writing JSON lines
+type EventLogger interface {
+	Logger
+	Event(e Event)
+}
+
+// event logs e to the Logger, if it is an EventLogger. Other loggers only receive the message of successful events,
+// since failures are returned by Generate for the caller to report.
+func (g *Generator) event(e Event) {
+	if l, ok := g.Logger.(EventLogger); ok {
+		l.Event(e)
+		return
+	}
+	if e.Err == nil {
+		g.logf("%s", e.Message)
+	}
+}
+
+// failureEvent returns the event of the failure err generating service
+func failureEvent(service string, language string, start time.Time, err error) Event {
+	e := Event{Message: "Generation failed", Service: service, Language: language, Duration: time.Since(start), Err: err}
+
+	var genErr *Error
+	if errors.As(err, &genErr) {
+		e.Phase = genErr.Phase
+		e.Err = genErr.Err
+	}
+	return e
+}
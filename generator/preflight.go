@@ -0,0 +1,45 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// preflight checks that the repositories of services can be accessed before any of them is cloned, so that a batch
+// with missing credentials fails at once instead of at its first clone. One repository is checked per host. Nothing is
+// checked when nothing is fetched.
+func (g *Generator) preflight(ctx context.Context, opts Options, services []string) error {
+	if opts.SkipPreflight || opts.LocalSource != "" || opts.Offline {
+		return nil
+	}
+
+	ctx, cancel := phaseContext(ctx, opts.cloneTimeout())
+	defer cancel()
+
+	cloneOpts := opts.cloneOptions()
+	if opts.ProtoRepo != "" {
+		org, repo := util.ParseRepository(opts.ProtoRepo)
+		g.logf("Checking access to %s/%s", org, repo)
+		if err := util.CheckRemote(ctx, org, repo, cloneOpts); err != nil {
+			return &Error{Phase: PhaseClone, Err: fmt.Errorf("preflight check failed: %s", err.Error())}
+		}
+		return nil
+	}
+
+	checked := make(map[string]bool)
+	for _, s := range services {
+		host, _ := cloneOpts.ServiceRemote(s)
+		if checked[host] {
+			continue
+		}
+		checked[host] = true
+
+		g.logf("Checking access to %s with the repository of %s", host, s)
+		if err := util.CheckServiceRemote(ctx, s, cloneOpts); err != nil {
+			return &Error{Service: s, Phase: PhaseClone, Err: fmt.Errorf("preflight check failed: %s", err.Error())}
+		}
+	}
+	return nil
+}
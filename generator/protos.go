@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// ServiceProtos are the files of the public and private protobuf directories of a service, relative to them
+type ServiceProtos struct {
+	Service string
+
+	// Commit is the SHA of the commit the files were listed at
+	Commit string
+
+	Public  []string
+	Private []string
+}
+
+// ListProtos lists the files in the public/ and private/ protobuf directories of opts.Services at opts.Ref, which
+// defaults to the default branch, from either the central protobuf repository or the service source. Repositories are
+// cloned without their file contents and listed with git ls-tree, unless they are cached in opts.CacheDir.
+func (g *Generator) ListProtos(ctx context.Context, opts Options) ([]ServiceProtos, error) {
+	if opts.LocalSource != "" || opts.ProtoArtifactURL != "" {
+		return nil, &Error{Phase: PhaseValidate, Err: errors.New("Protobufs can only be listed from repositories, not a local source or protobuf artifact")}
+	}
+	if err := validateCache(opts); err != nil {
+		return nil, &Error{Phase: PhaseValidate, Err: err}
+	}
+	if _, err := util.ParseCloneURLTemplate(opts.CloneURLTemplate); err != nil {
+		return nil, &Error{Phase: PhaseValidate, Err: err}
+	}
+
+	services, err := normalizeServices(opts.Services)
+	if err != nil {
+		return nil, &Error{Phase: PhaseValidate, Err: err}
+	}
+	if len(services) == 0 {
+		services = util.KnownServices()
+	}
+
+	tmpDir, err := os.MkdirTemp(os.TempDir(), util.TempDirPrefix)
+	if err != nil {
+		return nil, &Error{Phase: PhaseSetup, Err: fmt.Errorf("cannot create temporary directory: %s", err.Error())}
+	}
+	defer func() {
+		if err := util.CleanUpDirectories(tmpDir); err != nil {
+			g.logf("Warning: %s", err.Error())
+		}
+	}()
+
+	cloneOpts := opts.cloneOptions()
+	var listed []ServiceProtos
+	for _, s := range services {
+		if err := ctx.Err(); err != nil {
+			return listed, &Error{Service: s, Phase: PhaseSetup, Err: err}
+		}
+
+		// The protobuf directories are <service>/ of the central protobuf repository, or proto/ of the service source
+		root := "proto"
+		if opts.ProtoRepo != "" {
+			root = s
+		}
+		dirs := []string{path.Join(root, scope(false)), path.Join(root, scope(true))}
+
+		cloneCtx, cancelClone := phaseContext(ctx, opts.cloneTimeout())
+		var files []string
+		var commit string
+		if opts.ProtoRepo != "" {
+			org, repo := util.ParseRepository(opts.ProtoRepo)
+			files, commit, err = util.ListRepositoryFiles(cloneCtx, org, repo, tmpDir, dirs, cloneOpts)
+		} else {
+			files, commit, err = util.ListServiceFiles(cloneCtx, s, tmpDir, dirs, cloneOpts)
+		}
+		cancelClone()
+		if err != nil {
+			return listed, &Error{Service: s, Phase: PhaseClone, Err: timeoutError(cloneCtx, "clone", opts.cloneTimeout(), err)}
+		}
+
+		protos := ServiceProtos{Service: s, Commit: commit}
+		for _, f := range files {
+			if rel := strings.TrimPrefix(f, dirs[0]+"/"); rel != f {
+				protos.Public = append(protos.Public, rel)
+			} else if rel := strings.TrimPrefix(f, dirs[1]+"/"); rel != f {
+				protos.Private = append(protos.Private, rel)
+			}
+		}
+		listed = append(listed, protos)
+	}
+	return listed, nil
+}
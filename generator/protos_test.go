@@ -0,0 +1,42 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestListProtos(t *testing.T) {
+	setupGeneration(t)
+	remoteRepository(t, "protos", map[string]string{
+		"search/public/search.proto":   searchProto,
+		"search/public/v1/types.proto": searchProto,
+		"search/private/admin.proto":   searchProto,
+		"search/README.md":             "search\n",
+		"query/public/query.proto":     searchProto,
+	})
+	opts := Options{Services: []string{"search", "query"}, ProtoRepo: "org/protos"}
+
+	listed, err := (&Generator{}).ListProtos(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || listed[0].Commit == "" || listed[0].Commit != listed[1].Commit {
+		t.Fatalf("listed %+v, want both services at the same commit", listed)
+	}
+	want := []ServiceProtos{
+		{Service: "search", Commit: listed[0].Commit, Public: []string{"search.proto", "v1/types.proto"}, Private: []string{"admin.proto"}},
+		{Service: "query", Commit: listed[0].Commit, Public: []string{"query.proto"}},
+	}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("listed %+v, want %+v", listed, want)
+	}
+
+	opts.LocalSource = t.TempDir()
+	_, err = (&Generator{}).ListProtos(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate {
+		t.Errorf("expected listing a local source to be refused, got %v", err)
+	}
+}
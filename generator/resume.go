@@ -0,0 +1,38 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/asmahood/proto-client-generator/util"
+)
+
+// resumeStatePath returns the path of the resume state of a batch run of services with opts. Runs generating the same
+// services, in any order, in the same language and scope from the same repositories and ref into the same output share
+// their state. It is kept in the cache directory if there is one, and otherwise the temporary directory.
+func resumeStatePath(opts Options, services []string) string {
+	output, err := filepath.Abs(opts.OutputPath)
+	if err != nil {
+		output = opts.OutputPath
+	}
+	sorted := append([]string(nil), services...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%t\x00%s\x00%s\x00%s\x00%s", opts.Language, output, opts.Private, opts.ProtoRepo, opts.LocalSource, opts.Ref, strings.Join(sorted, ","))))
+
+	dir := opts.CacheDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return util.ResumeStatePath(dir, hex.EncodeToString(sum[:8]))
+}
+
+// resumable returns whether the services generated by the run are recorded in its resume state. Only batch runs that
+// write to the output are recorded.
+func (r *run) resumable() bool {
+	return r.batch && !r.opts.ListFiles && !r.opts.Diff
+}
@@ -0,0 +1,34 @@
+package generator
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeStatePath(t *testing.T) {
+	opts := Options{Language: "golang", OutputPath: "out", CacheDir: t.TempDir()}
+
+	path := resumeStatePath(opts, []string{"search", "billing"})
+	if filepath.Dir(path) != opts.CacheDir {
+		t.Errorf("resume state %s is not in the cache directory %s", path, opts.CacheDir)
+	}
+	if got := resumeStatePath(opts, []string{"billing", "search"}); got != path {
+		t.Errorf("the order of the services changed the resume state: %s != %s", got, path)
+	}
+
+	for name, services := range map[string][]string{
+		"fewer services": {"search"},
+		"other services": {"search", "users"},
+		"more services":  {"search", "billing", "users"},
+	} {
+		if got := resumeStatePath(opts, services); got == path {
+			t.Errorf("%s share the resume state %s", name, path)
+		}
+	}
+
+	other := opts
+	other.Ref = "v2"
+	if got := resumeStatePath(other, []string{"search", "billing"}); got == path {
+		t.Errorf("another ref shares the resume state %s", path)
+	}
+}
@@ -0,0 +1,39 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (o Options) cloneTimeout() time.Duration {
+	if o.CloneTimeout > 0 {
+		return o.CloneTimeout
+	}
+	return o.Timeout
+}
+
+func (o Options) generateTimeout() time.Duration {
+	if o.GenerateTimeout > 0 {
+		return o.GenerateTimeout
+	}
+	return o.Timeout
+}
+
+// phaseContext returns ctx bounded by timeout for the commands of a phase. A timeout of 0 leaves it unbounded
+func phaseContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutError returns err, or describes the timeout of the phase's commands if ctx exceeded its deadline, since the
+// error of a killed command does not
+func timeoutError(ctx context.Context, phase string, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s: %s", phase, timeout, err.Error())
+	}
+	return err
+}
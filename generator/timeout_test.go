@@ -0,0 +1,69 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhaseTimeouts(t *testing.T) {
+	opts := Options{Timeout: time.Minute}
+	if opts.cloneTimeout() != time.Minute || opts.generateTimeout() != time.Minute {
+		t.Errorf("the phases do not fall back to the timeout: %s, %s", opts.cloneTimeout(), opts.generateTimeout())
+	}
+
+	opts.CloneTimeout, opts.GenerateTimeout = 10*time.Minute, 30*time.Second
+	if opts.cloneTimeout() != 10*time.Minute || opts.generateTimeout() != 30*time.Second {
+		t.Errorf("got clone timeout %s and generate timeout %s", opts.cloneTimeout(), opts.generateTimeout())
+	}
+}
+
+func TestPhaseContext(t *testing.T) {
+	ctx, cancel := phaseContext(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("a phase without a timeout has a deadline")
+	}
+
+	start := time.Now()
+	ctx, cancel = phaseContext(context.Background(), time.Hour)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || deadline.Before(start.Add(time.Hour)) || deadline.After(time.Now().Add(time.Hour)) {
+		t.Errorf("got deadline %s, %t, want an hour from now", deadline, ok)
+	}
+
+	err := errors.New("signal: killed")
+	if got := timeoutError(context.Background(), "clone", time.Hour, err); got != err {
+		t.Errorf("an error without a timeout was replaced by %v", got)
+	}
+	expired, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	<-expired.Done()
+	if got := timeoutError(expired, "clone", time.Hour, err); got == nil || got.Error() != "clone timed out after 1h0m0s: signal: killed" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestGenerateTimeout(t *testing.T) {
+	setupGeneration(t)
+	fakeCommand(t, "protoc", `if [ "$1" = "--version" ]; then echo "libprotoc 3.19.4"; exit 0; fi
+exec sleep 10
+`)
+	searchRepository(t)
+	opts := searchOptions("out")
+	opts.Timeout = time.Hour
+	opts.GenerateTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := (&Generator{}).Generate(context.Background(), opts)
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseGenerate || !strings.Contains(err.Error(), "generation timed out after 100ms") {
+		t.Fatalf("expected generation to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("generation was stopped after %s", elapsed)
+	}
+}
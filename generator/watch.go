@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long Watch waits for changes to settle before regenerating
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+// Watch generates code as Generate does, then regenerates it whenever a protobuf in opts.LocalSource changes until ctx
+// is cancelled. Changes are debounced, so saving several files regenerates once. done is called with the result of
+// every generation.
+func (g *Generator) Watch(ctx context.Context, opts Options, debounce time.Duration, done func(Result, error)) error {
+	if opts.LocalSource == "" {
+		return &Error{Phase: PhaseValidate, Err: errors.New("A local source must be given to watch for changes")}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return &Error{Phase: PhaseSetup, Err: fmt.Errorf("cannot watch local source: %s", err.Error())}
+	}
+	defer watcher.Close()
+
+	if err := watchDirs(watcher, opts.LocalSource); err != nil {
+		return &Error{Phase: PhaseSetup, Err: err}
+	}
+
+	done(g.Generate(ctx, opts))
+	g.logf("Watching %s for changes", opts.LocalSource)
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// Watch directories created after starting, so their protobufs are also watched
+			if event.Op&fsnotify.Create != 0 {
+				if err := watchDirs(watcher, event.Name); err != nil {
+					g.logf("Warning: %s", err.Error())
+				}
+			}
+			if filepath.Ext(event.Name) != ".proto" {
+				continue
+			}
+			g.logf("Detected change to %s", event.Name)
+			timer = time.After(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			g.logf("Warning: error watching local source: %s", err.Error())
+		case <-timer:
+			timer = nil
+			g.logf("Regenerating")
+			done(g.Generate(ctx, opts))
+		}
+	}
+}
+
+// watchDirs adds root and every directory below it to watcher, skipping .git directories. root may be a file, in which
+// case nothing is added.
+func watchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("cannot watch '%s': %s", path, err.Error())
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("cannot watch '%s': %s", path, err.Error())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,70 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	setupGeneration(t)
+	src := localSource(t)
+	opts := searchOptions("out")
+	opts.LocalSource = src
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan error, 10)
+	watched := make(chan error)
+	go func() {
+		watched <- (&Generator{}).Watch(ctx, opts, 20*time.Millisecond, func(_ Result, err error) { results <- err })
+	}()
+
+	next := func() {
+		t.Helper()
+		select {
+		case err := <-results:
+			if err != nil {
+				t.Fatalf("generation failed: %s", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the protobuf was not generated")
+		}
+	}
+	next()
+
+	// Other files do not regenerate, a changed protobuf does so once its changes settle
+	writeFile(t, src, "README.md", "search\n")
+	path := filepath.Join(src, "proto", "public", "search.proto")
+	if err := os.WriteFile(path, []byte(searchProto+"\n// changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	next()
+	select {
+	case <-results:
+		t.Error("the protobuf was generated more than once for its changes")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case err := <-watched:
+		if err != nil {
+			t.Fatalf("Watch returned %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not return once cancelled")
+	}
+}
+
+func TestWatchRequiresLocalSource(t *testing.T) {
+	err := (&Generator{}).Watch(context.Background(), Options{Services: []string{"search"}}, time.Millisecond, func(Result, error) {})
+	var genErr *Error
+	if !errors.As(err, &genErr) || genErr.Phase != PhaseValidate || !strings.Contains(err.Error(), "local source") {
+		t.Fatalf("expected watching without a local source to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// archiveTime is the modification time of every file in an archive, so that archives of the same files are identical.
+// It is the earliest time a zip archive can record
+var archiveTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// ArchiveFormat returns the format of the archive written to path, chosen by its extension
+func ArchiveFormat(path string) (string, error) {
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		return ArchiveZip, nil
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return ArchiveTarGz, nil
+	}
+	return "", fmt.Errorf("Unsupported archive '%s', expected a .zip, .tar.gz or .tgz file", path)
+}
+
+// archiveFile is a file added to an archive
+type archiveFile struct {
+	// name is the slash separated path of the file in the archive
+	name string
+	src  string
+}
+
+// ArchiveOutput is an output directory added to an archive, holding the generated files of Services
+type ArchiveOutput struct {
+	Path     string
+	Services []string
+}
+
+// archiveFiles returns the files recorded in the manifests of outputs for their services, along with the manifests
+// themselves. Files of other services generated into the same directory by earlier runs are left out. Names are
+// relative to root.
+func archiveFiles(root string, outputs []ArchiveOutput) ([]archiveFile, error) {
+	var files []archiveFile
+	for _, output := range outputs {
+		rel, err := filepath.Rel(root, output.Path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot archive '%s': %s", output.Path, err.Error())
+		}
+		dir := filepath.ToSlash(rel)
+
+		manifest, err := ReadManifest(output.Path)
+		if err != nil {
+			return nil, err
+		}
+		// A file shared by several services is recorded once for each of them
+		seen := make(map[string]bool)
+		for _, service := range output.Services {
+			for _, f := range manifest.ServiceFiles(service) {
+				if seen[f.Name] {
+					continue
+				}
+				seen[f.Name] = true
+				files = append(files, archiveFile{name: path.Join(dir, f.Name), src: filepath.Join(output.Path, filepath.FromSlash(f.Name))})
+			}
+		}
+		files = append(files, archiveFile{name: path.Join(dir, ManifestName), src: filepath.Join(output.Path, ManifestName)})
+	}
+	return files, nil
+}
+
+// WriteArchive writes the generated files of outputs, and their manifests, into the archive at archivePath. The files
+// are named by their path relative to root. The archive is written to a temporary file renamed over archivePath once
+// complete, so that a failed run leaves any previous archive as it was.
+func WriteArchive(archivePath string, root string, outputs []ArchiveOutput) error {
+	format, err := ArchiveFormat(archivePath)
+	if err != nil {
+		return err
+	}
+
+	files, err := archiveFiles(root, outputs)
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return fmt.Errorf("cannot create directory for archive: %s", err.Error())
+	}
+	out, err := os.CreateTemp(filepath.Dir(archivePath), fmt.Sprintf(".%s.tmp-*", filepath.Base(archivePath)))
+	if err != nil {
+		return fmt.Errorf("cannot create archive: %s", err.Error())
+	}
+	tmp := out.Name()
+	fail := func(err error) error {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if format == ArchiveZip {
+		err = writeZip(out, files)
+	} else {
+		err = writeTarGz(out, files)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	// The temporary file is created readable only by its owner
+	if err := out.Chmod(0644); err != nil {
+		return fail(fmt.Errorf("cannot set the mode of archive: %s", err.Error()))
+	}
+	if err := out.Close(); err != nil {
+		return fail(fmt.Errorf("cannot write archive: %s", err.Error()))
+	}
+	if err := os.Rename(tmp, archivePath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cannot replace archive: %s", err.Error())
+	}
+	return nil
+}
+
+func writeZip(w io.Writer, files []archiveFile) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		info, err := os.Stat(f.src)
+		if err != nil {
+			return fmt.Errorf("cannot archive '%s': %s", f.name, err.Error())
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return fmt.Errorf("cannot archive '%s': %s", f.name, err.Error())
+		}
+		header.Name = f.name
+		header.Method = zip.Deflate
+		header.Modified = archiveTime
+
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("cannot archive '%s': %s", f.name, err.Error())
+		}
+		if err := copyToArchive(dst, f); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("cannot write archive: %s", err.Error())
+	}
+	return nil
+}
+
+func writeTarGz(w io.Writer, files []archiveFile) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		info, err := os.Stat(f.src)
+		if err != nil {
+			return fmt.Errorf("cannot archive '%s': %s", f.name, err.Error())
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return fmt.Errorf("cannot archive '%s': %s", f.name, err.Error())
+		}
+		header.Name = f.name
+
+		// Only the name, mode and size of files are recorded, leaving out times and owners
+		header.ModTime = archiveTime
+		header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("cannot archive '%s': %s", f.name, err.Error())
+		}
+		if err := copyToArchive(tw, f); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("cannot write archive: %s", err.Error())
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("cannot write archive: %s", err.Error())
+	}
+	return nil
+}
+
+// copyToArchive copies the contents of f to the archive entry w
+func copyToArchive(w io.Writer, f archiveFile) error {
+	in, err := os.Open(f.src)
+	if err != nil {
+		return fmt.Errorf("cannot archive '%s': %s", f.name, err.Error())
+	}
+	defer in.Close()
+
+	if _, err := io.Copy(w, in); err != nil {
+		return fmt.Errorf("cannot archive '%s': %s", f.name, err.Error())
+	}
+	return nil
+}
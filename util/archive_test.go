@@ -0,0 +1,130 @@
+package util
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"client.zip", ArchiveZip, false},
+		{"client.tar.gz", ArchiveTarGz, false},
+		{"dist/client.tgz", ArchiveTarGz, false},
+		{"client.tar", "", true},
+		{"client", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ArchiveFormat(tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ArchiveFormat(%s) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestWriteArchiveReproducible(t *testing.T) {
+	root := t.TempDir()
+	output := filepath.Join(root, "search")
+	m := &Manifest{Language: "golang"}
+	var copied []CopiedFile
+	for _, name := range []string{"search/search.pb.go", "common/page.pb.go"} {
+		data := "package " + filepath.Base(filepath.Dir(name)) + "\n"
+		path := writeFile(t, output, name, data)
+		sum, err := FileSHA256(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copied = append(copied, CopiedFile{Name: name, Size: int64(len(data)), SHA256: sum})
+	}
+	m.SetServiceFiles("search", copied)
+	if err := WriteManifest(output, m); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"client.zip", "client.tar.gz"} {
+		first := filepath.Join(t.TempDir(), name)
+		if err := WriteArchive(first, root, []ArchiveOutput{{Path: output, Services: []string{"search"}}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Regenerated files have new modification times
+		later := time.Now().Add(time.Hour)
+		for _, f := range append(m.Files, ManifestFile{Name: ManifestName}) {
+			if err := os.Chtimes(filepath.Join(output, filepath.FromSlash(f.Name)), later, later); err != nil {
+				t.Fatal(err)
+			}
+		}
+		second := filepath.Join(t.TempDir(), name)
+		if err := WriteArchive(second, root, []ArchiveOutput{{Path: output, Services: []string{"search"}}}); err != nil {
+			t.Fatal(err)
+		}
+
+		firstData, _ := os.ReadFile(first)
+		secondData, _ := os.ReadFile(second)
+		if len(firstData) == 0 || !bytes.Equal(firstData, secondData) {
+			t.Errorf("archives %s of the same files are not identical", name)
+		}
+	}
+}
+
+func TestWriteArchiveServices(t *testing.T) {
+	output := t.TempDir()
+	m := &Manifest{Language: "golang"}
+	for _, service := range []string{"search", "query"} {
+		data := "package " + service + "\n"
+		path := writeFile(t, output, service+".pb.go", data)
+		sum, err := FileSHA256(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetServiceFiles(service, []CopiedFile{{Name: service + ".pb.go", Size: int64(len(data)), SHA256: sum}})
+	}
+	if err := WriteManifest(output, m); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the files of the services given are archived
+	archive := filepath.Join(t.TempDir(), "client.zip")
+	if err := WriteArchive(archive, output, []ArchiveOutput{{Path: output, Services: []string{"search"}}}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	r.Close()
+	if got, want := strings.Join(names, ","), ManifestName+",search.pb.go"; got != want {
+		t.Errorf("the archive holds %s, want %s", got, want)
+	}
+	previous, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed archive leaves the previous one and no temporary file behind
+	if err := os.Remove(filepath.Join(output, "query.pb.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteArchive(archive, output, []ArchiveOutput{{Path: output, Services: []string{"search", "query"}}}); err == nil {
+		t.Fatal("expected archiving a missing file to fail")
+	}
+	if data, _ := os.ReadFile(archive); !bytes.Equal(data, previous) {
+		t.Error("the failed run replaced the previous archive")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(archive)); len(entries) != 1 {
+		t.Errorf("the failed run left %d files next to the archive", len(entries)-1)
+	}
+}
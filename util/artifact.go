@@ -0,0 +1,257 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ArtifactOptions configures how a protobuf artifact is downloaded
+type ArtifactOptions struct {
+	// SHA256 is the hex encoded checksum the downloaded archive must match
+	SHA256 string
+
+	// HTTPProxy and HTTPSProxy are the proxies the artifact is downloaded through. When empty, any proxy configured in
+	// the environment is used
+	HTTPProxy  string
+	HTTPSProxy string
+
+	// MaxFileSize is the largest file in bytes that is extracted from the archive. 0 disables the limit
+	MaxFileSize int64
+}
+
+// ValidateSHA256 returns an error if sum is not a hex encoded SHA-256 checksum
+func ValidateSHA256(sum string) error {
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("Invalid SHA-256 checksum '%s', expected 64 hexadecimal characters", sum)
+	}
+	return nil
+}
+
+// ValidateArtifactURL returns an error if rawURL is not the URL of an archive that DownloadArtifact can extract
+func ValidateArtifactURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("Invalid artifact URL '%s': %s", rawURL, err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Invalid artifact URL '%s', expected an http or https URL", rawURL)
+	}
+	_, err = ArchiveFormat(u.Path)
+	return err
+}
+
+// DownloadArtifact downloads the .zip, .tar.gz or .tgz archive at rawURL, verifies its checksum and extracts it into a
+// new directory in dir, returning the directory. When the archive holds a single top-level directory, as release
+// tarballs usually do, that directory is returned instead, unless it is a protobuf directory itself.
+func DownloadArtifact(ctx context.Context, rawURL string, dir string, opts ArtifactOptions) (string, error) {
+	if err := ValidateArtifactURL(rawURL); err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(rawURL)
+	format, _ := ArchiveFormat(u.Path)
+
+	archive, err := os.CreateTemp(dir, "artifact-*."+format)
+	if err != nil {
+		return "", fmt.Errorf("cannot create artifact file: %s", err.Error())
+	}
+	defer archive.Close()
+
+	if err := download(ctx, u, archive, opts); err != nil {
+		return "", fmt.Errorf("failed to download artifact '%s': %s", rawURL, err.Error())
+	}
+
+	root, err := os.MkdirTemp(dir, "artifact-")
+	if err != nil {
+		return "", fmt.Errorf("cannot create artifact directory: %s", err.Error())
+	}
+	if format == ArchiveZip {
+		err = extractZip(archive.Name(), root, opts.MaxFileSize)
+	} else {
+		err = extractTarGz(archive, root, opts.MaxFileSize)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot extract artifact '%s': %s", rawURL, err.Error())
+	}
+	return artifactRoot(root), nil
+}
+
+// download writes the body of u to f, checking it matches the checksum of opts. f is left at its start.
+func download(ctx context.Context, u *url.URL, f *os.File, opts ArtifactOptions) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: opts.proxy}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), resp.Body); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, opts.SHA256) {
+		return fmt.Errorf("checksum mismatch, expected %s but got %s", strings.ToLower(opts.SHA256), sum)
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
+
+// proxy returns the proxy of req, preferring the configured proxies over those of the environment
+func (o ArtifactOptions) proxy(req *http.Request) (*url.URL, error) {
+	return httpProxy(req, o.HTTPProxy, o.HTTPSProxy)
+}
+
+// httpProxy returns the proxy of req: httpsProxy or httpProxy by its scheme, or else the proxy of the environment
+func httpProxy(req *http.Request, httpProxy string, httpsProxy string) (*url.URL, error) {
+	switch {
+	case req.URL.Scheme == "https" && httpsProxy != "":
+		return url.Parse(httpsProxy)
+	case req.URL.Scheme == "http" && httpProxy != "":
+		return url.Parse(httpProxy)
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// extractPath returns the path in root of the archive entry name, which must not escape root
+func extractPath(root string, name string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("entry '%s' is outside the archive", name)
+	}
+	return filepath.Join(root, filepath.FromSlash(clean)), nil
+}
+
+// extractFile writes the contents of an archive entry to dst. A maxSize of 0 disables the size check
+func extractFile(r io.Reader, dst string, name string, maxSize int64) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModeDir|0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	n, err := io.Copy(out, r)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && n > maxSize {
+		return fmt.Errorf("file '%s' exceeds the maximum allowed size of %d bytes", name, maxSize)
+	}
+	return out.Close()
+}
+
+func extractTarGz(r io.Reader, root string, maxSize int64) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// Only directories and regular files are extracted, links could point outside the archive
+		dst, err := extractPath(root, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(dst, os.ModeDir|0755)
+		case tar.TypeReg:
+			err = extractFile(tr, dst, header.Name, maxSize)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(archive string, root string, maxSize int64) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		dst, err := extractPath(root, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(dst, os.ModeDir|0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		in, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = extractFile(in, dst, f.Name, maxSize)
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// artifactRoot returns the single top-level directory of the extracted archive in root, or root itself
+func artifactRoot(root string) string {
+	entries, err := os.ReadDir(root)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return root
+	}
+	switch name := entries[0].Name(); name {
+	case "proto", "public", "private":
+		return root
+	default:
+		return filepath.Join(root, name)
+	}
+}
+
+// ArtifactProtoRoot returns the directory holding the public/ and private/ protobuf directories of an artifact
+// extracted to dir: its proto/ directory, as in a service repository, or otherwise dir itself
+func ArtifactProtoRoot(dir string) string {
+	if info, err := os.Stat(filepath.Join(dir, "proto")); err == nil && info.IsDir() {
+		return filepath.Join(dir, "proto")
+	}
+	return dir
+}
@@ -0,0 +1,132 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarGz returns a .tar.gz archive of files, keyed by their slash separated names
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	tw := tar.NewWriter(zw)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// serveArtifacts serves archives keyed by their path, returning the URL of the server
+func serveArtifacts(t *testing.T, archives map[string][]byte) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDownloadArtifact(t *testing.T) {
+	release := tarGz(t, map[string]string{"search-1.2.0/proto/public/search.proto": "syntax = \"proto3\";\n"})
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, err := zw.Create("public/search.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("syntax = \"proto3\";\n"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	escaping := tarGz(t, map[string]string{"../search.proto": "syntax = \"proto3\";\n"})
+
+	url := serveArtifacts(t, map[string][]byte{"/search.tar.gz": release, "/search.zip": zipped.Bytes(), "/escaping.tgz": escaping})
+	ctx := context.Background()
+
+	dir, err := DownloadArtifact(ctx, url+"/search.tar.gz", t.TempDir(), ArtifactOptions{SHA256: strings.ToUpper(sha256Hex(release))})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if filepath.Base(dir) != "search-1.2.0" {
+		t.Errorf("the top-level directory of the release was not returned: %s", dir)
+	}
+	if _, err := os.Stat(filepath.Join(ArtifactProtoRoot(dir), "public", "search.proto")); err != nil {
+		t.Errorf("the protobuf was not extracted: %s", err)
+	}
+
+	dir, err = DownloadArtifact(ctx, url+"/search.zip", t.TempDir(), ArtifactOptions{SHA256: sha256Hex(zipped.Bytes())})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ArtifactProtoRoot(dir) != dir {
+		t.Errorf("an archive of the protobuf directories has the proto root %s", ArtifactProtoRoot(dir))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "public", "search.proto")); err != nil {
+		t.Errorf("the protobuf was not extracted: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		sum     string
+		wantErr string
+	}{
+		{"checksum mismatch", url + "/search.tar.gz", sha256Hex([]byte("other")), "checksum mismatch"},
+		{"missing", url + "/missing.tar.gz", sha256Hex(release), "unexpected status 404"},
+		{"escaping entry", url + "/escaping.tgz", sha256Hex(escaping), "is outside the archive"},
+		{"unknown format", url + "/search.rar", sha256Hex(release), ""},
+		{"not http", "ftp://example.com/search.tar.gz", sha256Hex(release), "expected an http or https URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DownloadArtifact(ctx, tt.url, t.TempDir(), ArtifactOptions{SHA256: tt.sum})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSHA256(t *testing.T) {
+	if err := ValidateSHA256(sha256Hex(nil)); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for _, sum := range []string{"", "abc", strings.Repeat("z", 64)} {
+		if err := ValidateSHA256(sum); err == nil {
+			t.Errorf("the checksum %q was accepted", sum)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// BufConfigName is the name of the buf configuration file that enables linting
+const BufConfigName = "buf.yaml"
+
+// BufAvailable returns true if a buf binary can be found on the PATH
+func BufAvailable() bool {
+	_, err := exec.LookPath("buf")
+	return err == nil
+}
+
+// FindBufConfig returns the path of the first buf.yaml found in dirs, or an empty string if none of them have one
+func FindBufConfig(dirs ...string) string {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, BufConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+func bufLintCmd(ctx context.Context, protoDir string, config string) *exec.Cmd {
+	return exec.CommandContext(ctx, "buf", "lint", protoDir, "--config", config)
+}
+
+// BufLint runs buf lint over the protobufs in protoDir using the buf configuration file config. If buf reports any
+// violations, they are returned in the error.
+func BufLint(ctx context.Context, protoDir string, config string) error {
+	out, err := bufLintCmd(ctx, protoDir, config).CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(out) > 0 {
+			return fmt.Errorf("buf lint found violations:\n\n%s", out)
+		}
+		return fmt.Errorf("failed to run buf lint: %s", err.Error())
+	}
+
+	return nil
+}
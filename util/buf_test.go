@@ -0,0 +1,55 @@
+package util
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBufLintCmd(t *testing.T) {
+	cmd := bufLintCmd(context.Background(), "/tmp/proto", "/src/buf.yaml")
+	want := []string{"buf", "lint", "/tmp/proto", "--config", "/src/buf.yaml"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Fatalf("got %v, want %v", cmd.Args, want)
+	}
+}
+
+func TestBufLint(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{"no violations", "exit 0\n", ""},
+		{"violations", "echo 'search.proto:1:1:Package name \"search\" should be suffixed'\nexit 100\n", "buf lint found violations"},
+		{"failure without output", "exit 1\n", "failed to run buf lint"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommand(t, "buf", tt.script)
+			err := BufLint(context.Background(), t.TempDir(), "buf.yaml")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindBufConfig(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	config := writeFile(t, second, BufConfigName, "version: v1\n")
+	if got := FindBufConfig(first, second); got != config {
+		t.Fatalf("got %q, want %q", got, config)
+	}
+	if got := FindBufConfig(first); got != "" {
+		t.Fatalf("got %q, want no config", got)
+	}
+}
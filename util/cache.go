@@ -0,0 +1,143 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CachePath returns the path of the cached clone of org/repo from host in cacheDir
+func CachePath(cacheDir string, host string, org string, repo string) string {
+	return filepath.Join(cacheDir, host, org, repo)
+}
+
+// cachedRepository returns the path of the cached clone of org/repo, cloning it when it is not cached yet and
+// otherwise updating it to opts.Ref, or the remote's default branch. A branch or tag fetched for opts.Ref is kept as
+// refs/remotes/origin/<ref>. In offline mode the remote is not fetched, and opts.Ref is checked out from the commits
+// and refs already in the cache, failing if it is not there. With opts.Refresh the remote is always fetched, pruning
+// deleted refs, and the clone is reset to it, discarding any local changes or history the remote no longer has.
+func cachedRepository(ctx context.Context, org string, repo string, opts CloneOptions) (string, error) {
+	src := CachePath(opts.CacheDir, opts.host(), org, repo)
+	_, err := os.Stat(filepath.Join(src, ".git"))
+	cached := err == nil
+	pinned := IsCommitSHA(opts.Ref)
+
+	if opts.Offline {
+		if !cached {
+			return "", fmt.Errorf("repository '%s/%s' is not in the cache '%s' and cannot be cloned offline", org, repo, opts.CacheDir)
+		}
+		if opts.Ref == "" {
+			return src, nil
+		}
+		checkoutOpts := opts
+		if !pinned {
+			sha, err := cachedRef(ctx, src, opts.Ref)
+			if err != nil {
+				return "", fmt.Errorf("the ref '%s' of repository '%s/%s' is not in the cache '%s'. Offline mode can only use refs fetched before, so generate once without --offline", opts.Ref, org, repo, opts.CacheDir)
+			}
+			checkoutOpts.Ref = sha
+		}
+		if err := checkoutOpts.checkout(ctx, src); err != nil {
+			return "", fmt.Errorf("failed to check out cached repository '%s/%s': %s", org, repo, err.Error())
+		}
+		return src, nil
+	}
+
+	if !cached {
+		if err := os.MkdirAll(filepath.Dir(src), 0755); err != nil {
+			return "", fmt.Errorf("cannot create cache directory: %s", err.Error())
+		}
+		// Remove anything left behind by an interrupted clone
+		if err := os.RemoveAll(src); err != nil {
+			return "", fmt.Errorf("cannot remove incomplete cached clone: %s", err.Error())
+		}
+
+		if err := opts.runClone(ctx, org, repo, src); err != nil {
+			os.RemoveAll(src)
+			return "", err
+		}
+		if pinned {
+			if err := opts.checkout(ctx, src); err != nil {
+				return "", fmt.Errorf("failed to check out repository '%s/%s': %s", org, repo, err.Error())
+			}
+		}
+		return src, nil
+	}
+
+	// A pinned commit never changes, so the remote is only fetched when the commit is not cached yet
+	if pinned {
+		if opts.Refresh || exec.CommandContext(ctx, "git", "-C", src, "cat-file", "-e", opts.Ref+"^{commit}").Run() != nil {
+			// The cached clone may be shallow or hold only the branch first cloned, so the full history of every branch
+			// and tag is fetched to find the commit
+			fetchArgs := append([]string{"-C", src, "fetch"}, opts.refreshArgs()...)
+			if _, err := os.Stat(filepath.Join(src, ".git", "shallow")); err == nil {
+				fetchArgs = append(fetchArgs, "--unshallow")
+			}
+			fetchArgs = append(fetchArgs, "origin", "+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*")
+			fetchCmd := exec.CommandContext(ctx, "git", fetchArgs...)
+			fetchCmd.Env = opts.env()
+			if err := fetchCmd.Run(); err != nil {
+				return "", fmt.Errorf("failed to update cached repository '%s/%s': %s", org, repo, err.Error())
+			}
+		}
+		if err := opts.checkout(ctx, src); err != nil {
+			return "", fmt.Errorf("failed to check out cached repository '%s/%s': %s", org, repo, err.Error())
+		}
+		return src, nil
+	}
+
+	// A named ref is also kept as a remote-tracking ref, so that it can be checked out offline
+	ref := "HEAD"
+	if opts.Ref != "" {
+		ref = fmt.Sprintf("+%s:refs/remotes/origin/%s", opts.Ref, opts.Ref)
+	}
+	fetchArgs := append([]string{"-C", src, "fetch"}, opts.refreshArgs()...)
+	if opts.Depth > 0 {
+		fetchArgs = append(fetchArgs, fmt.Sprintf("--depth=%d", opts.Depth))
+	}
+	fetchCmd := exec.CommandContext(ctx, "git", append(fetchArgs, "origin", ref)...)
+	fetchCmd.Env = opts.env()
+	if err := fetchCmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to update cached repository '%s/%s': %s", org, repo, err.Error())
+	}
+
+	// Resetting rather than merging follows a branch that was force pushed
+	resetCmd := exec.CommandContext(ctx, "git", "-C", src, "reset", "--hard", "FETCH_HEAD")
+	if err := resetCmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to update cached repository '%s/%s': %s", org, repo, err.Error())
+	}
+	if opts.Refresh {
+		if err := exec.CommandContext(ctx, "git", "-C", src, "clean", "-ffdx").Run(); err != nil {
+			return "", fmt.Errorf("failed to refresh cached repository '%s/%s': %s", org, repo, err.Error())
+		}
+	}
+
+	if err := opts.updateSubmodules(ctx, src); err != nil {
+		return "", fmt.Errorf("failed to update submodules of cached repository '%s/%s': %s", org, repo, err.Error())
+	}
+	return src, nil
+}
+
+// cachedRef returns the SHA of the commit the branch or tag ref points to in the cached clone at src, looking it up as
+// a remote-tracking branch, a tag and a local branch in turn
+func cachedRef(ctx context.Context, src string, ref string) (string, error) {
+	for _, name := range []string{"refs/remotes/origin/" + ref, "refs/tags/" + ref, "refs/heads/" + ref} {
+		out, err := exec.CommandContext(ctx, "git", "-C", src, "rev-parse", "--verify", "--quiet", name+"^{commit}").Output()
+		if err == nil {
+			return strings.TrimSpace(string(out)), nil
+		}
+	}
+	return "", fmt.Errorf("ref '%s' not found", ref)
+}
+
+// refreshArgs returns the arguments of git fetch that refresh a cached clone: refs deleted from the remote are pruned,
+// and tags moved on the remote are updated
+func (o CloneOptions) refreshArgs() []string {
+	if !o.Refresh {
+		return nil
+	}
+	return []string{"--prune", "--prune-tags", "--tags", "--force"}
+}
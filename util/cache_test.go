@@ -0,0 +1,80 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCachedRepositoryOfflineRef(t *testing.T) {
+	opts := remoteRepository(t, "search")
+	ctx := context.Background()
+
+	// The default branch is cached online, then the feature branch
+	if _, err := cachedRepository(ctx, "org", "search", opts); err != nil {
+		t.Fatal(err)
+	}
+	opts.Ref = "feature"
+	src, err := cachedRepository(ctx, "org", "search", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feature := git(t, src, "rev-parse", "HEAD")
+
+	opts.Offline = true
+	for _, tt := range []struct {
+		ref  string
+		want string
+	}{
+		{"v1", git(t, src, "rev-parse", "v1^{commit}")},
+		{"feature", feature},
+	} {
+		opts.Ref = tt.ref
+		if _, err := cachedRepository(ctx, "org", "search", opts); err != nil {
+			t.Fatalf("ref %s: %s", tt.ref, err)
+		}
+		if got := git(t, src, "rev-parse", "HEAD"); got != tt.want {
+			t.Fatalf("ref %s checked out %s, want %s", tt.ref, got, tt.want)
+		}
+	}
+
+	opts.Ref = "missing"
+	if _, err := cachedRepository(ctx, "org", "search", opts); err == nil || !strings.Contains(err.Error(), "is not in the cache") {
+		t.Fatalf("expected a ref missing from the cache to fail offline, got %v", err)
+	}
+}
+
+func TestCachedRepositoryRefresh(t *testing.T) {
+	opts := remoteRepository(t, "search")
+	ctx := context.Background()
+	src, err := cachedRepository(ctx, "org", "search", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	git(t, src, "fetch", "--quiet", "origin", "+refs/tags/*:refs/tags/*")
+	writeFile(t, src, "stray.txt", "left behind\n")
+
+	// The remote's main branch is force pushed and its tag moved
+	remote := strings.TrimPrefix(git(t, src, "remote", "get-url", "origin"), "file://")
+	writeFile(t, remote, "proto/public/search.proto", "syntax = \"proto3\";\n\npackage search.v3;\n")
+	git(t, remote, "commit", "--quiet", "--amend", "-am", "rewritten")
+	git(t, remote, "tag", "--force", "v1")
+	rewritten := git(t, remote, "rev-parse", "HEAD")
+
+	opts.Refresh = true
+	if _, err := cachedRepository(ctx, "org", "search", opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := git(t, src, "rev-parse", "HEAD"); got != rewritten {
+		t.Errorf("the cache was reset to %s, want the force pushed %s", got, rewritten)
+	}
+	if got := git(t, src, "rev-parse", "v1^{commit}"); got != rewritten {
+		t.Errorf("the cached tag v1 is %s, want it moved to %s", got, rewritten)
+	}
+	if _, err := os.Stat(filepath.Join(src, "stray.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the untracked file was not removed: %v", err)
+	}
+}
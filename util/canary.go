@@ -0,0 +1,79 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// canaryService is the name of the built-in protobuf CheckGeneration generates code from
+const canaryService = "canary"
+
+// canaryProto is a tiny protobuf declaring a service with a single RPC, which every language can generate
+const canaryProto = `syntax = "proto3";
+
+package canary.v1;
+
+option go_package = "example.com/canary/v1;canaryv1";
+option java_package = "com.example.canary.v1";
+
+service Canary {
+  rpc Ping(PingRequest) returns (PingResponse);
+}
+
+message PingRequest {
+  string message = 1;
+}
+
+message PingResponse {
+  string message = 1;
+}
+`
+
+// CheckGeneration checks that code can be generated for language end to end, by generating the code of a tiny
+// built-in protobuf with opts in a temporary directory. When opts.RPCFramework does not support language, only the
+// messages are generated.
+func CheckGeneration(ctx context.Context, language string, opts GenerateOptions) Check {
+	c := Check{Name: fmt.Sprintf("generate %s", language), Hint: "Run generate-clients doctor to find the missing tools"}
+	if !opts.MessagesOnly {
+		if err := ValidateRPCFramework(language, opts.rpcFramework()); err != nil {
+			opts.MessagesOnly = true
+			c.Detail = fmt.Sprintf("messages only, as %s does not support %s. ", opts.rpcFramework(), language)
+		}
+	}
+	// The output of protoc is reported in the error instead
+	opts.Logger = nil
+
+	dir, err := os.MkdirTemp(os.TempDir(), TempDirPrefix)
+	if err != nil {
+		c.Err = fmt.Errorf("cannot create temporary directory: %s", err.Error())
+		return c
+	}
+	defer CleanUpDirectories(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, canaryService+".proto"), []byte(canaryProto), 0644); err != nil {
+		c.Err = fmt.Errorf("cannot write protobuf file: %s", err.Error())
+		return c
+	}
+	if err := GenerateCode(ctx, language, canaryService, dir, opts); err != nil {
+		if genErr, ok := err.(*generatorError); ok && strings.TrimSpace(genErr.output) != "" {
+			err = fmt.Errorf("%s: %s", genErr.msg, strings.Join(strings.Fields(genErr.output), " "))
+		}
+		c.Err = err
+		return c
+	}
+
+	files, err := GeneratedFiles(dir, CopyOptions{})
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	if len(files) == 0 {
+		c.Err = fmt.Errorf("no %s code was generated", language)
+		return c
+	}
+	c.Detail += fmt.Sprintf("%d files generated", len(files))
+	return c
+}
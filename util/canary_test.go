@@ -0,0 +1,36 @@
+package util
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCheckGeneration(t *testing.T) {
+	fakeCommand(t, "protoc", `for a in "$@"; do case "$a" in --*_out=*) out=${a#*=}; out=${out##*:}; echo generated > "$out/canary.txt";; esac; done
+`)
+	c := CheckGeneration(context.Background(), LanguageGo, GenerateOptions{})
+	if c.Err != nil || c.Name != "generate "+LanguageGo || c.Detail != "1 files generated" {
+		t.Errorf("unexpected check %+v", c)
+	}
+
+	// Twirp has no Java plugin, so only the messages are generated
+	c = CheckGeneration(context.Background(), LanguageJava, GenerateOptions{RPCFramework: RPCFrameworkTwirp})
+	if c.Err != nil || !strings.HasPrefix(c.Detail, "messages only, as twirp does not support "+LanguageJava+". ") {
+		t.Errorf("unexpected check %+v", c)
+	}
+}
+
+func TestCheckGenerationFailures(t *testing.T) {
+	fakeCommand(t, "protoc", "echo 'protoc-gen-go: program not found or is not executable' >&2\nexit 1\n")
+	c := CheckGeneration(context.Background(), LanguageGo, GenerateOptions{})
+	if c.Err == nil || !strings.Contains(c.Err.Error(), "protoc-gen-go: program not found or is not executable") {
+		t.Errorf("expected the output of protoc in the error, got %v", c.Err)
+	}
+
+	fakeCommand(t, "protoc", "exit 0\n")
+	c = CheckGeneration(context.Background(), LanguageRuby, GenerateOptions{})
+	if c.Err == nil || c.Err.Error() != "no ruby code was generated" {
+		t.Errorf("expected generating no code to fail, got %v", c.Err)
+	}
+}
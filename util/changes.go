@@ -0,0 +1,410 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Kinds of the elements of a protobuf API that are compared by DiffDescriptors
+const (
+	ElementService   = "service"
+	ElementRPC       = "rpc"
+	ElementMessage   = "message"
+	ElementField     = "field"
+	ElementEnum      = "enum"
+	ElementEnumValue = "enum value"
+)
+
+// ChangeKind describes how an element of a protobuf API changed
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+// Element is a service, RPC, message, field, enum or enum value declared in a FileDescriptorSet
+type Element struct {
+	// Kind is one of the Element* constants
+	Kind string
+
+	// Name is the fully qualified name of the element, e.g. search.v1.SearchRequest.query
+	Name string
+
+	// Definition describes the element's number and types, e.g. "= 1 repeated string" for a field. Services, messages
+	// and enums have none
+	Definition string
+}
+
+// DescriptorChange is an element added, removed or changed between two FileDescriptorSets
+type DescriptorChange struct {
+	Kind    ChangeKind
+	Element Element
+
+	// Previous is the definition of a changed element before the change
+	Previous string
+}
+
+// String describes the change on one line, e.g. "~ field search.v1.SearchRequest.query: = 1 string -> = 1 int32"
+func (c DescriptorChange) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return strings.TrimSpace(fmt.Sprintf("+ %s %s %s", c.Element.Kind, c.Element.Name, c.Element.Definition))
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s %s", c.Element.Kind, c.Element.Name)
+	default:
+		return fmt.Sprintf("~ %s %s: %s -> %s", c.Element.Kind, c.Element.Name, c.Previous, c.Element.Definition)
+	}
+}
+
+// ReadDescriptorSet reads the elements declared by the files of the FileDescriptorSet at path, keyed by kind and name
+func ReadDescriptorSet(path string) (map[string]Element, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read descriptor set: %s", err.Error())
+	}
+
+	elements := make(map[string]Element)
+	err = decodeMessage(data, func(num int, v uint64, b []byte) error {
+		if num != 1 {
+			return nil
+		}
+		return decodeFile(b, elements)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set '%s': %s", path, err.Error())
+	}
+	return elements, nil
+}
+
+// DiffDescriptors returns the elements added to, removed from or changed in next compared to previous, ordered by name
+func DiffDescriptors(previous map[string]Element, next map[string]Element) []DescriptorChange {
+	var changes []DescriptorChange
+	for key, e := range next {
+		p, ok := previous[key]
+		switch {
+		case !ok:
+			changes = append(changes, DescriptorChange{Kind: ChangeAdded, Element: e})
+		case p.Definition != e.Definition:
+			changes = append(changes, DescriptorChange{Kind: ChangeChanged, Element: e, Previous: p.Definition})
+		}
+	}
+	for key, p := range previous {
+		if _, ok := next[key]; !ok {
+			changes = append(changes, DescriptorChange{Kind: ChangeRemoved, Element: p})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Element.Name != changes[j].Element.Name {
+			return changes[i].Element.Name < changes[j].Element.Name
+		}
+		return changes[i].Element.Kind < changes[j].Element.Kind
+	})
+	return changes
+}
+
+// rawField is a field of a protobuf encoded message. v holds the value of varint and fixed width fields, and data the
+// contents of length delimited fields, while raw is the whole encoded field, key included
+type rawField struct {
+	num      int
+	wireType uint64
+	v        uint64
+	data     []byte
+	raw      []byte
+}
+
+// splitMessage returns the fields of the protobuf encoded message b, in the order they are encoded
+func splitMessage(b []byte) ([]rawField, error) {
+	var fields []rawField
+	for len(b) > 0 {
+		start := b
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("malformed field key")
+		}
+		b = b[n:]
+
+		f := rawField{num: int(key >> 3), wireType: key & 7}
+		switch f.wireType {
+		case 0:
+			if f.v, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("malformed varint")
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, errors.New("truncated fixed width field")
+			}
+			f.v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 5:
+			if len(b) < 4 {
+				return nil, errors.New("truncated fixed width field")
+			}
+			f.v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return nil, errors.New("truncated length delimited field")
+			}
+			f.data, b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", f.wireType)
+		}
+		f.raw = start[:len(start)-len(b)]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// decodeMessage calls field with the number and value of each field of the protobuf encoded message b. v holds the
+// value of varint and fixed width fields, and b the contents of length delimited fields
+func decodeMessage(b []byte, field func(num int, v uint64, b []byte) error) error {
+	fields, err := splitMessage(b)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := field(f.num, f.v, f.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addElement records e in elements
+func addElement(elements map[string]Element, e Element) {
+	elements[e.Kind+" "+e.Name] = e
+}
+
+// qualify returns name qualified by scope, which may be empty
+func qualify(scope string, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// decodeFile decodes the elements declared by a FileDescriptorProto
+func decodeFile(b []byte, elements map[string]Element) error {
+	var pkg string
+	var messages, enums, services [][]byte
+	err := decodeMessage(b, func(num int, v uint64, b []byte) error {
+		switch num {
+		case 2:
+			pkg = string(b)
+		case 4:
+			messages = append(messages, b)
+		case 5:
+			enums = append(enums, b)
+		case 6:
+			services = append(services, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		if err := decodeMessageType(m, pkg, elements); err != nil {
+			return err
+		}
+	}
+	for _, e := range enums {
+		if err := decodeEnum(e, pkg, elements); err != nil {
+			return err
+		}
+	}
+	for _, s := range services {
+		if err := decodeService(s, pkg, elements); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeMessageType decodes a DescriptorProto declared in scope, along with its fields and nested types
+func decodeMessageType(b []byte, scope string, elements map[string]Element) error {
+	var name string
+	var fields, nested, enums [][]byte
+	err := decodeMessage(b, func(num int, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			name = string(b)
+		case 2:
+			fields = append(fields, b)
+		case 3:
+			nested = append(nested, b)
+		case 4:
+			enums = append(enums, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fullName := qualify(scope, name)
+	addElement(elements, Element{Kind: ElementMessage, Name: fullName})
+	for _, f := range fields {
+		if err := decodeField(f, fullName, elements); err != nil {
+			return err
+		}
+	}
+	for _, m := range nested {
+		if err := decodeMessageType(m, fullName, elements); err != nil {
+			return err
+		}
+	}
+	for _, e := range enums {
+		if err := decodeEnum(e, fullName, elements); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldTypes are the names of the scalar types of FieldDescriptorProto.Type
+var fieldTypes = map[uint64]string{
+	1: "double", 2: "float", 3: "int64", 4: "uint64", 5: "int32", 6: "fixed64", 7: "fixed32", 8: "bool", 9: "string",
+	10: "group", 11: "message", 12: "bytes", 13: "uint32", 14: "enum", 15: "sfixed32", 16: "sfixed64", 17: "sint32",
+	18: "sint64",
+}
+
+// decodeField decodes a FieldDescriptorProto of the message named scope
+func decodeField(b []byte, scope string, elements map[string]Element) error {
+	var name, typeName string
+	var number, label, typ uint64
+	err := decodeMessage(b, func(num int, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			name = string(b)
+		case 3:
+			number = v
+		case 4:
+			label = v
+		case 5:
+			typ = v
+		case 6:
+			typeName = strings.TrimPrefix(string(b), ".")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	definition := fmt.Sprintf("= %d", number)
+	switch label {
+	case 2:
+		definition += " required"
+	case 3:
+		definition += " repeated"
+	}
+	if typeName != "" {
+		definition += " " + typeName
+	} else {
+		definition += " " + fieldTypes[typ]
+	}
+	addElement(elements, Element{Kind: ElementField, Name: qualify(scope, name), Definition: definition})
+	return nil
+}
+
+// decodeEnum decodes an EnumDescriptorProto declared in scope, along with its values
+func decodeEnum(b []byte, scope string, elements map[string]Element) error {
+	var name string
+	var values [][]byte
+	err := decodeMessage(b, func(num int, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			name = string(b)
+		case 2:
+			values = append(values, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fullName := qualify(scope, name)
+	addElement(elements, Element{Kind: ElementEnum, Name: fullName})
+	for _, value := range values {
+		var valueName string
+		var number uint64
+		err := decodeMessage(value, func(num int, v uint64, b []byte) error {
+			switch num {
+			case 1:
+				valueName = string(b)
+			case 2:
+				number = v
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		addElement(elements, Element{Kind: ElementEnumValue, Name: qualify(fullName, valueName), Definition: fmt.Sprintf("= %d", int32(number))})
+	}
+	return nil
+}
+
+// decodeService decodes a ServiceDescriptorProto declared in scope, along with its RPCs
+func decodeService(b []byte, scope string, elements map[string]Element) error {
+	var name string
+	var methods [][]byte
+	err := decodeMessage(b, func(num int, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			name = string(b)
+		case 2:
+			methods = append(methods, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fullName := qualify(scope, name)
+	addElement(elements, Element{Kind: ElementService, Name: fullName})
+	for _, m := range methods {
+		var methodName, input, output string
+		var clientStreaming, serverStreaming bool
+		err := decodeMessage(m, func(num int, v uint64, b []byte) error {
+			switch num {
+			case 1:
+				methodName = string(b)
+			case 2:
+				input = strings.TrimPrefix(string(b), ".")
+			case 3:
+				output = strings.TrimPrefix(string(b), ".")
+			case 5:
+				clientStreaming = v != 0
+			case 6:
+				serverStreaming = v != 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		definition := fmt.Sprintf("(%s%s) returns (%s%s)", streamPrefix(clientStreaming), input, streamPrefix(serverStreaming), output)
+		addElement(elements, Element{Kind: ElementRPC, Name: qualify(fullName, methodName), Definition: definition})
+	}
+	return nil
+}
+
+// streamPrefix returns the prefix of a streamed RPC message type
+func streamPrefix(streaming bool) string {
+	if streaming {
+		return "stream "
+	}
+	return ""
+}
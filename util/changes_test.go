@@ -0,0 +1,111 @@
+package util
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// protoField returns a protobuf encoded length delimited field
+func protoField(num int, data ...[]byte) []byte {
+	var b []byte
+	for _, d := range data {
+		b = append(b, d...)
+	}
+	out := binary.AppendUvarint(nil, uint64(num)<<3|2)
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+// protoString returns a protobuf encoded string field
+func protoString(num int, s string) []byte {
+	return protoField(num, []byte(s))
+}
+
+// protoVarint returns a protobuf encoded varint field
+func protoVarint(num int, v uint64) []byte {
+	return binary.AppendUvarint(binary.AppendUvarint(nil, uint64(num)<<3), v)
+}
+
+// writeDescriptorSet writes a FileDescriptorSet holding file to name in dir, returning its path
+func writeDescriptorSet(t *testing.T, dir string, name string, file ...[]byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, protoField(1, file...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiffDescriptors(t *testing.T) {
+	dir := t.TempDir()
+	response := protoField(4, protoString(1, "QueryResponse"), protoField(2, protoString(1, "results"), protoVarint(3, 1), protoVarint(4, 3), protoVarint(5, 9)))
+	rpc := func(name string, serverStreaming bool) []byte {
+		streaming := uint64(0)
+		if serverStreaming {
+			streaming = 1
+		}
+		return protoField(2, protoString(1, name), protoString(2, ".search.v1.QueryRequest"), protoString(3, ".search.v1.QueryResponse"), protoVarint(6, streaming))
+	}
+
+	previous := writeDescriptorSet(t, dir, "previous.pb", protoString(1, "search.proto"), protoString(2, "search.v1"),
+		protoField(4, protoString(1, "QueryRequest"),
+			protoField(2, protoString(1, "query"), protoVarint(3, 1), protoVarint(4, 1), protoVarint(5, 9)),
+			protoField(2, protoString(1, "limit"), protoVarint(3, 2), protoVarint(4, 1), protoVarint(5, 5))),
+		response,
+		protoField(5, protoString(1, "Order"), protoField(2, protoString(1, "ASC"), protoVarint(2, 0)), protoField(2, protoString(1, "DESC"), protoVarint(2, 1))),
+		protoField(6, protoString(1, "Search"), rpc("Query", false)),
+	)
+	next := writeDescriptorSet(t, dir, "next.pb", protoString(1, "search.proto"), protoString(2, "search.v1"),
+		protoField(4, protoString(1, "QueryRequest"),
+			protoField(2, protoString(1, "query"), protoVarint(3, 1), protoVarint(4, 1), protoVarint(5, 3)),
+			protoField(2, protoString(1, "cursor"), protoVarint(3, 3), protoVarint(4, 1), protoVarint(5, 9))),
+		response,
+		protoField(5, protoString(1, "Order"), protoField(2, protoString(1, "ASC"), protoVarint(2, 0)), protoField(2, protoString(1, "DESC"), protoVarint(2, 1)), protoField(2, protoString(1, "RELEVANCE"), protoVarint(2, 2))),
+		protoField(6, protoString(1, "Search"), rpc("Query", true), rpc("Count", false)),
+	)
+
+	previousElements, err := ReadDescriptorSet(previous)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	nextElements, err := ReadDescriptorSet(next)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if e := previousElements["field search.v1.QueryResponse.results"]; e.Definition != "= 1 repeated string" {
+		t.Errorf("unexpected field %+v", e)
+	}
+
+	var got []string
+	for _, c := range DiffDescriptors(previousElements, nextElements) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"+ enum value search.v1.Order.RELEVANCE = 2",
+		"+ field search.v1.QueryRequest.cursor = 3 string",
+		"- field search.v1.QueryRequest.limit",
+		"~ field search.v1.QueryRequest.query: = 1 string -> = 1 int64",
+		"+ rpc search.v1.Search.Count (search.v1.QueryRequest) returns (search.v1.QueryResponse)",
+		"~ rpc search.v1.Search.Query: (search.v1.QueryRequest) returns (search.v1.QueryResponse) -> (search.v1.QueryRequest) returns (stream search.v1.QueryResponse)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got changes\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if changes := DiffDescriptors(nextElements, nextElements); len(changes) != 0 {
+		t.Errorf("identical descriptor sets differ: %v", changes)
+	}
+}
+
+func TestReadDescriptorSetInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.pb")
+	if err := os.WriteFile(path, []byte{0x0a, 0x05, 0x01}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDescriptorSet(path); err == nil || !strings.Contains(err.Error(), "invalid descriptor set") {
+		t.Errorf("expected a truncated descriptor set to be refused, got %v", err)
+	}
+}
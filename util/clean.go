@@ -0,0 +1,202 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OutputCleanup holds the generated files of an output directory, as recorded in its manifest, to remove with
+// RemoveOutput
+type OutputCleanup struct {
+	Path string
+
+	// Files are the generated files left as they were generated, which are removed
+	Files []string
+
+	// Modified are the generated files changed since they were generated, which are kept and left in the manifest
+	Modified []string
+
+	manifest *Manifest
+
+	// parent is the output holding Path when it is the directory of one service of a batch, removed by RemoveOutput
+	// once emptied
+	parent string
+}
+
+// PlanCleanup reads the manifest of outputPath to find the generated files to remove from it. Only files recorded in
+// the manifest are considered, and an error is returned if it records a file outside of outputPath. ok is false when
+// outputPath has no manifest.
+func PlanCleanup(outputPath string) (OutputCleanup, bool, error) {
+	c := OutputCleanup{Path: outputPath}
+	if _, err := os.Stat(filepath.Join(outputPath, ManifestName)); errors.Is(err, fs.ErrNotExist) {
+		return c, false, nil
+	}
+	m, err := ReadManifest(outputPath)
+	if err != nil {
+		return c, false, err
+	}
+	c.manifest = m
+
+	seen := make(map[string]bool)
+	for _, f := range c.manifest.Files {
+		if path.IsAbs(f.Name) || path.Clean(f.Name) != f.Name || f.Name == ".." || strings.HasPrefix(f.Name, "../") {
+			return c, false, fmt.Errorf("the manifest of '%s' records the file '%s', which is outside of it", outputPath, f.Name)
+		}
+		// A file shared by several services is recorded once for each of them
+		if seen[f.Name] {
+			continue
+		}
+		seen[f.Name] = true
+
+		sha, err := FileSHA256(filepath.Join(outputPath, filepath.FromSlash(f.Name)))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return c, false, fmt.Errorf("cannot read generated file '%s': %s", f.Name, err.Error())
+		case sha != f.SHA256:
+			c.Modified = append(c.Modified, f.Name)
+		default:
+			c.Files = append(c.Files, f.Name)
+		}
+	}
+	return c, true, nil
+}
+
+// PlanCleanups plans the cleanup of outputPath with PlanCleanup. When outputPath has no manifest, as when a batch was
+// generated into a directory per service, the cleanup of each of its directories holding a manifest is planned instead,
+// one level deep. No cleanup is returned when neither has a manifest.
+func PlanCleanups(outputPath string) ([]OutputCleanup, error) {
+	c, ok, err := PlanCleanup(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return []OutputCleanup{c}, nil
+	}
+
+	entries, err := os.ReadDir(outputPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read output '%s': %s", outputPath, err.Error())
+	}
+	var cleanups []OutputCleanup
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		c, ok, err := PlanCleanup(filepath.Join(outputPath, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			c.parent = outputPath
+			cleanups = append(cleanups, c)
+		}
+	}
+	return cleanups, nil
+}
+
+// RemoveOutput removes the generated files of c, the manifest and .gitignore written alongside them, and the
+// directories they leave empty, including the output directory itself and, for the directory of a service planned by
+// PlanCleanups, the output holding it. When files were modified, the manifest and .gitignore are rewritten to record
+// only them.
+func RemoveOutput(c OutputCleanup) error {
+	dirs := make(map[string]bool)
+	for _, name := range c.Files {
+		if err := os.Remove(filepath.Join(c.Path, filepath.FromSlash(name))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("cannot remove generated file '%s': %s", name, err.Error())
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	if len(c.Modified) > 0 {
+		modified := make(map[string]bool, len(c.Modified))
+		for _, name := range c.Modified {
+			modified[name] = true
+		}
+		var files []ManifestFile
+		for _, f := range c.manifest.Files {
+			if modified[f.Name] {
+				files = append(files, f)
+			}
+		}
+		m := *c.manifest
+		m.Files, m.Inputs = files, nil
+		if err := WriteManifest(c.Path, &m); err != nil {
+			return err
+		}
+		if generated, err := isGeneratedGitignore(c.Path); err != nil || !generated {
+			return err
+		}
+		return WriteGitignore(c.Path, &m)
+	}
+
+	if err := removeGeneratedGitignore(c.Path); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(c.Path, ManifestName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove manifest: %s", err.Error())
+	}
+
+	// Deeper directories come first, so that their parents are empty by the time they are removed
+	sorted := make([]string, 0, len(dirs)+1)
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, dir := range append(sorted, ".") {
+		if err := removeEmptyDir(filepath.Join(c.Path, filepath.FromSlash(dir))); err != nil {
+			return err
+		}
+	}
+	if c.parent != "" {
+		return removeEmptyDir(c.parent)
+	}
+	return nil
+}
+
+// isGeneratedGitignore returns true if outputPath has a .gitignore written by WriteGitignore
+func isGeneratedGitignore(outputPath string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(outputPath, GitignoreName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("cannot read %s: %s", GitignoreName, err.Error())
+	}
+	return strings.HasPrefix(string(data), gitignoreHeader), nil
+}
+
+// removeGeneratedGitignore removes the .gitignore of outputPath if it was written by WriteGitignore
+func removeGeneratedGitignore(outputPath string) error {
+	if generated, err := isGeneratedGitignore(outputPath); err != nil || !generated {
+		return err
+	}
+	if err := os.Remove(filepath.Join(outputPath, GitignoreName)); err != nil {
+		return fmt.Errorf("cannot remove %s: %s", GitignoreName, err.Error())
+	}
+	return nil
+}
+
+// removeEmptyDir removes dir if it exists and is empty
+func removeEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && len(entries) > 0 {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot read directory '%s': %s", dir, err.Error())
+	}
+	if err := os.Remove(dir); err != nil {
+		return fmt.Errorf("cannot remove directory '%s': %s", dir, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// generatedOutput returns an output directory holding files, generated for search and recorded in its manifest, along
+// with a generated .gitignore
+func generatedOutput(t *testing.T, files ...string) string {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "out")
+	var copied []CopiedFile
+	for _, name := range files {
+		writeFile(t, output, name, "generated "+name+"\n")
+		f, err := OutputFile(output, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copied = append(copied, f)
+	}
+	m := &Manifest{}
+	m.SetServiceFiles("search", copied)
+	if err := WriteManifest(output, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteGitignore(output, m); err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestRemoveOutput(t *testing.T) {
+	output := generatedOutput(t, "search.pb.go", "v1/query.pb.go")
+
+	c, ok, err := PlanCleanup(output)
+	if err != nil || !ok {
+		t.Fatalf("PlanCleanup = %t, %v", ok, err)
+	}
+	if !reflect.DeepEqual(c.Files, []string{"search.pb.go", "v1/query.pb.go"}) || len(c.Modified) != 0 {
+		t.Fatalf("unexpected cleanup %+v", c)
+	}
+	if err := RemoveOutput(c); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("the emptied output was not removed: %v", err)
+	}
+}
+
+func TestRemoveOutputKeepsModified(t *testing.T) {
+	output := generatedOutput(t, "search.pb.go", "v1/query.pb.go")
+	writeFile(t, output, "v1/query.pb.go", "edited\n")
+	writeFile(t, output, "README.md", "not generated\n")
+
+	c, _, err := PlanCleanup(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Files, []string{"search.pb.go"}) || !reflect.DeepEqual(c.Modified, []string{"v1/query.pb.go"}) {
+		t.Fatalf("unexpected cleanup %+v", c)
+	}
+	if err := RemoveOutput(c); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, name := range []string{"v1/query.pb.go", "README.md", ManifestName} {
+		if _, err := os.Stat(filepath.Join(output, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s was removed: %s", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(output, "search.pb.go")); !os.IsNotExist(err) {
+		t.Errorf("the unmodified file was kept: %v", err)
+	}
+	m, err := ReadManifest(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 1 || m.Files[0].Name != "v1/query.pb.go" {
+		t.Errorf("the manifest records %+v, want only the modified file", m.Files)
+	}
+	data, err := os.ReadFile(filepath.Join(output, GitignoreName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "search.pb.go") {
+		t.Errorf("the .gitignore still lists the removed file: %q", data)
+	}
+}
+
+func TestPlanCleanup(t *testing.T) {
+	if _, ok, err := PlanCleanup(t.TempDir()); ok || err != nil {
+		t.Errorf("an output without a manifest was planned: %t, %v", ok, err)
+	}
+
+	output := t.TempDir()
+	if err := WriteManifest(output, &Manifest{Files: []ManifestFile{{Name: "../search.pb.go", Service: "search"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := PlanCleanup(output); err == nil || !strings.Contains(err.Error(), "outside of it") {
+		t.Errorf("expected the file outside of the output to be refused, got %v", err)
+	}
+}
+
+func TestPlanCleanupsPerService(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out")
+	generate := func(service string) {
+		dir := filepath.Join(output, service)
+		writeFile(t, dir, service+".pb.go", "generated\n")
+		f, err := OutputFile(dir, service+".pb.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &Manifest{}
+		m.SetServiceFiles(service, []CopiedFile{f})
+		if err := WriteManifest(dir, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	generate("search")
+	generate("catalog")
+	writeFile(t, output, "docs/README.md", "not generated\n")
+
+	cleanups, err := PlanCleanups(output)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var planned []string
+	for _, c := range cleanups {
+		planned = append(planned, filepath.Base(c.Path)+": "+strings.Join(c.Files, ","))
+	}
+	if want := []string{"catalog: catalog.pb.go", "search: search.pb.go"}; !reflect.DeepEqual(planned, want) {
+		t.Fatalf("planned %q, want %q", planned, want)
+	}
+
+	for _, c := range cleanups {
+		if err := RemoveOutput(c); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	entries, err := os.ReadDir(output)
+	if err != nil {
+		t.Fatalf("the output holding other files was removed: %s", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "docs" {
+		t.Errorf("the directories of the services were not removed: %v", entries)
+	}
+
+	// The output is removed along with its last service
+	if err := os.RemoveAll(filepath.Join(output, "docs")); err != nil {
+		t.Fatal(err)
+	}
+	generate("search")
+	if cleanups, err = PlanCleanups(output); err != nil || len(cleanups) != 1 {
+		t.Fatalf("PlanCleanups = %+v, %v", cleanups, err)
+	}
+	if err := RemoveOutput(cleanups[0]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("the emptied output was not removed: %v", err)
+	}
+
+	if cleanups, err := PlanCleanups(output); err != nil || len(cleanups) != 0 {
+		t.Errorf("a missing output was planned: %+v, %v", cleanups, err)
+	}
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// cloneSizePollInterval is how often the size of a clone in progress is checked against CloneOptions.MaxSize
+const cloneSizePollInterval = 500 * time.Millisecond
+
+// DirSize returns the total size in bytes of the files in dir. Files removed while walking are skipped.
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != dir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot measure the size of '%s': %s", dir, err.Error())
+	}
+	return size, nil
+}
+
+// sizeError is the error of a clone of org/repo that grew to size bytes, larger than the limit of opts
+func (o CloneOptions) sizeError(org string, repo string, size int64) error {
+	return fmt.Errorf("repository '%s/%s' is %d bytes, which exceeds the maximum clone size of %d bytes", org, repo, size, o.MaxSize)
+}
+
+// checkCloneSize returns an error if the clone of org/repo at src is larger than opts.MaxSize
+func (o CloneOptions) checkCloneSize(org string, repo string, src string) error {
+	if o.MaxSize <= 0 {
+		return nil
+	}
+	size, err := DirSize(src)
+	if err != nil {
+		return err
+	}
+	if size > o.MaxSize {
+		return o.sizeError(org, repo, size)
+	}
+	return nil
+}
+
+// runClone clones org/repo into src. With opts.MaxSize the size of src is polled while cloning, and the clone is
+// aborted as soon as it grows larger.
+func (o CloneOptions) runClone(ctx context.Context, org string, repo string, src string) error {
+	cloneCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cloneCmd := exec.CommandContext(cloneCtx, "git", o.cloneArgs(org, repo, src)...)
+	cloneCmd.Env = o.env()
+	if err := cloneCmd.Start(); err != nil {
+		return fmt.Errorf("failed to clone repository '%s/%s': %s", org, repo, err.Error())
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cloneCmd.Wait() }()
+
+	var ticks <-chan time.Time
+	if o.MaxSize > 0 {
+		ticker := time.NewTicker(cloneSizePollInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("failed to clone repository '%s/%s': %s", org, repo, err.Error())
+			}
+			return o.checkCloneSize(org, repo, src)
+		case <-ticks:
+			if size, err := DirSize(src); err == nil && size > o.MaxSize {
+				cancel()
+				<-done
+				return o.sizeError(org, repo, size)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.proto", "12345")
+	writeFile(t, dir, "nested/b.proto", "123")
+
+	if size, err := DirSize(dir); err != nil || size != 8 {
+		t.Errorf("DirSize = %d, %v, want 8", size, err)
+	}
+	if _, err := DirSize(dir + "-missing"); err == nil {
+		t.Error("DirSize of a missing directory did not fail")
+	}
+}
+
+func TestCloneRepositoryMaxSize(t *testing.T) {
+	opts := remoteRepository(t, "search")
+	opts.MaxSize = 1 << 30
+	if _, err := CloneRepository(context.Background(), "org", "search", t.TempDir(), opts); err != nil {
+		t.Fatalf("a clone within the limit failed: %s", err)
+	}
+
+	opts.MaxSize = 10
+	for _, cacheDir := range []string{"", t.TempDir()} {
+		opts.CacheDir = cacheDir
+		_, err := CloneRepository(context.Background(), "org", "search", t.TempDir(), opts)
+		if err == nil || !strings.Contains(err.Error(), "exceeds the maximum clone size of 10 bytes") {
+			t.Errorf("CloneRepository with cache %q = %v, want the size limit to be exceeded", cacheDir, err)
+		}
+	}
+}
+
+func TestCloneRepositoryMaxSizeAborts(t *testing.T) {
+	fakeCommand(t, "git", `for a; do dir=$a; done
+mkdir -p "$dir" && printf '%01024d' 0 > "$dir/pack"
+exec sleep 10
+`)
+	opts := CloneOptions{MaxSize: 100}
+
+	start := time.Now()
+	_, err := CloneRepository(context.Background(), "org", "search", t.TempDir(), opts)
+	if err == nil || !strings.Contains(err.Error(), "repository 'org/search' is 1024 bytes") {
+		t.Errorf("CloneRepository = %v, want the clone to be aborted", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the clone was aborted after %s, want it aborted while cloning", elapsed)
+	}
+}
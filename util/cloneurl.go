@@ -0,0 +1,51 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// CloneURLData is the data a clone URL template is rendered with for each repository
+type CloneURLData struct {
+	// Host and Org are the Github host and organization of the repository, after any per service overrides
+	Host string
+	Org  string
+
+	// Service is the service the repository is cloned for. It is empty for a central protobuf repository
+	Service string
+
+	// Repo is the name of the repository
+	Repo string
+}
+
+// ParseCloneURLTemplate parses text as a clone URL template, e.g. https://{{.Host}}/{{.Org}}/{{.Repo}}.git, rendered
+// with CloneURLData. The template is rendered once with placeholder data so that unknown fields are reported here
+// rather than when cloning. An empty text returns a nil template, using the default SSH URLs.
+func ParseCloneURLTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("clone-url").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid clone URL template: %s", err.Error())
+	}
+	url, err := renderCloneURL(tmpl, CloneURLData{Host: DefaultHost, Org: DefaultOrg, Service: "service", Repo: "repo"})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid clone URL template: %s", err.Error())
+	}
+	if url == "" {
+		return nil, fmt.Errorf("Invalid clone URL template '%s', it renders an empty URL", text)
+	}
+	return tmpl, nil
+}
+
+// renderCloneURL renders the clone URL template tmpl with data
+func renderCloneURL(tmpl *template.Template, data CloneURLData) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
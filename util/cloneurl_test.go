@@ -0,0 +1,75 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCloneURLTemplate(t *testing.T) {
+	tests := []struct {
+		text    string
+		wantNil bool
+		wantErr bool
+	}{
+		{text: "", wantNil: true},
+		{text: "https://{{.Host}}/{{.Org}}/{{.Repo}}.git"},
+		{text: "https://{{.Host}/{{.Org}}", wantErr: true},
+		{text: "https://{{.Owner}}/{{.Repo}}.git", wantErr: true},
+		{text: "{{if .Service}}{{end}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseCloneURLTemplate(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCloneURLTemplate(%q) error = %v, wantErr %t", tt.text, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (tmpl == nil) != tt.wantNil {
+			t.Errorf("ParseCloneURLTemplate(%q) = %v, want nil %t", tt.text, tmpl, tt.wantNil)
+		}
+	}
+}
+
+func TestCloneServiceURLTemplate(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "git.log")
+	fakeCommand(t, "git", `echo "$@" > `+log+`
+exit 1
+`)
+	tmpl, err := ParseCloneURLTemplate("https://{{.Host}}/{{.Org}}/{{.Repo}}.git?service={{.Service}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := CloneOptions{
+		URLTemplate:  tmpl,
+		ServiceHosts: map[string]string{"query": "github.example.com"},
+		ServiceOrgs:  map[string]string{"query": "query-team"},
+		RepoNames:    map[string]string{"query": "query-service"},
+	}
+	CloneService(context.Background(), "query", t.TempDir(), opts)
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("git was not run: %s", err)
+	}
+	if !strings.Contains(string(data), "https://github.example.com/query-team/query-service.git?service=query") {
+		t.Errorf("git cloned %q", data)
+	}
+	if strings.Contains(string(data), "git@") {
+		t.Errorf("git cloned the SSH URL: %q", data)
+	}
+}
+
+func TestRemoteURLTemplateRepository(t *testing.T) {
+	tmpl, err := ParseCloneURLTemplate("https://{{.Host}}/{{.Org}}/{{.Repo}}{{if .Service}}-{{.Service}}{{end}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url := (CloneOptions{URLTemplate: tmpl}).remoteURL("org", "protos"); url != "https://"+DefaultHost+"/org/protos" {
+		t.Errorf("a central repository is cloned from %s", url)
+	}
+	if url := (CloneOptions{}).remoteURL("org", "protos"); url != "git@"+DefaultHost+":org/protos.git" {
+		t.Errorf("without a template the repository is cloned from %s", url)
+	}
+}
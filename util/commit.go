@@ -0,0 +1,73 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// RepositoryCommit returns the SHA of the commit checked out in the git repository at dir
+func RepositoryCommit(ctx context.Context, dir string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot get the commit of '%s': %s", dir, err.Error())
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// CommitOutput stages every change within outputPath, including removed files, and commits them to the git
+// repository holding outputPath with message. Changes outside of outputPath are not committed. It returns the SHA of
+// the commit, or an empty string if nothing changed.
+func CommitOutput(ctx context.Context, outputPath string, message string) (string, error) {
+	if err := exec.CommandContext(ctx, "git", "-C", outputPath, "rev-parse", "--show-toplevel").Run(); err != nil {
+		return "", fmt.Errorf("cannot commit the output: '%s' is not inside a git repository", outputPath)
+	}
+
+	if out, err := exec.CommandContext(ctx, "git", "-C", outputPath, "add", "--all", "--", ".").CombinedOutput(); err != nil {
+		return "", fmt.Errorf("cannot stage the output: %s", strings.TrimSpace(string(out)))
+	}
+
+	// git diff exits with 1 when there are staged changes
+	err := exec.CommandContext(ctx, "git", "-C", outputPath, "diff", "--cached", "--quiet", "--", ".").Run()
+	var exitErr *exec.ExitError
+	if err == nil {
+		return "", nil
+	} else if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		return "", fmt.Errorf("cannot check the output for changes: %s", err.Error())
+	}
+
+	commitCmd := exec.CommandContext(ctx, "git", "-C", outputPath, "commit", "--quiet", "--file", "-", "--", ".")
+	commitCmd.Stdin = strings.NewReader(message)
+	if out, err := commitCmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("cannot commit the output: %s", strings.TrimSpace(string(out)))
+	}
+	return RepositoryCommit(ctx, outputPath)
+}
+
+// UncommittedChanges returns the paths within outputPath, relative to the root of the git repository holding it, that
+// have uncommitted changes, including untracked files. An output that does not exist yet has no changes.
+func UncommittedChanges(ctx context.Context, outputPath string) ([]string, error) {
+	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err := exec.CommandContext(ctx, "git", "-C", outputPath, "rev-parse", "--show-toplevel").Run(); err != nil {
+		return nil, fmt.Errorf("cannot check the output for changes: '%s' is not inside a git repository", outputPath)
+	}
+
+	out, err := exec.CommandContext(ctx, "git", "-C", outputPath, "status", "--porcelain", "--untracked-files=all", "--", ".").Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot check the output for changes: %s", err.Error())
+	}
+
+	var changes []string
+	for _, line := range strings.Split(string(out), "\n") {
+		// Each line is a two letter status followed by a space and the path
+		if len(line) > 3 {
+			changes = append(changes, line[3:])
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitOutput(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for _, key := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		setenv(t, key+"_NAME", "test")
+		setenv(t, key+"_EMAIL", "test@example.com")
+	}
+	ctx := context.Background()
+
+	if _, err := CommitOutput(ctx, t.TempDir(), "generate"); err == nil || !strings.Contains(err.Error(), "is not inside a git repository") {
+		t.Errorf("expected an output outside a repository to be refused, got %v", err)
+	}
+
+	repo := t.TempDir()
+	git(t, repo, "init", "--quiet")
+	writeFile(t, repo, "README.md", "clients\n")
+	writeFile(t, repo, "out/search.pb.go", "package searchv1\n")
+	output := filepath.Join(repo, "out")
+
+	sha, err := CommitOutput(ctx, output, "Regenerate search\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sha == "" || git(t, repo, "rev-parse", "HEAD") != sha {
+		t.Errorf("returned commit %q is not HEAD", sha)
+	}
+	if files := git(t, repo, "show", "--name-only", "--format=%s", "HEAD"); files != "Regenerate search\n\nout/search.pb.go" {
+		t.Errorf("committed %q", files)
+	}
+
+	if sha, err := CommitOutput(ctx, output, "Regenerate search\n"); err != nil || sha != "" {
+		t.Errorf("an unchanged output was committed as %q, %v", sha, err)
+	}
+}
+
+func TestUncommittedChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	ctx := context.Background()
+	if _, err := UncommittedChanges(ctx, t.TempDir()); err == nil || !strings.Contains(err.Error(), "is not inside a git repository") {
+		t.Errorf("expected an output outside a repository to be refused, got %v", err)
+	}
+
+	repo := t.TempDir()
+	git(t, repo, "init", "--quiet")
+	writeFile(t, repo, "out/search.pb.go", "package searchv1\n")
+	git(t, repo, "add", "-A")
+	git(t, repo, "commit", "--quiet", "-m", "generate")
+	output := filepath.Join(repo, "out")
+
+	if changes, err := UncommittedChanges(ctx, filepath.Join(output, "missing")); err != nil || len(changes) != 0 {
+		t.Errorf("a missing output has changes %q, %v", changes, err)
+	}
+	if changes, err := UncommittedChanges(ctx, output); err != nil || len(changes) != 0 {
+		t.Errorf("a clean output has changes %q, %v", changes, err)
+	}
+
+	// Changes outside of the output are ignored
+	writeFile(t, repo, "README.md", "clients\n")
+	writeFile(t, repo, "out/search.pb.go", "package searchv1 // edited\n")
+	writeFile(t, repo, "out/v1/notes.txt", "manual\n")
+	changes, err := UncommittedChanges(ctx, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"out/search.pb.go", "out/v1/notes.txt"}; strings.Join(changes, ",") != strings.Join(want, ",") {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+}
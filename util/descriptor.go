@@ -0,0 +1,93 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+func descriptorSetCmd(ctx context.Context, inputs []string, dir string, out string, sourceInfo bool, opts GenerateOptions) *exec.Cmd {
+	args := append(opts.protocArgs(dir), "--include_imports", fmt.Sprintf("--descriptor_set_out=%s", out))
+	if sourceInfo {
+		args = append(args, "--include_source_info")
+	}
+	return opts.protocCommand(ctx, dir, append(args, inputs...))
+}
+
+// CopyDescriptorSet copies the FileDescriptorSet at src to dst, gzip compressing it if compress is true
+func CopyDescriptorSet(src string, dst string, compress bool) error {
+	if !compress {
+		return CopyFile(src, dst)
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("cannot read descriptor set: %s", err.Error())
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return fmt.Errorf("cannot compress descriptor set: %s", err.Error())
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("cannot compress descriptor set: %s", err.Error())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("cannot create directory for '%s': %s", dst, err.Error())
+	}
+	if err := os.WriteFile(dst, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("cannot write descriptor set: %s", err.Error())
+	}
+	return nil
+}
+
+// GenerateDescriptorSet compiles the protobuf of service in dir into a FileDescriptorSet, including its imports, and
+// writes it to out
+func GenerateDescriptorSet(ctx context.Context, service string, dir string, out string, opts GenerateOptions) error {
+	inputs, err := protoInputs(service, dir)
+	if err != nil {
+		return err
+	}
+	return runGenerator(descriptorSetCmd(ctx, inputs, dir, out, false, opts), opts)
+}
+
+// CompileDescriptorSet compiles the protobuf of service in dir into a FileDescriptorSet like GenerateDescriptorSet,
+// also keeping the comments of the source, so that code can be generated from it through GenerateOptions.DescriptorSetIn
+// without parsing the protobufs again
+func CompileDescriptorSet(ctx context.Context, service string, dir string, out string, opts GenerateOptions) error {
+	inputs, err := protoInputs(service, dir)
+	if err != nil {
+		return err
+	}
+	return runGenerator(descriptorSetCmd(ctx, inputs, dir, out, true, opts), opts)
+}
+
+func bufBreakingCmd(ctx context.Context, descriptor string, baseline string) *exec.Cmd {
+	return exec.CommandContext(ctx, "buf", "breaking", descriptor+"#format=bin", "--against", baseline+"#format=bin")
+}
+
+// BufBreaking compares the FileDescriptorSet descriptor against the baseline FileDescriptorSet using buf breaking. If
+// descriptor introduces breaking changes, they are returned in the error.
+func BufBreaking(ctx context.Context, descriptor string, baseline string) error {
+	if !BufAvailable() {
+		return errors.New("buf must be installed to check for breaking changes")
+	}
+
+	out, err := bufBreakingCmd(ctx, descriptor, baseline).CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(out) > 0 {
+			return fmt.Errorf("breaking changes detected against baseline '%s':\n\n%s", baseline, out)
+		}
+		return fmt.Errorf("failed to run buf breaking: %s", err.Error())
+	}
+
+	return nil
+}
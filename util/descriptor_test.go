@@ -0,0 +1,133 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBufBreakingCmd(t *testing.T) {
+	cmd := bufBreakingCmd(context.Background(), "search.bin", "baseline.bin")
+	want := []string{"buf", "breaking", "search.bin#format=bin", "--against", "baseline.bin#format=bin"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Fatalf("got %v, want %v", cmd.Args, want)
+	}
+}
+
+func TestBufBreaking(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{"compatible", "exit 0\n", ""},
+		{"breaking changes", "echo 'search.proto:5:3:Field \"1\" on message \"Query\" was deleted.'\nexit 100\n", "breaking changes detected against baseline 'baseline.bin'"},
+		{"failure without output", "exit 1\n", "failed to run buf breaking"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommand(t, "buf", tt.script)
+			err := BufBreaking(context.Background(), "search.bin", "baseline.bin")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCopyDescriptorSet(t *testing.T) {
+	dir := t.TempDir()
+	descriptor := []byte("\x0a\x0csearch.proto\x12\x09search.v1")
+	src := filepath.Join(dir, "search.bin")
+	if err := os.WriteFile(src, descriptor, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := filepath.Join(dir, "out", "search.pb")
+	if err := CopyDescriptorSet(src, plain, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if data, err := os.ReadFile(plain); err != nil || !bytes.Equal(data, descriptor) {
+		t.Errorf("the uncompressed descriptor is %q, %v", data, err)
+	}
+
+	compressed := filepath.Join(dir, "out", "gzip", "search.pb.gz")
+	if err := CopyDescriptorSet(src, compressed, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f, err := os.Open(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("the descriptor is not gzip compressed: %s", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("the descriptor cannot be decompressed: %s", err)
+	}
+	if !bytes.Equal(data, descriptor) {
+		t.Errorf("the descriptor decompresses to %q, want %q", data, descriptor)
+	}
+}
+
+func TestCompileDescriptorSet(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "protoc.log")
+	fakeCommand(t, "protoc", `echo "$@" >> `+log+`
+`)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+	out := filepath.Join(t.TempDir(), "search-inputs.pb")
+
+	if err := GenerateDescriptorSet(context.Background(), "search", dir, out, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompileDescriptorSet(context.Background(), "search", dir, out, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		"--proto_path=. --include_imports --descriptor_set_out=" + out + " search.proto",
+		"--proto_path=. --include_imports --descriptor_set_out=" + out + " --include_source_info search.proto",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("protoc calls = %q, want %q", calls, want)
+	}
+}
+
+func TestGenerateCodeDescriptorSetIn(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "protoc.log")
+	fakeCommand(t, "protoc", `echo "$@" >> `+log+`
+`)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+
+	opts := GenerateOptions{RPCFramework: RPCFrameworkNone, DescriptorSetIn: filepath.Join(dir, "search-inputs.pb")}
+	GenerateCode(context.Background(), LanguageGo, "search", dir, opts)
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), " --descriptor_set_in=search-inputs.pb ") {
+		t.Errorf("protoc was not given the descriptor set relative to its directory: %q", data)
+	}
+}
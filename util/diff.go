@@ -0,0 +1,248 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around the changes of each hunk of a unified diff
+const diffContext = 3
+
+// FileDiff is the change a generated file would make to the output, as a unified diff
+type FileDiff struct {
+	// Name is the slash separated path of the file relative to the output
+	Name   string     `json:"name"`
+	Status FileStatus `json:"status"`
+	Diff   string     `json:"diff"`
+}
+
+// DiffGeneratedFiles returns unified diffs of the generated files in protoDir that would change outputPath if they were
+// copied to it, without copying them. Files that would be unchanged are omitted.
+func DiffGeneratedFiles(protoDir string, outputPath string, opts CopyOptions) ([]FileDiff, error) {
+	files, err := generatedFiles(protoDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []FileDiff
+	for _, f := range files {
+		if err := checkFileSize(f.entry, opts.MaxFileSize); err != nil {
+			return nil, err
+		}
+
+		generated, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read '%s': %s", f.path, err.Error())
+		}
+		generated = append(BannerComment(f.name, opts.Banner), generated...)
+
+		status := FileUpdated
+		existing, err := os.ReadFile(filepath.Join(outputPath, filepath.FromSlash(f.name)))
+		if os.IsNotExist(err) {
+			status = FileCreated
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read '%s' of the output: %s", f.name, err.Error())
+		} else if bytes.Equal(existing, generated) {
+			continue
+		}
+
+		diffs = append(diffs, FileDiff{Name: f.name, Status: status, Diff: UnifiedDiff(f.name, existing, generated, status == FileCreated)})
+	}
+	return diffs, nil
+}
+
+// UnifiedDiff returns the unified diff turning old into new, the contents of the file name. A created file is diffed
+// against /dev/null. Binary files are only reported as differing.
+func UnifiedDiff(name string, old []byte, new []byte, created bool) string {
+	from := "a/" + name
+	if created {
+		from = "/dev/null"
+	}
+	if bytes.IndexByte(old, 0) >= 0 || bytes.IndexByte(new, 0) >= 0 {
+		return fmt.Sprintf("Binary files %s and b/%s differ\n", from, name)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ b/%s\n", from, name)
+	ops := diffLines(splitLines(old), splitLines(new))
+	for _, h := range hunks(ops) {
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(h.oldStart, h.oldLines), hunkRange(h.newStart, h.newLines))
+		for _, op := range ops[h.start:h.end] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// splitLines splits data into lines, each keeping its trailing newline
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOp is a line of an edit script: kept (' '), removed ('-') or added ('+')
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the shortest edit script turning a into b, found with Myers' algorithm
+func diffLines(a []string, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// trace holds v[-d-1..d+1] as it was before each round d, to walk the edits back from the end
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the rounds of diffLines back from the end of a and b, returning the edit script in order
+func backtrack(a []string, b []string, trace [][]int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		// trace[d] starts at k = -d-1
+		at := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunk is a run of the operations of an edit script, ops[start:end], covering changes and their context
+type hunk struct {
+	start, end         int
+	oldStart, oldLines int
+	newStart, newLines int
+}
+
+// hunks groups the changes of ops into hunks with diffContext lines of context. Changes separated by no more than
+// twice the context share a hunk
+func hunks(ops []diffOp) []hunk {
+	var hs []hunk
+	oldLine, newLine := 0, 0
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		before := 0
+		for before < diffContext && i-before > 0 && ops[i-before-1].kind == ' ' {
+			before++
+		}
+		h := hunk{start: i - before, oldStart: oldLine - before, newStart: newLine - before}
+
+		// Extend the hunk over the changes until a run of unchanged lines longer than the context on both sides
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := 0
+			for end+run < len(ops) && ops[end+run].kind == ' ' {
+				run++
+			}
+			if end+run == len(ops) || run > 2*diffContext {
+				if run > diffContext {
+					run = diffContext
+				}
+				end += run
+				break
+			}
+			end += run
+		}
+		h.end = end
+
+		for _, op := range ops[h.start:h.end] {
+			if op.kind != '+' {
+				h.oldLines++
+			}
+			if op.kind != '-' {
+				h.newLines++
+			}
+		}
+		for _, op := range ops[i:h.end] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		hs = append(hs, h)
+		i = h.end
+	}
+	return hs
+}
+
+// hunkRange formats the 0-based start and number of lines of a hunk as in a unified diff header, e.g. 3,4
+func hunkRange(start int, lines int) string {
+	if lines == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if lines == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, lines)
+}
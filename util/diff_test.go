@@ -0,0 +1,59 @@
+package util
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "package search\n\nconst a = 1\nconst b = 2\nconst c = 3\nconst d = 4\nconst e = 5\nconst f = 6\nconst g = 7\n"
+	new := "package search\n\nconst a = 1\nconst b = 2\nconst c = 3\nconst d = 40\nconst e = 5\nconst f = 6\nconst g = 7\nconst h = 8"
+	want := "--- a/search.pb.go\n+++ b/search.pb.go\n" +
+		"@@ -3,7 +3,8 @@\n" +
+		" const a = 1\n const b = 2\n const c = 3\n-const d = 4\n+const d = 40\n const e = 5\n const f = 6\n const g = 7\n" +
+		"+const h = 8\n\\ No newline at end of file\n"
+	if got := UnifiedDiff("search.pb.go", []byte(old), []byte(new), false); got != want {
+		t.Errorf("UnifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+
+	if got, want := UnifiedDiff("query.pb.go", nil, []byte("package query\n"), true), "--- /dev/null\n+++ b/query.pb.go\n@@ -0,0 +1 @@\n+package query\n"; got != want {
+		t.Errorf("UnifiedDiff of a created file =\n%s\nwant\n%s", got, want)
+	}
+	if got, want := UnifiedDiff("search.bin", []byte("a\x00"), []byte("b\x00"), false), "Binary files a/search.bin and b/search.bin differ\n"; got != want {
+		t.Errorf("UnifiedDiff of a binary file = %q, want %q", got, want)
+	}
+}
+
+func TestDiffGeneratedFiles(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "search.pb.go", "package searchv1\n\nconst Version = 2\n")
+	writeFile(t, protoDir, "search.twirp.go", "package searchv1\n")
+	writeFile(t, protoDir, "v1/types.pb.go", "package v1\n")
+
+	output := t.TempDir()
+	writeFile(t, output, "search.pb.go", "package searchv1\n\nconst Version = 1\n")
+	writeFile(t, output, "search.twirp.go", "package searchv1\n")
+
+	diffs, err := DiffGeneratedFiles(protoDir, output, CopyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileDiff{
+		{Name: "search.pb.go", Status: FileUpdated, Diff: "--- a/search.pb.go\n+++ b/search.pb.go\n@@ -1,3 +1,3 @@\n package searchv1\n \n-const Version = 1\n+const Version = 2\n"},
+		{Name: "v1/types.pb.go", Status: FileCreated, Diff: "--- /dev/null\n+++ b/v1/types.pb.go\n@@ -0,0 +1 @@\n+package v1\n"},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("diffed %+v, want %+v", diffs, want)
+	}
+	for i := range want {
+		if diffs[i] != want[i] {
+			t.Errorf("diff %d = %+v, want %+v", i, diffs[i], want[i])
+		}
+	}
+
+	// The output is only read
+	if matches, _ := filepath.Glob(filepath.Join(output, "v1", "*")); len(matches) != 0 {
+		t.Errorf("files were written to the output: %q", matches)
+	}
+}
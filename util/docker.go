@@ -0,0 +1,87 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dockerMounts returns the directories that protoc run with args reads or writes: its proto paths, the output
+// directories of its plugins, the directories of its descriptor sets, plugin binaries and inputs, and the working
+// directory. Paths are made absolute, and directories inside another one are left out.
+func dockerMounts(args []string, cwd string) []string {
+	dirs := []string{cwd}
+	for _, arg := range args {
+		var dir string
+		switch {
+		case strings.HasPrefix(arg, "--proto_path="):
+			dir = strings.TrimPrefix(arg, "--proto_path=")
+		case strings.HasPrefix(arg, "--descriptor_set_out="):
+			dir = filepath.Dir(strings.TrimPrefix(arg, "--descriptor_set_out="))
+		case strings.HasPrefix(arg, "--descriptor_set_in="):
+			dir = filepath.Dir(strings.TrimPrefix(arg, "--descriptor_set_in="))
+		case strings.HasPrefix(arg, "--plugin="):
+			if i := strings.Index(arg, "="); i >= 0 {
+				if j := strings.Index(arg[i+1:], "="); j >= 0 {
+					dir = filepath.Dir(arg[i+1+j+1:])
+				}
+			}
+		case strings.HasPrefix(arg, "--") && strings.Contains(arg, "_out="):
+			out := arg[strings.Index(arg, "_out=")+len("_out="):]
+			dir = out[strings.LastIndex(out, ":")+1:]
+		case !strings.HasPrefix(arg, "-"):
+			dir = filepath.Dir(arg)
+		}
+		if dir == "" {
+			continue
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(cwd, dir)
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+
+	// Shorter paths come first, so directories within them are found to be mounted already
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) < len(dirs[j]) })
+	var mounts []string
+	for _, dir := range dirs {
+		mounted := false
+		for _, m := range mounts {
+			if within(dir, m) {
+				mounted = true
+				break
+			}
+		}
+		if !mounted {
+			mounts = append(mounts, dir)
+		}
+	}
+	return mounts
+}
+
+// dockerArgs returns the arguments of docker running protoc with args in image. Every directory protoc uses is mounted
+// at the same path, so the paths in args can be passed unchanged, and protoc runs as the current user so the files it
+// writes are owned by them.
+func (o GenerateOptions) dockerArgs(args []string, cwd string) []string {
+	dockerArgs := []string{"run", "--rm", "--workdir", cwd}
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		dockerArgs = append(dockerArgs, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	for _, dir := range dockerMounts(args, cwd) {
+		dockerArgs = append(dockerArgs, "--volume", fmt.Sprintf("%s:%s", dir, dir))
+	}
+	for _, e := range o.Env {
+		dockerArgs = append(dockerArgs, "--env", e)
+	}
+	dockerArgs = append(dockerArgs, o.DockerImage, "protoc")
+	return append(dockerArgs, args...)
+}
+
+// dockerCommand returns a command running protoc with args in the opts.DockerImage container, in the directory cwd
+func (o GenerateOptions) dockerCommand(ctx context.Context, args []string, cwd string) *exec.Cmd {
+	return exec.CommandContext(ctx, "docker", o.dockerArgs(args, cwd)...)
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDockerMounts(t *testing.T) {
+	args := []string{
+		"--proto_path=.",
+		"--proto_path=/usr/include",
+		"--plugin=protoc-gen-go=/opt/plugins/protoc-gen-go",
+		"--go_out=paths=source_relative:/out/search",
+		"--descriptor_set_out=/out/search/descriptor.pb",
+		"--descriptor_set_in=/tmp/generation/search-inputs.pb",
+		"--experimental_allow_proto3_optional",
+		"search/v1/search.proto",
+	}
+	got := dockerMounts(args, "/work/src")
+	sort.Strings(got)
+	if want := []string{"/opt/plugins", "/out/search", "/tmp/generation", "/usr/include", "/work/src"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dockerMounts = %q, want %q", got, want)
+	}
+}
+
+func TestDockerArgs(t *testing.T) {
+	opts := GenerateOptions{DockerImage: "example.com/protoc:3.19", Env: []string{"GOFLAGS=-mod=mod"}}
+	got := opts.dockerArgs([]string{"--proto_path=/protos", "--go_out=/protos", "search.proto"}, "/protos")
+
+	want := []string{"run", "--rm", "--workdir", "/protos"}
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		want = append(want, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	want = append(want, "--volume", "/protos:/protos", "--env", "GOFLAGS=-mod=mod",
+		"example.com/protoc:3.19", "protoc", "--proto_path=/protos", "--go_out=/protos", "search.proto")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dockerArgs =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestGenerateCodeDocker(t *testing.T) {
+	log := writeFile(t, t.TempDir(), "docker.log", "")
+	fakeCommand(t, "docker", `echo "$@" >> `+log+`
+`)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+
+	opts := GenerateOptions{DockerImage: "example.com/protoc:3.19"}
+	if err := GenerateCode(context.Background(), LanguageGo, "search", dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call := string(data); !strings.Contains(call, "--volume "+dir+":"+dir) || !strings.Contains(call, "example.com/protoc:3.19 protoc ") {
+		t.Errorf("protoc was not run in the container with the protobufs mounted: %q", call)
+	}
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"context"
+	"fmt"
+)
+
+// Formats of the documentation generated by protoc-gen-doc
+const (
+	DocsHTML     = "html"
+	DocsMarkdown = "markdown"
+	DocsJSON     = "json"
+)
+
+// docsExtensions are the extensions of the documentation file written in each format
+var docsExtensions = map[string]string{
+	DocsHTML:     ".html",
+	DocsMarkdown: ".md",
+	DocsJSON:     ".json",
+}
+
+// ValidateDocsFormat checks that documentation can be generated in format
+func ValidateDocsFormat(format string) error {
+	if _, ok := docsExtensions[format]; !ok {
+		return fmt.Errorf("Invalid documentation format '%s'. Valid formats are: %s, %s, %s", format, DocsHTML, DocsMarkdown, DocsJSON)
+	}
+	return nil
+}
+
+// DocsName returns the name of the documentation file of service in format, e.g. search.md
+func DocsName(service string, format string) string {
+	return service + docsExtensions[format]
+}
+
+// GenerateDocs generates the documentation of the protobufs of service in format into dir using protoc-gen-doc. The
+// documentation of every protobuf is written to a single file named by DocsName
+func GenerateDocs(ctx context.Context, service string, format string, dir string, opts GenerateOptions) error {
+	if err := ValidateDocsFormat(format); err != nil {
+		return err
+	}
+	inputs, err := protoInputs(service, dir)
+	if err != nil {
+		return err
+	}
+
+	// protoc-gen-doc takes the format and the name of the file it writes as its options
+	p := plugin{name: "doc", opts: fmt.Sprintf("%s,%s", format, DocsName(service, format))}
+	args := append(opts.protocArgs(dir), opts.pluginArgs(p, dir)...)
+	args = append(args, inputs...)
+	return runGenerator(opts.protocCommand(ctx, dir, args), opts)
+}
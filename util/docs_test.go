@@ -0,0 +1,19 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestDocsName(t *testing.T) {
+	for format, want := range map[string]string{DocsHTML: "search.html", DocsMarkdown: "search.md", DocsJSON: "search.json"} {
+		if err := ValidateDocsFormat(format); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if got := DocsName("search", format); got != want {
+			t.Errorf("DocsName(search, %s) = %q, want %q", format, got, want)
+		}
+	}
+	if err := ValidateDocsFormat("pdf"); err == nil {
+		t.Error("the pdf format was accepted")
+	}
+}
@@ -0,0 +1,155 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// builtinGenerators are the languages protoc generates itself, without a protoc-gen-<name> plugin
+var builtinGenerators = map[string]bool{
+	"cpp": true, "csharp": true, "java": true, "js": true, "objc": true, "php": true, "python": true, "ruby": true,
+}
+
+// connectTimeout bounds each connectivity check
+const connectTimeout = 10 * time.Second
+
+// Check is the result of checking a prerequisite of generation
+type Check struct {
+	Name string
+
+	// Err is nil when the check passed
+	Err error
+
+	// Detail describes what was found, such as a version or path
+	Detail string
+
+	// Hint suggests how to fix a failed check
+	Hint string
+
+	// Optional checks are only needed by some features, and do not prevent generation when they fail
+	Optional bool
+}
+
+// lookPath finds the binary name in the toolchain directory or on the PATH
+func (o GenerateOptions) lookPath(name string) (string, error) {
+	if o.ToolchainDir != "" {
+		if p, err := exec.LookPath(filepath.Join(o.ToolchainDir, name)); err == nil {
+			return p, nil
+		}
+	}
+	return exec.LookPath(name)
+}
+
+// CheckProtoc checks that protoc can be run, reporting its version
+func CheckProtoc(ctx context.Context, opts GenerateOptions) Check {
+	c := Check{Name: "protoc", Hint: "Install protoc from https://github.com/protocolbuffers/protobuf/releases, or pass --toolchain-dir"}
+	path, err := opts.lookPath("protoc")
+	if err != nil {
+		c.Err = errors.New("protoc was not found")
+		return c
+	}
+
+	major, minor, err := ProtocVersion(ctx, opts)
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	c.Detail = fmt.Sprintf("%d.%d (%s)", major, minor, path)
+	return c
+}
+
+// CheckPlugins checks that the protoc plugins generating language code with framework can be found. framework may be
+// RPCFrameworkNone to check only the message plugin.
+func CheckPlugins(language string, framework string, opts GenerateOptions) []Check {
+	plugins := []plugin{messagePlugins[language]}
+	if rpc, err := rpcPlugin(language, framework); err == nil && rpc != nil {
+		plugins = append(plugins, *rpc)
+	}
+
+	var checks []Check
+	for _, p := range plugins {
+		c := Check{Name: fmt.Sprintf("%s plugin (%s)", p.name, language)}
+		if builtinGenerators[p.name] {
+			c.Detail = "built into protoc"
+			checks = append(checks, c)
+			continue
+		}
+
+		binary := "protoc-gen-" + p.name
+		c.Hint = fmt.Sprintf("Install %s on your PATH, or pass --plugin-path %s=<path>", binary, p.name)
+		if path, ok := opts.PluginPaths[p.name]; ok && path != "" {
+			binary = path
+		}
+		path, err := opts.lookPath(binary)
+		if err != nil {
+			c.Err = fmt.Errorf("%s was not found", binary)
+		} else {
+			c.Detail = path
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// CheckGit checks that git can be run, reporting its version
+func CheckGit(ctx context.Context) Check {
+	c := Check{Name: "git", Hint: "Install git from https://git-scm.com"}
+	out, err := exec.CommandContext(ctx, "git", "--version").Output()
+	if err != nil {
+		c.Err = fmt.Errorf("git cannot be run: %s", err.Error())
+		return c
+	}
+	c.Detail = strings.TrimSpace(string(out))
+	return c
+}
+
+// CheckSSH checks that git can authenticate with host over SSH, which repositories are cloned with
+func CheckSSH(ctx context.Context, host string) Check {
+	c := Check{Name: fmt.Sprintf("ssh (%s)", host), Hint: fmt.Sprintf("Add an SSH key to your account on %s and to your SSH agent", host)}
+
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	// Github closes the session after authenticating, so ssh exits with an error even when it succeeded
+	out, _ := exec.CommandContext(ctx, "ssh", "-T", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new", "git@"+host).CombinedOutput()
+	if !strings.Contains(string(out), "successfully authenticated") {
+		c.Err = fmt.Errorf("cannot authenticate with git@%s: %s", host, strings.TrimSpace(string(out)))
+		return c
+	}
+	c.Detail = "authenticated"
+	return c
+}
+
+// CheckHTTPS checks that host can be reached over HTTPS
+func CheckHTTPS(ctx context.Context, host string) Check {
+	c := Check{Name: fmt.Sprintf("https (%s)", host), Hint: "Check your network connection and the --https-proxy setting", Optional: true}
+
+	d := tls.Dialer{NetDialer: &net.Dialer{Timeout: connectTimeout}}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, "443"))
+	if err != nil {
+		c.Err = fmt.Errorf("cannot connect to %s: %s", host, err.Error())
+		return c
+	}
+	conn.Close()
+	c.Detail = "reachable"
+	return c
+}
+
+// CheckBuf checks that buf is installed, which lints protobufs and checks them for breaking changes
+func CheckBuf() Check {
+	c := Check{Name: "buf", Hint: "Install buf from https://buf.build to lint protobufs", Optional: true}
+	path, err := exec.LookPath("buf")
+	if err != nil {
+		c.Err = errors.New("buf was not found")
+		return c
+	}
+	c.Detail = path
+	return c
+}
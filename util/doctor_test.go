@@ -0,0 +1,48 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckProtoc(t *testing.T) {
+	setenv(t, "PATH", t.TempDir())
+	if c := CheckProtoc(context.Background(), GenerateOptions{}); c.Err == nil || c.Hint == "" {
+		t.Errorf("a missing protoc passed: %+v", c)
+	}
+
+	fakeCommand(t, "protoc", "echo 'libprotoc 3.19.4'\n")
+	if c := CheckProtoc(context.Background(), GenerateOptions{}); c.Err != nil || !strings.HasPrefix(c.Detail, "3.19 (") {
+		t.Errorf("unexpected check %+v", c)
+	}
+}
+
+func TestCheckPlugins(t *testing.T) {
+	setenv(t, "PATH", t.TempDir())
+	toolchain := t.TempDir()
+	if err := os.WriteFile(filepath.Join(toolchain, "protoc-gen-go"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	custom := filepath.Join(t.TempDir(), "protoc-gen-twirp-custom")
+	if err := os.WriteFile(custom, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := CheckPlugins(LanguageGo, RPCFrameworkTwirp, GenerateOptions{ToolchainDir: toolchain})
+	if len(checks) != 2 || checks[0].Err != nil || checks[1].Err == nil || !strings.Contains(checks[1].Hint, "--plugin-path twirp=") {
+		t.Errorf("unexpected checks %+v", checks)
+	}
+
+	checks = CheckPlugins(LanguageGo, RPCFrameworkTwirp, GenerateOptions{ToolchainDir: toolchain, PluginPaths: map[string]string{"twirp": custom}})
+	if len(checks) != 2 || checks[1].Err != nil || checks[1].Detail != custom {
+		t.Errorf("the custom twirp plugin was not found: %+v", checks)
+	}
+
+	checks = CheckPlugins("ruby", RPCFrameworkNone, GenerateOptions{})
+	if len(checks) != 1 || checks[0].Err != nil || checks[0].Detail != "built into protoc" {
+		t.Errorf("unexpected checks for ruby %+v", checks)
+	}
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// protoDecoder returns the decoder transcoding protobufs in the IANA character set name, e.g. ISO-8859-1 or
+// windows-1252, to UTF-8. nil is returned for an empty name or UTF-8, which protobufs are read as by protoc.
+func protoDecoder(name string) (*encoding.Decoder, error) {
+	if name == "" {
+		return nil, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("Unsupported protobuf encoding '%s', expected a character set such as ISO-8859-1 or windows-1252", name)
+	}
+	if enc == unicode.UTF8 {
+		return nil, nil
+	}
+	return enc.NewDecoder(), nil
+}
+
+// ValidateProtoEncoding returns an error if protobufs in the character set name cannot be transcoded to UTF-8
+func ValidateProtoEncoding(name string) error {
+	_, err := protoDecoder(name)
+	return err
+}
+
+// transcodeProtobuf rewrites the protobuf at path from the character set name to UTF-8. Nothing is done for UTF-8.
+func transcodeProtobuf(path string, name string) error {
+	dec, err := protoDecoder(name)
+	if err != nil || dec == nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read protobuf file: %s", err.Error())
+	}
+	transcoded, _, err := transform.Bytes(dec, data)
+	if err != nil {
+		return fmt.Errorf("cannot transcode protobuf file '%s' from %s: %s", filepath.Base(path), name, err.Error())
+	}
+	if err := os.WriteFile(path, transcoded, 0644); err != nil {
+		return fmt.Errorf("cannot rewrite protobuf file: %s", err.Error())
+	}
+	return nil
+}
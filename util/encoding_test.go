@@ -0,0 +1,65 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateProtoEncoding(t *testing.T) {
+	for _, name := range []string{"", "UTF-8", "utf-8", "ISO-8859-1", "latin1", "windows-1252", "Shift_JIS"} {
+		if err := ValidateProtoEncoding(name); err != nil {
+			t.Errorf("ValidateProtoEncoding(%q) = %s", name, err)
+		}
+	}
+	if err := ValidateProtoEncoding("EBCDIC-XYZ"); err == nil {
+		t.Error("an unknown encoding was accepted")
+	}
+}
+
+func TestCopyProtobufEncoding(t *testing.T) {
+	// "Café" in ISO-8859-1
+	latin1 := "syntax = \"proto3\";\n\n// Caf\xe9 search\n"
+	root := t.TempDir()
+	writeFile(t, root, "public/search.proto", latin1)
+	writeFile(t, root, "public/messages/v1/messages.proto", latin1)
+
+	protoDir := t.TempDir()
+	if err := CopyProtobuf("search", root, protoDir, false, 0, "ISO-8859-1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, name := range []string{"search.proto", "messages/v1/messages.proto"} {
+		data, err := os.ReadFile(filepath.Join(protoDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "// Café search\n") {
+			t.Errorf("%s was not transcoded to UTF-8: %q", name, data)
+		}
+	}
+
+	// UTF-8 protobufs are copied as they are
+	protoDir = t.TempDir()
+	if err := CopyProtobuf("search", root, protoDir, false, 0, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(protoDir, "search.proto")); string(data) != latin1 {
+		t.Errorf("the protobuf was changed without an encoding: %q", data)
+	}
+}
+
+func TestWriteProtobufEncoding(t *testing.T) {
+	protoDir := t.TempDir()
+	// The euro sign is 0x80 in windows-1252
+	if err := WriteProtobuf(strings.NewReader("// \x80 prices\n"), "search", protoDir, 0, "windows-1252"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := os.ReadFile(filepath.Join(protoDir, "search.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "// € prices\n" {
+		t.Errorf("got %q", data)
+	}
+}
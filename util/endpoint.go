@@ -0,0 +1,77 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// endpointTemplates hold the source declaring the default endpoint of a service for each language it can be embedded
+// in. They are rendered with endpointData
+var endpointTemplates = map[string]*template.Template{
+	LanguageGo: template.Must(template.New("go").Parse(`// Code generated by proto-client-generator. DO NOT EDIT.
+
+package {{.Package}}
+
+// DefaultEndpoint is the base URL of the {{.Service}} service the clients connect to by default
+const DefaultEndpoint = {{printf "%q" .Endpoint}}
+`)),
+	LanguagePython: template.Must(template.New("python").Parse(`# Generated by proto-client-generator. DO NOT EDIT.
+
+# The base URL of the {{.Service}} service the clients connect to by default
+DEFAULT_ENDPOINT = {{printf "%q" .Endpoint}}
+`)),
+}
+
+// endpointData is the data an endpoint template is rendered with
+type endpointData struct {
+	Package  string
+	Service  string
+	Endpoint string
+}
+
+// ValidateDefaultEndpoint checks that endpoint can be embedded in the clients generated for language, and that it is an
+// absolute URL
+func ValidateDefaultEndpoint(language string, endpoint string) error {
+	if _, ok := endpointTemplates[language]; !ok {
+		return fmt.Errorf("A default endpoint cannot be embedded in the clients generated for '%s'", language)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("Invalid default endpoint '%s', it must be an absolute URL such as https://search.example.com", endpoint)
+	}
+	return nil
+}
+
+// GenerateDefaultEndpoint writes a constant holding endpoint, the default base URL of service, alongside the code
+// generated for service in dir: DefaultEndpoint in <service>_endpoint.go for Go, in the package of the generated code,
+// and DEFAULT_ENDPOINT in <service>_endpoint.py for Python.
+func GenerateDefaultEndpoint(language string, service string, dir string, endpoint string) error {
+	tmpl, ok := endpointTemplates[language]
+	if !ok {
+		return fmt.Errorf("a default endpoint cannot be embedded in the clients generated for '%s'", language)
+	}
+
+	data := endpointData{Service: service, Endpoint: endpoint}
+	ext := ".py"
+	if language == LanguageGo {
+		pkg, err := goPackageName(filepath.Join(dir, service+".pb.go"))
+		if err != nil {
+			return err
+		}
+		data.Package = pkg
+		ext = ".go"
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return fmt.Errorf("cannot render default endpoint: %s", err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(dir, service+"_endpoint"+ext), b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("cannot write default endpoint: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateDefaultEndpoint(t *testing.T) {
+	tests := []struct {
+		language string
+		endpoint string
+		wantErr  bool
+	}{
+		{LanguageGo, "https://search.example.com", false},
+		{LanguagePython, "http://localhost:8080/twirp", false},
+		{LanguageRuby, "https://search.example.com", true},
+		{LanguageGo, "search.example.com", true},
+		{LanguageGo, "https://", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateDefaultEndpoint(tt.language, tt.endpoint); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateDefaultEndpoint(%s, %s) = %v, want error %t", tt.language, tt.endpoint, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGenerateDefaultEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "search.pb.go", "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage searchv1\n")
+
+	if err := GenerateDefaultEndpoint(LanguageGo, "search", dir, `https://search.example.com/"v1"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateDefaultEndpoint(LanguagePython, "search", dir, "https://search.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"search_endpoint.go": "// Code generated by proto-client-generator. DO NOT EDIT.\n\npackage searchv1\n\n" +
+			"// DefaultEndpoint is the base URL of the search service the clients connect to by default\n" +
+			"const DefaultEndpoint = \"https://search.example.com/\\\"v1\\\"\"\n",
+		"search_endpoint.py": "# Generated by proto-client-generator. DO NOT EDIT.\n\n" +
+			"# The base URL of the search service the clients connect to by default\n" +
+			"DEFAULT_ENDPOINT = \"https://search.example.com\"\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s =\n%s\nwant\n%s", name, data, want)
+		}
+	}
+
+	if err := GenerateDefaultEndpoint(LanguageGo, "query", dir, "https://query.example.com"); err == nil {
+		t.Error("a default endpoint was embedded without the generated Go code")
+	}
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExtensionsDefault stands for the DefaultExtensions of the language in a list of extensions
+const ExtensionsDefault = "default"
+
+// defaultExtensions are the extensions of the files the plugins of each language generate. OpenAPI specifications are
+// generated as .json for every language
+var defaultExtensions = map[string][]string{
+	LanguageGo:         {".go", ".json"},
+	LanguageRuby:       {".rb", ".json"},
+	LanguagePython:     {".py", ".pyi", ".json"},
+	LanguageJava:       {".java", ".json"},
+	LanguageJavascript: {".js", ".ts", ".json"},
+}
+
+// DefaultExtensions returns the extensions of the files generated for language
+func DefaultExtensions(language string) []string {
+	return append([]string(nil), defaultExtensions[language]...)
+}
+
+// ExpandExtensions returns exts with ExtensionsDefault replaced by the DefaultExtensions of language
+func ExpandExtensions(language string, exts []string) []string {
+	var expanded []string
+	for _, ext := range exts {
+		if ext == ExtensionsDefault {
+			expanded = append(expanded, DefaultExtensions(language)...)
+			continue
+		}
+		expanded = append(expanded, ext)
+	}
+	return expanded
+}
+
+// ValidateExtensions checks that every extension in exts starts with a dot, e.g. .go or .pb.go
+func ValidateExtensions(exts []string) error {
+	for _, ext := range exts {
+		if len(ext) < 2 || !strings.HasPrefix(ext, ".") || strings.ContainsAny(ext, `/\`) {
+			return fmt.Errorf("Invalid file extension '%s', extensions must start with a dot, e.g. .go", ext)
+		}
+	}
+	return nil
+}
+
+// hasExtension returns true if the file name ends with one of exts
+func hasExtension(name string, exts []string) bool {
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// copiedExtension returns true if the generated file name is copied by opts: .proto files only with IncludeProto,
+// and any other file if it has one of the allowed Extensions, when given, and none of the ExcludeExtensions
+func copiedExtension(name string, opts CopyOptions) bool {
+	if strings.HasSuffix(name, ".proto") {
+		return opts.IncludeProto
+	}
+	if len(opts.Extensions) > 0 && !hasExtension(name, opts.Extensions) {
+		return false
+	}
+	return !hasExtension(name, opts.ExcludeExtensions)
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandExtensions(t *testing.T) {
+	got := ExpandExtensions(LanguagePython, []string{ExtensionsDefault, ".txt"})
+	if want := []string{".py", ".pyi", ".json", ".txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandExtensions = %q, want %q", got, want)
+	}
+}
+
+func TestValidateExtensions(t *testing.T) {
+	if err := ValidateExtensions([]string{".go", ".pb.json"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for _, ext := range []string{"go", ".", "./go", ""} {
+		if err := ValidateExtensions([]string{ext}); err == nil {
+			t.Errorf("the extension %q was accepted", ext)
+		}
+	}
+}
+
+func TestCopyGeneratedFilesExtensions(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "search.pb.go", "package searchv1\n")
+	writeFile(t, protoDir, "search.swagger.json", "{}\n")
+	writeFile(t, protoDir, "plugin.log", "done\n")
+	writeFile(t, protoDir, "v1/.DS_Store", "\x00")
+
+	chdir(t, t.TempDir())
+	tests := []struct {
+		name string
+		opts CopyOptions
+		want []string
+	}{
+		{"allowed", CopyOptions{Extensions: DefaultExtensions(LanguageGo)}, []string{"search.pb.go", "search.swagger.json"}},
+		{"excluded", CopyOptions{ExcludeExtensions: []string{".log", ".DS_Store"}}, []string{"search.pb.go", "search.swagger.json"}},
+		{"both", CopyOptions{Extensions: []string{".go", ".log"}, ExcludeExtensions: []string{".log"}}, []string{"search.pb.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copied, err := CopyGeneratedFiles(protoDir, tt.name, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var names []string
+			for _, c := range copied {
+				names = append(names, c.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("copied %q, want %q", names, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(tt.name, "plugin.log")); err == nil {
+				t.Error("the stray log was copied")
+			}
+		})
+	}
+}
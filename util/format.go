@@ -0,0 +1,54 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Formatters of protobufs, in the order FindProtoFormatter prefers them
+const (
+	FormatterBuf         = "buf"
+	FormatterClangFormat = "clang-format"
+)
+
+// FindProtoFormatter returns the first protobuf formatter found on the PATH, or an empty string if none is installed
+func FindProtoFormatter() string {
+	for _, formatter := range []string{FormatterBuf, FormatterClangFormat} {
+		if _, err := exec.LookPath(formatter); err == nil {
+			return formatter
+		}
+	}
+	return ""
+}
+
+// formatProtoCmd returns the command formatting the protobuf at path in place with formatter
+func formatProtoCmd(ctx context.Context, formatter string, path string) *exec.Cmd {
+	if formatter == FormatterClangFormat {
+		return exec.CommandContext(ctx, FormatterClangFormat, "-i", path)
+	}
+	return exec.CommandContext(ctx, FormatterBuf, "format", "-w", path)
+}
+
+// FormatProtos formats every protobuf in protoDir in place with formatter, one of FormatterBuf or FormatterClangFormat
+func FormatProtos(ctx context.Context, protoDir string, formatter string) error {
+	if formatter != FormatterBuf && formatter != FormatterClangFormat {
+		return fmt.Errorf("unknown protobuf formatter '%s'", formatter)
+	}
+	files, err := ProtoFiles(protoDir)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		out, err := formatProtoCmd(ctx, formatter, path).CombinedOutput()
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("failed to format protobuf with %s: %s", formatter, msg)
+			}
+			return fmt.Errorf("failed to format protobuf with %s: %s", formatter, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindProtoFormatter(t *testing.T) {
+	dir := t.TempDir()
+	setenv(t, "PATH", dir)
+	if got := FindProtoFormatter(); got != "" {
+		t.Errorf("FindProtoFormatter = %q without a formatter installed", got)
+	}
+
+	for _, tt := range []struct{ install, want string }{{"clang-format", FormatterClangFormat}, {"buf", FormatterBuf}} {
+		if err := os.WriteFile(filepath.Join(dir, tt.install), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if got := FindProtoFormatter(); got != tt.want {
+			t.Errorf("FindProtoFormatter with %s installed = %q, want %q", tt.install, got, tt.want)
+		}
+	}
+}
+
+func TestFormatProtoCmd(t *testing.T) {
+	if got := strings.Join(formatProtoCmd(context.Background(), FormatterBuf, "search.proto").Args, " "); got != "buf format -w search.proto" {
+		t.Errorf("buf command = %q", got)
+	}
+	if got := strings.Join(formatProtoCmd(context.Background(), FormatterClangFormat, "search.proto").Args, " "); got != "clang-format -i search.proto" {
+		t.Errorf("clang-format command = %q", got)
+	}
+}
+
+func TestFormatProtos(t *testing.T) {
+	fakeCommand(t, "clang-format", `[ "$1" = "-i" ] || exit 2
+printf '// formatted\n' >> "$2"
+`)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, dir, "common/page.proto", "syntax = \"proto3\";\n")
+	writeFile(t, dir, "search.pb.go", "package search\n")
+
+	if err := FormatProtos(context.Background(), dir, FormatterClangFormat); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"search.proto":      "syntax = \"proto3\";\n// formatted\n",
+		"common/page.proto": "syntax = \"proto3\";\n// formatted\n",
+		"search.pb.go":      "package search\n",
+	} {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+
+	fakeCommand(t, "clang-format", "echo 'search.proto: invalid' >&2\nexit 1\n")
+	if err := FormatProtos(context.Background(), dir, FormatterClangFormat); err == nil || !strings.Contains(err.Error(), "search.proto: invalid") {
+		t.Errorf("expected the formatter's error, got %v", err)
+	}
+	if err := FormatProtos(context.Background(), dir, "prettier"); err == nil {
+		t.Error("an unknown formatter was accepted")
+	}
+}
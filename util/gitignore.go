@@ -0,0 +1,78 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GitignoreName is the name of the .gitignore written to an output directory by WriteGitignore
+const GitignoreName = ".gitignore"
+
+// gitignoreHeader starts every .gitignore written by WriteGitignore
+const gitignoreHeader = `# Written by proto-client-generator from the manifest of this directory. Everything but the generated files listed
+# below is ignored, so only generated files are tracked. Do not edit: it is rewritten on every generation.
+`
+
+// WriteGitignore writes a .gitignore to outputPath that ignores everything except the generated files recorded in m,
+// the manifest and the .gitignore itself
+func WriteGitignore(outputPath string, m *Manifest) error {
+	names := []string{GitignoreName, ManifestName}
+	for _, f := range m.Files {
+		names = append(names, f.Name)
+	}
+
+	var b strings.Builder
+	b.WriteString(gitignoreHeader)
+	b.WriteString("/*\n")
+	for _, line := range allowlist(names) {
+		b.WriteString(line + "\n")
+	}
+
+	if err := os.WriteFile(filepath.Join(outputPath, GitignoreName), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("cannot write %s: %s", GitignoreName, err.Error())
+	}
+	return nil
+}
+
+// allowlist returns the .gitignore patterns re-including the slash separated paths in names under a top-level "/*".
+// Git does not look inside ignored directories, so each directory of a nested path is re-included, with its own
+// contents ignored but for the paths below it.
+func allowlist(names []string) []string {
+	var patterns []string
+	seen := make(map[string]bool)
+	add := func(pattern string) {
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		parts := strings.Split(name, "/")
+		for i := 1; i < len(parts); i++ {
+			dir := "/" + escapeGitignore(path.Join(parts[:i]...))
+			add("!" + dir + "/")
+			add(dir + "/*")
+		}
+		add("!/" + escapeGitignore(name))
+	}
+	return patterns
+}
+
+// escapeGitignore escapes the characters of the slash separated path name that are special in .gitignore patterns
+func escapeGitignore(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune(`\*?[!#`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
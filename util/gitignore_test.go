@@ -0,0 +1,55 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAllowlist(t *testing.T) {
+	got := allowlist([]string{"search.pb.go", "v1/query/query.pb.go", "v1/search#1.pb.go"})
+	want := []string{
+		"!/search.pb.go",
+		"!/v1/",
+		"/v1/*",
+		"!/v1/query/",
+		"/v1/query/*",
+		"!/v1/query/query.pb.go",
+		"!/v1/search\\#1.pb.go",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWriteGitignore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	output := t.TempDir()
+	git(t, output, "init", "--quiet")
+	m := &Manifest{Files: []ManifestFile{{Name: "search.pb.go"}, {Name: "v1/query.pb.go"}}}
+	if err := WriteGitignore(output, m); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, name := range []string{"search.pb.go", "v1/query.pb.go", "stale.pb.go", "v1/stale.pb.go", "v2/search.pb.go", ManifestName} {
+		writeFile(t, output, name, "generated\n")
+	}
+	data, err := os.ReadFile(filepath.Join(output, GitignoreName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), gitignoreHeader) {
+		t.Errorf("the .gitignore does not start with its header: %q", data)
+	}
+
+	// Only the generated files, the manifest and the .gitignore are left to be tracked
+	tracked := git(t, output, "ls-files", "--others", "--exclude-standard")
+	want := strings.Join([]string{GitignoreName, ManifestName, "search.pb.go", "v1/query.pb.go"}, "\n")
+	if tracked != want {
+		t.Errorf("untracked files not ignored are %q, want %q", tracked, want)
+	}
+}
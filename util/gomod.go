@@ -0,0 +1,131 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GoModule is the Go module holding a directory
+type GoModule struct {
+	// Path is the module path declared by go.mod, e.g. github.com/org/repo
+	Path string
+
+	// Dir is the directory holding go.mod
+	Dir string
+}
+
+// FindGoModule returns the module whose go.mod is in dir or its closest parent holding one. dir need not exist yet.
+func FindGoModule(dir string) (GoModule, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return GoModule{}, fmt.Errorf("cannot resolve '%s': %s", dir, err.Error())
+	}
+
+	for d := abs; ; d = filepath.Dir(d) {
+		data, err := os.ReadFile(filepath.Join(d, "go.mod"))
+		if err == nil {
+			modulePath, err := parseModulePath(string(data))
+			if err != nil {
+				return GoModule{}, fmt.Errorf("invalid go.mod in '%s': %s", d, err.Error())
+			}
+			return GoModule{Path: modulePath, Dir: d}, nil
+		}
+		if parent := filepath.Dir(d); parent == d {
+			return GoModule{}, fmt.Errorf("No go.mod was found in '%s' or any of its parents", dir)
+		}
+	}
+}
+
+// parseModulePath returns the path of the module directive of the go.mod contents data
+func parseModulePath(data string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+
+		modulePath := fields[1]
+		if unquoted, err := strconv.Unquote(modulePath); err == nil {
+			modulePath = unquoted
+		}
+		if modulePath != "" {
+			return modulePath, nil
+		}
+	}
+	return "", errors.New("no module directive")
+}
+
+// ImportPath returns the import path of the package in dir, which must be within the module
+func (m GoModule) ImportPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve '%s': %s", dir, err.Error())
+	}
+	rel, err := filepath.Rel(m.Dir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' is not within the module '%s' in '%s'", dir, m.Path, m.Dir)
+	}
+	return path.Join(m.Path, filepath.ToSlash(rel)), nil
+}
+
+// goPlugins are the protoc plugins generating Go code, which are all given the import mappings of the protobufs
+var goPlugins = []string{"go", "go-grpc", "twirp", gatewayPlugin.name}
+
+// WithGoImportMappings returns opts with the import mappings added to the options of every Go plugin
+func WithGoImportMappings(opts map[string][]string, mappings []string) map[string][]string {
+	merged := make(map[string][]string, len(opts)+len(goPlugins))
+	for name, o := range opts {
+		merged[name] = o
+	}
+	for _, name := range goPlugins {
+		merged[name] = append(append([]string{}, mappings...), opts[name]...)
+	}
+	return merged
+}
+
+// GoImportMappings returns the M<proto>=<import path> options of the Go plugins mapping each protobuf in protoDir to
+// the package its code is written to in outputPath, which is within a Go module. With paths=source_relative the code of
+// a protobuf is written to the directory of the protobuf in outputPath, less the trimmed prefix, and within the
+// protobuf's own subdirectory when split is true. See GenerateOptions.SplitByProto.
+func GoImportMappings(protoDir string, outputPath string, trimmed string, split bool) ([]string, error) {
+	module, err := FindGoModule(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ProtoFiles(protoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []string
+	for _, f := range files {
+		rel, err := filepath.Rel(protoDir, f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot map protobuf '%s': %s", f, err.Error())
+		}
+		name := filepath.ToSlash(rel)
+
+		generated := name
+		if split {
+			generated = path.Join(SplitName(f), name)
+		}
+		dir := path.Dir(trimPrefix(generated, trimmed))
+		importPath, err := module.ImportPath(filepath.Join(outputPath, filepath.FromSlash(dir)))
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, fmt.Sprintf("M%s=%s", name, importPath))
+	}
+	return mappings, nil
+}
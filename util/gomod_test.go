@@ -0,0 +1,92 @@
+package util
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindGoModule(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "// The clients\nmodule \"github.com/org/clients\" // generated\n\ngo 1.21\n")
+
+	module, err := FindGoModule(filepath.Join(dir, "gen", "search"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if module.Path != "github.com/org/clients" || module.Dir != dir {
+		t.Errorf("FindGoModule = %+v, want github.com/org/clients in %s", module, dir)
+	}
+
+	importPath, err := module.ImportPath(filepath.Join(dir, "gen", "search"))
+	if err != nil || importPath != "github.com/org/clients/gen/search" {
+		t.Errorf("ImportPath = %q, %v, want github.com/org/clients/gen/search", importPath, err)
+	}
+	if _, err := module.ImportPath(t.TempDir()); err == nil {
+		t.Error("ImportPath outside of the module did not fail")
+	}
+
+	writeFile(t, dir, "broken/go.mod", "go 1.21\n")
+	if _, err := FindGoModule(filepath.Join(dir, "broken")); err == nil {
+		t.Error("FindGoModule with no module directive did not fail")
+	}
+}
+
+func TestGoImportMappings(t *testing.T) {
+	module := t.TempDir()
+	writeFile(t, module, "go.mod", "module github.com/org/clients\n")
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "proto/search/v1/search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "proto/common/page.proto", "syntax = \"proto3\";\n")
+
+	mappings, err := GoImportMappings(protoDir, filepath.Join(module, "gen"), "proto", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Mproto/common/page.proto=github.com/org/clients/gen/common",
+		"Mproto/search/v1/search.proto=github.com/org/clients/gen/search/v1",
+	}
+	if !reflect.DeepEqual(mappings, want) {
+		t.Errorf("GoImportMappings = %q, want %q", mappings, want)
+	}
+
+	if _, err := GoImportMappings(protoDir, t.TempDir(), "", false); err == nil {
+		t.Error("GoImportMappings outside of a module did not fail")
+	}
+}
+
+func TestWithGoImportMappings(t *testing.T) {
+	opts := map[string][]string{"go": {"paths=source_relative"}, "openapiv2": {"logtostderr=true"}}
+	merged := WithGoImportMappings(opts, []string{"Ma.proto=example.com/a"})
+
+	if want := []string{"Ma.proto=example.com/a", "paths=source_relative"}; !reflect.DeepEqual(merged["go"], want) {
+		t.Errorf("go options = %q, want %q", merged["go"], want)
+	}
+	for _, plugin := range []string{"go-grpc", "twirp", "grpc-gateway"} {
+		if want := []string{"Ma.proto=example.com/a"}; !reflect.DeepEqual(merged[plugin], want) {
+			t.Errorf("%s options = %q, want %q", plugin, merged[plugin], want)
+		}
+	}
+	if want := []string{"logtostderr=true"}; !reflect.DeepEqual(merged["openapiv2"], want) {
+		t.Errorf("openapiv2 options = %q, want %q", merged["openapiv2"], want)
+	}
+	if len(opts["go"]) != 1 {
+		t.Errorf("the options were modified: %q", opts["go"])
+	}
+}
+
+func TestGoImportMappingsSplit(t *testing.T) {
+	module := t.TempDir()
+	writeFile(t, module, "go.mod", "module github.com/org/clients\n")
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+
+	mappings, err := GoImportMappings(protoDir, module, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Msearch.proto=github.com/org/clients/search"}; !reflect.DeepEqual(mappings, want) {
+		t.Errorf("GoImportMappings = %q, want %q", mappings, want)
+	}
+}
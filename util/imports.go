@@ -0,0 +1,58 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// importPattern matches the import statements of a protobuf, capturing the imported path
+var importPattern = regexp.MustCompile(`(?m)^(\s*import\s+(?:public\s+|weak\s+)?")([^"]+)("\s*;)`)
+
+// replaceImport returns the import path with its longest matching prefix in replacements replaced
+func replaceImport(path string, replacements map[string]string) string {
+	match := ""
+	for old := range replacements {
+		if strings.HasPrefix(path, old) && len(old) > len(match) {
+			match = old
+		}
+	}
+	if match == "" {
+		return path
+	}
+	return replacements[match] + strings.TrimPrefix(path, match)
+}
+
+// ReplaceImports rewrites the import statements of the protobufs in protoDir. replacements maps import path prefixes to
+// what they are replaced with, e.g. github.com/org/protos/=common/. The longest matching prefix is replaced.
+func ReplaceImports(protoDir string, replacements map[string]string) error {
+	if len(replacements) == 0 {
+		return nil
+	}
+
+	files, err := ProtoFiles(protoDir)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot read protobuf file: %s", err.Error())
+		}
+
+		replaced := importPattern.ReplaceAllStringFunc(string(data), func(statement string) string {
+			m := importPattern.FindStringSubmatch(statement)
+			return m[1] + replaceImport(m[2], replacements) + m[3]
+		})
+		if replaced == string(data) {
+			continue
+		}
+
+		if err := os.WriteFile(path, []byte(replaced), 0644); err != nil {
+			return fmt.Errorf("cannot rewrite imports of protobuf file: %s", err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceImports(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", `syntax = "proto3";
+
+import "github.com/org/protos/common/page.proto";
+  import public "github.com/org/protos/v2/types.proto";
+import weak "github.com/org/other/legacy.proto";
+import "google/protobuf/timestamp.proto";
+
+// import "github.com/org/protos/comment.proto";
+`)
+	unchanged := "syntax = \"proto3\";\n\nimport \"google/protobuf/empty.proto\";\n"
+	writeFile(t, protoDir, "nested/empty.proto", unchanged)
+
+	replacements := map[string]string{
+		"github.com/org/protos/":    "common/",
+		"github.com/org/protos/v2/": "v2/",
+		"github.com/org/":           "org/",
+	}
+	if err := ReplaceImports(protoDir, replacements); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(protoDir, "search.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `syntax = "proto3";
+
+import "common/common/page.proto";
+  import public "v2/types.proto";
+import weak "org/other/legacy.proto";
+import "google/protobuf/timestamp.proto";
+
+// import "github.com/org/protos/comment.proto";
+`
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(protoDir, "nested", "empty.proto")); err != nil || string(data) != unchanged {
+		t.Errorf("a protobuf without matching imports was changed: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,208 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+const (
+	// DefaultServiceIndexMaxAge is how long a cached service index is used before it is fetched again
+	DefaultServiceIndexMaxAge = time.Hour
+
+	// DefaultServiceIndexTimeout is how long fetching a service index may take
+	DefaultServiceIndexTimeout = 30 * time.Second
+
+	// DefaultServiceIndexMaxSize is the largest service index, in bytes, that is accepted
+	DefaultServiceIndexMaxSize int64 = 10 * 1024 * 1024
+)
+
+// ServiceIndex lists services and the protobufs they define, published at a URL so that services can be added without
+// a new release. It is merged with the built-in services by AddServices
+type ServiceIndex struct {
+	Services []IndexedService `json:"services"`
+}
+
+// IndexedService is a service of a ServiceIndex
+type IndexedService struct {
+	Name string `json:"name"`
+
+	// Public and Private are true if the service has a public or private protobuf defined
+	Public  bool `json:"public"`
+	Private bool `json:"private"`
+}
+
+// ServiceIndexOptions configures how a service index is fetched
+type ServiceIndexOptions struct {
+	// CacheDir is the directory the fetched index is cached in. Defaults to the user's cache directory
+	CacheDir string
+
+	// MaxAge is how long the cached index is used before it is fetched again. Defaults to DefaultServiceIndexMaxAge
+	MaxAge time.Duration
+
+	// Timeout is how long fetching the index may take. Defaults to DefaultServiceIndexTimeout
+	Timeout time.Duration
+
+	// MaxSize is the largest index in bytes that is accepted. Defaults to DefaultServiceIndexMaxSize
+	MaxSize int64
+
+	// HTTPProxy and HTTPSProxy are the proxies the index is fetched through. When empty, any proxy configured in the
+	// environment is used
+	HTTPProxy  string
+	HTTPSProxy string
+}
+
+// serviceNamePattern matches the names of services, which are also the names of their repositories
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// indexed are the services added by AddServices, which extend those built in
+var indexed = make(map[string]IndexedService)
+
+// AddServices merges the services of index with the built-in services. A built-in service is only ever extended by the
+// index, e.g. with a protobuf scope it did not define yet
+func AddServices(index ServiceIndex) error {
+	if err := index.validate(); err != nil {
+		return err
+	}
+
+	for _, s := range index.Services {
+		if prev, ok := indexed[s.Name]; ok {
+			s.Public = s.Public || prev.Public
+			s.Private = s.Private || prev.Private
+		} else if !isKnownService(s.Name) {
+			services = append(services, s.Name)
+		}
+		indexed[s.Name] = s
+	}
+	return nil
+}
+
+// validate returns an error if a service of the index has a name that cannot be a service
+func (index ServiceIndex) validate() error {
+	for _, s := range index.Services {
+		if !serviceNamePattern.MatchString(s.Name) || s.Name == ServiceAll {
+			return fmt.Errorf("Invalid service name '%s' in the service index", s.Name)
+		}
+	}
+	return nil
+}
+
+// isKnownService returns true if s is one of the known services
+func isKnownService(s string) bool {
+	for _, svc := range services {
+		if svc == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceIndexPath returns the path the service index at url is cached at in cacheDir
+func ServiceIndexPath(cacheDir string, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(cacheDir, fmt.Sprintf("services-index-%s.json", hex.EncodeToString(sum[:8])))
+}
+
+// FetchServiceIndex returns the service index at url. The index is cached, and a cached index younger than
+// opts.MaxAge is used without fetching it. If the index cannot be fetched an older cached index is used instead,
+// returning the error of the fetch along with it, so the caller can warn about it.
+func FetchServiceIndex(ctx context.Context, url string, opts ServiceIndexOptions) (ServiceIndex, error) {
+	cacheDir := opts.CacheDir
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			dir = os.TempDir()
+		}
+		cacheDir = filepath.Join(dir, "proto-client-generator")
+	}
+	maxAge := opts.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultServiceIndexMaxAge
+	}
+
+	path := ServiceIndexPath(cacheDir, url)
+	cached, cacheErr := readServiceIndex(path)
+	if info, err := os.Stat(path); cacheErr == nil && err == nil && time.Since(info.ModTime()) < maxAge {
+		return cached, nil
+	}
+
+	data, err := downloadServiceIndex(ctx, url, opts)
+	if err == nil {
+		// Only a valid index is cached, so an invalid one does not replace the last valid index
+		var index ServiceIndex
+		if err = json.Unmarshal(data, &index); err != nil {
+			err = fmt.Errorf("invalid service index: %s", err.Error())
+		} else if err = index.validate(); err == nil {
+			if err := os.MkdirAll(cacheDir, 0755); err == nil {
+				os.WriteFile(path, data, 0644)
+			}
+			return index, nil
+		}
+	}
+
+	err = fmt.Errorf("cannot fetch service index '%s': %s", url, err.Error())
+	if cacheErr == nil {
+		return cached, err
+	}
+	return ServiceIndex{}, err
+}
+
+// downloadServiceIndex returns the body of url, fetched through the proxies of opts within its timeout and size limit
+func downloadServiceIndex(ctx context.Context, url string, opts ServiceIndexOptions) ([]byte, error) {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultServiceIndexTimeout
+	}
+	maxSize := opts.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultServiceIndexMaxSize
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: timeout, Transport: &http.Transport{Proxy: opts.proxy}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("the index exceeds the maximum allowed size of %d bytes", maxSize)
+	}
+	return data, nil
+}
+
+// proxy returns the proxy of req, preferring the configured proxies over those of the environment
+func (o ServiceIndexOptions) proxy(req *http.Request) (*url.URL, error) {
+	return httpProxy(req, o.HTTPProxy, o.HTTPSProxy)
+}
+
+// readServiceIndex reads the cached service index at path
+func readServiceIndex(path string) (ServiceIndex, error) {
+	var index ServiceIndex
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return index, err
+	}
+	err = json.Unmarshal(data, &index)
+	return index, err
+}
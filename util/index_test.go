@@ -0,0 +1,128 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testServiceIndex = `{"services": [{"name": "billing", "public": true}]}`
+
+func TestFetchServiceIndex(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testServiceIndex))
+	}))
+	url := server.URL + "/index.json"
+	opts := ServiceIndexOptions{CacheDir: t.TempDir()}
+
+	index, err := FetchServiceIndex(context.Background(), url, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(index.Services) != 1 || index.Services[0].Name != "billing" || !index.Services[0].Public {
+		t.Fatalf("unexpected index %+v", index)
+	}
+
+	// The cached index is used while it is younger than MaxAge
+	server.Close()
+	if index, err = FetchServiceIndex(context.Background(), url, opts); err != nil || len(index.Services) != 1 {
+		t.Fatalf("the cached index was not used: %+v, %v", index, err)
+	}
+}
+
+func TestFetchServiceIndexInvalidName(t *testing.T) {
+	var body atomic.Value
+	body.Store(`{"services": [{"name": "../billing", "public": true}]}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer server.Close()
+	url := server.URL + "/index.json"
+	opts := ServiceIndexOptions{CacheDir: t.TempDir(), MaxAge: time.Nanosecond}
+
+	_, err := FetchServiceIndex(context.Background(), url, opts)
+	if err == nil || !strings.Contains(err.Error(), "Invalid service name '../billing'") {
+		t.Fatalf("expected the invalid service name to be refused, got %v", err)
+	}
+	if _, err := os.Stat(ServiceIndexPath(opts.CacheDir, url)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the invalid index was cached: %v", err)
+	}
+
+	// An invalid index does not replace the cached index, which is used instead
+	body.Store(testServiceIndex)
+	if _, err := FetchServiceIndex(context.Background(), url, opts); err != nil {
+		t.Fatal(err)
+	}
+	body.Store(`{"services": [{"name": "all"}]}`)
+	index, err := FetchServiceIndex(context.Background(), url, opts)
+	if err == nil || len(index.Services) != 1 || index.Services[0].Name != "billing" {
+		t.Fatalf("expected the cached index along with an error, got %+v, %v", index, err)
+	}
+	data, err := os.ReadFile(ServiceIndexPath(opts.CacheDir, url))
+	if err != nil || string(data) != testServiceIndex {
+		t.Errorf("the cached index was replaced: %q, %v", data, err)
+	}
+}
+
+func TestFetchServiceIndexLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ServiceIndexOptions
+		delay   time.Duration
+		wantErr string
+	}{
+		{"over the size limit", ServiceIndexOptions{MaxSize: 10}, 0, "exceeds the maximum allowed size of 10 bytes"},
+		{"at the size limit", ServiceIndexOptions{MaxSize: int64(len(testServiceIndex))}, 0, ""},
+		{"over the timeout", ServiceIndexOptions{Timeout: 50 * time.Millisecond}, time.Second, "Timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(tt.delay):
+				case <-r.Context().Done():
+					return
+				}
+				w.Write([]byte(testServiceIndex))
+			}))
+			defer server.Close()
+
+			opts := tt.opts
+			opts.CacheDir = t.TempDir()
+			_, err := FetchServiceIndex(context.Background(), server.URL, opts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFetchServiceIndexProxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.Write([]byte(testServiceIndex))
+	}))
+	defer proxy.Close()
+
+	opts := ServiceIndexOptions{CacheDir: t.TempDir(), HTTPProxy: proxy.URL}
+	if _, err := FetchServiceIndex(context.Background(), "http://index.example.invalid/index.json", opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if requested != "http://index.example.invalid/index.json" {
+		t.Errorf("the proxy received %q", requested)
+	}
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ListRepositoryFiles lists the files under paths in the repository org/repo at opts.Ref, or its default branch, along
+// with the commit they were listed at. Unless the repository is cached in opts.CacheDir it is cloned into dir without
+// checking it out or fetching the contents of any file, so that listing a large repository stays cheap.
+func ListRepositoryFiles(ctx context.Context, org string, repo string, dir string, paths []string, opts CloneOptions) ([]string, string, error) {
+	rev := "HEAD"
+	if IsCommitSHA(opts.Ref) {
+		rev = opts.Ref
+	}
+
+	var src string
+	var err error
+	if opts.CacheDir != "" {
+		if src, err = CloneRepository(ctx, org, repo, dir, opts); err != nil {
+			return nil, "", err
+		}
+	} else if src, err = opts.treeClone(ctx, org, repo, dir); err != nil {
+		return nil, "", err
+	}
+
+	out, err := exec.CommandContext(ctx, "git", "-C", src, "rev-parse", rev+"^{commit}").Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot find '%s' in repository '%s/%s'", opts.Ref, org, repo)
+	}
+	commit := strings.TrimSpace(string(out))
+
+	args := append([]string{"-C", src, "ls-tree", "-r", "--name-only", commit, "--"}, paths...)
+	out, err = exec.CommandContext(ctx, "git", args...).Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot list the files of repository '%s/%s': %s", org, repo, err.Error())
+	}
+
+	var files []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, commit, nil
+}
+
+// treeClone clones org/repo into a new directory in dir with only its commits and trees, none of its file contents,
+// and without checking out a working tree. A branch or tag is cloned at a depth of 1 unless opts.Depth is set.
+func (o CloneOptions) treeClone(ctx context.Context, org string, repo string, dir string) (string, error) {
+	if o.Offline {
+		return "", fmt.Errorf("cannot clone repository '%s/%s' offline without a cache directory", org, repo)
+	}
+	src, err := os.MkdirTemp(dir, repo+"-")
+	if err != nil {
+		return "", fmt.Errorf("cannot create clone directory for repository '%s/%s': %s", org, repo, err.Error())
+	}
+
+	o.Filter = "blob:none"
+	o.RecurseSubmodules = false
+	if o.Depth == 0 {
+		o.Depth = 1
+	}
+	args := o.cloneArgs(org, repo, src)
+	args = append([]string{args[0], "--no-checkout"}, args[1:]...)
+
+	cloneCmd := exec.CommandContext(ctx, "git", args...)
+	cloneCmd.Env = o.env()
+	if out, err := cloneCmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to clone repository '%s/%s': %s", org, repo, strings.TrimSpace(string(out)))
+	}
+	return src, nil
+}
+
+// ListServiceFiles lists the files under paths in the source repository of service. See ListRepositoryFiles
+func ListServiceFiles(ctx context.Context, service string, dir string, paths []string, opts CloneOptions) ([]string, string, error) {
+	host, org := opts.ServiceRemote(service)
+	opts.Host = host
+	opts.service = service
+	return ListRepositoryFiles(ctx, org, RepoName(service, opts.RepoNames), dir, paths, opts)
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListRepositoryFiles(t *testing.T) {
+	opts := remoteRepository(t, "search")
+	opts.CacheDir = ""
+	ctx := context.Background()
+	paths := []string{"proto/public", "proto/private"}
+
+	for _, ref := range []string{"HEAD", "feature"} {
+		if ref != "HEAD" {
+			opts.Ref = ref
+		}
+		dir := t.TempDir()
+		files, commit, err := ListRepositoryFiles(ctx, "org", "search", dir, paths, opts)
+		if err != nil {
+			t.Fatalf("ref %s: %s", ref, err)
+		}
+		if want := []string{"proto/public/search.proto"}; !reflect.DeepEqual(files, want) {
+			t.Errorf("ref %s listed %q, want %q", ref, files, want)
+		}
+		if want := strings.Fields(git(t, dir, "ls-remote", opts.remoteURL("org", "search"), ref))[0]; commit != want {
+			t.Errorf("ref %s was listed at %s, want %s", ref, commit, want)
+		}
+
+		// The repository is listed without checking it out
+		if checkedOut, _ := filepath.Glob(filepath.Join(dir, "*", "proto")); len(checkedOut) != 0 {
+			t.Errorf("ref %s was checked out: %q", ref, checkedOut)
+		}
+	}
+
+	opts.Offline = true
+	if _, _, err := ListRepositoryFiles(ctx, "org", "search", t.TempDir(), paths, opts); err == nil {
+		t.Error("a repository was listed offline without a cache")
+	}
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// errLocked is returned by lockFile when the lock is held by another process and waiting was not requested
+var errLocked = errors.New("lock is held by another process")
+
+// OutputLock is an exclusive lock held on an output directory while generated files are copied into it
+type OutputLock struct {
+	f    *os.File
+	path string
+}
+
+// lockPath returns the path of the lock file guarding outputPath. Lock files are kept in the system temp directory so
+// they are never copied alongside generated code, and are removed when the lock is released.
+func lockPath(outputPath string) (string, error) {
+	abs, err := filepath.Abs(outputPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve output path: %s", err.Error())
+	}
+
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("proto-client-generator-%s.lock", hex.EncodeToString(sum[:8]))), nil
+}
+
+// LockOutput acquires an exclusive lock on outputPath, preventing concurrent runs from writing to it at the same time.
+// If wait is true, LockOutput blocks until the lock is released by the other run. Otherwise an error is returned.
+func LockOutput(outputPath string, wait bool) (*OutputLock, error) {
+	path, err := lockPath(outputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open lock file: %s", err.Error())
+		}
+
+		if err := lockFile(f, wait); err != nil {
+			f.Close()
+			if errors.Is(err, errLocked) {
+				return nil, fmt.Errorf("output '%s' is locked by another run. Use --wait-lock to wait for it to finish", outputPath)
+			}
+			return nil, fmt.Errorf("cannot lock output '%s': %s", outputPath, err.Error())
+		}
+
+		// The run that held the lock removes the lock file when releasing it, so a run that waited for it may have
+		// locked a file no longer at path. The lock is then taken again on the file now there
+		if isLockFile(f, path) {
+			return &OutputLock{f: f, path: path}, nil
+		}
+		f.Close()
+	}
+}
+
+// isLockFile reports whether f is still the file at path
+func isLockFile(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	return err == nil && os.SameFile(opened, current)
+}
+
+// Unlock releases the lock on the output directory, removing its lock file
+func (l *OutputLock) Unlock() error {
+	// The file is removed while still locked, so that no other run can lock it in between. Removing it may fail on
+	// Windows, which does not remove open files, in which case it is left for the next run
+	os.Remove(l.path)
+	if err := unlockFile(l.f); err != nil {
+		l.f.Close()
+		return fmt.Errorf("cannot unlock output: %s", err.Error())
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockOutput(t *testing.T) {
+	setenv(t, "TMPDIR", t.TempDir())
+	output := t.TempDir()
+
+	lock, err := LockOutput(output, false)
+	if err != nil {
+		t.Fatalf("cannot lock the output: %s", err)
+	}
+	if _, err := LockOutput(output, false); err == nil || !strings.Contains(err.Error(), "is locked by another run") {
+		t.Fatalf("expected the locked output to be refused, got %v", err)
+	}
+	other, err := LockOutput(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("another output was locked as well: %s", err)
+	}
+	other.Unlock()
+
+	// A waiting run gets the lock once it is released
+	locked := make(chan error)
+	go func() {
+		l, err := LockOutput(output, true)
+		if err == nil {
+			err = l.Unlock()
+		}
+		locked <- err
+	}()
+	select {
+	case err := <-locked:
+		t.Fatalf("the waiting run did not wait for the lock: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-locked; err != nil {
+		t.Fatalf("the waiting run failed: %s", err)
+	}
+
+	// Released locks leave no lock file behind
+	path, err := lockPath(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the lock file %s was not removed: %v", path, err)
+	}
+}
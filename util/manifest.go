@@ -0,0 +1,173 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ManifestName is the name of the manifest written to each output directory, listing the files generated into it
+const ManifestName = ".proto-gen-manifest.json"
+
+// Manifest records the generated files written to an output directory
+type Manifest struct {
+	Language string         `json:"language"`
+	Files    []ManifestFile `json:"files"`
+
+	// Inputs holds the fingerprint of the protobufs and settings each service was last generated from, keyed by service
+	Inputs map[string]string `json:"inputs,omitempty"`
+}
+
+// ManifestFile is a generated file recorded in a Manifest
+type ManifestFile struct {
+	// Name is the slash separated path of the file relative to the output directory
+	Name    string `json:"name"`
+	Service string `json:"service"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+}
+
+// ReadManifest reads the manifest in outputPath. An empty manifest is returned if outputPath does not have one.
+func ReadManifest(outputPath string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(outputPath, ManifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Manifest{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %s", err.Error())
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest: %s", err.Error())
+	}
+	return &m, nil
+}
+
+// WriteManifest writes m as the manifest of outputPath
+func WriteManifest(outputPath string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode manifest: %s", err.Error())
+	}
+
+	if err := os.WriteFile(filepath.Join(outputPath, ManifestName), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write manifest: %s", err.Error())
+	}
+	return nil
+}
+
+// ServiceFiles returns the files in m generated for service
+func (m *Manifest) ServiceFiles(service string) []ManifestFile {
+	var files []ManifestFile
+	for _, f := range m.Files {
+		if f.Service == service {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// SetServiceFiles replaces the files recorded for service with copied
+func (m *Manifest) SetServiceFiles(service string, copied []CopiedFile) {
+	files := make([]ManifestFile, 0, len(m.Files)+len(copied))
+	for _, f := range m.Files {
+		if f.Service != service {
+			files = append(files, f)
+		}
+	}
+
+	for _, c := range copied {
+		files = append(files, ManifestFile{Name: c.Name, Service: service, Size: c.Size, SHA256: c.SHA256})
+	}
+
+	// Files are kept in a stable order, whatever order the services are generated in
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Name != files[j].Name {
+			return files[i].Name < files[j].Name
+		}
+		return files[i].Service < files[j].Service
+	})
+	m.Files = files
+}
+
+// RemoveStaleFiles deletes the files that the manifest in outputPath records for service but that are not in copied,
+// returning the names of the deleted files
+func RemoveStaleFiles(outputPath string, m *Manifest, service string, copied []CopiedFile) ([]string, error) {
+	current := make(map[string]bool, len(copied))
+	for _, c := range copied {
+		current[c.Name] = true
+	}
+
+	var deleted []string
+	for _, f := range m.ServiceFiles(service) {
+		if current[f.Name] {
+			continue
+		}
+
+		err := os.Remove(filepath.Join(outputPath, filepath.FromSlash(f.Name)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return deleted, fmt.Errorf("cannot remove stale generated file: %s", err.Error())
+		}
+		deleted = append(deleted, f.Name)
+	}
+	return deleted, nil
+}
+
+// ProtoFingerprint returns a sha256 over the paths and contents of the .proto files in protoDir and settings. Two
+// generations with the same fingerprint produce the same output.
+func ProtoFingerprint(protoDir string, settings string) (string, error) {
+	files, err := ProtoFiles(protoDir)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", settings)
+	for _, f := range files {
+		rel, err := filepath.Rel(protoDir, f)
+		if err != nil {
+			return "", err
+		}
+
+		sum, err := FileSHA256(f)
+		if err != nil {
+			return "", fmt.Errorf("cannot hash protobuf file: %s", err.Error())
+		}
+		fmt.Fprintf(h, "%s %s\n", filepath.ToSlash(rel), sum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// IsUpToDate returns true if service was last generated into outputPath from inputs with the given fingerprint, and all
+// of the files it generated are still present as they were written, per their recorded sha256
+func (m *Manifest) IsUpToDate(outputPath string, service string, fingerprint string) bool {
+	if m.Inputs[service] != fingerprint {
+		return false
+	}
+
+	for _, f := range m.ServiceFiles(service) {
+		path := filepath.Join(outputPath, filepath.FromSlash(f.Name))
+		info, err := os.Stat(path)
+		if err != nil || info.Size() != f.Size {
+			return false
+		}
+		if sum, err := FileSHA256(path); err != nil || sum != f.SHA256 {
+			return false
+		}
+	}
+	return true
+}
+
+// SetInputs records the fingerprint of the inputs service was generated from
+func (m *Manifest) SetInputs(service string, fingerprint string) {
+	if m.Inputs == nil {
+		m.Inputs = make(map[string]string)
+	}
+	m.Inputs[service] = fingerprint
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifestFilesOrder(t *testing.T) {
+	search := []CopiedFile{{Name: "search/search.pb.go", Size: 1, SHA256: "a"}, {Name: "common/page.pb.go", Size: 2, SHA256: "b"}}
+	query := []CopiedFile{{Name: "query/query.pb.go", Size: 3, SHA256: "c"}, {Name: "common/page.pb.go", Size: 2, SHA256: "b"}}
+
+	first, second := &Manifest{Language: "golang"}, &Manifest{Language: "golang"}
+	first.SetServiceFiles("search", search)
+	first.SetServiceFiles("query", query)
+	second.SetServiceFiles("query", query)
+	second.SetServiceFiles("search", search)
+
+	firstDir, secondDir := t.TempDir(), t.TempDir()
+	if err := WriteManifest(firstDir, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteManifest(secondDir, second); err != nil {
+		t.Fatal(err)
+	}
+	firstData, _ := os.ReadFile(filepath.Join(firstDir, ManifestName))
+	secondData, _ := os.ReadFile(filepath.Join(secondDir, ManifestName))
+	if !bytes.Equal(firstData, secondData) {
+		t.Errorf("the manifests depend on the order services are generated in:\n%s\n%s", firstData, secondData)
+	}
+
+	var names []string
+	for _, f := range first.Files {
+		names = append(names, f.Service+":"+f.Name)
+	}
+	want := []string{"query:common/page.pb.go", "search:common/page.pb.go", "query:query/query.pb.go", "search:search/search.pb.go"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("manifest files = %q, want %q", names, want)
+	}
+}
+
+func TestManifestIsUpToDate(t *testing.T) {
+	output := t.TempDir()
+	path := writeFile(t, output, "pkg/search.pb.go", "package search\n")
+	sum, err := FileSHA256(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifest{}
+	m.SetServiceFiles("search", []CopiedFile{{Name: "pkg/search.pb.go", Size: int64(len("package search\n")), SHA256: sum}})
+	m.SetInputs("search", "fingerprint")
+
+	if !m.IsUpToDate(output, "search", "fingerprint") {
+		t.Fatal("expected the untouched output to be up to date")
+	}
+	if m.IsUpToDate(output, "search", "other") {
+		t.Fatal("expected a different fingerprint not to be up to date")
+	}
+
+	// An edit keeping the size of the file is still detected
+	writeFile(t, output, "pkg/search.pb.go", "package searcH\n")
+	if m.IsUpToDate(output, "search", "fingerprint") {
+		t.Fatal("expected a same-size edit not to be up to date")
+	}
+}
@@ -0,0 +1,608 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Numbers of the fields of a FileDescriptorProto that FilterMethods rewrites
+const (
+	fileDependency       = 3
+	fileMessageType      = 4
+	fileEnumType         = 5
+	fileService          = 6
+	fileExtension        = 7
+	fileSourceCodeInfo   = 9
+	filePublicDependency = 10
+	fileWeakDependency   = 11
+)
+
+// FilterMethods writes the FileDescriptorSet at in, compiled with CompileDescriptorSet, to out with the RPC methods
+// not in methods stripped from its services, so that a minimal client is generated from it through
+// GenerateOptions.DescriptorSetIn. Methods are named on their own, e.g. Query, or along with their service, e.g.
+// Search.Query. Services left without any method are stripped as a whole, along with the messages and enums only their
+// stripped methods used and the imports only those provided. The comments of the source are kept for what remains. An
+// error is returned if one of methods is not declared by any service.
+func FilterMethods(in string, out string, methods []string) error {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return fmt.Errorf("cannot read descriptor set: %s", err.Error())
+	}
+
+	wanted := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		wanted[m] = true
+	}
+	found := make(map[string]bool, len(methods))
+	keep := func(service string, method string) bool {
+		for _, name := range []string{method, service + "." + method} {
+			if wanted[name] {
+				found[name] = true
+				return true
+			}
+		}
+		return false
+	}
+
+	filtered, err := filterDescriptorSet(data, keep)
+	if err != nil {
+		return fmt.Errorf("invalid descriptor set '%s': %s", in, err.Error())
+	}
+
+	var missing []string
+	for _, m := range methods {
+		if !found[m] {
+			missing = append(missing, m)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("no service declares the methods: %s", strings.Join(missing, ", "))
+	}
+
+	if err := os.WriteFile(out, filtered, 0644); err != nil {
+		return fmt.Errorf("cannot write descriptor set: %s", err.Error())
+	}
+	return nil
+}
+
+// descriptorFile is a FileDescriptorProto of a FileDescriptorSet, indexed for filtering its services
+type descriptorFile struct {
+	name   string
+	fields []rawField
+
+	// types are the top-level messages and enums, keyed by their field number and position, e.g. "4/0" for the first
+	// message
+	types map[string]*descriptorType
+
+	services []descriptorService
+
+	// extensionRefs are the types the extensions declared at the top of the file refer to
+	extensionRefs []string
+}
+
+// descriptorType is a top-level message or enum of a descriptorFile
+type descriptorType struct {
+	// refs are the fully qualified names of the types the fields of a message and of its nested messages refer to
+	refs []string
+}
+
+// descriptorService is a ServiceDescriptorProto of a descriptorFile
+type descriptorService struct {
+	name    string
+	methods []descriptorMethod
+}
+
+// descriptorMethod is a MethodDescriptorProto of a descriptorService
+type descriptorMethod struct {
+	name string
+
+	// types are the fully qualified names of the input and output types
+	types []string
+	kept  bool
+}
+
+// filterDescriptorSet returns the FileDescriptorSet data with the methods for which keep returns false removed, along
+// with the services, types and imports left unused by them
+func filterDescriptorSet(data []byte, keep func(service string, method string) bool) ([]byte, error) {
+	set, err := splitMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// owners maps the fully qualified name of every message and enum, nested ones included, to the file and key of the
+	// top-level type declaring it
+	owners := make(map[string]typeOwner)
+	var files []*descriptorFile
+	for _, f := range set {
+		if f.num != 1 {
+			continue
+		}
+		file, err := indexDescriptorFile(f.data, len(files), owners)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	// Types no method uses, e.g. messages of events, are kept along with everything they use. Other types are kept
+	// only if a kept method uses them
+	var roots, methodTypes []string
+	for _, file := range files {
+		roots = append(roots, file.extensionRefs...)
+		for i := range file.services {
+			s := &file.services[i]
+			for j := range s.methods {
+				m := &s.methods[j]
+				methodTypes = append(methodTypes, m.types...)
+				if m.kept = keep(s.name, m.name); m.kept {
+					roots = append(roots, m.types...)
+				}
+			}
+		}
+	}
+	usedByMethods := reachableTypes(files, owners, methodTypes)
+	for name, owner := range owners {
+		if !usedByMethods[owner] {
+			roots = append(roots, name)
+		}
+	}
+	kept := reachableTypes(files, owners, roots)
+
+	out := make([]byte, 0, len(data))
+	index := 0
+	for _, f := range set {
+		if f.num != 1 {
+			out = append(out, f.raw...)
+			continue
+		}
+		b, err := files[index].filter(index, files, owners, kept)
+		if err != nil {
+			return nil, fmt.Errorf("file '%s': %s", files[index].name, err.Error())
+		}
+		out = appendBytesField(out, 1, b)
+		index++
+	}
+	return out, nil
+}
+
+// typeOwner identifies the top-level type of a file declaring a type
+type typeOwner struct {
+	file int
+	key  string
+}
+
+// reachableTypes returns the top-level types declaring the types named by roots, along with those their fields refer
+// to, transitively
+func reachableTypes(files []*descriptorFile, owners map[string]typeOwner, roots []string) map[typeOwner]bool {
+	reached := make(map[typeOwner]bool)
+	pending := append([]string(nil), roots...)
+	for len(pending) > 0 {
+		name := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		owner, ok := owners[name]
+		if !ok || reached[owner] {
+			continue
+		}
+		reached[owner] = true
+		pending = append(pending, files[owner.file].types[owner.key].refs...)
+	}
+	return reached
+}
+
+// indexDescriptorFile indexes the FileDescriptorProto b, the index-th file of its set, recording the owners of its
+// types
+func indexDescriptorFile(b []byte, index int, owners map[string]typeOwner) (*descriptorFile, error) {
+	fields, err := splitMessage(b)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &descriptorFile{fields: fields, types: make(map[string]*descriptorType)}
+	var pkg string
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			file.name = string(f.data)
+		case 2:
+			pkg = string(f.data)
+		}
+	}
+
+	counts := make(map[int]int)
+	for _, f := range fields {
+		switch f.num {
+		case fileMessageType, fileEnumType:
+			key := typeKey(f.num, counts[f.num])
+			counts[f.num]++
+			t := &descriptorType{}
+			var names []string
+			if f.num == fileMessageType {
+				names, t.refs, err = indexMessageType(f.data, pkg)
+			} else {
+				names, err = indexEnum(f.data, pkg)
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range names {
+				owners[name] = typeOwner{file: index, key: key}
+			}
+			file.types[key] = t
+		case fileService:
+			s, err := indexService(f.data)
+			if err != nil {
+				return nil, err
+			}
+			file.services = append(file.services, s)
+		case fileExtension:
+			refs, err := fieldRefs(f.data)
+			if err != nil {
+				return nil, err
+			}
+			file.extensionRefs = append(file.extensionRefs, refs...)
+		}
+	}
+	return file, nil
+}
+
+// typeKey returns the key of the position-th top-level type declared by the field num of a FileDescriptorProto
+func typeKey(num int, position int) string {
+	return fmt.Sprintf("%d/%d", num, position)
+}
+
+// indexMessageType returns the fully qualified names of the DescriptorProto b declared in scope and of its nested
+// types, along with the types referred to by its fields and extensions
+func indexMessageType(b []byte, scope string) ([]string, []string, error) {
+	fields, err := splitMessage(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	var name string
+	for _, f := range fields {
+		if f.num == 1 {
+			name = string(f.data)
+		}
+	}
+
+	fullName := qualify(scope, name)
+	names := []string{fullName}
+	var refs []string
+	for _, f := range fields {
+		switch f.num {
+		case 2, 6:
+			r, err := fieldRefs(f.data)
+			if err != nil {
+				return nil, nil, err
+			}
+			refs = append(refs, r...)
+		case 3:
+			n, r, err := indexMessageType(f.data, fullName)
+			if err != nil {
+				return nil, nil, err
+			}
+			names, refs = append(names, n...), append(refs, r...)
+		case 4:
+			n, err := indexEnum(f.data, fullName)
+			if err != nil {
+				return nil, nil, err
+			}
+			names = append(names, n...)
+		}
+	}
+	return names, refs, nil
+}
+
+// indexEnum returns the fully qualified name of the EnumDescriptorProto b declared in scope
+func indexEnum(b []byte, scope string) ([]string, error) {
+	var name string
+	err := decodeMessage(b, func(num int, v uint64, b []byte) error {
+		if num == 1 {
+			name = string(b)
+		}
+		return nil
+	})
+	return []string{qualify(scope, name)}, err
+}
+
+// fieldRefs returns the types the FieldDescriptorProto b refers to: its message or enum type and, for an extension,
+// the message it extends
+func fieldRefs(b []byte) ([]string, error) {
+	var refs []string
+	err := decodeMessage(b, func(num int, v uint64, b []byte) error {
+		if num == 2 || num == 6 {
+			refs = append(refs, strings.TrimPrefix(string(b), "."))
+		}
+		return nil
+	})
+	return refs, err
+}
+
+// indexService indexes the ServiceDescriptorProto b and its methods
+func indexService(b []byte) (descriptorService, error) {
+	var s descriptorService
+	fields, err := splitMessage(b)
+	if err != nil {
+		return s, err
+	}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			s.name = string(f.data)
+		case 2:
+			var m descriptorMethod
+			err := decodeMessage(f.data, func(num int, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					m.name = string(b)
+				case 2, 3:
+					m.types = append(m.types, strings.TrimPrefix(string(b), "."))
+				}
+				return nil
+			})
+			if err != nil {
+				return s, err
+			}
+			s.methods = append(s.methods, m)
+		}
+	}
+	return s, nil
+}
+
+// filter returns the FileDescriptorProto of file, the index-th of files, with its methods that were not kept, the
+// services left without methods, the types not in kept and the imports they alone used removed. The paths of its source
+// code info are renumbered to match.
+func (file *descriptorFile) filter(index int, files []*descriptorFile, owners map[string]typeOwner, kept map[typeOwner]bool) ([]byte, error) {
+	// Imports are only removed if the file used their types before filtering but no longer does, so that those only
+	// providing options or imported publicly are kept
+	usedBefore, usedAfter := make(map[string]bool), make(map[string]bool)
+	use := func(used map[string]bool, refs []string) {
+		for _, name := range refs {
+			if owner, ok := owners[name]; ok {
+				used[files[owner.file].name] = true
+			}
+		}
+	}
+	use(usedBefore, file.extensionRefs)
+	use(usedAfter, file.extensionRefs)
+	for key, t := range file.types {
+		use(usedBefore, t.refs)
+		if kept[typeOwner{file: index, key: key}] {
+			use(usedAfter, t.refs)
+		}
+	}
+	for _, s := range file.services {
+		for _, m := range s.methods {
+			use(usedBefore, m.types)
+			if m.kept {
+				use(usedAfter, m.types)
+			}
+		}
+	}
+
+	// renumbered maps the position of each removable element to its position after filtering, or -1 if it is removed.
+	// Elements are keyed by their field number, e.g. "6" for services, and those of the services by "6/<position>/2"
+	renumbered := make(map[string][]int)
+	next := make(map[string]int)
+	renumber := func(key string, keep bool) {
+		if !keep {
+			renumbered[key] = append(renumbered[key], -1)
+			return
+		}
+		renumbered[key] = append(renumbered[key], next[key])
+		next[key]++
+	}
+
+	counts := make(map[int]int)
+	var out []byte
+	var sourceInfo *rawField
+	for i, f := range file.fields {
+		position := counts[f.num]
+		counts[f.num]++
+		field := strconv.Itoa(f.num)
+
+		switch f.num {
+		case fileDependency:
+			dep := string(f.data)
+			keep := !usedBefore[dep] || usedAfter[dep]
+			renumber(field, keep)
+			if keep {
+				out = append(out, f.raw...)
+			}
+		case fileMessageType, fileEnumType:
+			keep := kept[typeOwner{file: index, key: typeKey(f.num, position)}]
+			renumber(field, keep)
+			if keep {
+				out = append(out, f.raw...)
+			}
+		case fileService:
+			s := file.services[position]
+			b, methods, err := filterService(f.data, s)
+			if err != nil {
+				return nil, err
+			}
+			renumber(field, b != nil)
+			renumbered[fmt.Sprintf("%s/%d/2", field, position)] = methods
+			if b != nil {
+				out = appendBytesField(out, f.num, b)
+			}
+		case filePublicDependency, fileWeakDependency:
+			// Filtered below, once the positions of every import are known
+		case fileSourceCodeInfo:
+			sourceInfo = &file.fields[i]
+		default:
+			out = append(out, f.raw...)
+		}
+	}
+
+	for _, num := range []int{filePublicDependency, fileWeakDependency} {
+		var values []uint64
+		for _, f := range file.fields {
+			if f.num != num {
+				continue
+			}
+			v, err := varints(f)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v...)
+		}
+
+		deps := renumbered[strconv.Itoa(fileDependency)]
+		for _, v := range values {
+			if v >= uint64(len(deps)) {
+				return nil, fmt.Errorf("import %d does not exist", v)
+			}
+			renumber(strconv.Itoa(num), deps[v] >= 0)
+			if deps[v] >= 0 {
+				out = appendVarintField(out, num, uint64(deps[v]))
+			}
+		}
+	}
+
+	if sourceInfo != nil {
+		b, err := filterSourceCodeInfo(sourceInfo.data, renumbered)
+		if err != nil {
+			return nil, err
+		}
+		out = appendBytesField(out, fileSourceCodeInfo, b)
+	}
+	return out, nil
+}
+
+// filterService returns the ServiceDescriptorProto b of s with the methods that were not kept removed, or nil if none
+// was kept, along with the position after filtering of each of its methods, -1 for those removed
+func filterService(b []byte, s descriptorService) ([]byte, []int, error) {
+	fields, err := splitMessage(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out []byte
+	var positions []int
+	method, next := 0, 0
+	for _, f := range fields {
+		if f.num != 2 {
+			out = append(out, f.raw...)
+			continue
+		}
+		if s.methods[method].kept {
+			out = append(out, f.raw...)
+			positions = append(positions, next)
+			next++
+		} else {
+			positions = append(positions, -1)
+		}
+		method++
+	}
+	if next == 0 {
+		return nil, nil, nil
+	}
+	return out, positions, nil
+}
+
+// filterSourceCodeInfo returns the SourceCodeInfo b with the locations of removed elements dropped and the paths of
+// the others renumbered, by the positions of renumbered
+func filterSourceCodeInfo(b []byte, renumbered map[string][]int) ([]byte, error) {
+	fields, err := splitMessage(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	for _, f := range fields {
+		if f.num != 1 {
+			out = append(out, f.raw...)
+			continue
+		}
+		location, err := splitMessage(f.data)
+		if err != nil {
+			return nil, err
+		}
+		var path []uint64
+		for _, lf := range location {
+			if lf.num == 1 {
+				v, err := varints(lf)
+				if err != nil {
+					return nil, err
+				}
+				path = append(path, v...)
+			}
+		}
+
+		path, ok := renumberPath(path, renumbered)
+		if !ok {
+			continue
+		}
+		var lb []byte
+		for i, lf := range location {
+			if lf.num != 1 {
+				lb = append(lb, lf.raw...)
+			} else if i == 0 || location[i-1].num != 1 {
+				var packed []byte
+				for _, v := range path {
+					packed = binary.AppendUvarint(packed, v)
+				}
+				lb = appendBytesField(lb, 1, packed)
+			}
+		}
+		out = appendBytesField(out, 1, lb)
+	}
+	return out, nil
+}
+
+// renumberPath returns the path of a SourceCodeInfo location with the positions of the elements it goes through
+// renumbered, or false if one of them was removed
+func renumberPath(path []uint64, renumbered map[string][]int) ([]uint64, bool) {
+	path = append([]uint64(nil), path...)
+	key := ""
+	for i := 0; i+1 < len(path); i += 2 {
+		key = strings.TrimPrefix(fmt.Sprintf("%s/%d", key, path[i]), "/")
+		positions, ok := renumbered[key]
+		if !ok {
+			break
+		}
+		if path[i+1] >= uint64(len(positions)) || positions[path[i+1]] < 0 {
+			return nil, false
+		}
+		key = fmt.Sprintf("%s/%d", key, path[i+1])
+		path[i+1] = uint64(positions[path[i+1]])
+	}
+	return path, true
+}
+
+// varints returns the values of the repeated varint field f, either packed or not
+func varints(f rawField) ([]uint64, error) {
+	switch f.wireType {
+	case 0:
+		return []uint64{f.v}, nil
+	case 2:
+		var values []uint64
+		for b := f.data; len(b) > 0; {
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("malformed packed varint")
+			}
+			values, b = append(values, v), b[n:]
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("field %d is not a varint", f.num)
+}
+
+// appendBytesField appends the length delimited field num holding data to b
+func appendBytesField(b []byte, num int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// appendVarintField appends the varint field num holding v to b
+func appendVarintField(b []byte, num int, v uint64) []byte {
+	return binary.AppendUvarint(binary.AppendUvarint(b, uint64(num)<<3), v)
+}
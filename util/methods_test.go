@@ -0,0 +1,294 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// protoPacked returns a protobuf encoded packed repeated varint field
+func protoPacked(num int, values ...uint64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.AppendUvarint(b, v)
+	}
+	return protoField(num, b)
+}
+
+// protoMessageType returns an encoded DescriptorProto named name, with a field of type typeName for each of them
+func protoMessageType(name string, typeNames ...string) []byte {
+	fields := [][]byte{protoString(1, name)}
+	for i, typeName := range typeNames {
+		fields = append(fields, protoField(2, protoString(1, strings.ToLower(name)), protoVarint(3, uint64(i+1)),
+			protoVarint(5, 11), protoString(6, typeName)))
+	}
+	return protoField(4, fields...)
+}
+
+// protoMethod returns an encoded MethodDescriptorProto named name, followed by its other fields
+func protoMethod(name string, input string, output string, fields ...[]byte) []byte {
+	return protoField(2, append([][]byte{protoString(1, name), protoString(2, input), protoString(3, output)}, fields...)...)
+}
+
+// protoLocation returns an encoded SourceCodeInfo.Location at path, with comment as its leading comments
+func protoLocation(comment string, path ...uint64) []byte {
+	return protoField(1, protoPacked(1, path...), protoPacked(2, 1, 0, 10), protoString(3, comment))
+}
+
+var (
+	// queryOptions are the options of Search.Query, like option (google.api.http) = { get: "/v1/query" }
+	queryOptions = protoField(4, protoField(72295728, protoString(2, "/v1/query")))
+
+	// searchOptions are the options of the Search service, like option deprecated = true
+	searchOptions = protoField(3, protoVarint(33, 1))
+
+	commonFile = protoField(1, protoString(1, "common.proto"), protoString(2, "common.v1"),
+		protoMessageType("Page"),
+	)
+	annotationsFile = protoField(1, protoString(1, "annotations.proto"), protoString(2, "google.api"),
+		protoField(7, protoString(1, "http"), protoString(2, ".google.protobuf.MethodOptions"), protoVarint(3, 72295728),
+			protoVarint(5, 11), protoString(6, ".google.api.HttpRule")),
+		protoMessageType("HttpRule"),
+	)
+	searchFile = protoField(1, protoString(1, "search.proto"), protoString(2, "search.v1"),
+		protoString(3, "common.proto"),
+		protoString(3, "annotations.proto"),
+		protoMessageType("QueryRequest"),
+		protoMessageType("QueryResponse"),
+		protoMessageType("SuggestRequest", ".common.v1.Page"),
+		protoMessageType("Event", ".search.v1.QueryResponse"),
+		protoMessageType("ReindexRequest"),
+		protoField(6, protoString(1, "Search"),
+			protoMethod("Query", ".search.v1.QueryRequest", ".search.v1.QueryResponse", queryOptions),
+			protoMethod("Suggest", ".search.v1.SuggestRequest", ".search.v1.QueryResponse"),
+			searchOptions,
+		),
+		protoField(6, protoString(1, "Admin"),
+			protoMethod("Reindex", ".search.v1.ReindexRequest", ".search.v1.QueryResponse"),
+		),
+		protoVarint(10, 0),
+		protoField(9,
+			protoLocation("common", 3, 0),
+			protoLocation("public common", 10, 0),
+			protoLocation("QueryRequest", 4, 0),
+			protoLocation("SuggestRequest", 4, 2),
+			protoLocation("Event", 4, 3),
+			protoLocation("Event.queryresponse", 4, 3, 2, 0),
+			protoLocation("ReindexRequest", 4, 4),
+			protoLocation("Search", 6, 0),
+			protoLocation("Query", 6, 0, 2, 0),
+			protoLocation("Query options", 6, 0, 2, 0, 4),
+			protoLocation("Suggest", 6, 0, 2, 1),
+			protoLocation("Search options", 6, 0, 3),
+			protoLocation("Admin", 6, 1),
+			protoLocation("Reindex", 6, 1, 2, 0),
+		),
+	)
+)
+
+// descriptorSet is a FileDescriptorSet of search.proto along with its imports
+var descriptorSet = string(commonFile) + string(annotationsFile) + string(searchFile)
+
+// descriptorFileFields returns the fields of the file named name of the FileDescriptorSet at path
+func descriptorFileFields(t *testing.T, path string, name string) []rawField {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := splitMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range set {
+		fields, err := splitMessage(f.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fields) > 0 && string(fields[0].data) == name {
+			return fields
+		}
+	}
+	t.Fatalf("the descriptor set has no file '%s'", name)
+	return nil
+}
+
+// descriptorComments returns the leading comments of the source code info of fields, keyed by their path
+func descriptorComments(t *testing.T, fields []rawField) map[string]string {
+	t.Helper()
+	comments := make(map[string]string)
+	for _, f := range fields {
+		if f.num != fileSourceCodeInfo {
+			continue
+		}
+		locations, err := splitMessage(f.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range locations {
+			var path []string
+			var comment string
+			err := decodeMessage(l.data, func(num int, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					values, err := varints(rawField{num: num, wireType: 2, data: b})
+					for _, v := range values {
+						path = append(path, strconv.FormatUint(v, 10))
+					}
+					return err
+				case 3:
+					comment = string(b)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			comments[strings.Join(path, ",")] = comment
+		}
+	}
+	return comments
+}
+
+// descriptorValues returns the values of the string or varint fields num of fields
+func descriptorValues(fields []rawField, num int) []string {
+	var values []string
+	for _, f := range fields {
+		if f.num != num {
+			continue
+		}
+		if f.wireType == 0 {
+			values = append(values, strconv.FormatUint(f.v, 10))
+		} else {
+			values = append(values, string(f.data))
+		}
+	}
+	return values
+}
+
+// descriptorElements returns the kind and name of the elements of the FileDescriptorSet at path, ordered by name
+func descriptorElements(t *testing.T, path string) []string {
+	t.Helper()
+	elements, err := ReadDescriptorSet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range elements {
+		if e.Kind != ElementField {
+			names = append(names, e.Kind+" "+e.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFilterMethods(t *testing.T) {
+	tests := []struct {
+		name     string
+		methods  []string
+		elements []string
+		deps     []string
+		public   []string
+		comments map[string]string
+	}{
+		{
+			name:    "method",
+			methods: []string{"Query"},
+			elements: []string{
+				"message google.api.HttpRule", "message search.v1.Event", "message search.v1.QueryRequest",
+				"message search.v1.QueryResponse", "rpc search.v1.Search.Query", "service search.v1.Search",
+			},
+			deps: []string{"annotations.proto"},
+			comments: map[string]string{
+				"4,0": "QueryRequest", "4,2": "Event", "4,2,2,0": "Event.queryresponse", "6,0": "Search",
+				"6,0,2,0": "Query", "6,0,2,0,4": "Query options", "6,0,3": "Search options",
+			},
+		},
+		{
+			name:    "service method",
+			methods: []string{"Admin.Reindex", "Search.Suggest"},
+			elements: []string{
+				"message common.v1.Page", "message google.api.HttpRule", "message search.v1.Event",
+				"message search.v1.QueryResponse", "message search.v1.ReindexRequest", "message search.v1.SuggestRequest",
+				"rpc search.v1.Admin.Reindex", "rpc search.v1.Search.Suggest", "service search.v1.Admin",
+				"service search.v1.Search",
+			},
+			deps:   []string{"common.proto", "annotations.proto"},
+			public: []string{"0"},
+			comments: map[string]string{
+				"3,0": "common", "10,0": "public common", "4,1": "SuggestRequest", "4,2": "Event",
+				"4,2,2,0": "Event.queryresponse", "4,3": "ReindexRequest", "6,0": "Search", "6,0,2,0": "Suggest",
+				"6,0,3": "Search options", "6,1": "Admin", "6,1,2,0": "Reindex",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			in := writeFile(t, dir, "inputs.pb", descriptorSet)
+			out := filepath.Join(dir, "methods.pb")
+			if err := FilterMethods(in, out, tt.methods); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got := descriptorElements(t, out); !reflect.DeepEqual(got, tt.elements) {
+				t.Errorf("elements = %q, want %q", got, tt.elements)
+			}
+			fields := descriptorFileFields(t, out, "search.proto")
+			if got := descriptorValues(fields, fileDependency); !reflect.DeepEqual(got, tt.deps) {
+				t.Errorf("imports = %q, want %q", got, tt.deps)
+			}
+			if got := descriptorValues(fields, filePublicDependency); !reflect.DeepEqual(got, tt.public) {
+				t.Errorf("public imports = %q, want %q", got, tt.public)
+			}
+			if got := descriptorComments(t, fields); !reflect.DeepEqual(got, tt.comments) {
+				t.Errorf("comments = %q, want %q", got, tt.comments)
+			}
+
+			// The options of the kept service and methods are kept as they are
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(data, searchOptions) {
+				t.Error("the options of the service were not kept")
+			}
+			if bytes.Contains(data, queryOptions) != (tt.methods[0] == "Query") {
+				t.Error("the options of Query were not kept along with it")
+			}
+		})
+	}
+}
+
+func TestFilterMethodsMissing(t *testing.T) {
+	dir := t.TempDir()
+	in := writeFile(t, dir, "inputs.pb", descriptorSet)
+	out := filepath.Join(dir, "methods.pb")
+
+	err := FilterMethods(in, out, []string{"Query", "Search.Reindex", "Fake"})
+	if err == nil || !strings.HasSuffix(err.Error(), "no service declares the methods: Fake, Search.Reindex") {
+		t.Fatalf("expected the undeclared methods to be reported, got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("the descriptor set was written: %v", err)
+	}
+}
+
+func TestFilterMethodsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "inputs.pb")
+	if err := os.WriteFile(in, []byte("descriptor\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := FilterMethods(in, filepath.Join(dir, "methods.pb"), []string{"Query"})
+	if err == nil || !strings.Contains(err.Error(), "invalid descriptor set") {
+		t.Fatalf("expected the invalid descriptor set to be refused, got %v", err)
+	}
+}
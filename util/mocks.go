@@ -0,0 +1,70 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// goRPCInterfaceFiles holds the name of the generated Go file declaring the RPC interfaces of a service for each RPC
+// framework
+var goRPCInterfaceFiles = map[string]string{
+	RPCFrameworkTwirp: "%s.twirp.go",
+	RPCFrameworkGRPC:  "%s_grpc.pb.go",
+}
+
+// IsMockableLanguage returns true if mocks can be generated for the client interfaces of lang. Returns false otherwise
+func IsMockableLanguage(lang string) bool {
+	return lang == LanguageGo
+}
+
+// goPackageName returns the package name declared in the Go source file at path
+func goPackageName(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot open generated file: %s", err.Error())
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "package ")), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("cannot read generated file: %s", err.Error())
+	}
+
+	return "", fmt.Errorf("no package declaration found in '%s'", filepath.Base(path))
+}
+
+func mockgenCmd(ctx context.Context, source string, destination string, pkg string, opts GenerateOptions) *exec.Cmd {
+	return opts.command(ctx, "mockgen", fmt.Sprintf("-source=%s", source), fmt.Sprintf("-destination=%s", destination), fmt.Sprintf("-package=%s", pkg))
+}
+
+// GenerateMocks generates gomock mocks of the RPC interfaces generated for service in dir using mockgen. The mocks are
+// written to <service>_mock.go in dir, in the same package as the generated code.
+func GenerateMocks(ctx context.Context, language string, service string, dir string, opts GenerateOptions) error {
+	if !IsMockableLanguage(language) {
+		return fmt.Errorf("mocks cannot be generated for '%s'", language)
+	}
+
+	name, ok := goRPCInterfaceFiles[opts.rpcFramework()]
+	if !ok {
+		return fmt.Errorf("mocks cannot be generated for the '%s' RPC framework", opts.rpcFramework())
+	}
+
+	source := filepath.Join(dir, fmt.Sprintf(name, service))
+	pkg, err := goPackageName(source)
+	if err != nil {
+		return err
+	}
+
+	return runGenerator(mockgenCmd(ctx, source, filepath.Join(dir, fmt.Sprintf("%s_mock.go", service)), pkg, opts), opts)
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeMockgen is a mockgen that writes its arguments to the -destination file
+const fakeMockgen = `for a in "$@"; do
+  case "$a" in
+    -destination=*) dst=${a#*=};;
+  esac
+done
+echo "$@" > "$dst"
+`
+
+func TestGenerateMocks(t *testing.T) {
+	fakeCommand(t, "mockgen", fakeMockgen)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.twirp.go", "// Code generated by protoc-gen-twirp.\n\npackage searchv1\n")
+
+	if err := GenerateMocks(context.Background(), LanguageGo, "search", dir, GenerateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "search_mock.go"))
+	if err != nil {
+		t.Fatalf("the mocks were not generated: %s", err)
+	}
+	args := string(data)
+	if !strings.Contains(args, "-source="+filepath.Join(dir, "search.twirp.go")) || !strings.Contains(args, "-package=searchv1") {
+		t.Errorf("mockgen ran with %q", args)
+	}
+}
+
+func TestGenerateMocksErrors(t *testing.T) {
+	fakeCommand(t, "mockgen", fakeMockgen)
+	tests := []struct {
+		name     string
+		language string
+		opts     GenerateOptions
+		file     string
+		wantErr  string
+	}{
+		{"unsupported language", LanguageRuby, GenerateOptions{}, "", "mocks cannot be generated for 'ruby'"},
+		{"unsupported framework", LanguageGo, GenerateOptions{RPCFramework: RPCFrameworkNone}, "", "mocks cannot be generated for the 'none' RPC framework"},
+		{"missing package", LanguageGo, GenerateOptions{}, "// no package\n", "no package declaration found in 'search.twirp.go'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.file != "" {
+				writeFile(t, dir, "search.twirp.go", tt.file)
+			}
+			err := GenerateMocks(context.Background(), tt.language, "search", dir, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
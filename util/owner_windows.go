@@ -0,0 +1,7 @@
+//go:build windows
+// +build windows
+
+package util
+
+// ownersSupported is whether the owner of files can be changed, which Windows does not support
+const ownersSupported = false
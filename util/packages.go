@@ -0,0 +1,96 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// packagePattern matches the package declaration of a protobuf, capturing the package name
+var packagePattern = regexp.MustCompile(`(?m)^(\s*package\s+)([\w.]+)(\s*;)`)
+
+// nonIdentifier matches characters that cannot appear in a protobuf identifier
+var nonIdentifier = regexp.MustCompile(`\W`)
+
+// NormalizePackages rewrites the package declarations of the protobufs in protoDir to be scoped by service, so that
+// services declaring the same package generate distinct symbols, e.g. package api.v1 of catalog becomes catalog.api.v1.
+// References to the types of a renamed package in the other protobufs are rewritten along with it. Packages already
+// scoped by service, and the well-known types, are left as they are. It returns the renamed packages, mapped to their
+// new names.
+func NormalizePackages(protoDir string, service string) (map[string]string, error) {
+	files, err := ProtoFiles(protoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := nonIdentifier.ReplaceAllString(service, "_")
+	contents := make(map[string]string, len(files))
+	renames := make(map[string]string)
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read protobuf file: %s", err.Error())
+		}
+		contents[path] = string(data)
+
+		if m := packagePattern.FindStringSubmatch(string(data)); m != nil {
+			if m[2] != scope && !strings.HasPrefix(m[2], scope+".") && !strings.HasPrefix(m[2], "google.") {
+				renames[m[2]] = scope + "." + m[2]
+			}
+		}
+	}
+	if len(renames) == 0 {
+		return renames, nil
+	}
+
+	// Longer packages are replaced first, so that a package is not mistaken for the prefix of another
+	packages := make([]string, 0, len(renames))
+	for pkg := range renames {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return len(packages[i]) > len(packages[j]) })
+	references := make([]*regexp.Regexp, len(packages))
+	for i, pkg := range packages {
+		references[i] = regexp.MustCompile(`(^|[^\w.])(\.?)` + regexp.QuoteMeta(pkg) + `\.([A-Za-z_])`)
+	}
+
+	for _, path := range files {
+		lines := strings.Split(contents[path], "\n")
+		for i, line := range lines {
+			if m := packagePattern.FindStringSubmatch(line); m != nil {
+				if scoped, ok := renames[m[2]]; ok {
+					lines[i] = m[1] + scoped + line[len(m[1])+len(m[2]):]
+				}
+				continue
+			}
+			if isDeclarationLine(line) {
+				continue
+			}
+			for j, pkg := range packages {
+				lines[i] = references[j].ReplaceAllString(lines[i], "${1}${2}"+renames[pkg]+".${3}")
+			}
+		}
+
+		rewritten := strings.Join(lines, "\n")
+		if rewritten == contents[path] {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(rewritten), 0644); err != nil {
+			return nil, fmt.Errorf("cannot rewrite package of protobuf file: %s", err.Error())
+		}
+	}
+	return renames, nil
+}
+
+// isDeclarationLine returns true if line is a comment, import or file option of a protobuf, which do not refer to types
+func isDeclarationLine(line string) bool {
+	line = strings.TrimSpace(line)
+	for _, prefix := range []string{"//", "/*", "*", "import ", "option "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizePackages(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "common/page.proto", `syntax = "proto3";
+
+package api.common;
+
+message Page {
+  int32 size = 1;
+}
+`)
+	writeFile(t, dir, "search.proto", `syntax = "proto3";
+
+// Searches api.common pages
+package api.v1;
+
+import "common/page.proto";
+
+option go_package = "example.com/api.v1";
+
+message SearchRequest {
+  api.common.Page page = 1;
+  .api.common.Page next = 2;
+}
+`)
+	writeFile(t, dir, "catalog.proto", "syntax = \"proto3\";\n\npackage catalog.v1;\n")
+
+	renames, err := NormalizePackages(dir, "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"api.common": "catalog.api.common", "api.v1": "catalog.api.v1"}; !reflect.DeepEqual(renames, want) {
+		t.Errorf("renames = %v, want %v", renames, want)
+	}
+
+	want := map[string]string{
+		"common/page.proto": "syntax = \"proto3\";\n\npackage catalog.api.common;\n\nmessage Page {\n  int32 size = 1;\n}\n",
+		"search.proto": `syntax = "proto3";
+
+// Searches api.common pages
+package catalog.api.v1;
+
+import "common/page.proto";
+
+option go_package = "example.com/api.v1";
+
+message SearchRequest {
+  catalog.api.common.Page page = 1;
+  .catalog.api.common.Page next = 2;
+}
+`,
+		"catalog.proto": "syntax = \"proto3\";\n\npackage catalog.v1;\n",
+	}
+	for name, contents := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents {
+			t.Errorf("%s =\n%s\nwant\n%s", name, data, contents)
+		}
+	}
+
+	// The rewritten references resolve to the renamed package
+	if _, err := exec.LookPath("protoc"); err == nil {
+		cmd := exec.Command("protoc", "--proto_path="+dir, "--descriptor_set_out="+filepath.Join(t.TempDir(), "descriptor.pb"), "search.proto")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("the rewritten protobufs do not compile: %s", out)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// FileOwner is the user and group that copied generated files are owned by. An ID of -1 leaves it unchanged
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// ParseFileMode parses text as the octal permission bits of copied generated files, e.g. 0644 or 664
+func ParseFileMode(text string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(text, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("Invalid file mode '%s', it must be octal permission bits such as 0644", text)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ParseFileOwner parses text as the owner of copied generated files, given as user[:group] or :group. Users and groups
+// are either names or numeric IDs.
+func ParseFileOwner(text string) (*FileOwner, error) {
+	if !ownersSupported {
+		return nil, fmt.Errorf("The owner of generated files cannot be set on this platform")
+	}
+
+	owner := &FileOwner{UID: -1, GID: -1}
+	name, group := text, ""
+	if i := strings.IndexByte(text, ':'); i >= 0 {
+		name, group = text[:i], text[i+1:]
+		if group == "" {
+			return nil, fmt.Errorf("Invalid file owner '%s', it must be user[:group] or :group", text)
+		}
+	}
+	if name == "" && group == "" {
+		return nil, fmt.Errorf("Invalid file owner '%s', it must be user[:group] or :group", text)
+	}
+
+	if name != "" {
+		id, err := lookupID(name, func(n string) (string, error) {
+			u, err := user.Lookup(n)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Unknown user '%s' of generated files", name)
+		}
+		owner.UID = id
+	}
+	if group != "" {
+		id, err := lookupID(group, func(n string) (string, error) {
+			g, err := user.LookupGroup(n)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Unknown group '%s' of generated files", group)
+		}
+		owner.GID = id
+	}
+	return owner, nil
+}
+
+// lookupID returns the numeric ID name, or the ID lookup returns for it when it is not numeric
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// setPermissions applies the mode and owner of opts, when set, to the copied generated file at path
+func setPermissions(path string, opts CopyOptions) error {
+	if opts.Mode != 0 {
+		if err := os.Chmod(path, opts.Mode); err != nil {
+			return fmt.Errorf("cannot set the mode of generated file: %s", err.Error())
+		}
+	}
+	if opts.Owner != nil {
+		if err := os.Chown(path, opts.Owner.UID, opts.Owner.GID); err != nil {
+			return fmt.Errorf("cannot set the owner of generated file: %s", err.Error())
+		}
+	}
+	return nil
+}
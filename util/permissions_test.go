@@ -0,0 +1,96 @@
+package util
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{text: "0644", want: 0644},
+		{text: "664", want: 0664},
+		{text: "0777", want: 0777},
+		{text: "1777", wantErr: true},
+		{text: "0689", wantErr: true},
+		{text: "rw-r--r--", wantErr: true},
+	}
+	for _, tt := range tests {
+		mode, err := ParseFileMode(tt.text)
+		if (err != nil) != tt.wantErr || mode != tt.want {
+			t.Errorf("ParseFileMode(%q) = %o, %v, want %o, error %t", tt.text, mode, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFileOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		if _, err := ParseFileOwner("1000"); err == nil {
+			t.Error("an owner was accepted on Windows")
+		}
+		return
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("the current user is unknown: %s", err)
+	}
+	uid, _ := strconv.Atoi(current.Uid)
+	gid, _ := strconv.Atoi(current.Gid)
+
+	tests := []struct {
+		text    string
+		want    FileOwner
+		wantErr bool
+	}{
+		{text: "1000", want: FileOwner{UID: 1000, GID: -1}},
+		{text: "1000:1001", want: FileOwner{UID: 1000, GID: 1001}},
+		{text: ":1001", want: FileOwner{UID: -1, GID: 1001}},
+		{text: current.Username, want: FileOwner{UID: uid, GID: -1}},
+		{text: current.Uid + ":" + current.Gid, want: FileOwner{UID: uid, GID: gid}},
+		{text: "", wantErr: true},
+		{text: ":", wantErr: true},
+		{text: "1000:", wantErr: true},
+		{text: "no-such-user-of-generated-files", wantErr: true},
+		{text: ":no-such-group-of-generated-files", wantErr: true},
+	}
+	for _, tt := range tests {
+		owner, err := ParseFileOwner(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFileOwner(%q) error = %v, wantErr %t", tt.text, err, tt.wantErr)
+			continue
+		}
+		if err == nil && *owner != tt.want {
+			t.Errorf("ParseFileOwner(%q) = %+v, want %+v", tt.text, *owner, tt.want)
+		}
+	}
+}
+
+func TestCopyGeneratedFilesPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "v1/search.pb.go", "package v1\n")
+
+	// Owning the files by the current user and group is permitted without privileges
+	opts := CopyOptions{Mode: 0600, Owner: &FileOwner{UID: os.Getuid(), GID: os.Getgid()}}
+	chdir(t, t.TempDir())
+	if _, err := CopyGeneratedFiles(protoDir, "out", opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	info, err := os.Stat(filepath.Join("out", "v1", "search.pb.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the copied file has mode %o, want 600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CheckRemote checks that org/repo can be read from opts.Host with git ls-remote, without cloning it. git is not
+// allowed to prompt for credentials, so missing or rejected credentials fail the check instead of hanging.
+func CheckRemote(ctx context.Context, org string, repo string, opts CloneOptions) error {
+	lsRemoteCmd := exec.CommandContext(ctx, "git", "ls-remote", opts.remoteURL(org, repo), "HEAD")
+	lsRemoteCmd.Env = append(opts.env(), "GIT_TERMINAL_PROMPT=0")
+	if os.Getenv("GIT_SSH_COMMAND") == "" {
+		lsRemoteCmd.Env = append(lsRemoteCmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+
+	var stderr bytes.Buffer
+	lsRemoteCmd.Stderr = &stderr
+	if err := lsRemoteCmd.Run(); err != nil {
+		detail := strings.TrimSpace(stderr.String())
+		if detail == "" {
+			detail = err.Error()
+		}
+		return fmt.Errorf("cannot access repository '%s/%s' on %s: %s", org, repo, opts.host(), detail)
+	}
+	return nil
+}
+
+// CheckServiceRemote checks that the repository of service can be read. See CheckRemote
+func CheckServiceRemote(ctx context.Context, service string, opts CloneOptions) error {
+	host, org := opts.ServiceRemote(service)
+	opts.Host = host
+	opts.service = service
+	return CheckRemote(ctx, org, RepoName(service, opts.RepoNames), opts)
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckRemote(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "git.log")
+	fakeCommand(t, "git", `echo "$@ $GIT_TERMINAL_PROMPT" >> `+log+`
+echo "0123456789abcdef	HEAD"
+`)
+	if err := CheckRemote(context.Background(), "org", "search", CloneOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("git was not run: %s", err)
+	}
+	if strings.TrimSpace(string(data)) != "ls-remote git@github.com:org/search.git HEAD 0" {
+		t.Errorf("git was run as %q", data)
+	}
+
+	fakeCommand(t, "git", "echo 'Permission denied (publickey).' >&2\nexit 128\n")
+	err = CheckServiceRemote(context.Background(), "search", CloneOptions{ServiceHosts: map[string]string{"search": "github.example.com"}})
+	if err == nil || err.Error() != "cannot access repository '"+DefaultOrg+"/search' on github.example.com: Permission denied (publickey)." {
+		t.Errorf("got %v", err)
+	}
+}
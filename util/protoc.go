@@ -0,0 +1,190 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Proto3OptionalFlag enables proto3 optional fields in protoc versions where they are experimental
+const Proto3OptionalFlag = "--experimental_allow_proto3_optional"
+
+// protocArgs returns the arguments given to every protoc invocation compiling the protobufs in dir
+func (o GenerateOptions) protocArgs(dir string) []string {
+	var args []string
+	for _, p := range ProtoPaths(dir, o.ImportPaths) {
+		args = append(args, fmt.Sprintf("--proto_path=%s", p))
+	}
+	if o.Proto3Optional {
+		args = append(args, Proto3OptionalFlag)
+	}
+	if o.DescriptorSetIn != "" {
+		args = append(args, fmt.Sprintf("--descriptor_set_in=%s", o.DescriptorSetIn))
+	}
+	return args
+}
+
+// protocCommand returns a command running protoc with args on the protobufs in dir. protoc runs in o.WorkDir, or dir
+// by default, since some plugins resolve paths from their working directory rather than the proto path. The paths in
+// args are made relative to the working directory when they are within it, and absolute otherwise.
+func (o GenerateOptions) protocCommand(ctx context.Context, dir string, args []string) *exec.Cmd {
+	workDir := o.WorkDir
+	if workDir == "" {
+		workDir = dir
+	}
+	if abs, err := filepath.Abs(workDir); err == nil {
+		workDir = abs
+	}
+
+	relArgs := make([]string, len(args))
+	for i, arg := range args {
+		relArgs[i] = relativeArg(arg, workDir)
+	}
+
+	var cmd *exec.Cmd
+	if o.DockerImage != "" {
+		cmd = o.dockerCommand(ctx, relArgs, workDir)
+	} else {
+		cmd = o.command(ctx, "protoc", relArgs...)
+	}
+	cmd.Dir = workDir
+	return cmd
+}
+
+// relativeArg returns the protoc argument arg with the path it holds, if any, relative to workDir. Plugin binaries
+// given by name, to be found on the PATH, are left as they are
+func relativeArg(arg string, workDir string) string {
+	switch {
+	case strings.HasPrefix(arg, "--proto_path="):
+		return "--proto_path=" + relativePath(strings.TrimPrefix(arg, "--proto_path="), workDir)
+	case strings.HasPrefix(arg, "--descriptor_set_out="):
+		return "--descriptor_set_out=" + relativePath(strings.TrimPrefix(arg, "--descriptor_set_out="), workDir)
+	case strings.HasPrefix(arg, "--descriptor_set_in="):
+		return "--descriptor_set_in=" + relativePath(strings.TrimPrefix(arg, "--descriptor_set_in="), workDir)
+	case strings.HasPrefix(arg, "--plugin="):
+		i := strings.Index(arg[len("--plugin="):], "=")
+		if i < 0 {
+			return arg
+		}
+		name, path := arg[:len("--plugin=")+i+1], arg[len("--plugin=")+i+1:]
+		if !strings.ContainsAny(path, `/\`) {
+			return arg
+		}
+		return name + relativePath(path, workDir)
+	case strings.HasPrefix(arg, "--") && strings.Contains(arg, "_out="):
+		i := strings.Index(arg, "_out=") + len("_out=")
+		if j := strings.LastIndex(arg[i:], ":"); j >= 0 {
+			i += j + 1
+		}
+		return arg[:i] + relativePath(arg[i:], workDir)
+	case !strings.HasPrefix(arg, "-"):
+		return relativePath(arg, workDir)
+	}
+	return arg
+}
+
+// relativePath returns path relative to workDir if it is within it, and otherwise as an absolute path. Relative paths
+// are resolved from the current working directory
+func relativePath(path string, workDir string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if !within(abs, workDir) {
+		return abs
+	}
+	rel, err := filepath.Rel(workDir, abs)
+	if err != nil {
+		return abs
+	}
+	return rel
+}
+
+// ProtoPaths returns the --proto_path entries of protoc compiling the protobufs in dir: dir, followed by importPaths
+// in the order they are given. Paths are compared once cleaned and made absolute, and only the first occurrence of each
+// is kept, since protoc rejects a file found through two proto paths.
+func ProtoPaths(dir string, importPaths []string) []string {
+	paths := make([]string, 0, len(importPaths)+1)
+	seen := make(map[string]bool)
+	for _, p := range append([]string{dir}, importPaths...) {
+		key := filepath.Clean(p)
+		if abs, err := filepath.Abs(p); err == nil {
+			key = abs
+		}
+		if p == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// pluginArgs returns the protoc arguments running p with its output in dir, along with the plugin's binary when a
+// custom path is configured for it
+func (o GenerateOptions) pluginArgs(p plugin, dir string) []string {
+	var args []string
+	if path, ok := o.PluginPaths[p.name]; ok && path != "" {
+		args = append(args, fmt.Sprintf("--plugin=protoc-gen-%s=%s", p.name, path))
+	}
+	return append(args, p.arg(dir, o.pluginOpts(p)))
+}
+
+// pluginOpts returns the options given to p in addition to its defaults
+func (o GenerateOptions) pluginOpts(p plugin) []string {
+	s, ok := streamingPluginOpts[p.name]
+	if !ok {
+		return o.PluginOpts[p.name]
+	}
+
+	mode := s.streaming
+	if o.NoStreaming {
+		mode = s.unary
+	}
+	return append([]string{mode}, o.PluginOpts[p.name]...)
+}
+
+// warningPattern matches the warnings protoc writes to its error output, either diagnostics of a protobuf such as
+// "foo.proto:3:1: warning: Import bar.proto is unused." or messages of the protobuf library such as
+// "[libprotobuf WARNING ...]". Other output, such as informational messages of plugins, does not match.
+var warningPattern = regexp.MustCompile(`^(\S+:\d+:\d+: warning: |\[libprotobuf WARNING |warning: )`)
+
+// protocWarnings returns the warning lines of the protoc error output stderr
+func protocWarnings(stderr []byte) []string {
+	var warnings []string
+	for _, line := range strings.Split(string(stderr), "\n") {
+		line = strings.TrimSpace(line)
+		if warningPattern.MatchString(line) {
+			warnings = append(warnings, line)
+		}
+	}
+	return warnings
+}
+
+// ProtocVersion returns the major and minor version of the protoc that opts runs
+func ProtocVersion(ctx context.Context, opts GenerateOptions) (int, int, error) {
+	out, err := opts.command(ctx, "protoc", "--version").Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get protoc version: %s", err.Error())
+	}
+
+	// protoc prints its version as "libprotoc 3.14.0"
+	var major, minor int
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("cannot parse protoc version '%s'", strings.TrimSpace(string(out)))
+	}
+	if _, err := fmt.Sscanf(fields[len(fields)-1], "%d.%d", &major, &minor); err != nil {
+		return 0, 0, fmt.Errorf("cannot parse protoc version '%s'", strings.TrimSpace(string(out)))
+	}
+	return major, minor, nil
+}
+
+// NeedsProto3OptionalFlag reports whether protoc major.minor requires Proto3OptionalFlag to compile proto3 optional
+// fields. They were experimental from 3.12 until 3.15, which enabled them by default.
+func NeedsProto3OptionalFlag(major int, minor int) bool {
+	return major == 3 && minor >= 12 && minor < 15
+}
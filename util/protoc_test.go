@@ -0,0 +1,195 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProtocVersion(t *testing.T) {
+	tests := []struct {
+		output    string
+		wantMajor int
+		wantMinor int
+		wantErr   bool
+	}{
+		{"libprotoc 3.14.0", 3, 14, false},
+		{"libprotoc 22.2", 22, 2, false},
+		{"", 0, 0, true},
+		{"libprotoc unknown", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		fakeCommand(t, "protoc", "echo '"+tt.output+"'\n")
+		major, minor, err := ProtocVersion(context.Background(), GenerateOptions{})
+		if (err != nil) != tt.wantErr || major != tt.wantMajor || minor != tt.wantMinor {
+			t.Errorf("ProtocVersion of %q = %d.%d, %v, want %d.%d", tt.output, major, minor, err, tt.wantMajor, tt.wantMinor)
+		}
+	}
+}
+
+func TestNeedsProto3OptionalFlag(t *testing.T) {
+	tests := []struct {
+		major, minor int
+		want         bool
+	}{
+		{3, 11, false},
+		{3, 12, true},
+		{3, 14, true},
+		{3, 15, false},
+		{4, 13, false},
+	}
+	for _, tt := range tests {
+		if got := NeedsProto3OptionalFlag(tt.major, tt.minor); got != tt.want {
+			t.Errorf("NeedsProto3OptionalFlag(%d, %d) = %t, want %t", tt.major, tt.minor, got, tt.want)
+		}
+	}
+}
+
+func TestPluginArgs(t *testing.T) {
+	opts := GenerateOptions{
+		PluginPaths: map[string]string{"go": "/opt/bin/protoc-gen-go-custom", "twirp": ""},
+		PluginOpts:  map[string][]string{"go": {"module=example.com/x"}},
+	}
+	tests := []struct {
+		plugin plugin
+		want   string
+	}{
+		{plugin{"go", "paths=source_relative"}, "--plugin=protoc-gen-go=/opt/bin/protoc-gen-go-custom --go_out=paths=source_relative,module=example.com/x:out"},
+		{plugin{"twirp", ""}, "--twirp_out=out"},
+		{plugin{"ruby", ""}, "--ruby_out=out"},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(opts.pluginArgs(tt.plugin, "out"), " "); got != tt.want {
+			t.Errorf("pluginArgs(%s) = %q, want %q", tt.plugin.name, got, tt.want)
+		}
+	}
+}
+
+func TestPluginArgsStreaming(t *testing.T) {
+	rpc, err := rpcPlugin(LanguageJavascript, RPCFrameworkGRPC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		opts GenerateOptions
+		want string
+	}{
+		{GenerateOptions{}, "--grpc-web_out=import_style=commonjs,mode=grpcwebtext:out"},
+		{GenerateOptions{NoStreaming: true}, "--grpc-web_out=import_style=commonjs,mode=grpcweb:out"},
+		{GenerateOptions{PluginOpts: map[string][]string{"grpc-web": {"a=b"}}}, "--grpc-web_out=import_style=commonjs,mode=grpcwebtext,a=b:out"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.opts.pluginArgs(*rpc, "out"), " "); got != tt.want {
+			t.Errorf("NoStreaming %t: got %q, want %q", tt.opts.NoStreaming, got, tt.want)
+		}
+	}
+
+	// Plugins that always or never support streaming are not given streaming options
+	twirp, err := rpcPlugin(LanguageGo, RPCFrameworkTwirp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join((GenerateOptions{NoStreaming: true}).pluginArgs(*twirp, "out"), " "); got != "--twirp_out=paths=source_relative:out" {
+		t.Errorf("got %q for twirp", got)
+	}
+}
+
+func TestProtocWarnings(t *testing.T) {
+	stderr := `search.proto:3:1: warning: Import google/protobuf/empty.proto is unused.
+[libprotobuf WARNING google/protobuf/compiler/parser.cc:648] No syntax specified for the proto file: query.proto.
+warning: directory does not exist.
+Generating search clients
+protoc-gen-twirp: reading search.proto, no warnings found
+search.proto:9:5: "Query" is already defined in "search.v1".
+`
+	want := []string{
+		"search.proto:3:1: warning: Import google/protobuf/empty.proto is unused.",
+		"[libprotobuf WARNING google/protobuf/compiler/parser.cc:648] No syntax specified for the proto file: query.proto.",
+		"warning: directory does not exist.",
+	}
+	if got := protocWarnings([]byte(stderr)); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRunGeneratorFailOnWarning(t *testing.T) {
+	fakeCommand(t, "protoc", "echo 'search.proto:3:1: warning: Import empty.proto is unused.' >&2\necho 'informational' >&2\n")
+	opts := GenerateOptions{}
+	if err := runGenerator(opts.command(context.Background(), "protoc"), opts); err != nil {
+		t.Errorf("a warning failed the generator without FailOnWarning: %s", err)
+	}
+
+	opts.FailOnWarning = true
+	err := runGenerator(opts.command(context.Background(), "protoc"), opts)
+	if err == nil || !strings.Contains(err.Error(), "generator reported 1 warnings: search.proto:3:1: warning: Import empty.proto is unused.") {
+		t.Errorf("expected the warning to fail the generator, got %v", err)
+	}
+}
+
+func TestProtoPaths(t *testing.T) {
+	chdir(t, t.TempDir())
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := ProtoPaths("proto", []string{"shared", "", "./proto", filepath.Join(wd, "shared"), "vendor/../third_party", "third_party/", "google"})
+	want := []string{"proto", "shared", "vendor/../third_party", "google"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	opts := GenerateOptions{ImportPaths: []string{"shared", "proto"}, Proto3Optional: true}
+	if got := strings.Join(opts.protocArgs("proto"), " "); got != "--proto_path=proto --proto_path=shared "+Proto3OptionalFlag {
+		t.Errorf("got protoc arguments %q", got)
+	}
+}
+
+func TestProtocCommandWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	include := t.TempDir()
+	args := []string{
+		"--proto_path=" + dir,
+		"--proto_path=" + include,
+		"--plugin=protoc-gen-go=" + filepath.Join(dir, "bin", "protoc-gen-go"),
+		"--plugin=protoc-gen-twirp=protoc-gen-twirp",
+		"--go_out=paths=source_relative:" + filepath.Join(dir, "out"),
+		"--descriptor_set_out=" + filepath.Join(dir, "descriptor.pb"),
+		filepath.Join(dir, "search.proto"),
+	}
+
+	cmd := GenerateOptions{}.protocCommand(context.Background(), dir, args)
+	if cmd.Dir != dir {
+		t.Errorf("protoc runs in %s, want the protobuf directory %s", cmd.Dir, dir)
+	}
+	want := []string{
+		"--proto_path=.",
+		"--proto_path=" + include,
+		"--plugin=protoc-gen-go=" + filepath.Join("bin", "protoc-gen-go"),
+		"--plugin=protoc-gen-twirp=protoc-gen-twirp",
+		"--go_out=paths=source_relative:out",
+		"--descriptor_set_out=descriptor.pb",
+		"search.proto",
+	}
+	if got := cmd.Args[1:]; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("protoc args = %q, want %q", got, want)
+	}
+
+	cmd = GenerateOptions{WorkDir: include}.protocCommand(context.Background(), dir, args)
+	if cmd.Dir != include {
+		t.Errorf("protoc runs in %s, want the working directory %s", cmd.Dir, include)
+	}
+	if got := cmd.Args[1:3]; got[0] != "--proto_path="+dir || got[1] != "--proto_path=." {
+		t.Errorf("proto paths = %q, want those outside of the working directory to be absolute", got)
+	}
+
+	// Relative paths are resolved from the current working directory
+	chdir(t, dir)
+	if got := relativeArg("search.proto", include); got != filepath.Join(dir, "search.proto") {
+		t.Errorf("relativeArg = %q, want %q", got, filepath.Join(dir, "search.proto"))
+	}
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ResumeState records the services of a batch run that were generated successfully, so a failed run can be resumed
+type ResumeState struct {
+	Succeeded []string `json:"succeeded"`
+}
+
+// ResumeStatePath returns the path of the resume state of the run identified by key, kept in dir
+func ResumeStatePath(dir string, key string) string {
+	return filepath.Join(dir, fmt.Sprintf("proto-gen-resume-%s.json", key))
+}
+
+// ReadResumeState reads the resume state at path. An empty state is returned if there is none.
+func ReadResumeState(path string) (*ResumeState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ResumeState{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read resume state: %s", err.Error())
+	}
+
+	var state ResumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("cannot parse resume state '%s': %s", path, err.Error())
+	}
+	return &state, nil
+}
+
+// WriteResumeState writes state to path, creating its directory if needed
+func WriteResumeState(path string, state *ResumeState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode resume state: %s", err.Error())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|0755); err != nil {
+		return fmt.Errorf("cannot create resume state directory: %s", err.Error())
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write resume state: %s", err.Error())
+	}
+	return nil
+}
+
+// RemoveResumeState removes the resume state at path, if any
+func RemoveResumeState(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove resume state: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// generateRetryDelay is how long GenerateCode waits before each retry, multiplied by the number of the attempt
+const generateRetryDelay = time.Second
+
+// protoErrorPattern matches the diagnostics protoc reports in the protobufs it compiles, such as
+// "search.proto:3:1: Expected top-level statement" or "common.proto: File not found.". Generation failing with an
+// error among them fails the same way when retried
+var protoErrorPattern = regexp.MustCompile(`^\S+\.proto(:\d+:\d+)?: `)
+
+// transientPattern matches the failures that may not occur again when generating is retried: the generator or a plugin
+// was killed, timed out, could not reach the network or ran out of a resource
+var transientPattern = regexp.MustCompile(`(?i)(killed by signal|signal: (killed|terminated|interrupt)|timed out|timeout|` +
+	`deadline exceeded|connection (reset|refused)|network (is )?unreachable|temporary failure in name resolution|` +
+	`no such host|resource temporarily unavailable|too many open files|cannot allocate memory|out of memory)`)
+
+// permanentPattern matches the failures protoc reports about its command line and plugins that fail the same way when
+// retried, such as "protoc-gen-twirp: program not found or is not executable", "--twirp_out: protoc-gen-twirp: Plugin
+// failed with status code 1." or "Unknown flag: --twirp_opt"
+var permanentPattern = regexp.MustCompile(`(program not found|Plugin failed|Unknown flag)`)
+
+// generatorError is returned when the generator command fails, along with the error output it produced
+type generatorError struct {
+	msg    string
+	output string
+}
+
+func (e *generatorError) Error() string {
+	return e.msg
+}
+
+// wrapGeneratorError prefixes the message of err with prefix, keeping the error output of a generatorError
+func wrapGeneratorError(prefix string, err error) error {
+	if genErr, ok := err.(*generatorError); ok {
+		return &generatorError{msg: fmt.Sprintf("%s: %s", prefix, genErr.msg), output: genErr.output}
+	}
+	return fmt.Errorf("%s: %s", prefix, err.Error())
+}
+
+// isTransient returns true if err may not occur again when generating is retried: the generator failed with a known
+// transient failure, e.g. a plugin was killed or could not reach the network, and protoc reported neither an error in
+// the protobufs nor a missing or failing plugin. Errors running the generator at all, such as a missing binary, and any
+// other failure are not transient
+func isTransient(err error) bool {
+	genErr, ok := err.(*generatorError)
+	if !ok {
+		return false
+	}
+	transient := transientPattern.MatchString(genErr.msg)
+	for _, line := range strings.Split(genErr.output, "\n") {
+		if protoErrorPattern.MatchString(line) && !warningPattern.MatchString(line) || permanentPattern.MatchString(line) {
+			return false
+		}
+		transient = transient || transientPattern.MatchString(line)
+	}
+	return transient
+}
+
+// generateWithRetries runs generate, running it again up to opts.Retries times while it fails transiently. The partial
+// output of a failed attempt, every file in dir other than the protobufs, is removed before the next attempt
+func generateWithRetries(ctx context.Context, dir string, opts GenerateOptions, generate func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := generate()
+		if err == nil || attempt > opts.Retries || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		if opts.Logger != nil {
+			opts.Logger.Printf("Warning: Generation failed, retrying (%d of %d): %s", attempt, opts.Retries, err.Error())
+		}
+		if err := removeGeneratedFiles(dir); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * generateRetryDelay):
+		}
+	}
+}
+
+// removeGeneratedFiles removes every file in dir and its subdirectories other than the .proto files
+func removeGeneratedFiles(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(d.Name()) == ".proto" {
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot remove the output of the failed generation: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&generatorError{msg: "failed", output: "--twirp_out: protoc-gen-twirp: Plugin killed by signal 9.\n"}, true},
+		{&generatorError{msg: "failed", output: "search.proto:3:1: Expected top-level statement (e.g. \"message\").\n"}, false},
+		{&generatorError{msg: "failed", output: "common.proto: File not found.\n"}, false},
+		{&generatorError{msg: "failed", output: "search.proto:5:3: warning: Import common.proto is unused.\nconnection reset by peer\n"}, true},
+		{wrapGeneratorError("plugin 'twirp' failed", &generatorError{msg: "failed", output: "network unreachable\n"}), true},
+		{&generatorError{msg: "failed to run generator command: signal: killed", output: ""}, true},
+		{&generatorError{msg: "failed", output: "--grpc-web_out: context deadline exceeded\n"}, true},
+		{&generatorError{msg: "failed", output: "protoc-gen-twirp: fork/exec: resource temporarily unavailable\n"}, true},
+		{&generatorError{msg: "failed", output: "protoc-gen-twirp: program not found or is not executable\n"}, false},
+		{&generatorError{msg: "failed", output: "dial tcp: connection refused\n--twirp_out: protoc-gen-twirp: Plugin failed with status code 1.\n"}, false},
+		{&generatorError{msg: "failed", output: "Unknown flag: --twirp_opt\n"}, false},
+		{&generatorError{msg: "failed", output: "panic: runtime error: index out of range\n"}, false},
+		{errors.New("exec: \"protoc\": executable file not found in $PATH"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("isTransient(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateCodeRetries(t *testing.T) {
+	attempts := filepath.Join(t.TempDir(), "attempts")
+	fakeCommand(t, "protoc", `echo attempt >> `+attempts+`
+for a in "$@"; do case "$a" in --go_out=*) out=${a##*:};; esac; done
+if [ "$(wc -l < `+attempts+`)" -lt 2 ]; then
+  echo partial > "$out/partial.pb.go"
+  echo "--twirp_out: protoc-gen-twirp: Plugin killed by signal 9." >&2
+  exit 1
+fi
+echo generated > "$out/search.pb.go"
+`)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+
+	if err := GenerateCode(context.Background(), LanguageGo, "search", dir, GenerateOptions{Retries: 2}); err != nil {
+		t.Fatalf("the flaky generation was not retried: %s", err)
+	}
+	if data, _ := os.ReadFile(attempts); strings.Count(string(data), "attempt") != 2 {
+		t.Errorf("generated %d times, want 2", strings.Count(string(data), "attempt"))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partial.pb.go")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the output of the failed attempt was not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "search.proto")); err != nil {
+		t.Errorf("the protobuf was removed: %s", err)
+	}
+}
+
+func TestGenerateCodeNoRetryOfProtoErrors(t *testing.T) {
+	attempts := filepath.Join(t.TempDir(), "attempts")
+	fakeCommand(t, "protoc", `echo attempt >> `+attempts+`
+echo "search.proto:3:1: Expected top-level statement (e.g. \"message\")." >&2
+exit 1
+`)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+
+	if err := GenerateCode(context.Background(), LanguageGo, "search", dir, GenerateOptions{Retries: 3}); err == nil {
+		t.Fatal("the invalid protobuf was generated")
+	}
+	if data, _ := os.ReadFile(attempts); strings.Count(string(data), "attempt") != 1 {
+		t.Errorf("generated %d times, want an error in the protobufs not to be retried", strings.Count(string(data), "attempt"))
+	}
+}
+
+func TestGenerateCodeNoRetryOfMissingPlugin(t *testing.T) {
+	attempts := filepath.Join(t.TempDir(), "attempts")
+	fakeCommand(t, "protoc", `echo attempt >> `+attempts+`
+echo "protoc-gen-twirp: program not found or is not executable" >&2
+echo "Please specify a program using absolute path or make sure the program is available in your PATH system variable" >&2
+echo "--twirp_out: protoc-gen-twirp: Plugin failed with status code 1." >&2
+exit 1
+`)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+
+	err := GenerateCode(context.Background(), LanguageGo, "search", dir, GenerateOptions{Retries: 3})
+	if err == nil {
+		t.Fatal("generating without the plugin succeeded")
+	}
+	if data, _ := os.ReadFile(attempts); strings.Count(string(data), "attempt") != 1 {
+		t.Errorf("generated %d times, want a missing plugin not to be retried", strings.Count(string(data), "attempt"))
+	}
+}
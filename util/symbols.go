@@ -0,0 +1,65 @@
+package util
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+)
+
+// GoSymbols returns the package-level identifiers declared by the generated Go files in protoDir, keyed by the package
+// they are declared in. Packages are identified by their slash separated output directory and package name, so
+// symbols of two services collide only when their files are merged into the same package.
+func GoSymbols(protoDir string, opts CopyOptions) (map[string][]string, error) {
+	files, err := generatedFiles(protoDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make(map[string][]string)
+	fset := token.NewFileSet()
+	for _, f := range files {
+		if filepath.Ext(f.name) != ".go" {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, f.path, nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse generated file '%s': %s", f.name, err.Error())
+		}
+
+		pkg := path.Join(path.Dir(f.name), file.Name.Name)
+		symbols[pkg] = append(symbols[pkg], declaredSymbols(file)...)
+	}
+	return symbols, nil
+}
+
+// declaredSymbols returns the package-level identifiers declared in file. Methods, init functions and blank
+// identifiers never collide, and are omitted.
+func declaredSymbols(file *ast.File) []string {
+	var names []string
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.Name != "init" {
+				names = append(names, d.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						if n.Name != "_" {
+							names = append(names, n.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return names
+}
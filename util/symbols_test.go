@@ -0,0 +1,53 @@
+package util
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGoSymbols(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "search.pb.go", `package searchv1
+
+import "fmt"
+
+type QueryRequest struct{}
+
+func (q *QueryRequest) Reset() {}
+
+var (
+	File_search_proto = 1
+	_                 = fmt.Sprint
+)
+
+const Version, Revision = 1, 2
+
+func init() {}
+
+func NewSearchClient() {}
+`)
+	writeFile(t, protoDir, "v2/search.pb.go", "package searchv1\n\ntype QueryRequest struct{}\n")
+	writeFile(t, protoDir, "search.pb.json", "{}\n")
+
+	symbols, err := GoSymbols(protoDir, CopyOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, names := range symbols {
+		sort.Strings(names)
+	}
+	want := map[string][]string{
+		"searchv1":    {"File_search_proto", "NewSearchClient", "QueryRequest", "Revision", "Version"},
+		"v2/searchv1": {"QueryRequest"},
+	}
+	if !reflect.DeepEqual(symbols, want) {
+		t.Errorf("got %v, want %v", symbols, want)
+	}
+
+	writeFile(t, protoDir, "broken.pb.go", "package\n")
+	if _, err := GoSymbols(protoDir, CopyOptions{}); err == nil {
+		t.Error("an unparsable generated file was not reported")
+	}
+}
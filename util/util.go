@@ -1,14 +1,20 @@
 package util
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
 )
 
 const (
@@ -35,8 +41,71 @@ const (
 	ServiceTaskrunner    = "taskrunner"
 	ServiceUploads       = "uploads"
 	ServiceWarehouses    = "warehouses"
+
+	RPCFrameworkTwirp = "twirp"
+	RPCFrameworkGRPC  = "grpc"
+	RPCFrameworkNone  = "none"
+
+	// DefaultRPCFramework is the RPC framework code is generated for when none is given
+	DefaultRPCFramework = RPCFrameworkTwirp
+
+	// DefaultOrg is the Github organization that service repositories are cloned from
+	DefaultOrg = "asmahood"
+
+	// DefaultHost is the Github host that repositories are cloned from
+	DefaultHost = "github.com"
+
+	// DefaultMaxFileSize is the largest file, in bytes, that will be copied by default
+	DefaultMaxFileSize int64 = 50 * 1024 * 1024
 )
 
+// ServiceAll is the service value that selects every service with a protobuf defined
+const ServiceAll = "all"
+
+// services lists every known service, including those added by AddServices
+var services = []string{
+	ServiceAudit, ServiceAuthorization, ServiceCatalog, ServiceCategory, ServiceDataspec, ServiceExports, ServiceGrants,
+	ServiceJabba, ServiceOrganizations, ServiceParser, ServiceQuery, ServiceReferences, ServiceSearch, ServiceSources,
+	ServiceTaskrunner, ServiceUploads, ServiceWarehouses,
+}
+
+// KnownServices returns every known service, whether or not it has a protobuf defined
+func KnownServices() []string {
+	return append([]string(nil), services...)
+}
+
+// AllServices returns every service with a public protobuf defined, or a private protobuf if private is true
+func AllServices(private bool) []string {
+	var all []string
+	for _, svc := range services {
+		if (private && IsValidPrivateService(svc)) || (!private && IsValidPublicService(svc)) {
+			all = append(all, svc)
+		}
+	}
+	return all
+}
+
+// Languages returns every language that client code can be generated for
+func Languages() []string {
+	return []string{LanguageGo, LanguageRuby, LanguagePython, LanguageJava, LanguageJavascript}
+}
+
+// defaultLayouts are the conventional output directories of the generated code of each language, as templates rendered
+// with the service
+var defaultLayouts = map[string]string{
+	LanguageGo:         "pkg/{{.Service}}",
+	LanguageRuby:       "lib/rpc/{{.Service}}",
+	LanguagePython:     "{{.Service}}",
+	LanguageJava:       "src/main/java",
+	LanguageJavascript: "src/rpc/{{.Service}}",
+}
+
+// DefaultLayout returns the conventional output directory of code generated for language, a template such as
+// pkg/{{.Service}}. It is empty for unsupported languages
+func DefaultLayout(language string) string {
+	return defaultLayouts[language]
+}
+
 // IsValidLanguage returns true if lang is supported to generate client code. Returns false otherwise
 func IsValidLanguage(lang string) bool {
 	switch lang {
@@ -54,7 +123,7 @@ func IsValidPublicService(s string) bool {
 		ServiceQuery, ServiceReferences, ServiceSearch, ServiceSources, ServiceUploads, ServiceWarehouses:
 		return true
 	default:
-		return false
+		return indexed[s].Public
 	}
 }
 
@@ -65,19 +134,333 @@ func IsValidPrivateService(s string) bool {
 		ServiceOrganizations, ServiceQuery, ServiceReferences, ServiceSources, ServiceWarehouses, ServiceTaskrunner:
 		return true
 	default:
+		return indexed[s].Private
+	}
+}
+
+// cleanUpAttempts is the number of times CleanUpDirectories tries to remove a directory before giving up
+const cleanUpAttempts = 5
+
+// CleanUpDirectories removes dir and everything it contains. Removal is retried with a short backoff, since on Windows
+// a file cannot be removed while a handle to it is still open, e.g. by an exiting subprocess or a virus scanner.
+func CleanUpDirectories(dir string) error {
+	var err error
+	backoff := 50 * time.Millisecond
+	for attempt := 1; attempt <= cleanUpAttempts; attempt++ {
+		if err = os.RemoveAll(dir); err == nil {
+			return nil
+		}
+		if attempt < cleanUpAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("could not remove directory '%s': %s", dir, err.Error())
+}
+
+// resolvePath returns the absolute path of path with symbolic links resolved. path need not exist: the links of its
+// closest existing parent are resolved.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	missing := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, missing), nil
+		}
+		if filepath.Dir(dir) == dir {
+			return abs, nil
+		}
+		missing = filepath.Join(filepath.Base(dir), missing)
+	}
+}
+
+// PathsOverlap returns whether a and b are the same directory, or one is inside the other, once made absolute and
+// their symbolic links resolved
+func PathsOverlap(a string, b string) (bool, error) {
+	resolvedA, err := resolvePath(a)
+	if err != nil {
+		return false, fmt.Errorf("cannot resolve '%s': %s", a, err.Error())
+	}
+	resolvedB, err := resolvePath(b)
+	if err != nil {
+		return false, fmt.Errorf("cannot resolve '%s': %s", b, err.Error())
+	}
+	return within(resolvedA, resolvedB) || within(resolvedB, resolvedA), nil
+}
+
+// TempDirPrefix is the prefix of the temporary directories created in the temporary directory root, such as
+// os.TempDir(), that services are generated in. They are removed once done.
+const TempDirPrefix = "client-generation-"
+
+// TempDirOf returns the temporary directory of root that path is inside of, once made absolute and their symbolic links
+// resolved, or an empty string if there is none. root itself, its parents and other paths within it are not
+// temporary directories.
+func TempDirOf(path string, root string) (string, error) {
+	resolvedPath, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve '%s': %s", path, err.Error())
+	}
+	resolvedRoot, err := resolvePath(root)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve '%s': %s", root, err.Error())
+	}
+	if !within(resolvedPath, resolvedRoot) || resolvedPath == resolvedRoot {
+		return "", nil
+	}
+
+	rel, err := filepath.Rel(resolvedRoot, resolvedPath)
+	if err != nil {
+		return "", nil
+	}
+	first := strings.SplitN(rel, string(filepath.Separator), 2)[0]
+	if !strings.HasPrefix(first, TempDirPrefix) {
+		return "", nil
+	}
+	return filepath.Join(resolvedRoot, first), nil
+}
+
+// within returns whether path is dir or inside it. Both must be clean absolute paths
+func within(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ParseRepository splits a repository in the form org/name into its org and name. If no org is given, DefaultOrg is used.
+func ParseRepository(s string) (string, string) {
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return DefaultOrg, s
+}
+
+// CloneOptions configures how repositories are cloned
+type CloneOptions struct {
+	// Host is the Github host that repositories are cloned from. Defaults to DefaultHost
+	Host string
+
+	// Org is the Github organization that service repositories are cloned from. Defaults to DefaultOrg
+	Org string
+
+	// ServiceHosts and ServiceOrgs map services to the host and organization of their repository when they differ
+	// from Host and Org, such as services that live on another Github instance
+	ServiceHosts map[string]string
+	ServiceOrgs  map[string]string
+
+	// RepoNames maps services to the name of their repository when it differs from the service key
+	RepoNames map[string]string
+
+	// URLTemplate, if set, renders the URL repositories are cloned from with CloneURLData, instead of the SSH URL of
+	// Host. See ParseCloneURLTemplate
+	URLTemplate *template.Template
+
+	// service is the service the repository is cloned for, set by CloneService
+	service string
+
+	// Ref is the branch, tag or commit SHA checked out. Defaults to the default branch of the repository
+	Ref string
+
+	// Depth limits clones to this many commits of history. 0 clones the full history
+	Depth int
+
+	// RecurseSubmodules also clones the submodules of repositories, for protobufs defined in a submodule
+	RecurseSubmodules bool
+
+	// Filter is a git filter spec, e.g. blob:none, making clones partial. Omitted objects are fetched when checked out
+	Filter string
+
+	// CacheDir is a directory where clones are kept between runs. Cached clones are updated instead of cloned again
+	CacheDir string
+
+	// Offline forbids any network git operation, using the clones in CacheDir as they are
+	Offline bool
+
+	// Refresh always fetches cached clones, even of a commit already in the cache, pruning deleted refs and resetting
+	// them to the remote
+	Refresh bool
+
+	// MaxSize is the largest size in bytes a clone may grow to, including its git directory. Clones are aborted once
+	// they grow larger. 0 disables the limit
+	MaxSize int64
+
+	// HTTPProxy and HTTPSProxy are set as the proxies of the git subprocess. When empty, any proxy configured in the
+	// environment is used.
+	HTTPProxy  string
+	HTTPSProxy string
+}
+
+// env returns the environment of git subprocesses
+func (o CloneOptions) env() []string {
+	return append(os.Environ(), ProxyEnv(o.HTTPProxy, o.HTTPSProxy)...)
+}
+
+// ProxyEnv returns environment variables configuring httpProxy and httpsProxy as the proxies of a subprocess. Empty
+// proxies are omitted so that proxies already set in the environment are passed through.
+func ProxyEnv(httpProxy string, httpsProxy string) []string {
+	var env []string
+	if httpProxy != "" {
+		env = append(env, "HTTP_PROXY="+httpProxy, "http_proxy="+httpProxy)
+	}
+	if httpsProxy != "" {
+		env = append(env, "HTTPS_PROXY="+httpsProxy, "https_proxy="+httpsProxy)
+	}
+	return env
+}
+
+// host returns the Github host that repositories are cloned from
+func (o CloneOptions) host() string {
+	if o.Host == "" {
+		return DefaultHost
+	}
+	return o.Host
+}
+
+// cloneArgs returns the arguments of the git command cloning org/repo into dst
+func (o CloneOptions) cloneArgs(org string, repo string, dst string) []string {
+	args := []string{"clone"}
+
+	// A pinned commit may be anywhere in the history, so it is cloned in full and checked out afterwards
+	depth := o.Depth
+	if IsCommitSHA(o.Ref) {
+		depth = 0
+	} else if o.Ref != "" {
+		args = append(args, "--branch", o.Ref)
+	}
+
+	if depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", depth))
+	}
+	if o.Filter != "" {
+		args = append(args, "--filter="+o.Filter)
+	}
+	if o.RecurseSubmodules {
+		args = append(args, "--recurse-submodules")
+		if depth > 0 {
+			args = append(args, "--shallow-submodules")
+		}
+	}
+	return append(args, o.remoteURL(org, repo), dst)
+}
+
+// remoteURL returns the URL of org/repo on the host, rendered by URLTemplate when set, or its SSH URL
+func (o CloneOptions) remoteURL(org string, repo string) string {
+	if o.URLTemplate != nil {
+		// The template was checked to render by ParseCloneURLTemplate
+		url, err := renderCloneURL(o.URLTemplate, CloneURLData{Host: o.host(), Org: org, Service: o.service, Repo: repo})
+		if err == nil {
+			return url
+		}
+	}
+	return fmt.Sprintf("git@%s:%s/%s.git", o.host(), org, repo)
+}
+
+// ServiceRemote returns the host and organization of the repository holding service
+func (o CloneOptions) ServiceRemote(service string) (string, string) {
+	host := o.host()
+	if h, ok := o.ServiceHosts[service]; ok && h != "" {
+		host = h
+	}
+	org := o.Org
+	if so, ok := o.ServiceOrgs[service]; ok && so != "" {
+		org = so
+	}
+	if org == "" {
+		org = DefaultOrg
+	}
+	return host, org
+}
+
+// CloneRepository clones the Github repository org/repo from opts.Host into dir, returning the path it was cloned to.
+// Each clone is made in a new directory named after the repository with a unique suffix, so repositories of the same
+// name, or directories already in dir, do not collide. If opts.CacheDir is set, the repository is instead cloned into
+// or updated in the cache, and the cached path returned.
+func CloneRepository(ctx context.Context, org string, repo string, dir string, opts CloneOptions) (string, error) {
+	if opts.CacheDir != "" {
+		src, err := cachedRepository(ctx, org, repo, opts)
+		if err != nil {
+			return "", err
+		}
+		// An update of a cached clone can grow it past the limit as well
+		return src, opts.checkCloneSize(org, repo, src)
+	}
+	if opts.Offline {
+		return "", fmt.Errorf("cannot clone repository '%s/%s' offline without a cache directory", org, repo)
+	}
+
+	src, err := os.MkdirTemp(dir, repo+"-")
+	if err != nil {
+		return "", fmt.Errorf("cannot create clone directory for repository '%s/%s': %s", org, repo, err.Error())
+	}
+	if err := opts.runClone(ctx, org, repo, src); err != nil {
+		return "", err
+	}
+
+	// git clone can only check out branches and tags, so a pinned commit is checked out after cloning
+	if IsCommitSHA(opts.Ref) {
+		if err := opts.checkout(ctx, src); err != nil {
+			return "", fmt.Errorf("failed to check out repository '%s/%s': %s", org, repo, err.Error())
+		}
+	}
+
+	return src, nil
+}
+
+// IsCommitSHA returns true if ref looks like a full or abbreviated commit SHA rather than a branch or tag
+func IsCommitSHA(ref string) bool {
+	if len(ref) < 7 || len(ref) > 40 {
 		return false
 	}
+	for _, c := range ref {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkout checks out the commit opts.Ref in the clone at src, along with the matching commits of its submodules
+func (o CloneOptions) checkout(ctx context.Context, src string) error {
+	out, err := exec.CommandContext(ctx, "git", "-C", src, "checkout", "--quiet", "--force", "--detach", o.Ref).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot check out '%s': %s", o.Ref, strings.TrimSpace(string(out)))
+	}
+	return o.updateSubmodules(ctx, src)
 }
 
-func CleanUpDirectories(dir string) {
-	if err := os.RemoveAll(dir); err != nil {
-		log.Fatalf("Error: Could not remove directory '%s': %s", dir, err.Error())
+// updateSubmodules updates the submodules of the clone at src to the commits it records, if submodules are cloned
+func (o CloneOptions) updateSubmodules(ctx context.Context, src string) error {
+	if !o.RecurseSubmodules {
+		return nil
 	}
+
+	args := []string{"-C", src, "submodule", "update", "--init", "--recursive"}
+	if o.Depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", o.Depth))
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = o.env()
+	return cmd.Run()
 }
 
-func CloneService(service string, dir string) (string, error) {
-	src := filepath.Join(dir, service)
-	err := exec.Command("git", "clone", fmt.Sprintf("git@github.com:asmahood/%s.git", service), src).Run()
+// RepoName returns the name of the repository holding service. repoNames maps services whose repository is named
+// differently from their service key; any other service uses its key as the repository name.
+func RepoName(service string, repoNames map[string]string) string {
+	if repo, ok := repoNames[service]; ok && repo != "" {
+		return repo
+	}
+	return service
+}
+
+// CloneService clones the source repository of service into dir, returning the path it was cloned to
+func CloneService(ctx context.Context, service string, dir string, opts CloneOptions) (string, error) {
+	host, org := opts.ServiceRemote(service)
+	opts.Host = host
+	opts.service = service
+
+	src, err := CloneRepository(ctx, org, RepoName(service, opts.RepoNames), dir, opts)
 	if err != nil {
 		return "", fmt.Errorf("failed to clone service: %s", err.Error())
 	}
@@ -85,12 +468,57 @@ func CloneService(service string, dir string) (string, error) {
 	return src, nil
 }
 
-func CopyProtobuf(service string, serviceDir string, protoDir string, private bool) error {
+// checkFileSize returns an error if f is larger than maxSize bytes. A maxSize of 0 disables the check.
+func checkFileSize(f fs.DirEntry, maxSize int64) error {
+	if maxSize <= 0 {
+		return nil
+	}
+
+	info, err := f.Info()
+	if err != nil {
+		return fmt.Errorf("cannot read file info for '%s': %s", f.Name(), err.Error())
+	}
+
+	if info.Size() > maxSize {
+		return fmt.Errorf("file '%s' is %d bytes, which exceeds the maximum allowed size of %d bytes", f.Name(), info.Size(), maxSize)
+	}
+
+	return nil
+}
+
+// HasProtobufs returns true if the public (or private if private is true) protobuf directory in serviceProtoRoot holds
+// at least one .proto file. Returns false otherwise.
+func HasProtobufs(serviceProtoRoot string, private bool) bool {
+	scope := "public"
+	if private {
+		scope = "private"
+	}
+
+	files, err := os.ReadDir(filepath.Join(serviceProtoRoot, scope))
+	if err != nil {
+		return false
+	}
+
+	for _, f := range files {
+		if !f.IsDir() && filepath.Ext(f.Name()) == ".proto" {
+			return true
+		}
+	}
+	return false
+}
+
+// CopyProtobuf copies the public or private protobuf of service into protoDir. serviceProtoRoot is the directory holding
+// the service's public/ and private/ protobuf directories. The protobuf in the scope directory is copied as
+// <service>.proto, or if there are several, the one named after the service or else the first one is, and the others
+// keep their names. The .proto files of any packages in its subdirectories keep their relative paths, so imports of
+// other packages such as "messages/v1/messages.proto" still resolve. Protobufs in the character set encoding, e.g.
+// ISO-8859-1, are transcoded to UTF-8. An empty encoding is UTF-8.
+func CopyProtobuf(service string, serviceProtoRoot string, protoDir string, private bool, maxFileSize int64, encoding string) error {
 	serviceProtoDir := ""
 	if private {
-		serviceProtoDir = filepath.Join(serviceDir, "proto", "private")
+		serviceProtoDir = filepath.Join(serviceProtoRoot, "private")
 	} else {
-		serviceProtoDir = filepath.Join(serviceDir, "proto", "public")
+		serviceProtoDir = filepath.Join(serviceProtoRoot, "public")
 	}
 
 	files, err := os.ReadDir(serviceProtoDir)
@@ -98,64 +526,518 @@ func CopyProtobuf(service string, serviceDir string, protoDir string, private bo
 		return fmt.Errorf("failed to read service protobuf directory: %s", err.Error())
 	}
 
+	var protos []fs.DirEntry
 	for _, f := range files {
 		// Ignore any files that are not protobuf files
 		if filepath.Ext(f.Name()) != ".proto" {
 			continue
 		}
 
-		src, err := os.Open(filepath.Join(serviceProtoDir, f.Name()))
+		if err := checkFileSize(f, maxFileSize); err != nil {
+			return err
+		}
+		protos = append(protos, f)
+	}
+
+	// The protobuf named after the service, or else the first one, is the one compiled as <service>.proto
+	mainName := ""
+	for _, f := range protos {
+		if f.Name() == fmt.Sprintf("%s.proto", service) {
+			mainName = f.Name()
+		}
+	}
+	if mainName == "" && len(protos) > 0 {
+		mainName = protos[0].Name()
+	}
+
+	for _, f := range protos {
+		name := f.Name()
+		if name == mainName {
+			name = fmt.Sprintf("%s.proto", service)
+		}
+
+		dst := filepath.Join(protoDir, name)
+		if err := copyProtobufFile(filepath.Join(serviceProtoDir, f.Name()), dst); err != nil {
+			return err
+		}
+		if err := transcodeProtobuf(dst, encoding); err != nil {
+			return err
+		}
+	}
+
+	return copyProtobufPackages(serviceProtoDir, protoDir, maxFileSize, encoding)
+}
+
+// WriteProtobuf writes the protobuf read from r into protoDir as <service>.proto, in place of CopyProtobuf. A maxFileSize
+// of 0 disables the size limit. The protobuf is transcoded to UTF-8 from encoding like with CopyProtobuf.
+func WriteProtobuf(r io.Reader, service string, protoDir string, maxFileSize int64, encoding string) error {
+	if maxFileSize > 0 {
+		r = io.LimitReader(r, maxFileSize+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("cannot read protobuf: %s", err.Error())
+	}
+	if maxFileSize > 0 && int64(len(data)) > maxFileSize {
+		return fmt.Errorf("protobuf exceeds the maximum allowed size of %d bytes", maxFileSize)
+	}
+
+	path := filepath.Join(protoDir, fmt.Sprintf("%s.proto", service))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("cannot create protobuf file: %s", err.Error())
+	}
+	return transcodeProtobuf(path, encoding)
+}
+
+// copyProtobufPackages copies the .proto files in the subdirectories of serviceProtoDir to the same relative paths in
+// protoDir, transcoding them from encoding
+func copyProtobufPackages(serviceProtoDir string, protoDir string, maxFileSize int64, encoding string) error {
+	return filepath.WalkDir(serviceProtoDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return fmt.Errorf("cannot open source protobuf file: %s", err.Error())
+			return fmt.Errorf("failed to read service protobuf directory: %s", err.Error())
+		}
+		if d.IsDir() || filepath.Ext(d.Name()) != ".proto" || filepath.Dir(path) == serviceProtoDir {
+			return nil
 		}
-		defer src.Close()
 
-		dst, err := os.Create(filepath.Join(protoDir, fmt.Sprintf("%s.proto", service)))
+		if err := checkFileSize(d, maxFileSize); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(serviceProtoDir, path)
 		if err != nil {
-			return fmt.Errorf("cannot create protobuf file: %s", err.Error())
+			return err
+		}
+		dst := filepath.Join(protoDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("cannot create protobuf package directory: %s", err.Error())
+		}
+		if err := copyProtobufFile(path, dst); err != nil {
+			return err
 		}
-		defer dst.Close()
+		return transcodeProtobuf(dst, encoding)
+	})
+}
 
-		_, err = io.Copy(dst, src)
+// ProtoFiles returns the paths of the .proto files in protoDir and its subdirectories, in lexical order
+func ProtoFiles(protoDir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(protoDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return fmt.Errorf("cannot copy protobuf file: %s", err)
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(d.Name()) == ".proto" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protobuf directory: %s", err.Error())
+	}
+	return files, nil
+}
+
+// protoInputs returns the protobufs of service in dir that code is generated from: <service>.proto followed by the
+// protobufs of any other packages copied alongside it
+func protoInputs(service string, dir string) ([]string, error) {
+	files, err := ProtoFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	main := filepath.Join(dir, fmt.Sprintf("%s.proto", service))
+	inputs := []string{main}
+	for _, f := range files {
+		if f != main {
+			inputs = append(inputs, f)
 		}
 	}
+	return inputs, nil
+}
 
+// copyProtobufFile copies the protobuf src to dst, verifying that the sha256 of the copy matches what was read from src.
+// Both files are closed before returning so that no handles are left open on the temporary directory.
+func copyProtobufFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("cannot open source protobuf file: %s", err.Error())
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("cannot create protobuf file: %s", err.Error())
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(out, io.TeeReader(in, h)); err != nil {
+		return fmt.Errorf("cannot copy protobuf file: %s", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("cannot copy protobuf file: %s", err.Error())
+	}
+
+	// Re-read the copy, so that a write cut short, e.g. on a network filesystem, is not compiled as a truncated protobuf
+	sum, err := FileSHA256(dst)
+	if err != nil {
+		return fmt.Errorf("cannot verify copied protobuf file: %s", err.Error())
+	}
+	if expected := hex.EncodeToString(h.Sum(nil)); sum != expected {
+		return fmt.Errorf("copied protobuf file '%s' is corrupt, its sha256 %s does not match %s of the source '%s'", filepath.Base(dst), sum, expected, src)
+	}
 	return nil
 }
 
-func goGenerateCmd(service string, dir string) *exec.Cmd {
-	return exec.Command("protoc", fmt.Sprintf("--twirp_out=paths=source_relative:%s", dir), fmt.Sprintf("--go_out=paths=source_relative:%s", dir), fmt.Sprintf("--proto_path=%s", dir), filepath.Join(dir, fmt.Sprintf("%s.proto", service)))
+// plugin is a protoc code generation plugin, passed to protoc as --<name>_out=<opts>:<dir>
+type plugin struct {
+	name string
+	opts string
 }
 
-func rubyGenerateCmd(service string, dir string) *exec.Cmd {
-	return exec.Command("protoc", fmt.Sprintf("--proto_path=%s", dir), fmt.Sprintf("--twirp_ruby_out=%s", dir), fmt.Sprintf("--ruby_out=%s", dir), filepath.Join(dir, fmt.Sprintf("%s.proto", service)))
+// arg returns the protoc argument running the plugin, with extra appended to its default options
+func (p plugin) arg(dir string, extra []string) string {
+	opts := extra
+	if p.opts != "" {
+		opts = append([]string{p.opts}, extra...)
+	}
+
+	if len(opts) == 0 {
+		return fmt.Sprintf("--%s_out=%s", p.name, dir)
+	}
+	return fmt.Sprintf("--%s_out=%s:%s", p.name, strings.Join(opts, ","), dir)
 }
 
-func pythonGenerateCmd(service string, dir string) *exec.Cmd {
-	return exec.Command("protoc", fmt.Sprintf("--proto_path=%s", dir), fmt.Sprintf("--twirpy_out=%s", dir), fmt.Sprintf("--python_out=%s", dir), filepath.Join(dir, fmt.Sprintf("%s.proto", service)))
+// messagePlugins holds the protoc plugin used to generate the message types of each language
+var messagePlugins = map[string]plugin{
+	LanguageGo:         {"go", "paths=source_relative"},
+	LanguageRuby:       {"ruby", ""},
+	LanguagePython:     {"python", ""},
+	LanguageJava:       {"java", ""},
+	LanguageJavascript: {"js", "import_style=commonjs,binary"},
 }
 
-func javascriptGenerateCmd(service string, dir string) *exec.Cmd {
-	return exec.Command("protoc", fmt.Sprintf("--proto_path=%s", dir), fmt.Sprintf("--twirp_js_out=%s", dir), fmt.Sprintf("--js_out=import_style=commonjs,binary:%s", dir), filepath.Join(dir, fmt.Sprintf("%s.proto", service)))
+// rpcPlugins holds the protoc plugin used to generate RPC code for each language supported by an RPC framework
+var rpcPlugins = map[string]map[string]plugin{
+	RPCFrameworkTwirp: {
+		LanguageGo:         {"twirp", "paths=source_relative"},
+		LanguageRuby:       {"twirp_ruby", ""},
+		LanguagePython:     {"twirpy", ""},
+		LanguageJavascript: {"twirp_js", ""},
+	},
+	RPCFrameworkGRPC: {
+		LanguageGo:         {"go-grpc", "paths=source_relative"},
+		LanguageRuby:       {"grpc", ""},
+		LanguagePython:     {"grpc_python", ""},
+		LanguageJava:       {"grpc-java", ""},
+		LanguageJavascript: {"grpc-web", "import_style=commonjs"},
+	},
 }
 
-func GenerateCode(language string, service string, dir string) error {
-	var protocCmd *exec.Cmd
-	switch language {
-	case LanguageGo:
-		protocCmd = goGenerateCmd(service, dir)
-	case LanguageRuby:
-		protocCmd = rubyGenerateCmd(service, dir)
-	case LanguagePython:
-		protocCmd = pythonGenerateCmd(service, dir)
-	case LanguageJavascript:
-		protocCmd = javascriptGenerateCmd(service, dir)
-	default:
-		return errors.New("no command has been implemented for this language")
+// gatewayPlugin generates the grpc-gateway reverse proxies of Go gRPC services
+var gatewayPlugin = plugin{"grpc-gateway", "paths=source_relative"}
+
+// streamingPluginOpts holds the options of RPC plugins that only generate streaming-capable clients when asked to,
+// keyed by plugin name. The other plugins either always support streaming RPCs (grpc) or never do (twirp).
+var streamingPluginOpts = map[string]struct{ streaming, unary string }{
+	// grpc-web only supports server streaming in its grpcwebtext mode
+	"grpc-web": {streaming: "mode=grpcwebtext", unary: "mode=grpcweb"},
+}
+
+// SupportedRPCFrameworks returns the RPC frameworks that code can be generated with for language, in sorted order
+func SupportedRPCFrameworks(language string) []string {
+	frameworks := []string{RPCFrameworkNone}
+	for framework, plugins := range rpcPlugins {
+		if _, ok := plugins[language]; ok {
+			frameworks = append(frameworks, framework)
+		}
+	}
+	sort.Strings(frameworks)
+	return frameworks
+}
+
+// rpcPlugin returns the plugin generating RPC code for language with framework. A nil plugin is returned for
+// RPCFrameworkNone.
+func rpcPlugin(language string, framework string) (*plugin, error) {
+	if framework == RPCFrameworkNone {
+		return nil, nil
+	}
+
+	plugins, ok := rpcPlugins[framework]
+	if !ok {
+		return nil, fmt.Errorf("unknown RPC framework '%s'. Valid values are: %s, %s, %s", framework, RPCFrameworkTwirp, RPCFrameworkGRPC, RPCFrameworkNone)
+	}
+
+	p, ok := plugins[language]
+	if !ok {
+		return nil, fmt.Errorf("the '%s' RPC framework does not support '%s'. Supported frameworks for '%s' are: %s", framework, language, language, strings.Join(SupportedRPCFrameworks(language), ", "))
+	}
+	return &p, nil
+}
+
+// ValidateRPCFramework returns an error if code cannot be generated for language using the RPC framework
+func ValidateRPCFramework(language string, framework string) error {
+	_, err := rpcPlugin(language, framework)
+	return err
+}
+
+// Logger receives the output of the commands that are run
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// GenerateOptions configures how client code is generated
+type GenerateOptions struct {
+	// Logger receives the output of protoc. If nil, the output is discarded
+	Logger Logger
+
+	// RPCFramework is the framework RPC code is generated for. Defaults to DefaultRPCFramework
+	RPCFramework string
+
+	// MessagesOnly generates only the message types, omitting every RPC plugin
+	MessagesOnly bool
+
+	// PluginOpts holds extra options appended to the output options of a plugin, keyed by plugin name (e.g. go, twirp)
+	PluginOpts map[string][]string
+
+	// ToolchainDir is a directory holding pinned protoc and plugin binaries. It is searched for protoc first, and
+	// prepended to the PATH of the subprocess so protoc finds the pinned plugins
+	ToolchainDir string
+
+	// DockerImage is a Docker image providing protoc and its plugins. When set, protoc is run in a container of the
+	// image with the directories it uses mounted, instead of on the host
+	DockerImage string
+
+	// ImportPaths are extra directories imports of the protobufs are resolved from, after the protobuf directory
+	ImportPaths []string
+
+	// Env holds KEY=VALUE environment variables added to the environment of protoc and its plugins
+	Env []string
+
+	// PluginPaths maps plugin names (e.g. go, twirp) to the binary protoc runs for the plugin, for plugins not
+	// installed as protoc-gen-<name> on the PATH
+	PluginPaths map[string]string
+
+	// NoStreaming generates unary-only clients from plugins that can also generate streaming-capable clients. See
+	// streamingPluginOpts
+	NoStreaming bool
+
+	// FailOnWarning fails generation when protoc reports warnings
+	FailOnWarning bool
+
+	// SeparatePlugins runs each plugin in its own protoc invocation instead of all of them in one, so that errors can
+	// be attributed to the plugin that produced them
+	SeparatePlugins bool
+
+	// SplitByProto generates the code of each protobuf in its own protoc invocation, into a subdirectory of the output
+	// named after the protobuf. See SplitName
+	SplitByProto bool
+
+	// GRPCGateway also runs the grpc-gateway plugin, generating reverse proxies serving the gRPC services over REST
+	// (.pb.gw.go). Only supported for Go with RPCFrameworkGRPC
+	GRPCGateway bool
+
+	// WorkDir is the working directory of protoc, for plugins that resolve paths from it. Defaults to the protobuf
+	// directory
+	WorkDir string
+
+	// Retries is the number of times GenerateCode is run again when it fails transiently, e.g. when a plugin crashes,
+	// rather than because of an error in the protobufs
+	Retries int
+
+	// Proto3Optional passes Proto3OptionalFlag to protoc, allowing proto3 optional fields in protoc 3.12 to 3.14
+	Proto3Optional bool
+
+	// DescriptorSetIn is a FileDescriptorSet of the protobufs compiled with CompileDescriptorSet. protoc reads the
+	// protobufs from it rather than parsing them again
+	DescriptorSetIn string
+}
+
+// rpcFramework returns the RPC framework to generate code for
+func (o GenerateOptions) rpcFramework() string {
+	if o.RPCFramework == "" {
+		return DefaultRPCFramework
+	}
+	return o.RPCFramework
+}
+
+// command returns a command running the binary name, resolved from the toolchain directory if one is configured.
+// protoc is run in the opts.DockerImage container instead when one is configured.
+func (o GenerateOptions) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if o.DockerImage != "" && name == "protoc" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			cwd = os.TempDir()
+		}
+		return o.dockerCommand(ctx, args, cwd)
+	}
+	if o.ToolchainDir == "" && len(o.Env) == 0 {
+		return exec.CommandContext(ctx, name, args...)
+	}
+
+	path := name
+	env := os.Environ()
+	if o.ToolchainDir != "" {
+		if p, err := exec.LookPath(filepath.Join(o.ToolchainDir, name)); err == nil {
+			path = p
+		}
+		env = append(env, "PATH="+o.ToolchainDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(env, o.Env...)
+	return cmd
+}
+
+// ValidateEnv checks that every entry of env is in the form KEY=VALUE
+func ValidateEnv(env []string) error {
+	for _, e := range env {
+		if i := strings.Index(e, "="); i <= 0 {
+			return fmt.Errorf("Invalid environment variable '%s', expected KEY=VALUE", e)
+		}
+	}
+	return nil
+}
+
+// generatePlugins returns the protoc plugins generating the code of language
+func generatePlugins(language string, opts GenerateOptions) ([]plugin, error) {
+	messages, ok := messagePlugins[language]
+	if !ok {
+		return nil, errors.New("no command has been implemented for this language")
+	}
+
+	plugins := []plugin{messages}
+	if !opts.MessagesOnly {
+		rpc, err := rpcPlugin(language, opts.rpcFramework())
+		if err != nil {
+			return nil, err
+		}
+		if rpc != nil {
+			plugins = append(plugins, *rpc)
+		}
+	}
+	if opts.GRPCGateway {
+		plugins = append(plugins, gatewayPlugin)
+	}
+	return plugins, nil
+}
+
+// ValidateGRPCGateway returns an error if grpc-gateway reverse proxies cannot be generated for language with the RPC
+// framework
+func ValidateGRPCGateway(language string, framework string, messagesOnly bool) error {
+	if language != LanguageGo {
+		return fmt.Errorf("grpc-gateway code cannot be generated for '%s'", language)
+	}
+	if messagesOnly || framework != RPCFrameworkGRPC {
+		return fmt.Errorf("grpc-gateway code can only be generated along with the '%s' RPC framework", RPCFrameworkGRPC)
+	}
+	return nil
+}
+
+// generateCmd returns a protoc command running plugins on the inputs among the protobufs in dir, with their output in
+// outDir
+func generateCmd(ctx context.Context, plugins []plugin, inputs []string, dir string, outDir string, opts GenerateOptions) *exec.Cmd {
+	args := opts.protocArgs(dir)
+	for _, p := range plugins {
+		args = append(args, opts.pluginArgs(p, outDir)...)
 	}
+	args = append(args, inputs...)
 
+	return opts.protocCommand(ctx, dir, args)
+}
+
+func openAPIGenerateCmd(ctx context.Context, inputs []string, dir string, opts GenerateOptions) *exec.Cmd {
+	args := append(opts.protocArgs(dir), opts.pluginArgs(plugin{name: "openapiv2"}, dir)...)
+	args = append(args, inputs...)
+	return opts.protocCommand(ctx, dir, args)
+}
+
+// GenerateCode generates the client code of service for language into dir. Generation failing transiently is retried
+// up to opts.Retries times
+func GenerateCode(ctx context.Context, language string, service string, dir string, opts GenerateOptions) error {
+	plugins, err := generatePlugins(language, opts)
+	if err != nil {
+		return err
+	}
+	inputs, err := protoInputs(service, dir)
+	if err != nil {
+		return err
+	}
+
+	return generateWithRetries(ctx, dir, opts, func() error {
+		if !opts.SplitByProto {
+			return generateInputs(ctx, plugins, inputs, dir, dir, opts)
+		}
+
+		// Each protobuf is generated on its own into a subdirectory named after it
+		split := make(map[string]string)
+		for _, input := range inputs {
+			name := SplitName(input)
+			if other, ok := split[name]; ok {
+				return fmt.Errorf("the protobufs '%s' and '%s' would both be generated into '%s'", other, input, name)
+			}
+			split[name] = input
+
+			outDir := filepath.Join(dir, name)
+			if err := os.MkdirAll(outDir, os.ModeDir|0755); err != nil {
+				return fmt.Errorf("cannot create output directory of protobuf '%s': %s", name, err.Error())
+			}
+			if err := generateInputs(ctx, plugins, []string{input}, dir, outDir, opts); err != nil {
+				return wrapGeneratorError(fmt.Sprintf("protobuf '%s'", name), err)
+			}
+		}
+		return nil
+	})
+}
+
+// SplitName returns the name of the subdirectory the code of the protobuf at path is generated into with
+// GenerateOptions.SplitByProto: its file name without the .proto extension
+func SplitName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".proto")
+}
+
+// generateInputs runs plugins on the inputs among the protobufs in dir, with their output in outDir
+func generateInputs(ctx context.Context, plugins []plugin, inputs []string, dir string, outDir string, opts GenerateOptions) error {
+	if !opts.SeparatePlugins {
+		return runGenerator(generateCmd(ctx, plugins, inputs, dir, outDir, opts), opts)
+	}
+
+	// Run each plugin in its own protoc invocation, so that output and failures are attributed to the plugin
+	for _, p := range plugins {
+		pluginOpts := opts
+		if opts.Logger != nil {
+			pluginOpts.Logger = prefixLogger{prefix: fmt.Sprintf("[%s] ", p.name), logger: opts.Logger}
+		}
+		if err := runGenerator(generateCmd(ctx, []plugin{p}, inputs, dir, outDir, opts), pluginOpts); err != nil {
+			return wrapGeneratorError(fmt.Sprintf("plugin '%s' failed", p.name), err)
+		}
+	}
+	return nil
+}
+
+// prefixLogger prefixes every message logged to logger
+type prefixLogger struct {
+	prefix string
+	logger Logger
+}
+
+func (l prefixLogger) Printf(format string, v ...interface{}) {
+	l.logger.Printf(l.prefix+format, v...)
+}
+
+// GenerateOpenAPI generates an OpenAPI v2 specification for service into dir using the grpc-gateway openapiv2 plugin
+func GenerateOpenAPI(ctx context.Context, service string, dir string, opts GenerateOptions) error {
+	inputs, err := protoInputs(service, dir)
+	if err != nil {
+		return err
+	}
+	return runGenerator(openAPIGenerateCmd(ctx, inputs, dir, opts), opts)
+}
+
+// runGenerator runs protocCmd to completion, logging any output it produces to opts.Logger. With opts.FailOnWarning,
+// warnings in its error output fail the command.
+func runGenerator(protocCmd *exec.Cmd, opts GenerateOptions) error {
+	logger := opts.Logger
 	out, err := protocCmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to pipe command output: %s", err.Error())
@@ -170,60 +1052,421 @@ func GenerateCode(language string, service string, dir string) error {
 		return fmt.Errorf("failed to start client generator: %s", err.Error())
 	}
 
-	logs, err := ioutil.ReadAll(out)
+	logs, err := io.ReadAll(out)
 	if err != nil {
 		return fmt.Errorf("failed to read output from command: %s", err.Error())
-	} else if len(logs) > 0 {
-		log.Printf("\n\n%s\n\n", logs)
+	} else if len(logs) > 0 && logger != nil {
+		logger.Printf("\n\n%s\n\n", logs)
 	}
 
 	logs, err = io.ReadAll(errOut)
 	if err != nil {
 		return fmt.Errorf("failed to read error from command: %s", err.Error())
-	} else if len(logs) > 0 {
-		log.Printf("Generator encountered error:\n\n%s\n", logs)
+	} else if len(logs) > 0 && logger != nil {
+		logger.Printf("Generator encountered error:\n\n%s\n", logs)
 	}
 
 	err = protocCmd.Wait()
 	if err != nil {
-		return fmt.Errorf("failed to run generator command: %s", err.Error())
+		return &generatorError{msg: fmt.Sprintf("failed to run generator command: %s", err.Error()), output: string(logs)}
+	}
+
+	if opts.FailOnWarning {
+		if warnings := protocWarnings(logs); len(warnings) > 0 {
+			return fmt.Errorf("generator reported %d warnings: %s", len(warnings), strings.Join(warnings, "; "))
+		}
+	}
+
+	return nil
+}
+
+// CopyFile copies the file at src to dst, creating the parent directories of dst if needed
+func CopyFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("cannot create directory for '%s': %s", dst, err.Error())
+	}
+	_, err := copyFile(src, dst, nil, nil)
+	return err
+}
+
+// copyBufferSize is the size of the buffer files are copied through
+const copyBufferSize = 128 * 1024
+
+// copyFile copies the file at src to dst, preserving its mode, and returns the number of bytes written. prefix is
+// written before the contents of src, and everything written is also written to hash when it is not nil. The copy is
+// written to a temporary file beside dst that is renamed over dst once complete, so a failed copy never leaves a
+// partial dst behind.
+func copyFile(src string, dst string, prefix []byte, hash io.Writer) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open '%s': %s", src, err.Error())
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("cannot stat '%s': %s", src, err.Error())
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dst), fmt.Sprintf(".%s.tmp-*", filepath.Base(dst)))
+	if err != nil {
+		return 0, fmt.Errorf("cannot create '%s': %s", dst, err.Error())
+	}
+	tmp := out.Name()
+	fail := func(err error) (int64, error) {
+		out.Close()
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	w := io.Writer(out)
+	if hash != nil {
+		w = io.MultiWriter(out, hash)
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return fail(fmt.Errorf("cannot write '%s': %s", dst, err.Error()))
+	}
+	n, err := io.CopyBuffer(w, in, make([]byte, copyBufferSize))
+	n += int64(len(prefix))
+	if err != nil {
+		return fail(fmt.Errorf("cannot copy '%s' to '%s': %s", src, dst, err.Error()))
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		return fail(fmt.Errorf("cannot set the mode of '%s': %s", dst, err.Error()))
+	}
+	if err := out.Sync(); err != nil {
+		return fail(fmt.Errorf("cannot write '%s': %s", dst, err.Error()))
+	}
+	if err := out.Close(); err != nil {
+		return fail(fmt.Errorf("cannot write '%s': %s", dst, err.Error()))
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("cannot replace '%s': %s", dst, err.Error())
+	}
+	return n, nil
+}
+
+// CopyOptions configures how generated files are copied to the output
+type CopyOptions struct {
+	// MaxFileSize is the largest file in bytes that will be copied. 0 disables the limit
+	MaxFileSize int64
+
+	// TrimPrefix is a slash separated directory prefix removed from the path of generated files in the output, e.g.
+	// github.com/org/repo for Go code generated under its import path
+	TrimPrefix string
+
+	// IncludeProto also copies the .proto files the code was generated from
+	IncludeProto bool
+
+	// Banner is prepended to every generated file with a known comment syntax, as a comment. See BannerComment
+	Banner string
+
+	// ChangedOnly only writes the generated files that differ from the output, leaving identical files untouched
+	ChangedOnly bool
+
+	// Extensions, if given, are the only extensions of generated files that are copied, e.g. .go. Files with one of the
+	// ExcludeExtensions are never copied, e.g. stray .log files dropped by a plugin
+	Extensions        []string
+	ExcludeExtensions []string
+
+	// Mode, if not 0, is the permission bits set on every copied file, and Owner, if not nil, the user and group they
+	// are owned by, so that steps running as another user can read and modify them
+	Mode  os.FileMode
+	Owner *FileOwner
+}
+
+// generatedFile is a file generated into the protobuf directory
+type generatedFile struct {
+	// path is the location of the file in the protobuf directory
+	path string
+
+	// name is the slash separated path of the file relative to the output directory
+	name string
+
+	entry fs.DirEntry
+}
+
+// GeneratedFiles returns the slash separated paths, relative to the output, of the generated files in protoDir that
+// would be copied to the output
+func GeneratedFiles(protoDir string, opts CopyOptions) ([]string, error) {
+	files, err := generatedFiles(protoDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.name)
+	}
+	return names, nil
+}
+
+// DropGeneratedFiles removes the generated files in protoDir named by names, as returned by GeneratedFiles, so that they
+// are not copied to the output
+func DropGeneratedFiles(protoDir string, names []string, opts CopyOptions) error {
+	files, err := generatedFiles(protoDir, opts)
+	if err != nil {
+		return err
 	}
 
+	drop := make(map[string]bool, len(names))
+	for _, name := range names {
+		drop[name] = true
+	}
+	for _, f := range files {
+		if !drop[f.name] {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return fmt.Errorf("cannot remove generated file '%s': %s", f.name, err.Error())
+		}
+	}
 	return nil
 }
 
-func CopyGeneratedFiles(protoDir string, outputPath string) error {
-	cwd, err := os.Getwd()
+// OutputFile describes the file name already in outputPath, as it would be recorded in a manifest
+func OutputFile(outputPath string, name string) (CopiedFile, error) {
+	path := filepath.Join(outputPath, filepath.FromSlash(name))
+	info, err := os.Stat(path)
+	if err != nil {
+		return CopiedFile{}, fmt.Errorf("cannot read '%s' of the output: %s", name, err.Error())
+	}
+	sha, err := FileSHA256(path)
 	if err != nil {
-		return fmt.Errorf("cannot locate current working directory: %s", err)
+		return CopiedFile{}, fmt.Errorf("cannot read '%s' of the output: %s", name, err.Error())
 	}
+	return CopiedFile{Name: name, Size: info.Size(), SHA256: sha, Status: FileUnchanged}, nil
+}
 
-	files, err := os.ReadDir(protoDir)
+// ListGeneratedFiles describes the generated files in protoDir that would be copied to outputPath, including how they
+// would change it, without copying them. With opts.ChangedOnly, files that would be unchanged are omitted
+func ListGeneratedFiles(protoDir string, outputPath string, opts CopyOptions) ([]CopiedFile, error) {
+	files, err := generatedFiles(protoDir, opts)
 	if err != nil {
-		return fmt.Errorf("failed to read protobuf directory: %s", err.Error())
+		return nil, err
 	}
 
+	listed := make([]CopiedFile, 0, len(files))
 	for _, f := range files {
-		// Do not copy any .proto files to the output
-		if filepath.Ext(f.Name()) == ".proto" {
+		if err := checkFileSize(f.entry, opts.MaxFileSize); err != nil {
+			return nil, err
+		}
+
+		c := CopiedFile{Name: f.name}
+		c.SHA256, c.Size, err = generatedFileSHA256(f.path, BannerComment(f.name, opts.Banner))
+		if err != nil {
+			return nil, err
+		}
+		c.Status = fileStatus(filepath.Join(outputPath, filepath.FromSlash(f.name)), c.SHA256)
+		if opts.ChangedOnly && c.Status == FileUnchanged {
 			continue
 		}
+		listed = append(listed, c)
+	}
+	return listed, nil
+}
+
+// generatedFileSHA256 returns the hex encoded sha256 and size of the generated file at path as it would be copied to
+// the output after banner
+func generatedFileSHA256(path string, banner []byte) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot open '%s': %s", path, err.Error())
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	h.Write(banner)
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot read '%s': %s", path, err.Error())
+	}
+	return hex.EncodeToString(h.Sum(nil)), n + int64(len(banner)), nil
+}
+
+// fileStatus returns how writing a file with the hex encoded sha256 to dst changes it
+func fileStatus(dst string, sha string) FileStatus {
+	previous, err := FileSHA256(dst)
+	switch {
+	case err != nil:
+		return FileCreated
+	case previous == sha:
+		return FileUnchanged
+	default:
+		return FileUpdated
+	}
+}
 
-		src, err := os.Open(filepath.Join(protoDir, f.Name()))
+// trimPrefix removes the directory prefix from the slash separated path name. Paths outside of prefix are unchanged.
+func trimPrefix(name string, prefix string) string {
+	prefix = strings.Trim(filepath.ToSlash(prefix), "/")
+	if prefix == "" {
+		return name
+	}
+	return strings.TrimPrefix(name, prefix+"/")
+}
+
+func generatedFiles(protoDir string, opts CopyOptions) ([]generatedFile, error) {
+	var generated []generatedFile
+	sources := make(map[string]string)
+	err := filepath.WalkDir(protoDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return fmt.Errorf("failed to open generated file: %s", err.Error())
+			return err
 		}
 
-		dst, err := os.Create(filepath.Join(cwd, outputPath, f.Name()))
+		// Do not copy any .proto files to the output, unless they were requested, or files of other extensions
+		if d.IsDir() || !copiedExtension(d.Name(), opts) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(protoDir, path)
 		if err != nil {
-			return fmt.Errorf("failed to create generated file in output: %s", err.Error())
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		// Trimming the prefix must not map two generated files onto the same output path
+		name := trimPrefix(rel, opts.TrimPrefix)
+		if other, ok := sources[name]; ok {
+			return fmt.Errorf("generated files '%s' and '%s' both map to '%s' after trimming prefix '%s'", other, rel, name, opts.TrimPrefix)
 		}
+		sources[name] = rel
+
+		generated = append(generated, generatedFile{path: path, name: name, entry: d})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protobuf directory: %s", err.Error())
+	}
+
+	// Trimming a prefix can reorder the files, which are copied and recorded in the order of their output names
+	sort.Slice(generated, func(i, j int) bool { return generated[i].name < generated[j].name })
+	return generated, nil
+}
+
+// FileStatus describes how copying a generated file changed the output
+type FileStatus string
+
+const (
+	FileCreated   FileStatus = "created"
+	FileUpdated   FileStatus = "updated"
+	FileUnchanged FileStatus = "unchanged"
+)
+
+// CopiedFile describes a generated file copied to the output
+type CopiedFile struct {
+	// Name is the slash separated path of the file relative to the output
+	Name   string
+	Size   int64
+	SHA256 string
+	Status FileStatus
+}
+
+// FileSHA256 returns the hex encoded sha256 of the file at path
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
 
-		_, err = io.Copy(dst, src)
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CopyGeneratedFiles copies the generated files in protoDir to outputPath, returning a description of each copied file
+func CopyGeneratedFiles(protoDir string, outputPath string, opts CopyOptions) ([]CopiedFile, error) {
+	files, err := generatedFiles(protoDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := make([]CopiedFile, 0, len(files))
+	for _, f := range files {
+		if err := checkFileSize(f.entry, opts.MaxFileSize); err != nil {
+			return nil, err
+		}
+
+		dst := filepath.Join(outputPath, filepath.FromSlash(f.name))
+		c, err := copyGeneratedFile(f.path, dst, BannerComment(f.name, opts.Banner), opts.ChangedOnly)
 		if err != nil {
-			return fmt.Errorf("failed to copy generated file to output: %s", err.Error())
+			return nil, err
 		}
+		if err := setPermissions(dst, opts); err != nil {
+			return nil, err
+		}
+		c.Name = f.name
+		copied = append(copied, c)
 	}
 
-	return nil
+	return copied, nil
+}
+
+// commentPrefixes holds the line comment syntax of generated files, keyed by extension
+var commentPrefixes = map[string]string{
+	".go": "//", ".java": "//", ".js": "//", ".ts": "//", ".proto": "//", ".rb": "#", ".py": "#", ".pyi": "#",
+}
+
+// BannerComment returns banner as a comment in the syntax of the file name, or nil if the syntax of name is unknown.
+// Files commented with // are separated from the banner by a blank line, so that it is not taken as the doc comment
+// of a Go package. Files commented with # are not, keeping the banner in the same comment block as magic comments
+// such as Ruby's frozen_string_literal.
+func BannerComment(name string, banner string) []byte {
+	prefix, ok := commentPrefixes[filepath.Ext(name)]
+	if banner == "" || !ok {
+		return nil
+	}
+
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(banner, "\n"), "\n") {
+		b.WriteString(strings.TrimRight(prefix+" "+line, " ") + "\n")
+	}
+	if prefix == "//" {
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// copyGeneratedFile copies the generated file at src to dst after banner, comparing against any existing dst to report
+// whether the output was created, updated or left unchanged. With changedOnly, an identical dst is not rewritten.
+func copyGeneratedFile(src string, dst string, banner []byte, changedOnly bool) (CopiedFile, error) {
+	c := CopiedFile{Name: filepath.Base(src)}
+	previous, previousErr := FileSHA256(dst)
+
+	if changedOnly && previousErr == nil {
+		sha, size, err := generatedFileSHA256(src, banner)
+		if err != nil {
+			return c, fmt.Errorf("failed to copy generated file to output: %s", err.Error())
+		}
+		if sha == previous {
+			c.Size, c.SHA256, c.Status = size, sha, FileUnchanged
+			return c, nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return c, fmt.Errorf("failed to create directory in output: %s", err.Error())
+	}
+
+	h := sha256.New()
+	size, err := copyFile(src, dst, banner, h)
+	if err != nil {
+		return c, fmt.Errorf("failed to copy generated file to output: %s", err.Error())
+	}
+	c.Size = size
+	c.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	switch {
+	case previousErr != nil:
+		c.Status = FileCreated
+	case previous == c.SHA256:
+		c.Status = FileUnchanged
+	default:
+		c.Status = FileUpdated
+	}
+	return c, nil
 }
@@ -0,0 +1,1052 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes data to the slash separated name under dir, creating its directories
+func writeFile(t *testing.T, dir string, name string, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// chdir changes the working directory to dir for the rest of the test. Outputs are resolved from the working directory
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// fakeCommand installs an executable shell script named name, running script, first on the PATH for the rest of the
+// test
+func fakeCommand(t *testing.T, name string, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// setenv sets the environment variable key to value for the rest of the test
+func setenv(t *testing.T, key string, value string) {
+	t.Helper()
+	previous, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestCopyProtobufMaxFileSize(t *testing.T) {
+	proto := strings.Repeat("x", 100)
+	tests := []struct {
+		name    string
+		maxSize int64
+		wantErr bool
+	}{
+		{"under the limit", 200, false},
+		{"at the limit", 100, false},
+		{"over the limit", 99, true},
+		{"no limit", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFile(t, root, "public/search.proto", proto)
+			protoDir := t.TempDir()
+
+			err := CopyProtobuf("search", root, protoDir, false, tt.maxSize, "")
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "exceeds the maximum allowed size") {
+					t.Fatalf("expected the oversized protobuf to be rejected, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, err := os.Stat(filepath.Join(protoDir, "search.proto")); err != nil {
+				t.Fatalf("protobuf was not copied: %s", err)
+			}
+		})
+	}
+}
+
+func TestCopyProtobufTopLevelFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  map[string]string
+	}{
+		{"single protobuf", []string{"api.proto"}, map[string]string{"search.proto": "api.proto"}},
+		{"named after the service", []string{"common.proto", "search.proto"}, map[string]string{"search.proto": "search.proto", "common.proto": "common.proto"}},
+		{"first protobuf", []string{"api.proto", "types.proto"}, map[string]string{"search.proto": "api.proto", "types.proto": "types.proto"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, f := range tt.files {
+				writeFile(t, root, "public/"+f, f)
+			}
+			protoDir := t.TempDir()
+
+			if err := CopyProtobuf("search", root, protoDir, false, 0, ""); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			entries, err := os.ReadDir(protoDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Errorf("copied %d protobufs, want %d", len(entries), len(tt.want))
+			}
+			for name, from := range tt.want {
+				data, err := os.ReadFile(filepath.Join(protoDir, name))
+				if err != nil {
+					t.Fatalf("%s was not copied: %s", name, err)
+				}
+				if string(data) != from {
+					t.Errorf("%s holds %s, want %s", name, data, from)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteProtobufMaxFileSize(t *testing.T) {
+	err := WriteProtobuf(strings.NewReader(strings.Repeat("x", 100)), "search", t.TempDir(), 50, "")
+	if err == nil || !strings.Contains(err.Error(), "exceeds the maximum allowed size") {
+		t.Fatalf("expected the oversized protobuf to be rejected, got %v", err)
+	}
+}
+
+func TestCopyGeneratedFilesMaxFileSize(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "search.pb.go", strings.Repeat("x", 100))
+
+	chdir(t, t.TempDir())
+	if err := os.Mkdir("out", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CopyGeneratedFiles(protoDir, "out", CopyOptions{MaxFileSize: 99}); err == nil {
+		t.Fatal("expected the oversized generated file to be rejected")
+	}
+	if _, err := os.Stat(filepath.Join("out", "search.pb.go")); err == nil {
+		t.Fatal("oversized generated file was copied")
+	}
+}
+
+func TestParseRepository(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantOrg  string
+		wantRepo string
+	}{
+		{"protos", DefaultOrg, "protos"},
+		{"acme/protos", "acme", "protos"},
+		{"group/subgroup/protos", "group/subgroup", "protos"},
+	}
+
+	for _, tt := range tests {
+		org, repo := ParseRepository(tt.input)
+		if org != tt.wantOrg || repo != tt.wantRepo {
+			t.Errorf("ParseRepository(%q) = %q, %q, want %q, %q", tt.input, org, repo, tt.wantOrg, tt.wantRepo)
+		}
+	}
+}
+
+func TestGenerateOpenAPI(t *testing.T) {
+	fakeCommand(t, "protoc", `for a in "$@"; do case "$a" in --openapiv2_out=*) echo '{"swagger": "2.0"}' > "${a#*=}/search.swagger.json";; esac; done
+`)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+
+	if err := GenerateOpenAPI(context.Background(), "search", dir, GenerateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "search.swagger.json"))
+	if err != nil {
+		t.Fatalf("the OpenAPI specification was not generated: %s", err)
+	}
+	if string(data) != "{\"swagger\": \"2.0\"}\n" {
+		t.Errorf("unexpected specification %q", data)
+	}
+}
+
+func TestCloneServiceRepoName(t *testing.T) {
+	opts := remoteRepository(t, "search-service")
+	opts.CacheDir = ""
+	opts.RepoNames = map[string]string{"search": "search-service"}
+
+	src, err := CloneService(context.Background(), "search", t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("cloning the renamed repository failed: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "proto", "public", "search.proto")); err != nil {
+		t.Errorf("the repository was not cloned: %s", err)
+	}
+
+	opts.RepoNames = nil
+	if _, err := CloneService(context.Background(), "search", t.TempDir(), opts); err == nil {
+		t.Error("cloning the service without its repository name succeeded")
+	}
+}
+
+func TestAllServices(t *testing.T) {
+	public := AllServices(false)
+	private := AllServices(true)
+	for _, s := range public {
+		if !IsValidPublicService(s) {
+			t.Errorf("%s was selected without a public protobuf", s)
+		}
+	}
+	for _, s := range private {
+		if !IsValidPrivateService(s) {
+			t.Errorf("%s was selected without a private protobuf", s)
+		}
+	}
+	if !strings.Contains(strings.Join(public, ","), ServiceSearch) || strings.Contains(strings.Join(private, ","), ServiceSearch) {
+		t.Errorf("unexpected services %q and %q", public, private)
+	}
+}
+
+func TestGeneratedFiles(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "search.pb.go", "package search\n")
+	writeFile(t, protoDir, "search.twirp.go", "package search\n")
+
+	files, err := GeneratedFiles(protoDir, CopyOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Join(files, ",") != "search.pb.go,search.twirp.go" {
+		t.Errorf("got %q, want only the generated files", files)
+	}
+}
+
+func TestProxyEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		httpProxy  string
+		httpsProxy string
+		want       []string
+	}{
+		{"none", "", "", nil},
+		{"http", "http://proxy:3128", "", []string{"HTTP_PROXY=http://proxy:3128", "http_proxy=http://proxy:3128"}},
+		{"both", "http://proxy:3128", "http://secure:3128", []string{"HTTP_PROXY=http://proxy:3128", "http_proxy=http://proxy:3128", "HTTPS_PROXY=http://secure:3128", "https_proxy=http://secure:3128"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProxyEnv(tt.httpProxy, tt.httpsProxy); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("ProxyEnv = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloneRepositoryProxy(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "git.log")
+	fakeCommand(t, "git", `echo "$HTTP_PROXY $HTTPS_PROXY" > `+log+`
+exit 1
+`)
+
+	opts := CloneOptions{HTTPProxy: "http://proxy:3128", HTTPSProxy: "http://secure:3128"}
+	if _, err := CloneRepository(context.Background(), "org", "search", t.TempDir(), opts); err == nil {
+		t.Fatal("the failing clone succeeded")
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("git was not run: %s", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "http://proxy:3128 http://secure:3128" {
+		t.Errorf("git ran with the proxies %q", got)
+	}
+}
+
+// fakePlugins is a protoc script writing a search_<plugin>.txt file for each plugin it is run with
+const fakePlugins = `for a in "$@"; do
+  case "$a" in
+    --*_out=*)
+      name=${a%%_out=*}; name=${name#--}
+      dir=${a#*_out=}; dir=${dir##*:}
+      echo "// generated by $name" > "$dir/search_$name.txt";;
+  esac
+done
+`
+
+func TestGenerateCodeMessagesOnly(t *testing.T) {
+	fakeCommand(t, "protoc", fakePlugins)
+	tests := []struct {
+		opts GenerateOptions
+		want string
+	}{
+		{GenerateOptions{}, "search_go.txt,search_twirp.txt"},
+		{GenerateOptions{MessagesOnly: true}, "search_go.txt"},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+		if err := GenerateCode(context.Background(), LanguageGo, "search", dir, tt.opts); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		files, err := GeneratedFiles(dir, CopyOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(files, ","); got != tt.want {
+			t.Errorf("%+v generated %s, want %s", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateCodeCancelled(t *testing.T) {
+	fakeCommand(t, "protoc", "exec sleep 10\n")
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := GenerateCode(ctx, LanguageGo, "search", dir, GenerateOptions{}); err == nil {
+		t.Fatal("the cancelled generation succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("protoc was not killed on cancellation, generation took %s", elapsed)
+	}
+}
+
+func TestValidateRPCFramework(t *testing.T) {
+	tests := []struct {
+		language  string
+		framework string
+		wantErr   string
+	}{
+		{LanguageGo, RPCFrameworkTwirp, ""},
+		{LanguageGo, RPCFrameworkGRPC, ""},
+		{LanguageJava, RPCFrameworkNone, ""},
+		{LanguageJava, RPCFrameworkTwirp, "Supported frameworks for 'java' are: grpc, none"},
+		{LanguageGo, "thrift", "unknown RPC framework 'thrift'"},
+	}
+
+	for _, tt := range tests {
+		err := ValidateRPCFramework(tt.language, tt.framework)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("ValidateRPCFramework(%s, %s) = %v", tt.language, tt.framework, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ValidateRPCFramework(%s, %s) = %v, want an error containing %q", tt.language, tt.framework, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGenerateCodeRPCFramework(t *testing.T) {
+	fakeCommand(t, "protoc", fakePlugins)
+	dir := t.TempDir()
+	writeFile(t, dir, "search.proto", "syntax = \"proto3\";\n")
+
+	if err := GenerateCode(context.Background(), LanguageGo, "search", dir, GenerateOptions{RPCFramework: RPCFrameworkGRPC}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	files, err := GeneratedFiles(dir, CopyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(files, ","); got != "search_go-grpc.txt,search_go.txt" {
+		t.Errorf("generated %s, want the gRPC client instead of twirp", got)
+	}
+}
+
+func TestPluginArg(t *testing.T) {
+	tests := []struct {
+		plugin plugin
+		extra  []string
+		want   string
+	}{
+		{plugin{"ruby", ""}, nil, "--ruby_out=out"},
+		{plugin{"ruby", ""}, []string{"a=b"}, "--ruby_out=a=b:out"},
+		{plugin{"go", "paths=source_relative"}, nil, "--go_out=paths=source_relative:out"},
+		{plugin{"go", "paths=source_relative"}, []string{"module=example.com/x", "a=b"}, "--go_out=paths=source_relative,module=example.com/x,a=b:out"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.plugin.arg("out", tt.extra); got != tt.want {
+			t.Errorf("arg(%q) = %q, want %q", tt.extra, got, tt.want)
+		}
+	}
+}
+
+func TestCopyGeneratedFilesTrimPrefix(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "github.com/org/repo/search/v1/search.pb.go", "package searchv1\n")
+	writeFile(t, protoDir, "other/search.pb.go", "package other\n")
+
+	chdir(t, t.TempDir())
+	copied, err := CopyGeneratedFiles(protoDir, "out", CopyOptions{TrimPrefix: "/github.com/org/repo/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var names []string
+	for _, f := range copied {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "other/search.pb.go,search/v1/search.pb.go" {
+		t.Errorf("copied %s", got)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join("out", filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s was not copied: %s", name, err)
+		}
+	}
+}
+
+func TestGeneratedFilesTrimPrefixCollision(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "prefix/search.pb.go", "package a\n")
+	writeFile(t, protoDir, "search.pb.go", "package b\n")
+
+	_, err := GeneratedFiles(protoDir, CopyOptions{TrimPrefix: "prefix"})
+	if err == nil || !strings.Contains(err.Error(), "both map to 'search.pb.go'") {
+		t.Fatalf("expected the colliding paths to be rejected, got %v", err)
+	}
+}
+
+func TestDropGeneratedFiles(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "prefix/v1/search.pb.go", "package v1\n")
+	writeFile(t, protoDir, "prefix/v1/common.pb.go", "package v1\n")
+
+	opts := CopyOptions{TrimPrefix: "prefix"}
+	if err := DropGeneratedFiles(protoDir, []string{"v1/common.pb.go"}, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	files, err := GeneratedFiles(protoDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{"v1/search.pb.go"}) {
+		t.Errorf("files left %q, want only v1/search.pb.go", files)
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	output := t.TempDir()
+	writeFile(t, output, "v1/common.pb.go", "package v1\n")
+
+	f, err := OutputFile(output, "v1/common.pb.go")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := CopiedFile{Name: "v1/common.pb.go", Size: 11, SHA256: sha256Hex([]byte("package v1\n")), Status: FileUnchanged}
+	if f != want {
+		t.Errorf("OutputFile = %+v, want %+v", f, want)
+	}
+	if _, err := OutputFile(output, "missing.pb.go"); err == nil {
+		t.Error("a missing file of the output was described")
+	}
+}
+
+func TestHasProtobufs(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "public/search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, root, "private/README.md", "none yet\n")
+
+	if !HasProtobufs(root, false) {
+		t.Error("the public protobuf was not found")
+	}
+	if HasProtobufs(root, true) {
+		t.Error("a private protobuf was found in a directory without one")
+	}
+	if HasProtobufs(t.TempDir(), false) {
+		t.Error("a protobuf was found in an empty repository")
+	}
+}
+
+func TestCommandToolchainDir(t *testing.T) {
+	toolchain := t.TempDir()
+	protoc := writeFile(t, toolchain, "protoc", "#!/bin/sh\n")
+	if err := os.Chmod(protoc, 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts := GenerateOptions{ToolchainDir: toolchain}
+
+	cmd := opts.command(context.Background(), "protoc", "--version")
+	if cmd.Path != protoc {
+		t.Errorf("protoc was resolved to %s, want the pinned %s", cmd.Path, protoc)
+	}
+	if !strings.Contains(strings.Join(cmd.Env, "\n"), "PATH="+toolchain+string(os.PathListSeparator)) {
+		t.Error("the toolchain directory is not first on the PATH of protoc, so its plugins would not be found")
+	}
+
+	// Binaries missing from the toolchain are looked up on the PATH
+	if cmd := opts.command(context.Background(), "git"); cmd.Path == filepath.Join(toolchain, "git") {
+		t.Errorf("git was resolved to the toolchain directory")
+	}
+}
+
+func TestServiceRemote(t *testing.T) {
+	opts := CloneOptions{
+		Org:          "acme",
+		ServiceHosts: map[string]string{"search": "github.example.com"},
+		ServiceOrgs:  map[string]string{"search": "search-team", "query": ""},
+	}
+	tests := []struct {
+		service  string
+		wantHost string
+		wantOrg  string
+	}{
+		{"search", "github.example.com", "search-team"},
+		{"query", DefaultHost, "acme"},
+		{"audit", DefaultHost, "acme"},
+	}
+	for _, tt := range tests {
+		host, org := opts.ServiceRemote(tt.service)
+		if host != tt.wantHost || org != tt.wantOrg {
+			t.Errorf("ServiceRemote(%s) = %s, %s, want %s, %s", tt.service, host, org, tt.wantHost, tt.wantOrg)
+		}
+	}
+
+	if _, org := (CloneOptions{}).ServiceRemote("search"); org != DefaultOrg {
+		t.Errorf("the default organization is %s, want %s", org, DefaultOrg)
+	}
+}
+
+func TestCloneServiceRemoteURL(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "git.log")
+	fakeCommand(t, "git", `echo "$@" > `+log+`
+exit 1
+`)
+	opts := CloneOptions{ServiceHosts: map[string]string{"search": "github.example.com"}, ServiceOrgs: map[string]string{"search": "search-team"}}
+	CloneService(context.Background(), "search", t.TempDir(), opts)
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("git was not run: %s", err)
+	}
+	if !strings.Contains(string(data), "git@github.example.com:search-team/search.git") {
+		t.Errorf("git cloned %q", data)
+	}
+}
+
+func TestCleanUpDirectories(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "client-generation-1")
+	writeFile(t, dir, "proto/search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, dir, "search-2/proto/public/search.proto", "syntax = \"proto3\";\n")
+
+	if err := CleanUpDirectories(dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("the directory was not removed: %v", err)
+	}
+	if err := CleanUpDirectories(dir); err != nil {
+		t.Errorf("removing a missing directory failed: %s", err)
+	}
+}
+
+func TestCopyProtobufClosesFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "public/search.proto", "syntax = \"proto3\";\n")
+	protoDir := t.TempDir()
+	if err := CopyProtobuf("search", root, protoDir, false, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Open handles are listed in /proc on Linux, and would keep the directory from being removed on Windows
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open files cannot be listed on this platform")
+	}
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+		if err == nil && (strings.HasPrefix(target, root) || strings.HasPrefix(target, protoDir)) {
+			t.Errorf("%s is still open", target)
+		}
+	}
+}
+
+func TestCopyProtobufFileVerifiesCopy(t *testing.T) {
+	src := writeFile(t, t.TempDir(), "search.proto", "syntax = \"proto3\";\n")
+	dst := filepath.Join(t.TempDir(), "search.proto")
+	if err := copyProtobufFile(src, dst); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Writes to the null device succeed, but nothing is read back, as with a copy cut short
+	if _, err := os.Stat(os.DevNull); err != nil || runtime.GOOS == "windows" {
+		t.Skip("the null device cannot be written to as a file on this platform")
+	}
+	if err := copyProtobufFile(src, os.DevNull); err == nil || !strings.Contains(err.Error(), "is corrupt") {
+		t.Errorf("expected the truncated copy to be detected, got %v", err)
+	}
+}
+
+func TestValidateEnv(t *testing.T) {
+	if err := ValidateEnv([]string{"GOFLAGS=-mod=mod", "EMPTY="}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for _, env := range []string{"NOVALUE", "=value"} {
+		if err := ValidateEnv([]string{env}); err == nil || !strings.Contains(err.Error(), "expected KEY=VALUE") {
+			t.Errorf("ValidateEnv(%q) = %v, want an error", env, err)
+		}
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	cmd := GenerateOptions{Env: []string{"PLUGIN_MODE=strict"}}.command(context.Background(), "protoc")
+	if len(cmd.Env) == 0 || cmd.Env[len(cmd.Env)-1] != "PLUGIN_MODE=strict" {
+		t.Errorf("the environment was not passed to protoc: %q", cmd.Env)
+	}
+	if cmd := (GenerateOptions{}).command(context.Background(), "protoc"); cmd.Env != nil {
+		t.Errorf("protoc did not inherit the environment: %q", cmd.Env)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	data := strings.Repeat("generated\n", copyBufferSize/5)
+	src := writeFile(t, dir, "src/protoc-gen-search", data)
+	if err := os.Chmod(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dst := writeFile(t, dir, "out/protoc-gen-search", "old")
+
+	h := sha256.New()
+	n, err := copyFile(src, dst, nil, h)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("copied %d bytes, want %d", n, len(data))
+	}
+	if got, _ := os.ReadFile(dst); string(got) != data {
+		t.Error("the copy differs from the source")
+	}
+	if sum := sha256.Sum256([]byte(data)); hex.EncodeToString(h.Sum(nil)) != hex.EncodeToString(sum[:]) {
+		t.Error("the hash of the copy is wrong")
+	}
+	if info, _ := os.Stat(dst); info.Mode().Perm() != 0755 {
+		t.Errorf("the copy has mode %s, want the mode of the source", info.Mode().Perm())
+	}
+
+	// A failed copy leaves neither a partial file nor its temporary file behind
+	if _, err := copyFile(filepath.Join(dir, "missing"), dst, nil, nil); err == nil {
+		t.Fatal("copying a missing file succeeded")
+	}
+	if got, _ := os.ReadFile(dst); string(got) != data {
+		t.Error("the failed copy replaced the previous file")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dst)); len(entries) != 1 {
+		t.Errorf("the output holds %d files, want only the copy", len(entries))
+	}
+}
+
+func TestCloneArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CloneOptions
+		want string
+	}{
+		{"default", CloneOptions{}, "clone git@github.com:org/search.git dst"},
+		{"depth", CloneOptions{Depth: 1}, "clone --depth=1 git@github.com:org/search.git dst"},
+		{"submodules", CloneOptions{RecurseSubmodules: true}, "clone --recurse-submodules git@github.com:org/search.git dst"},
+		{"shallow submodules", CloneOptions{Depth: 5, RecurseSubmodules: true}, "clone --depth=5 --recurse-submodules --shallow-submodules git@github.com:org/search.git dst"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.opts.cloneArgs("org", "search", "dst"), " "); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// git runs git with args in dir, failing the test on error and returning its trimmed output
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// githubRemotes rewrites the Github URLs of the org and DefaultOrg organizations to a directory of local remotes for the
+// rest of the test, returning the directory. The remotes, and their submodules, are cloned over the file protocol
+func githubRemotes(t *testing.T) string {
+	t.Helper()
+	remotes := t.TempDir()
+	setenv(t, "GIT_CONFIG_COUNT", "3")
+	setenv(t, "GIT_CONFIG_KEY_0", "protocol.file.allow")
+	setenv(t, "GIT_CONFIG_VALUE_0", "always")
+	for i, org := range []string{"org", DefaultOrg} {
+		setenv(t, fmt.Sprintf("GIT_CONFIG_KEY_%d", i+1), "url.file://"+filepath.ToSlash(remotes)+"/.insteadOf")
+		setenv(t, fmt.Sprintf("GIT_CONFIG_VALUE_%d", i+1), "git@github.com:"+org+"/")
+	}
+	return remotes
+}
+
+// remoteRepository creates the repository org/repo among the Github remotes, with a commit on its main branch, a commit
+// on its feature branch and a v1 tag of the main commit. It returns the clone options cloning it into a cache
+func remoteRepository(t *testing.T, repo string) CloneOptions {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remotes := githubRemotes(t)
+	dir := filepath.Join(remotes, repo+".git")
+	git(t, remotes, "init", "--quiet", "--initial-branch=main", dir)
+	writeFile(t, dir, "proto/public/search.proto", "syntax = \"proto3\";\n")
+	git(t, dir, "add", "-A")
+	git(t, dir, "commit", "--quiet", "-m", "main")
+	git(t, dir, "tag", "v1")
+	git(t, dir, "checkout", "--quiet", "-b", "feature")
+	writeFile(t, dir, "proto/public/search.proto", "syntax = \"proto3\";\n\npackage search.v2;\n")
+	git(t, dir, "commit", "--quiet", "-am", "feature")
+	git(t, dir, "checkout", "--quiet", "main")
+	return CloneOptions{CacheDir: t.TempDir(), Depth: 1}
+}
+
+func TestCloneRepositorySubmodules(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remotes := githubRemotes(t)
+
+	protos := filepath.Join(remotes, "protos")
+	git(t, remotes, "init", "--quiet", "--initial-branch=main", protos)
+	writeFile(t, protos, "search.proto", "syntax = \"proto3\";\n")
+	git(t, protos, "add", "-A")
+	git(t, protos, "commit", "--quiet", "-m", "protos")
+
+	search := filepath.Join(remotes, "search.git")
+	git(t, remotes, "init", "--quiet", "--initial-branch=main", search)
+	git(t, search, "submodule", "--quiet", "add", "../protos", "proto/shared")
+	git(t, search, "commit", "--quiet", "-m", "submodule")
+	writeFile(t, search, "README.md", "search\n")
+	git(t, search, "add", "-A")
+	git(t, search, "commit", "--quiet", "-m", "readme")
+
+	opts := CloneOptions{Depth: 1, RecurseSubmodules: true}
+	src, err := CloneRepository(context.Background(), "org", "search", t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "proto", "shared", "search.proto")); err != nil {
+		t.Errorf("the submodule was not cloned: %s", err)
+	}
+	if n := git(t, src, "rev-list", "--count", "HEAD"); n != "1" {
+		t.Errorf("the clone has %s commits, want a depth of 1", n)
+	}
+}
+
+func TestIsCommitSHA(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"3f2a9c1", true},
+		{"3f2a9c1d4e5b6a7980f1e2d3c4b5a69788796a5b", true},
+		{"3f2a9c", false},
+		{"3f2a9c1d4e5b6a7980f1e2d3c4b5a69788796a5b1", false},
+		{"3F2A9C1", false},
+		{"main", false},
+		{"v1.2.3", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsCommitSHA(tt.ref); got != tt.want {
+			t.Errorf("IsCommitSHA(%q) = %t, want %t", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestCloneArgsRef(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CloneOptions
+		want string
+	}{
+		{"branch", CloneOptions{Ref: "feature", Depth: 1}, "clone --branch feature --depth=1 git@github.com:org/search.git dst"},
+		{"commit", CloneOptions{Ref: "3f2a9c1", Depth: 1, RecurseSubmodules: true}, "clone --recurse-submodules git@github.com:org/search.git dst"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.opts.cloneArgs("org", "search", "dst"), " "); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloneRepositoryPinnedCommit(t *testing.T) {
+	opts := remoteRepository(t, "search")
+	ctx := context.Background()
+
+	// The commit of the v1 tag is behind the feature branch, and beyond the depth of a shallow clone of it
+	opts.Ref = "feature"
+	src, err := cachedRepository(ctx, "org", "search", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := git(t, src, "rev-parse", "HEAD")
+	tagged := strings.Fields(git(t, src, "ls-remote", "origin", "v1"))[0]
+
+	for _, cacheDir := range []string{"", opts.CacheDir} {
+		for _, ref := range []string{tagged, tagged[:7], pinned} {
+			o := opts
+			o.CacheDir, o.Ref = cacheDir, ref
+			src, err := CloneRepository(ctx, "org", "search", t.TempDir(), o)
+			if err != nil {
+				t.Fatalf("cache %q, ref %s: %s", cacheDir, ref, err)
+			}
+			if got := git(t, src, "rev-parse", "HEAD"); !strings.HasPrefix(got, ref) {
+				t.Errorf("cache %q: checked out %s, want %s", cacheDir, got, ref)
+			}
+		}
+	}
+}
+
+func TestBannerComment(t *testing.T) {
+	banner := "DO NOT EDIT\ngenerated from abc123\n"
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"search.pb.go", "// DO NOT EDIT\n// generated from abc123\n\n"},
+		{"search_pb.rb", "# DO NOT EDIT\n# generated from abc123\n"},
+		{"search.json", ""},
+	}
+	for _, tt := range tests {
+		if got := string(BannerComment(tt.name, banner)); got != tt.want {
+			t.Errorf("BannerComment(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := BannerComment("search.pb.go", ""); got != nil {
+		t.Errorf("an empty banner is commented as %q", got)
+	}
+}
+
+func TestCopyGeneratedFilesBanner(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "search.pb.go", "package searchv1\n")
+	writeFile(t, protoDir, "search_pb.rb", "# frozen_string_literal: true\n")
+
+	chdir(t, t.TempDir())
+	if _, err := CopyGeneratedFiles(protoDir, "out", CopyOptions{Banner: "DO NOT EDIT"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for name, want := range map[string]string{
+		"search.pb.go": "// DO NOT EDIT\n\npackage searchv1\n",
+		"search_pb.rb": "# DO NOT EDIT\n# frozen_string_literal: true\n",
+	} {
+		data, err := os.ReadFile(filepath.Join("out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
+
+func TestCloneArgsFilter(t *testing.T) {
+	opts := CloneOptions{Depth: 1, Filter: "blob:none"}
+	if got := strings.Join(opts.cloneArgs("org", "search", "dst"), " "); got != "clone --depth=1 --filter=blob:none git@github.com:org/search.git dst" {
+		t.Errorf("got %q", got)
+	}
+	if got := strings.Join((CloneOptions{}).cloneArgs("org", "search", "dst"), " "); strings.Contains(got, "--filter") {
+		t.Errorf("a filter was given without being configured: %q", got)
+	}
+}
+
+func TestCopyGeneratedFilesChangedOnly(t *testing.T) {
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "created.pb.go", "package searchv1\n")
+	writeFile(t, protoDir, "updated.pb.go", "package searchv1\n\nconst V = 2\n")
+	writeFile(t, protoDir, "unchanged.pb.go", "package searchv1\n\nconst W = 1\n")
+
+	chdir(t, t.TempDir())
+	writeFile(t, "out", "updated.pb.go", "package searchv1\n\nconst V = 1\n")
+	unchanged := writeFile(t, "out", "unchanged.pb.go", "package searchv1\n\nconst W = 1\n")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(unchanged, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := CopyOptions{ChangedOnly: true}
+	listed, err := ListGeneratedFiles(protoDir, "out", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var statuses []string
+	for _, f := range listed {
+		statuses = append(statuses, f.Name+" "+string(f.Status))
+	}
+	if got := strings.Join(statuses, ", "); got != "created.pb.go created, updated.pb.go updated" {
+		t.Errorf("listed %s", got)
+	}
+
+	copied, err := CopyGeneratedFiles(protoDir, "out", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	statuses = nil
+	for _, f := range copied {
+		statuses = append(statuses, f.Name+" "+string(f.Status))
+	}
+	if got := strings.Join(statuses, ", "); got != "created.pb.go created, unchanged.pb.go unchanged, updated.pb.go updated" {
+		t.Errorf("copied %s", got)
+	}
+
+	if data, err := os.ReadFile(filepath.Join("out", "updated.pb.go")); err != nil || !strings.Contains(string(data), "V = 2") {
+		t.Errorf("the updated file was not written: %q, %v", data, err)
+	}
+	info, err := os.Stat(unchanged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("the unchanged file was rewritten at %s", info.ModTime())
+	}
+}
+
+func TestValidateGRPCGateway(t *testing.T) {
+	tests := []struct {
+		language     string
+		framework    string
+		messagesOnly bool
+		wantErr      bool
+	}{
+		{LanguageGo, RPCFrameworkGRPC, false, false},
+		{LanguageGo, RPCFrameworkTwirp, false, true},
+		{LanguageGo, RPCFrameworkGRPC, true, true},
+		{LanguageRuby, RPCFrameworkGRPC, false, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateGRPCGateway(tt.language, tt.framework, tt.messagesOnly); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateGRPCGateway(%s, %s, %t) = %v", tt.language, tt.framework, tt.messagesOnly, err)
+		}
+	}
+}
+
+func TestCloneServiceUniqueDirectory(t *testing.T) {
+	opts := remoteRepository(t, "protos")
+	opts.CacheDir = ""
+	opts.RepoNames = map[string]string{"search": "protos", "query": "protos"}
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "protos"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	search, err := CloneService(context.Background(), "search", dir, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	query, err := CloneService(context.Background(), "query", dir, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if search == query || filepath.Dir(search) != dir || filepath.Dir(query) != dir {
+		t.Fatalf("the services were cloned to %s and %s", search, query)
+	}
+	for _, src := range []string{search, query} {
+		if !strings.HasPrefix(filepath.Base(src), "protos-") {
+			t.Errorf("the clone %s is not named after the repository", src)
+		}
+		if _, err := os.Stat(filepath.Join(src, "proto", "public", "search.proto")); err != nil {
+			t.Errorf("the repository was not cloned to %s: %s", src, err)
+		}
+	}
+}
+
+func TestTempDirOf(t *testing.T) {
+	root := t.TempDir()
+	tmp := filepath.Join(root, TempDirPrefix+"123")
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"inside a temporary directory", filepath.Join(tmp, "out"), tmp},
+		{"a temporary directory", tmp, tmp},
+		{"nested in a temporary directory", filepath.Join(tmp, "search-456", "out"), tmp},
+		{"the root", root, ""},
+		{"a parent of the root", filepath.Dir(root), ""},
+		{"another directory in the root", filepath.Join(root, "out"), ""},
+		{"outside of the root", t.TempDir(), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TempDirOf(tt.path, root)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			want := tt.want
+			if want != "" {
+				want = filepath.Join(resolved(t, root), filepath.Base(want))
+			}
+			if got != want {
+				t.Errorf("TempDirOf(%s) = %q, want %q", tt.path, got, want)
+			}
+		})
+	}
+}
+
+// resolved returns dir with its symbolic links resolved, e.g. /private/var for /var on macOS
+func resolved(t *testing.T, dir string) string {
+	t.Helper()
+	path, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,125 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compiler checks that the generated files, given as slash separated paths relative to dir, compile
+type compiler func(ctx context.Context, dir string, files []string, opts GenerateOptions) error
+
+// compilers verify the generated code of each language that can be checked
+var compilers = map[string]compiler{
+	LanguageGo:         compileGo,
+	LanguagePython:     compilePython,
+	LanguageRuby:       compileRuby,
+	LanguageJavascript: compileJavascript,
+}
+
+// IsVerifiableLanguage returns true if VerifyCompile can check the generated code of language
+func IsVerifiableLanguage(language string) bool {
+	_, ok := compilers[language]
+	return ok
+}
+
+// VerifyCompile checks that the code generated for language in protoDir compiles, by copying the files that would be
+// copied to the output into a temporary directory and compiling them there. Go code is built as a module with its
+// dependencies resolved by go mod tidy. Python, Ruby and JavaScript code is only checked for syntax errors.
+func VerifyCompile(ctx context.Context, language string, protoDir string, copyOpts CopyOptions, opts GenerateOptions) error {
+	compile, ok := compilers[language]
+	if !ok {
+		return fmt.Errorf("Compiling generated '%s' code cannot be verified", language)
+	}
+
+	files, err := generatedFiles(protoDir, copyOpts)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp(os.TempDir(), "verify-compile-")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary directory: %s", err.Error())
+	}
+	defer CleanUpDirectories(dir)
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if err := CopyFile(f.path, filepath.Join(dir, filepath.FromSlash(f.name))); err != nil {
+			return err
+		}
+		names = append(names, f.name)
+	}
+
+	if err := compile(ctx, dir, names, opts); err != nil {
+		return fmt.Errorf("generated code does not compile: %s", err.Error())
+	}
+	return nil
+}
+
+// runCompiler runs name in dir, returning its output as the error if it fails
+func runCompiler(ctx context.Context, dir string, opts GenerateOptions, name string, args ...string) error {
+	cmd := opts.command(ctx, name, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if detail := strings.TrimSpace(string(out)); detail != "" {
+			return fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), detail)
+		}
+		return fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), err.Error())
+	}
+	return nil
+}
+
+// withExt returns the files with the extension ext
+func withExt(files []string, ext string) []string {
+	var matched []string
+	for _, f := range files {
+		if filepath.Ext(f) == ext {
+			matched = append(matched, f)
+		}
+	}
+	return matched
+}
+
+func compileGo(ctx context.Context, dir string, files []string, opts GenerateOptions) error {
+	if len(withExt(files, ".go")) == 0 {
+		return nil
+	}
+	if err := runCompiler(ctx, dir, opts, "go", "mod", "init", "verify"); err != nil {
+		return err
+	}
+	if err := runCompiler(ctx, dir, opts, "go", "mod", "tidy"); err != nil {
+		return err
+	}
+	return runCompiler(ctx, dir, opts, "go", "build", "./...")
+}
+
+func compilePython(ctx context.Context, dir string, files []string, opts GenerateOptions) error {
+	sources := withExt(files, ".py")
+	if len(sources) == 0 {
+		return nil
+	}
+	return runCompiler(ctx, dir, opts, "python3", append([]string{"-m", "py_compile"}, sources...)...)
+}
+
+func compileRuby(ctx context.Context, dir string, files []string, opts GenerateOptions) error {
+	// ruby -c only checks the first file it is given
+	for _, f := range withExt(files, ".rb") {
+		if err := runCompiler(ctx, dir, opts, "ruby", "-c", f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileJavascript(ctx context.Context, dir string, files []string, opts GenerateOptions) error {
+	for _, f := range withExt(files, ".js") {
+		if err := runCompiler(ctx, dir, opts, "node", "--check", f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestVerifyCompileGo(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	setenv(t, "GOPROXY", "off")
+	setenv(t, "GOFLAGS", "")
+
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "search/v1/search.pb.go", "package searchv1\n\nimport \"strings\"\n\nfunc Query(q string) string { return strings.TrimSpace(q) }\n")
+	if err := VerifyCompile(context.Background(), LanguageGo, protoDir, CopyOptions{}, GenerateOptions{}); err != nil {
+		t.Fatalf("compiling code was refused: %s", err)
+	}
+
+	writeFile(t, protoDir, "search/v1/search_mock.go", "package searchv1\n\nfunc Mock() { return Query }\n")
+	err := VerifyCompile(context.Background(), LanguageGo, protoDir, CopyOptions{}, GenerateOptions{})
+	if err == nil || !strings.Contains(err.Error(), "generated code does not compile: go build ./...") {
+		t.Errorf("expected code that does not compile to be refused, got %v", err)
+	}
+}
+
+func TestVerifyCompilePython(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n")
+	writeFile(t, protoDir, "search_pb2.py", "QUERY = 1\n")
+	if err := VerifyCompile(context.Background(), LanguagePython, protoDir, CopyOptions{}, GenerateOptions{}); err != nil {
+		t.Fatalf("valid code was refused: %s", err)
+	}
+
+	writeFile(t, protoDir, "search_pb2_grpc.py", "def query(:\n")
+	if err := VerifyCompile(context.Background(), LanguagePython, protoDir, CopyOptions{}, GenerateOptions{}); err == nil {
+		t.Error("a syntax error was not reported")
+	}
+}
+
+func TestVerifyCompileUnsupported(t *testing.T) {
+	if IsVerifiableLanguage(LanguageJava) {
+		t.Fatal("java is reported as verifiable")
+	}
+	if err := VerifyCompile(context.Background(), LanguageJava, t.TempDir(), CopyOptions{}, GenerateOptions{}); err == nil {
+		t.Error("verifying java was not refused")
+	}
+}
@@ -0,0 +1,117 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// wellKnownTypePrefix is the import path prefix of the protobuf well-known types, such as google/protobuf/timestamp.proto
+const wellKnownTypePrefix = "google/protobuf/"
+
+// protoImports returns the paths imported by the protobuf at path
+func protoImports(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read protobuf file: %s", err.Error())
+	}
+
+	var imports []string
+	for _, m := range importPattern.FindAllStringSubmatch(string(data), -1) {
+		imports = append(imports, m[2])
+	}
+	return imports, nil
+}
+
+// includeDirs returns the directories the well-known types are searched for in: the import paths of opts, then the
+// include directory installed alongside protoc, then the system include directories
+func includeDirs(opts GenerateOptions) []string {
+	dirs := append([]string{}, opts.ImportPaths...)
+
+	protoc := "protoc"
+	if opts.ToolchainDir != "" {
+		protoc = filepath.Join(opts.ToolchainDir, "protoc")
+	}
+	if path, err := exec.LookPath(protoc); err == nil {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		dirs = append(dirs, filepath.Join(filepath.Dir(filepath.Dir(path)), "include"))
+	}
+	return append(dirs, "/usr/local/include", "/usr/include")
+}
+
+// findInclude returns the first of dirs holding the protobuf imported as name
+func findInclude(dirs []string, name string) (string, error) {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find the well-known type '%s' in %s. Use --import-path to give the directory holding it", name, strings.Join(dirs, ", "))
+}
+
+// VendorWellKnownTypes copies the well-known types imported by the protobufs in protoDir, and those they import, into
+// protoDir from the include directory of protoc, so that code is generated for them along with the service's protobufs.
+// The import paths of the copied protobufs are returned in sorted order.
+func VendorWellKnownTypes(protoDir string, opts GenerateOptions) ([]string, error) {
+	files, err := ProtoFiles(protoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, f := range files {
+		imports, err := protoImports(f)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, imports...)
+	}
+
+	dirs := includeDirs(opts)
+	vendored := make(map[string]bool)
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if !strings.HasPrefix(name, wellKnownTypePrefix) || vendored[name] {
+			continue
+		}
+
+		dst := filepath.Join(protoDir, filepath.FromSlash(name))
+		if _, err := os.Stat(dst); err == nil {
+			// The service already ships its own copy of the well-known type
+			vendored[name] = true
+			continue
+		}
+
+		src, err := findInclude(dirs, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModeDir|0755); err != nil {
+			return nil, fmt.Errorf("cannot create protobuf directory: %s", err.Error())
+		}
+		if err := copyProtobufFile(src, dst); err != nil {
+			return nil, err
+		}
+		vendored[name] = true
+
+		imports, err := protoImports(dst)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, imports...)
+	}
+
+	names := make([]string, 0, len(vendored))
+	for name := range vendored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
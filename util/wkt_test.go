@@ -0,0 +1,44 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVendorWellKnownTypes(t *testing.T) {
+	include := t.TempDir()
+	writeFile(t, include, "google/protobuf/timestamp.proto", "syntax = \"proto3\";\n\nimport \"google/protobuf/duration.proto\";\n")
+	writeFile(t, include, "google/protobuf/duration.proto", "syntax = \"proto3\";\n")
+	writeFile(t, include, "google/protobuf/empty.proto", "syntax = \"proto3\";\n")
+
+	protoDir := t.TempDir()
+	writeFile(t, protoDir, "search.proto", "syntax = \"proto3\";\n\nimport \"google/protobuf/timestamp.proto\";\nimport \"common/page.proto\";\nimport \"google/protobuf/wrappers.proto\";\n")
+	own := "syntax = \"proto3\";\n\n// vendored by the service\n"
+	writeFile(t, protoDir, "google/protobuf/wrappers.proto", own)
+
+	vendored, err := VendorWellKnownTypes(protoDir, GenerateOptions{ImportPaths: []string{include}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := strings.Join(vendored, ","); got != "google/protobuf/duration.proto,google/protobuf/timestamp.proto,google/protobuf/wrappers.proto" {
+		t.Errorf("vendored %s", got)
+	}
+	for _, name := range []string{"google/protobuf/timestamp.proto", "google/protobuf/duration.proto"} {
+		if _, err := os.Stat(filepath.Join(protoDir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s was not copied: %s", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(protoDir, "google", "protobuf", "empty.proto")); err == nil {
+		t.Error("a well-known type that is not imported was copied")
+	}
+	if data, err := os.ReadFile(filepath.Join(protoDir, "google", "protobuf", "wrappers.proto")); err != nil || string(data) != own {
+		t.Errorf("the service's own copy of a well-known type was replaced: %q, %v", data, err)
+	}
+
+	writeFile(t, protoDir, "query.proto", "syntax = \"proto3\";\n\nimport \"google/protobuf/unknown_type.proto\";\n")
+	if _, err := VendorWellKnownTypes(protoDir, GenerateOptions{ImportPaths: []string{include}}); err == nil || !strings.Contains(err.Error(), "cannot find the well-known type 'google/protobuf/unknown_type.proto'") {
+		t.Errorf("expected a missing well-known type to be reported, got %v", err)
+	}
+}